@@ -2,6 +2,10 @@ package digitaltwin
 
 import (
 	"fmt"
+	"iter"
+	"maps"
+	"reflect"
+	"slices"
 	"strings"
 	"time"
 )
@@ -17,6 +21,14 @@ type Assembly interface {
 	Value(n NodeHash) Value
 	EdgesOf(n NodeHash) []NodeHash
 	VisitEdges(fn func(from, to Value) bool)
+	// Values returns an iterator over the values of all nodes in the assembly, in
+	// no particular order. Unlike Nodes, it neither copies nor exposes the internal
+	// map when the caller only cares about the values.
+	Values() iter.Seq[Value]
+	// EdgePairs returns an iterator over the source and target values of all edges
+	// in the assembly. Unlike VisitEdges, the edges are yielded in a deterministic
+	// order: sorted by the content-address of their source, then of their target.
+	EdgePairs() iter.Seq2[Value, Value]
 }
 
 // AssemblyRef exposes methods to consistently reference component-graphs across
@@ -47,6 +59,78 @@ func ComputeForestHash(components ...AssemblyRef) ForestHash {
 	return HashComponents(precomputed)
 }
 
+// EqualAssemblies reports whether the given assemblies are structurally equal:
+// they have the same roots, the same nodes (by content-address and value), and
+// the same edges, irrespective of order.
+//
+// Unlike comparing AssemblyHash, it neither hashes the entire graphs nor
+// reports equality by a matching digest; it compares the graphs directly and
+// returns as soon as it finds a difference. Node values are compared with
+// reflect.DeepEqual.
+//
+// Note that all empty assemblies are structurally equal, even AssemblyRemoved
+// notifications of different components.
+func EqualAssemblies(a, b Assembly) bool {
+	if !equalNodeSets(a.Roots(), b.Roots()) {
+		return false
+	}
+	an, bn := a.Nodes(), b.Nodes()
+	if len(an) != len(bn) {
+		return false
+	}
+	for h, v := range an {
+		w, ok := bn[h]
+		if !ok || !reflect.DeepEqual(v, w) {
+			return false
+		}
+	}
+	// Both assemblies have the same nodes by now, so comparing the edges of the
+	// nodes of one of them covers the edges of both.
+	for h := range an {
+		if !equalNodeSets(a.EdgesOf(h), b.EdgesOf(h)) {
+			return false
+		}
+	}
+	return true
+}
+
+// The equalNodeSets function reports whether the given slices contain the same
+// node hashes, irrespective of order.
+func equalNodeSets(x, y []NodeHash) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	set := make(map[NodeHash]int, len(x))
+	for _, h := range x {
+		set[h]++
+	}
+	for _, h := range y {
+		if set[h] == 0 {
+			return false
+		}
+		set[h]--
+	}
+	return true
+}
+
+// RootValues returns the values of the roots of the given assembly, sorted by
+// their content-addresses, so the same assembly always yields them in the same
+// order. It saves looking up the value of every root returned by Roots.
+//
+// An empty assembly (e.g. AssemblyRemoved) has no roots, so RootValues returns
+// nil for it.
+func RootValues(a Assembly) []Value {
+	roots := a.Roots()
+	if len(roots) == 0 {
+		return nil
+	}
+	values := make([]Value, 0, len(roots))
+	for _, h := range slices.SortedFunc(slices.Values(roots), NodeHash.Compare) {
+		values = append(values, a.Value(h))
+	}
+	return values
+}
+
 // GraphChanged notifies the internal graph-based world-view maintained by a
 // digital-twin has changed. The message contains the bulk changeset relative to
 // the previously notified baseline. This baseline state of the graph is hashed
@@ -69,6 +153,211 @@ func (c GraphChanged) IsEmpty() bool {
 	return c.GraphAfter == c.GraphBefore
 }
 
+// Follows reports whether the changeset directly follows the given previous
+// changeset, meaning its GraphBefore equals the GraphAfter of prev. Consumers
+// use it to detect gaps in (or reordering of) a stream of notifications.
+//
+// A zero-valued prev stands for "no previous changeset" (e.g. before the first
+// notification was received), which every changeset follows. This is safe
+// because no graph hashes to a zero ForestHash, not even an empty one.
+func (c GraphChanged) Follows(prev GraphChanged) bool {
+	return prev.GraphAfter == (ForestHash{}) || prev.GraphAfter == c.GraphBefore
+}
+
+// Filter returns a copy of the changeset containing only the created, updated,
+// and removed assemblies for which keep returns true. It recomputes nothing, so
+// GraphBefore, GraphAfter, and Timestamp are preserved as-is. Keep in mind that
+// a filtered changeset may contain no assemblies at all while IsEmpty still
+// returns false, as the graph itself did change.
+//
+// Filter never modifies the slices of the original changeset.
+func (c GraphChanged) Filter(keep func(Assembly) bool) GraphChanged {
+	filtered := c
+	filtered.Created = filterAssemblies(c.Created, keep)
+	filtered.Updated = filterAssemblies(c.Updated, keep)
+	filtered.Removed = filterAssemblies(c.Removed, keep)
+	return filtered
+}
+
+// CoalesceChanges merges a contiguous run of changesets into a single changeset
+// relative to the baseline of the first one, as if the graph had changed from
+// the GraphBefore of the first changeset straight to the GraphAfter of the last
+// one. It lets a lagging consumer fast-forward through a backlog of changesets.
+//
+// The changesets must be given in the order they were notified, such that the
+// GraphAfter of each one equals the GraphBefore of the next one; otherwise,
+// CoalesceChanges returns an error. It also returns an error if a component
+// changes in a way that contradicts its previous changes (e.g. an update to a
+// component that has been removed).
+//
+// The changes of each component are collapsed into (at most) a single change:
+// a created then updated component is reported as created (with its latest
+// assembly), a created then removed component is not reported at all, and a
+// removed then created component is reported as updated. A component whose
+// latest hash equals its baseline hash is not reported either, as it has not
+// changed as far as the coalesced changeset is concerned. The Timestamp of the
+// coalesced changeset is the Timestamp of the last changeset.
+func CoalesceChanges(changes ...GraphChanged) (GraphChanged, error) {
+	if len(changes) == 0 {
+		return GraphChanged{}, fmt.Errorf("coalesce changes: no changesets given")
+	}
+	for i := 1; i < len(changes); i++ {
+		if !changes[i].Follows(changes[i-1]) {
+			return GraphChanged{}, fmt.Errorf("coalesce changes: changeset %d does not follow changeset %d: baseline %v, want %v",
+				i, i-1, changes[i].GraphBefore, changes[i-1].GraphAfter)
+		}
+	}
+
+	// We track the net change of each component relative to the baseline of the
+	// first changeset, i.e. whether (and how) it existed there and how it exists
+	// (if at all) by the end of the last changeset.
+	type netChange struct {
+		existed          bool          // whether the component existed at the baseline
+		baseline         ComponentHash // its hash at the baseline, if it existed
+		baselineAssembly Assembly      // the component at the baseline, if known
+		latest           Assembly      // nil if the component does not exist (anymore)
+	}
+	var order []ComponentID // first appearance, to keep the output deterministic
+	net := make(map[ComponentID]*netChange)
+	lookup := func(id ComponentID) *netChange {
+		c, ok := net[id]
+		if !ok {
+			c = &netChange{}
+			net[id] = c
+			order = append(order, id)
+		}
+		return c
+	}
+
+	for i, changeset := range changes {
+		for _, created := range changeset.Created {
+			c, seen := net[created.AssemblyID()]
+			if seen && c.latest != nil {
+				return GraphChanged{}, fmt.Errorf("coalesce changes: changeset %d creates existing component %v", i, created.AssemblyID())
+			}
+			c = lookup(created.AssemblyID())
+			c.latest = created.Assembly
+		}
+		for _, updated := range changeset.Updated {
+			c, seen := net[updated.AssemblyID()]
+			if seen && c.latest == nil {
+				return GraphChanged{}, fmt.Errorf("coalesce changes: changeset %d updates removed component %v", i, updated.AssemblyID())
+			}
+			c = lookup(updated.AssemblyID())
+			if !seen {
+				c.existed, c.baseline, c.baselineAssembly = true, updated.Baseline, updated.BaselineAssembly
+			}
+			c.latest = updated.Assembly
+		}
+		for _, removed := range changeset.Removed {
+			c, seen := net[removed.AssemblyID()]
+			if seen && c.latest == nil {
+				return GraphChanged{}, fmt.Errorf("coalesce changes: changeset %d removes removed component %v", i, removed.AssemblyID())
+			}
+			c = lookup(removed.AssemblyID())
+			if !seen {
+				c.existed, c.baseline = true, removed.AssemblyHash()
+			}
+			c.latest = nil
+		}
+	}
+
+	coalesced := GraphChanged{
+		GraphBefore: changes[0].GraphBefore,
+		GraphAfter:  changes[len(changes)-1].GraphAfter,
+		Timestamp:   changes[len(changes)-1].Timestamp,
+	}
+	for _, id := range order {
+		c := net[id]
+		switch {
+		case !c.existed && c.latest != nil:
+			coalesced.Created = append(coalesced.Created, AssemblyCreated{Assembly: c.latest})
+		case c.existed && c.latest == nil:
+			coalesced.Removed = append(coalesced.Removed, AssemblyRemoved{ID: id, Hash: c.baseline})
+		case c.existed && c.latest.AssemblyHash() != c.baseline:
+			coalesced.Updated = append(coalesced.Updated, AssemblyUpdated{Baseline: c.baseline, Assembly: c.latest, BaselineAssembly: c.baselineAssembly})
+		}
+	}
+	return coalesced, nil
+}
+
+func filterAssemblies[S ~[]E, E Assembly](assemblies S, keep func(Assembly) bool) (filtered S) {
+	for _, a := range assemblies {
+		if keep(a) {
+			filtered = append(filtered, a)
+		}
+	}
+	return filtered
+}
+
+// A Lineage relates the components of a merge or a split: the Sources are the
+// removed components, and the Targets are the created components that took their
+// nodes. A merge has several Sources and a single Target, while a split has a
+// single Source and several Targets.
+type Lineage struct {
+	Sources []ComponentID
+	Targets []ComponentID
+}
+
+// DetectMergeSplit reconstructs the merges and splits among the given created
+// and removed assemblies, matching them by the node hashes they share. It only
+// depends on the given assemblies, so it serves offline analysis of historical
+// changes as well as engines.
+//
+// A created assembly sharing nodes with several removed assemblies is reported
+// as a merge of them, and a removed assembly sharing nodes with several created
+// assemblies is reported as a split into them. The components of every Lineage
+// follow the order of the given assemblies, and so do the lineages themselves.
+//
+// Beware, the AssemblyRemoved notifications of an engine carry no nodes (see
+// GraphChanged), so callers pass the latest assemblies of the removed
+// components instead (e.g. those they retained from earlier notifications).
+func DetectMergeSplit(created, removed []Assembly) (merges, splits []Lineage) {
+	// We index the removed assemblies by their nodes, so every created assembly
+	// finds those it shares nodes with in a single pass over its own nodes.
+	owners := make(map[NodeHash][]int)
+	for i, r := range removed {
+		for h := range r.Nodes() {
+			owners[h] = append(owners[h], i)
+		}
+	}
+	// The sources of every created assembly, and the targets of every removed one,
+	// as indices of the given slices.
+	sources := make([][]int, len(created))
+	targets := make([][]int, len(removed))
+	for i, c := range created {
+		shared := make(map[int]struct{})
+		for h := range c.Nodes() {
+			for _, j := range owners[h] {
+				shared[j] = struct{}{}
+			}
+		}
+		for _, j := range slices.Sorted(maps.Keys(shared)) {
+			sources[i] = append(sources[i], j)
+			targets[j] = append(targets[j], i)
+		}
+	}
+
+	ids := func(assemblies []Assembly, indices []int) []ComponentID {
+		s := make([]ComponentID, len(indices))
+		for i, j := range indices {
+			s[i] = assemblies[j].AssemblyID()
+		}
+		return s
+	}
+	for i, s := range sources {
+		if len(s) > 1 {
+			merges = append(merges, Lineage{Sources: ids(removed, s), Targets: []ComponentID{created[i].AssemblyID()}})
+		}
+	}
+	for j, t := range targets {
+		if len(t) > 1 {
+			splits = append(splits, Lineage{Sources: []ComponentID{removed[j].AssemblyID()}, Targets: ids(created, t)})
+		}
+	}
+	return merges, splits
+}
+
 // AssemblyCreated notifies about a new graph component that has been added to
 // the complete graph maintained by a digital twin.
 //
@@ -84,9 +373,15 @@ type AssemblyCreated struct {
 // The message contains both the modified component graph (like AssemblyCreated)
 // and a Baseline hash referencing the latest snapshot of the component graph
 // before is has been updated.
+//
+// Engines that retain the assemblies they observe may also include the
+// BaselineAssembly itself, so consumers can diff the component graph without
+// storing its previous assemblies on their own. It is nil otherwise, and also
+// when the engine had never observed the baseline (e.g. it predates the engine).
 type AssemblyUpdated struct {
-	Baseline ComponentHash // content address of the component graph before the update
-	Assembly               // an independent representation of the component graph
+	Baseline         ComponentHash // content address of the component graph before the update
+	Assembly                       // an independent representation of the component graph
+	BaselineAssembly Assembly      // the component graph before the update, if known
 }
 
 // AssemblyRemoved notifies about the disappearance of an existing (through a
@@ -133,9 +428,41 @@ func (c AssemblyRemoved) EdgesOf(NodeHash) []NodeHash {
 // has no nodes, and consequently, no edges to visit.
 func (c AssemblyRemoved) VisitEdges(func(from, to Value) bool) {}
 
+// Values returns an iterator that yields nothing because an empty assembly has
+// no nodes.
+func (c AssemblyRemoved) Values() iter.Seq[Value] {
+	return func(func(Value) bool) {}
+}
+
+// EdgePairs returns an iterator that yields nothing because an empty assembly
+// has no nodes, and consequently, no edges.
+func (c AssemblyRemoved) EdgePairs() iter.Seq2[Value, Value] {
+	return func(func(from, to Value) bool) {}
+}
+
 // FormatChanges returns a human-readable representation of the changeset.
 // The indent string is prepended to each line.
 func FormatChanges(changes GraphChanged, indent string) string {
+	return formatChanges(changes, indent, nil)
+}
+
+// FormatChangesVerbose returns a human-readable representation of the
+// changeset, like FormatChanges, but renders what changed within each updated
+// component instead of its edges alone. The indent string is prepended to each
+// line.
+//
+// For every updated component, it calls baselineLookup with the component's ID
+// to obtain the component's assembly as of the baseline of the changeset. When
+// one is found, it lists the nodes and edges added to (+) and removed from (-)
+// that assembly, by value. Otherwise, and also when baselineLookup is nil, it
+// renders the component the same way FormatChanges does.
+func FormatChangesVerbose(changes GraphChanged, indent string, baselineLookup func(ComponentID) (Assembly, bool)) string {
+	return formatChanges(changes, indent, baselineLookup)
+}
+
+// The formatChanges function implements both FormatChanges and
+// FormatChangesVerbose; a nil baselineLookup never finds a baseline.
+func formatChanges(changes GraphChanged, indent string, baselineLookup func(ComponentID) (Assembly, bool)) string {
 	var b strings.Builder
 	fmt.Fprintf(&b, indent+"baseline snapshot: %v\n", changes.GraphBefore)
 	for _, c := range changes.Created {
@@ -147,6 +474,12 @@ func FormatChanges(changes GraphChanged, indent string) string {
 	}
 	for _, c := range changes.Updated {
 		fmt.Fprintf(&b, indent+"* %v | %v\n", c.AssemblyID(), c.AssemblyHash())
+		if baselineLookup != nil {
+			if baseline, ok := baselineLookup(c.AssemblyID()); ok {
+				formatAssemblyDiff(&b, indent+"  ", baseline, c.Assembly)
+				continue
+			}
+		}
 		c.VisitEdges(func(s, t Value) bool {
 			fmt.Fprintf(&b, indent+"  %v -> %v\n", s, t)
 			return true
@@ -158,3 +491,33 @@ func FormatChanges(changes GraphChanged, indent string) string {
 	fmt.Fprintf(&b, indent+"current snapshot: %v\n", changes.GraphAfter)
 	return b.String()
 }
+
+// The formatAssemblyDiff function writes the nodes and then the edges removed
+// from the before assembly and added to the after assembly, each ordered by
+// content-address, so the same assemblies are always rendered the same way.
+func formatAssemblyDiff(b *strings.Builder, indent string, before, after Assembly) {
+	had, has := before.Nodes(), after.Nodes()
+	for _, h := range slices.SortedFunc(maps.Keys(had), NodeHash.Compare) {
+		if _, ok := has[h]; !ok {
+			fmt.Fprintf(b, indent+"- %v\n", had[h])
+		}
+	}
+	for _, h := range slices.SortedFunc(maps.Keys(has), NodeHash.Compare) {
+		if _, ok := had[h]; !ok {
+			fmt.Fprintf(b, indent+"+ %v\n", has[h])
+		}
+	}
+
+	hadEdges, hasEdges := edgesOf(before), edgesOf(after)
+	hadEdge, hasEdge := edgeSet(hadEdges), edgeSet(hasEdges)
+	for _, e := range hadEdges {
+		if !hasEdge[e] {
+			fmt.Fprintf(b, indent+"- %v -> %v\n", had[e[0]], had[e[1]])
+		}
+	}
+	for _, e := range hasEdges {
+		if !hadEdge[e] {
+			fmt.Fprintf(b, indent+"+ %v -> %v\n", has[e[0]], has[e[1]])
+		}
+	}
+}
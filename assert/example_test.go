@@ -82,6 +82,26 @@ func (x printApplier) RetractEdges(_ context.Context, node digitaltwin.Value, ki
 	return 0, nil
 }
 
+func (x printApplier) RetractAllEdges(_ context.Context, node digitaltwin.Value) (n int, err error) {
+	fmt.Println(node, "<-/-> *")
+	return 0, nil
+}
+
+func (x printApplier) DetachNode(_ context.Context, node digitaltwin.Value) (err error) {
+	fmt.Println(node, "<-/-> *")
+	return nil
+}
+
+func (x printApplier) HasEdge(_ context.Context, from, to digitaltwin.Value) (ok bool, err error) {
+	fmt.Println(from, "-?->", to)
+	return false, nil
+}
+
+func (x printApplier) NodeExists(_ context.Context, node digitaltwin.Value) (ok bool, err error) {
+	fmt.Println("?", node)
+	return false, nil
+}
+
 func (x printApplier) AssertManyToOne(ctx context.Context, source, target digitaltwin.Value) error {
 	fmt.Printf("many nodes of type %T may associate with %v\n", source, target)
 	return nil
@@ -113,7 +113,9 @@ func (a *AttributeMap[V]) Iter(fn func(k ComponentID, v V) bool) {
 // receive the attribute a specific assembly.
 func TrackAttribute[V any](m *AttributeMap[V], source *pubsub.Subscription) component.Proc {
 	return func(l *component.L) {
-		var trackedGraph ForestHash
+		// We only keep the hashes of the last handled changeset, rather than the
+		// entire changeset, as that is all we need to detect a discontinuity.
+		var previous GraphChanged
 		for l.Continue() {
 			msg, err := source.Receive(l.GraceContext())
 			if err != nil {
@@ -129,9 +131,9 @@ func TrackAttribute[V any](m *AttributeMap[V], source *pubsub.Subscription) comp
 				l.Fatalf("Failed to unmarshal graph changes; stopping attribute tracking: %v\n", err)
 			}
 
-			if trackedGraph != (ForestHash{}) && trackedGraph != graphChanged.GraphBefore {
+			if !graphChanged.Follows(previous) {
 				l.Logf("Detected a discontinuity in GraphChanged messages: last handled graph hash %s, received previous graph hash %s",
-					trackedGraph.String(), graphChanged.GraphBefore.String())
+					previous.GraphAfter.String(), graphChanged.GraphBefore.String())
 				l.Fatalf("Exiting due to detected discontinuity")
 			}
 
@@ -141,6 +143,7 @@ func TrackAttribute[V any](m *AttributeMap[V], source *pubsub.Subscription) comp
 			for _, updated := range graphChanged.Updated {
 				m.Update(updated)
 			}
+			previous = GraphChanged{GraphBefore: graphChanged.GraphBefore, GraphAfter: graphChanged.GraphAfter}
 			msg.Ack()
 		}
 	}
@@ -1,11 +1,11 @@
 package digitaltwin
 
 import (
-	"bytes"
 	"crypto/sha1"
 	"encoding/gob"
+	"iter"
 	"maps"
-	"sort"
+	"slices"
 	"unsafe"
 )
 
@@ -89,6 +89,11 @@ func (b *AssemblyBuilder) Connect(source, target Value) {
 }
 
 // Roots shall replace b's existing root nodes list with the given roots.
+//
+// An Assembly may have several roots, and its AssemblyID digests all of them.
+// Digital-twin engines report a DAG whose roots converge on shared nodes as a
+// single component with all of those roots (see the "converge" case of the
+// enginetest package).
 func (b *AssemblyBuilder) Roots(root ...Value) {
 	b.copyCheck()
 	b.Nodes(root...)
@@ -112,41 +117,42 @@ func (b *AssemblyBuilder) hintNodes(n int) {
 	b.nodes = nodes
 }
 
-/*
 // hintEdges copies the internal edges-map to a new, larger map so that there
 // are approximately (depends on map implementation) e edges of capacity to
-// b.edges without requiring rehashing and allocations.
+// b.neighbours without requiring rehashing and allocations.
+//
+// Edges are stored per source node, and we cannot know in advance which nodes
+// the hinted edges originate from. So, we can only make room for e more source
+// nodes (the most there may be); each source node still allocates its own set of
+// neighbours when connected for the first time.
 func (b *AssemblyBuilder) hintEdges(e int) {
 	// the calculation (i.e., len = 2*len + extra) is based on strings/builder.go (Builder.Grow)
 	neighbours := make(map[NodeHash]map[NodeHash]struct{}, 2*len(b.neighbours)+e)
-	for from, tos := range b.neighbours {
-		neighbours[from] = make(map[NodeHash]struct{}, len(b.nodes))
-		neighbours[k] = v
-	}
+	maps.Copy(neighbours, b.neighbours)
 	b.neighbours = neighbours
 }
-*/
 
 // Hint hints b's map size, if necessary, to guarantee space for more n nodes
-// and e edges. After Grow(n, e), approximately (depends on map implementation)
+// and e edges. After Hint(n, e), approximately (depends on map implementation)
 // n nodes and e edges can be added to b without another allocation.
-// If either n or e is negative, Grow shall panic.
+// A zero n or e hints nothing about nodes or edges, respectively.
+// If either n or e is negative, Hint shall panic.
 func (b *AssemblyBuilder) Hint(n, e int) {
 	b.copyCheck()
 
 	if n < 0 {
-		panic("digitaltwin.AssemblyBuilder.Grow: negative node count")
+		panic("digitaltwin.AssemblyBuilder.Hint: negative node count")
 	}
 	if len(b.nodes) < n {
 		b.hintNodes(n)
 	}
 
 	if e < 0 {
-		panic("digitaltwin.AssemblyBuilder.Grow: negative edge count")
+		panic("digitaltwin.AssemblyBuilder.Hint: negative edge count")
+	}
+	if len(b.neighbours) < e {
+		b.hintEdges(e)
 	}
-	//if len(b.neighbours) < e {
-	//	b.hintEdges(e)
-	//}
 }
 
 // Noescape hides a pointer from escape analysis.
@@ -193,6 +199,7 @@ func (a AssemblyGraph) Roots() []NodeHash             { return a.Root }
 func (a AssemblyGraph) Nodes() map[NodeHash]Value     { return a.Vertices }
 func (a AssemblyGraph) Value(n NodeHash) Value        { return a.Vertices[n] }
 func (a AssemblyGraph) EdgesOf(n NodeHash) []NodeHash { return a.Neighbours[n] }
+func (a AssemblyGraph) Values() iter.Seq[Value]       { return maps.Values(a.Vertices) }
 
 func (a AssemblyGraph) VisitEdges(fn func(from, to Value) bool) {
 	for from, neighbours := range a.Neighbours {
@@ -204,15 +211,28 @@ func (a AssemblyGraph) VisitEdges(fn func(from, to Value) bool) {
 	}
 }
 
+func (a AssemblyGraph) EdgePairs() iter.Seq2[Value, Value] {
+	return func(yield func(from, to Value) bool) {
+		// sort lexicographically to achieve consistency, without modifying the
+		// underlying slices which may be shared with other goroutines
+		for _, from := range slices.SortedFunc(maps.Keys(a.Neighbours), NodeHash.Compare) {
+			for _, to := range slices.SortedFunc(slices.Values(a.Neighbours[from]), NodeHash.Compare) {
+				if !yield(a.Vertices[from], a.Vertices[to]) {
+					return
+				}
+			}
+		}
+	}
+}
+
 func (a AssemblyGraph) AssemblyID() ComponentID {
 	h := sha1.New()
-	// sort lexicographically to achieve consistency
-	sort.Slice(a.Root, func(i, j int) bool {
-		return bytes.Compare(a.Root[i][:], a.Root[j][:]) < 0
-	})
+	// sort lexicographically to achieve consistency, without mutating the roots as
+	// assemblies are shared between goroutines
+	roots := slices.SortedFunc(slices.Values(a.Root), NodeHash.Compare)
 	// hash root nodes in sorted order
-	for i := range a.Root {
-		h.Write(a.Root[i][:])
+	for i := range roots {
+		h.Write(roots[i][:])
 	}
 	return ComponentID(h.Sum(nil))
 }
@@ -228,17 +248,13 @@ func (a AssemblyGraph) AssemblyHash() ComponentHash {
 	for n := range a.Vertices {
 		nodes = append(nodes, n)
 	}
-	sort.Slice(nodes, func(i, j int) bool {
-		return bytes.Compare(nodes[i][:], nodes[j][:]) < 0
-	})
+	slices.SortFunc(nodes, NodeHash.Compare)
 
 	// hash nodes in sorted order, then hash their sorted neighbours
 	for _, from := range nodes {
 		h.Write(from[:])
-		neighbours := a.Neighbours[from]
-		sort.Slice(neighbours, func(i, j int) bool {
-			return bytes.Compare(neighbours[i][:], neighbours[j][:]) < 0
-		})
+		// sort a copy, as other goroutines may read the neighbours (e.g. EdgesOf)
+		neighbours := slices.SortedFunc(slices.Values(a.Neighbours[from]), NodeHash.Compare)
 		for _, to := range neighbours {
 			h.Write(to[:])
 		}
@@ -3,6 +3,9 @@ package digitaltwin
 import (
 	"fmt"
 	"hash"
+	"maps"
+	"slices"
+	"sync"
 	"testing"
 )
 
@@ -120,3 +123,211 @@ func (d dummyNode) ContentAddress(h hash.Hash) error {
 	h.Write([]byte{d.id})
 	return nil
 }
+
+func TestAssemblyGraph_Values(t *testing.T) {
+	var b AssemblyBuilder
+	b.Roots(dummyNode{id: 1})
+	b.Connect(dummyNode{id: 1}, dummyNode{id: 2})
+	b.Connect(dummyNode{id: 1}, dummyNode{id: 3})
+	b.Connect(dummyNode{id: 3}, dummyNode{id: 4})
+	a := b.Assemble()
+
+	byID := func(x, y Value) int { return int(x.(dummyNode).id) - int(y.(dummyNode).id) }
+	want := slices.SortedFunc(maps.Values(a.Nodes()), byID)
+	got := slices.SortedFunc(a.Values(), byID)
+	if !slices.Equal(got, want) {
+		t.Errorf("Values() = %v, want %v", got, want)
+	}
+
+	// An empty assembly yields nothing.
+	for v := range (AssemblyRemoved{}).Values() {
+		t.Errorf("AssemblyRemoved.Values() yielded %v", v)
+	}
+}
+
+func TestRootValues(t *testing.T) {
+	// Two roots converge on a shared child.
+	first, second, child := dummyNode{id: 1}, dummyNode{id: 2}, dummyNode{id: 3}
+	var b AssemblyBuilder
+	b.Roots(second, first)
+	b.Connect(first, child)
+	b.Connect(second, child)
+	a := b.Assemble()
+
+	want := []Value{first, second}
+	if MustContentAddress(second).Compare(MustContentAddress(first)) < 0 {
+		want = []Value{second, first}
+	}
+	if got := RootValues(a); !slices.Equal(got, want) {
+		t.Errorf("RootValues() = %v, want %v", got, want)
+	}
+
+	if got := RootValues(AssemblyRemoved{}); got != nil {
+		t.Errorf("RootValues(AssemblyRemoved) = %v, want nil", got)
+	}
+}
+
+func TestAssemblyGraph_EdgePairs(t *testing.T) {
+	edges := [][2]dummyNode{
+		{{id: 1}, {id: 2}},
+		{{id: 1}, {id: 3}},
+		{{id: 3}, {id: 4}},
+		{{id: 3}, {id: 5}},
+		{{id: 2}, {id: 5}},
+	}
+	var b AssemblyBuilder
+	b.Roots(dummyNode{id: 1})
+	for _, e := range edges {
+		b.Connect(e[0], e[1])
+	}
+	a := b.Assemble()
+
+	got := make(map[[2]dummyNode]int)
+	var order [][2]NodeHash
+	for from, to := range a.EdgePairs() {
+		got[[2]dummyNode{from.(dummyNode), to.(dummyNode)}]++
+		order = append(order, [2]NodeHash{MustContentAddress(from), MustContentAddress(to)})
+	}
+	for _, e := range edges {
+		if got[e] != 1 {
+			t.Errorf("EdgePairs() yielded %v -> %v %d times, want once", e[0], e[1], got[e])
+		}
+	}
+	if len(got) != len(edges) {
+		t.Errorf("EdgePairs() yielded %d distinct edges, want %d", len(got), len(edges))
+	}
+	isSorted := slices.IsSortedFunc(order, func(x, y [2]NodeHash) int {
+		if c := x[0].Compare(y[0]); c != 0 {
+			return c
+		}
+		return x[1].Compare(y[1])
+	})
+	if !isSorted {
+		t.Errorf("EdgePairs() yielded edges out of order")
+	}
+
+	// Breaking out of the loop stops the iteration.
+	var n int
+	for range a.EdgePairs() {
+		n++
+		break
+	}
+	if n != 1 {
+		t.Errorf("EdgePairs() yielded %d edges after break, want 1", n)
+	}
+
+	// An empty assembly yields nothing.
+	for from, to := range (AssemblyRemoved{}).EdgePairs() {
+		t.Errorf("AssemblyRemoved.EdgePairs() yielded %v -> %v", from, to)
+	}
+}
+
+// Connects a chain of n nodes, so every edge originates from a different node.
+func connectChain(b *AssemblyBuilder, n int) {
+	for i := 1; i < n; i++ {
+		b.Connect(dummyNode{id: byte(i - 1)}, dummyNode{id: byte(i)})
+	}
+}
+
+func TestBuilderHintEdges(t *testing.T) {
+	const nodes = 200
+	unhinted := testing.AllocsPerRun(100, func() {
+		var b AssemblyBuilder
+		connectChain(&b, nodes)
+	})
+	hinted := testing.AllocsPerRun(100, func() {
+		var b AssemblyBuilder
+		b.Hint(nodes, nodes-1)
+		connectChain(&b, nodes)
+	})
+	if hinted >= unhinted {
+		t.Errorf("Builder allocs with Hint = %v; want fewer than %v without", hinted, unhinted)
+	}
+}
+
+func BenchmarkBuilderHint(b *testing.B) {
+	const nodes = 200
+	b.Run("Unhinted", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var builder AssemblyBuilder
+			connectChain(&builder, nodes)
+		}
+	})
+	b.Run("Hinted", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var builder AssemblyBuilder
+			builder.Hint(nodes, nodes-1)
+			connectChain(&builder, nodes)
+		}
+	})
+}
+
+// Run with -race to detect AssemblyID mutating the assembly it identifies.
+func TestAssemblyID_concurrent(t *testing.T) {
+	// Several roots, deliberately out of order.
+	a := AssemblyGraph{
+		Root: []NodeHash{
+			MustContentAddress(dummyNode{id: 3}),
+			MustContentAddress(dummyNode{id: 1}),
+			MustContentAddress(dummyNode{id: 2}),
+		},
+	}
+	roots := slices.Clone(a.Root)
+	want := a.AssemblyID()
+
+	var wg sync.WaitGroup
+	for range 32 {
+		wg.Go(func() {
+			if got := a.AssemblyID(); got != want {
+				t.Errorf("AssemblyID() = %v, want %v", got, want)
+			}
+			_ = a.Roots()[0] // read concurrently with any write
+		})
+	}
+	wg.Wait()
+
+	if !slices.Equal(a.Root, roots) {
+		t.Errorf("AssemblyID() reordered the roots to %v, want %v", a.Root, roots)
+	}
+}
+
+// Run with -race to detect AssemblyHash mutating the assembly it hashes.
+func TestAssemblyHash_concurrent(t *testing.T) {
+	root, x, y, z := dummyNode{id: 0}, dummyNode{id: 1}, dummyNode{id: 2}, dummyNode{id: 3}
+	// The neighbours of the root are deliberately out of order.
+	a := AssemblyGraph{
+		Root: []NodeHash{MustContentAddress(root)},
+		Vertices: map[NodeHash]Value{
+			MustContentAddress(root): root,
+			MustContentAddress(x):    x,
+			MustContentAddress(y):    y,
+			MustContentAddress(z):    z,
+		},
+		Neighbours: map[NodeHash][]NodeHash{
+			MustContentAddress(root): {MustContentAddress(z), MustContentAddress(x), MustContentAddress(y)},
+		},
+	}
+	edges := slices.Clone(a.EdgesOf(MustContentAddress(root)))
+	want := a.AssemblyHash()
+
+	var wg sync.WaitGroup
+	for range 32 {
+		wg.Go(func() {
+			if got := a.AssemblyHash(); got != want {
+				t.Errorf("AssemblyHash() = %v, want %v", got, want)
+			}
+		})
+		wg.Go(func() {
+			for _, to := range a.EdgesOf(MustContentAddress(root)) {
+				_ = a.Value(to)
+			}
+		})
+	}
+	wg.Wait()
+
+	if got := a.EdgesOf(MustContentAddress(root)); !slices.Equal(got, edges) {
+		t.Errorf("AssemblyHash() reordered the neighbours to %v, want %v", got, edges)
+	}
+}
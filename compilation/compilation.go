@@ -20,7 +20,9 @@ import (
 	"encoding/gob"
 	"fmt"
 	"iter"
+	"maps"
 	"reflect"
+	"slices"
 
 	"github.com/go-digitaltwin/go-digitaltwin"
 )
@@ -108,6 +110,45 @@ func (r *Recorder) Steps() []Step {
 	return s
 }
 
+// Len returns the number of currently recorded mutation steps. Unlike
+// len(r.Steps()), it does not copy the recorded steps.
+func (r *Recorder) Len() int {
+	return len(r.steps)
+}
+
+// IsEmpty reports whether the Recorder has no recorded mutation steps, e.g. to
+// skip applying an empty compilation altogether.
+func (r *Recorder) IsEmpty() bool {
+	return len(r.steps) == 0
+}
+
+// Last returns the most recently recorded mutation step without removing it,
+// and whether there was any such step at all.
+func (r *Recorder) Last() (Step, bool) {
+	if len(r.steps) == 0 {
+		return nil, false
+	}
+	return r.steps[len(r.steps)-1], true
+}
+
+// Pop removes the most recently recorded mutation step and returns it, and
+// whether there was any such step at all.
+//
+// Together with the recording methods, it enables amending the most recent step
+// (e.g. replacing an AssertNode with an AssertEdge once its target is known)
+// without rebuilding the entire recording.
+func (r *Recorder) Pop() (Step, bool) {
+	if len(r.steps) == 0 {
+		return nil, false
+	}
+	last := r.steps[len(r.steps)-1]
+	// Clear the vacated slot so the popped step does not linger in the backing
+	// array until it is overwritten.
+	r.steps[len(r.steps)-1] = nil
+	r.steps = r.steps[:len(r.steps)-1]
+	return last, true
+}
+
 // Replay creates a [digitaltwin.Compilation] function that sequentially applies
 // a series of mutation steps. It transforms recorded steps into an executable
 // compilation that can be applied to a graph.
@@ -121,9 +162,23 @@ func (r *Recorder) Steps() []Step {
 // to implement additional error handling or transaction-like behaviour if
 // atomicity is required.
 func Replay(steps []Step) digitaltwin.Compilation {
+	return ReplayWithProgress(steps, nil)
+}
+
+// ReplayWithProgress is like Replay, but calls the given progress function after
+// each step with the index of the step in steps, the step itself and the error
+// it returned (nil on success). It is called for the failing step as well, right
+// before the compilation stops, which lets callers log the progress of replaying
+// a large recording and pinpoint the step that failed. A nil progress function
+// is ignored.
+func ReplayWithProgress(steps []Step, progress func(i int, step Step, err error)) digitaltwin.Compilation {
 	return func(ctx context.Context, w digitaltwin.GraphWriter) error {
-		for _, step := range steps {
-			if err := step.Do(ctx, w); err != nil {
+		for i, step := range steps {
+			err := step.Do(ctx, w)
+			if progress != nil {
+				progress(i, step, err)
+			}
+			if err != nil {
 				return err
 			}
 		}
@@ -131,6 +186,17 @@ func Replay(steps []Step) digitaltwin.Compilation {
 	}
 }
 
+// ApplyTo applies the currently recorded mutation steps to the graph of the
+// given [digitaltwin.Applier], as if by:
+//
+//	a.Apply(ctx, Replay(r.Steps()))
+//
+// It replays a copy of the recorded steps, so recording further steps while the
+// Applier is busy does not affect the applied compilation.
+func (r *Recorder) ApplyTo(ctx context.Context, a digitaltwin.Applier) error {
+	return a.Apply(ctx, Replay(r.Steps()))
+}
+
 // Targets iterate over all nodes affected by the provided steps, yielding each
 // target node to the provided function once.
 //
@@ -187,6 +253,45 @@ func (r *Recorder) AssertEdge(from, to digitaltwin.Value) {
 	r.steps = append(r.steps, assertEdge{From: from, To: to})
 }
 
+// AssertAssembly records a mutation step that will assert every node and edge
+// of the given assembly.
+//
+// When replayed, this step ensures all nodes of the assembly exist in the graph,
+// and then that all of its edges exist between them. It is equivalent to (but
+// more compact than) recording AssertNode for each of its nodes followed by
+// AssertEdge for each of its edges. The assembly is captured when recorded, so
+// later changes to it do not affect the step.
+func (r *Recorder) AssertAssembly(a digitaltwin.Assembly) {
+	var s assertAssembly
+	// We capture nodes and edges in a deterministic order, so replaying the same
+	// assembly always issues the same sequence of writes.
+	for _, n := range slices.SortedFunc(maps.Keys(a.Nodes()), digitaltwin.NodeHash.Compare) {
+		s.Nodes = append(s.Nodes, a.Value(n))
+	}
+	for from, to := range a.EdgePairs() {
+		s.Edges = append(s.Edges, assertEdge{From: from, To: to})
+	}
+	r.steps = append(r.steps, s)
+}
+
+// RecordAssembly records the steps that reconstruct the given assembly into the
+// given Recorder: an AssertNode step for each of its nodes, followed by an
+// AssertEdge step for each of its edges. This turns an observed assembly (e.g.
+// of a digitaltwin.ComponentChanged notification) back into mutations, which
+// tests replay against a fresh graph.
+//
+// Unlike Recorder.AssertAssembly, which records the entire assembly as a single
+// step, it records the steps one by one, so they may be amended individually
+// (e.g. with Recorder.Pop). Both are replayed in the same deterministic order.
+func RecordAssembly(a digitaltwin.Assembly, r *Recorder) {
+	for _, n := range slices.SortedFunc(maps.Keys(a.Nodes()), digitaltwin.NodeHash.Compare) {
+		r.AssertNode(a.Value(n))
+	}
+	for from, to := range a.EdgePairs() {
+		r.AssertEdge(from, to)
+	}
+}
+
 // RetractEdges records a mutation step that will retract edges from a node.
 //
 // When replayed, this step removes all edges from the specified node to nodes of
@@ -196,6 +301,50 @@ func (r *Recorder) RetractEdges(node digitaltwin.Value, kind reflect.Type) {
 	r.steps = append(r.steps, retractEdges{Node: node, Kind: kind})
 }
 
+// RetractAllEdges records a mutation step that will retract all edges of a node.
+//
+// When replayed, this step removes every edge connected to the specified node,
+// in either direction and regardless of the types of the nodes on their other
+// ends. The node itself remains in the graph.
+func (r *Recorder) RetractAllEdges(node digitaltwin.Value) {
+	r.steps = append(r.steps, retractAllEdges{Node: node})
+}
+
+// Barrier records a step that marks the current point of the recording with the
+// given tag, e.g. to tell the old state from the new one when replaying in
+// phases.
+//
+// When replayed, this step does nothing, and it has no targets. It only exists
+// for tooling to partition the recorded steps; see SplitAtBarriers and
+// BarrierTag.
+func (r *Recorder) Barrier(tag string) {
+	r.steps = append(r.steps, barrier{Tag: tag})
+}
+
+// BarrierTag returns the tag of the given step, if it was recorded by
+// Recorder.Barrier.
+func BarrierTag(s Step) (tag string, ok bool) {
+	b, ok := s.(barrier)
+	return b.Tag, ok
+}
+
+// SplitAtBarriers partitions the given steps into segments delimited by the
+// steps recorded with Recorder.Barrier, so they can be replayed in phases. It
+// returns one more segment than there are barriers: every segment but the first
+// starts with the barrier that delimits it (see BarrierTag), and any segment may
+// otherwise be empty. Replaying the segments in order is equivalent to
+// replaying the steps at once.
+func SplitAtBarriers(steps []Step) [][]Step {
+	segments := [][]Step{nil}
+	for _, s := range steps {
+		if _, ok := s.(barrier); ok {
+			segments = append(segments, nil)
+		}
+		segments[len(segments)-1] = append(segments[len(segments)-1], s)
+	}
+	return segments
+}
+
 // AssertOneToOne records a mutation step that will assert a one-to-one
 // relationship between the source and target nodes.
 //
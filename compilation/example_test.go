@@ -3,8 +3,10 @@ package compilation_test
 import (
 	"context"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"reflect"
+	"slices"
 
 	"github.com/go-digitaltwin/go-digitaltwin"
 	"github.com/go-digitaltwin/go-digitaltwin/compilation"
@@ -140,6 +142,26 @@ func (w PrintGraphWriter) RetractEdges(ctx context.Context, node digitaltwin.Val
 	return 0, nil
 }
 
+func (w PrintGraphWriter) RetractAllEdges(ctx context.Context, node digitaltwin.Value) (int, error) {
+	fmt.Println(node, "<-/-> *")
+	return 0, nil
+}
+
+func (w PrintGraphWriter) DetachNode(ctx context.Context, node digitaltwin.Value) error {
+	fmt.Println(node, "<-/-> *")
+	return nil
+}
+
+func (w PrintGraphWriter) HasEdge(ctx context.Context, from, to digitaltwin.Value) (bool, error) {
+	fmt.Println(from, "-?->", to)
+	return false, nil
+}
+
+func (w PrintGraphWriter) NodeExists(ctx context.Context, node digitaltwin.Value) (bool, error) {
+	fmt.Println("?", node)
+	return false, nil
+}
+
 // We demonstrate the usage of the Recorder for capturing and replaying a series
 // of graph relationship assertions. This example covers the entire lifecycle:
 // defining nodes relevant to a specific scenario, recording various types of
@@ -288,3 +310,385 @@ func ExampleTargets() {
 	// (D)
 	// (E)
 }
+
+// We demonstrate how to record an entire assembly as a single step. Rather than
+// recording each node and edge of a component individually, the Recorder
+// captures the assembly at once; replaying the step (even in another process)
+// asserts all of its nodes, and then all of its edges.
+func ExampleRecorder_AssertAssembly() {
+	var (
+		nodeA = TestNode{Value: "A"}
+		nodeB = TestNode{Value: "B"}
+		nodeC = TestNode{Value: "C"}
+	)
+
+	// Build a small component with a single root.
+	var b digitaltwin.AssemblyBuilder
+	b.Roots(nodeA)
+	b.Connect(nodeA, nodeB)
+	b.Connect(nodeA, nodeC)
+
+	var recorder compilation.Recorder
+	recorder.AssertAssembly(b.Assemble())
+	fmt.Printf("Recorded %d steps\n", len(recorder.Steps()))
+
+	// Round-trip the steps as if transmitted to another process.
+	encodedSteps, err := compilation.Encode(recorder.Steps())
+	if err != nil {
+		panic(err)
+	}
+	decodedSteps, err := compilation.Decode(encodedSteps)
+	if err != nil {
+		panic(err)
+	}
+
+	// Every node of the assembly is a target of the decoded step.
+	for target := range compilation.Targets(decodedSteps) {
+		fmt.Println("target", target)
+	}
+
+	err = compilation.Replay(decodedSteps)(context.Background(), PrintGraphWriter{})
+	if err != nil {
+		panic(err)
+	}
+
+	// Unordered output:
+	// Recorded 1 steps
+	// target (A)
+	// target (B)
+	// target (C)
+	// + (A)
+	// + (B)
+	// + (C)
+	// (A) -> (B)
+	// (A) -> (C)
+}
+
+// We demonstrate how to follow the progress of a replay, and pinpoint the step
+// that failed. The graph writer rejects node C, so the replay stops at the step
+// asserting it, and the remaining steps are never reported.
+func ExampleReplayWithProgress() {
+	var (
+		nodeA = TestNode{Value: "A"}
+		nodeB = TestNode{Value: "B"}
+		nodeC = TestNode{Value: "C"}
+	)
+
+	var recorder compilation.Recorder
+	recorder.AssertNode(nodeA)
+	recorder.AssertEdge(nodeA, nodeB)
+	recorder.AssertNode(nodeC)
+	recorder.AssertEdge(nodeB, nodeC)
+
+	progress := func(i int, step compilation.Step, err error) {
+		if err != nil {
+			fmt.Printf("step %d (%T) failed: %v\n", i, step, err)
+			return
+		}
+		fmt.Printf("step %d done\n", i)
+	}
+	err := compilation.ReplayWithProgress(recorder.Steps(), progress)(context.Background(), rejectingGraphWriter{Reject: nodeC})
+	fmt.Println("replay:", err)
+
+	// Output:
+	// + (A)
+	// step 0 done
+	// (A) -> (B)
+	// step 1 done
+	// step 2 (compilation.assertNode) failed: rejected (C)
+	// replay: rejected (C)
+}
+
+// A rejectingGraphWriter is a PrintGraphWriter that fails to assert a single
+// node.
+type rejectingGraphWriter struct {
+	PrintGraphWriter
+	Reject digitaltwin.Value
+}
+
+func (w rejectingGraphWriter) AssertNode(ctx context.Context, node digitaltwin.Value) error {
+	if node == w.Reject {
+		return fmt.Errorf("rejected %v", node)
+	}
+	return w.PrintGraphWriter.AssertNode(ctx, node)
+}
+
+// We demonstrate how barriers partition a recording into phases. The barriers
+// survive a round-trip to another process, which then replays each phase on its
+// own; the barriers themselves leave the graph untouched.
+func ExampleSplitAtBarriers() {
+	var (
+		nodeA = TestNode{Value: "A"}
+		nodeB = TestNode{Value: "B"}
+		nodeC = TestNode{Value: "C"}
+	)
+
+	var recorder compilation.Recorder
+	recorder.AssertEdge(nodeA, nodeB)
+	recorder.Barrier("old state")
+	recorder.RetractNode(nodeB)
+	recorder.AssertEdge(nodeA, nodeC)
+	recorder.Barrier("new state")
+
+	// Round-trip the steps as if transmitted to another process.
+	encodedSteps, err := compilation.Encode(recorder.Steps())
+	if err != nil {
+		panic(err)
+	}
+	decodedSteps, err := compilation.Decode(encodedSteps)
+	if err != nil {
+		panic(err)
+	}
+
+	for i, segment := range compilation.SplitAtBarriers(decodedSteps) {
+		fmt.Printf("segment %d: %d steps\n", i, len(segment))
+		if len(segment) > 0 {
+			if tag, ok := compilation.BarrierTag(segment[0]); ok {
+				fmt.Printf("after barrier %q\n", tag)
+			}
+		}
+		err := compilation.Replay(segment)(context.Background(), PrintGraphWriter{})
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// Output:
+	// segment 0: 1 steps
+	// (A) -> (B)
+	// segment 1: 3 steps
+	// after barrier "old state"
+	// - (B)
+	// (A) -> (C)
+	// segment 2: 1 steps
+	// after barrier "new state"
+}
+
+// We demonstrate how Len and IsEmpty track the steps held by a recorder, as
+// steps are recorded, popped, and reset.
+func ExampleRecorder_Len() {
+	var recorder compilation.Recorder
+	fmt.Printf("New recorder: %d step(s), empty: %t\n", recorder.Len(), recorder.IsEmpty())
+
+	nodeA := TestNode{Value: "A"}
+	nodeB := TestNode{Value: "B"}
+	recorder.AssertNode(nodeA)
+	recorder.AssertEdge(nodeA, nodeB)
+	recorder.RetractNode(nodeB)
+	fmt.Printf("After recording: %d step(s), empty: %t\n", recorder.Len(), recorder.IsEmpty())
+
+	recorder.Pop()
+	fmt.Printf("After popping: %d step(s), empty: %t\n", recorder.Len(), recorder.IsEmpty())
+
+	recorder.Reset()
+	fmt.Printf("After reset: %d step(s), empty: %t\n", recorder.Len(), recorder.IsEmpty())
+
+	// Output:
+	// New recorder: 0 step(s), empty: true
+	// After recording: 3 step(s), empty: false
+	// After popping: 2 step(s), empty: false
+	// After reset: 0 step(s), empty: true
+}
+
+// We demonstrate how to amend the most recently recorded step. A node asserted
+// on its own is later upgraded to an edge, once the target of that edge becomes
+// known, by popping the original step and recording its replacement.
+func ExampleRecorder_Pop() {
+	var recorder compilation.Recorder
+
+	// Popping (or peeking) an empty recorder reports that there is no step.
+	_, ok := recorder.Pop()
+	fmt.Println("Popped from empty recorder:", ok)
+
+	nodeA := TestNode{Value: "A"}
+	nodeB := TestNode{Value: "B"}
+	recorder.AssertNode(nodeA)
+
+	// Peeking leaves the recorded steps intact.
+	last, _ := recorder.Last()
+	fmt.Printf("Last step targets %d node(s), %d step(s) recorded\n", len(slices.Collect(last.Targets())), recorder.Len())
+
+	// Replace the node assertion with an edge assertion.
+	recorder.Pop()
+	recorder.AssertEdge(nodeA, nodeB)
+
+	err := compilation.Replay(recorder.Steps())(context.Background(), PrintGraphWriter{})
+	if err != nil {
+		panic(err)
+	}
+
+	// Output:
+	// Popped from empty recorder: false
+	// Last step targets 1 node(s), 1 step(s) recorded
+	// (A) -> (B)
+}
+
+// We demonstrate how to apply the recorded steps directly to an Applier, which
+// replays them in the order they were recorded.
+func ExampleRecorder_ApplyTo() {
+	var recorder compilation.Recorder
+	nodeA := TestNode{Value: "A"}
+	nodeB := TestNode{Value: "B"}
+	recorder.AssertNode(nodeA)
+	recorder.AssertEdge(nodeA, nodeB)
+	recorder.RetractNode(nodeB)
+
+	if err := recorder.ApplyTo(context.Background(), PrintApplier{}); err != nil {
+		panic(err)
+	}
+
+	// Output:
+	// + (A)
+	// (A) -> (B)
+	// - (B)
+}
+
+// We demonstrate how to turn an observed assembly back into the steps that
+// reconstruct it, and replay them against a fresh graph. Here, the graph is an
+// AssemblingApplier, which assembles the nodes and edges it is given; so the
+// reconstructed component hashes just like the original one.
+func ExampleRecordAssembly() {
+	var (
+		nodeA = TestNode{Value: "A"}
+		nodeB = TestNode{Value: "B"}
+		nodeC = TestNode{Value: "C"}
+	)
+
+	// Usually, the assembly is received in a digitaltwin.ComponentChanged.
+	var b digitaltwin.AssemblyBuilder
+	b.Roots(nodeA)
+	b.Connect(nodeA, nodeB)
+	b.Connect(nodeB, nodeC)
+	observed := b.Assemble()
+
+	var recorder compilation.Recorder
+	compilation.RecordAssembly(observed, &recorder)
+	fmt.Printf("Recorded %d steps\n", recorder.Len())
+
+	var fresh AssemblingApplier
+	if err := recorder.ApplyTo(context.Background(), &fresh); err != nil {
+		panic(err)
+	}
+	reconstructed := fresh.Assemble()
+	fmt.Println("Same component:", reconstructed.AssemblyID() == observed.AssemblyID())
+	fmt.Println("Same hash:", reconstructed.AssemblyHash() == observed.AssemblyHash())
+
+	// Output:
+	// Recorded 5 steps
+	// Same component: true
+	// Same hash: true
+}
+
+// We demonstrate how an assembly of several roots, which converge on a shared
+// node, is reconstructed with all of its roots.
+func ExampleRecordAssembly_twoRoots() {
+	var (
+		nodeA = TestNode{Value: "A"}
+		nodeB = TestNode{Value: "B"}
+		nodeC = TestNode{Value: "C"}
+	)
+
+	var b digitaltwin.AssemblyBuilder
+	b.Roots(nodeA, nodeB)
+	b.Connect(nodeA, nodeC)
+	b.Connect(nodeB, nodeC)
+	observed := b.Assemble()
+
+	var recorder compilation.Recorder
+	compilation.RecordAssembly(observed, &recorder)
+
+	var fresh AssemblingApplier
+	if err := recorder.ApplyTo(context.Background(), &fresh); err != nil {
+		panic(err)
+	}
+	reconstructed := fresh.Assemble()
+	fmt.Println("Roots:", len(reconstructed.Roots()))
+	fmt.Println("Same component:", reconstructed.AssemblyID() == observed.AssemblyID())
+	fmt.Println("Same hash:", reconstructed.AssemblyHash() == observed.AssemblyHash())
+
+	// Output:
+	// Roots: 2
+	// Same component: true
+	// Same hash: true
+}
+
+// An AssemblingApplier implements the digitaltwin.Applier interface by
+// assembling the nodes and edges asserted by compilations into a single
+// component, whose roots are the nodes without incoming edges.
+type AssemblingApplier struct {
+	nodes    map[digitaltwin.NodeHash]digitaltwin.Value
+	edges    [][2]digitaltwin.Value
+	incoming map[digitaltwin.NodeHash]bool
+}
+
+func (a *AssemblingApplier) Apply(ctx context.Context, compilation digitaltwin.Compilation) error {
+	return compilation(ctx, a)
+}
+
+// Assemble returns the component assembled from all applied compilations.
+func (a *AssemblingApplier) Assemble() digitaltwin.Assembly {
+	var b digitaltwin.AssemblyBuilder
+	// Roots replaces the roots of the builder, so we collect all of them first.
+	var roots []digitaltwin.Value
+	for h, node := range a.nodes {
+		b.Nodes(node)
+		if !a.incoming[h] {
+			roots = append(roots, node)
+		}
+	}
+	b.Roots(roots...)
+	for _, e := range a.edges {
+		b.Connect(e[0], e[1])
+	}
+	return b.Assemble()
+}
+
+func (a *AssemblingApplier) AssertNode(_ context.Context, node digitaltwin.Value) error {
+	if a.nodes == nil {
+		a.nodes = make(map[digitaltwin.NodeHash]digitaltwin.Value)
+		a.incoming = make(map[digitaltwin.NodeHash]bool)
+	}
+	a.nodes[digitaltwin.MustContentAddress(node)] = node
+	return nil
+}
+
+func (a *AssemblingApplier) RetractNode(context.Context, digitaltwin.Value) error {
+	return errors.New("an AssemblingApplier only asserts")
+}
+
+func (a *AssemblingApplier) AssertEdge(ctx context.Context, from, to digitaltwin.Value) error {
+	_ = a.AssertNode(ctx, from)
+	_ = a.AssertNode(ctx, to)
+	a.edges = append(a.edges, [2]digitaltwin.Value{from, to})
+	a.incoming[digitaltwin.MustContentAddress(to)] = true
+	return nil
+}
+
+func (a *AssemblingApplier) RetractEdges(context.Context, digitaltwin.Value, reflect.Type) (int, error) {
+	return 0, errors.New("an AssemblingApplier only asserts")
+}
+
+func (a *AssemblingApplier) RetractAllEdges(context.Context, digitaltwin.Value) (int, error) {
+	return 0, errors.New("an AssemblingApplier only asserts")
+}
+
+func (a *AssemblingApplier) DetachNode(context.Context, digitaltwin.Value) error {
+	return errors.New("an AssemblingApplier only asserts")
+}
+
+func (a *AssemblingApplier) HasEdge(_ context.Context, from, to digitaltwin.Value) (bool, error) {
+	return slices.Contains(a.edges, [2]digitaltwin.Value{from, to}), nil
+}
+
+func (a *AssemblingApplier) NodeExists(_ context.Context, node digitaltwin.Value) (bool, error) {
+	_, ok := a.nodes[digitaltwin.MustContentAddress(node)]
+	return ok, nil
+}
+
+// A PrintApplier implements the digitaltwin.Applier interface by applying
+// compilations to a PrintGraphWriter.
+type PrintApplier struct{}
+
+func (a PrintApplier) Apply(ctx context.Context, compilation digitaltwin.Compilation) error {
+	return compilation(ctx, PrintGraphWriter{})
+}
@@ -24,10 +24,13 @@ func init() {
 	gob.Register(retractNode{})
 	gob.Register(assertEdge{})
 	gob.Register(retractEdges{})
+	gob.Register(retractAllEdges{})
+	gob.Register(assertAssembly{})
 	gob.Register(assertOneToOne{})
 	gob.Register(assertOneToMany{})
 	gob.Register(assertManyToOne{})
 	gob.Register(assertManyToMany{})
+	gob.Register(barrier{})
 }
 
 // An assertNode is a Step that ensures a specific node exists in the graph.
@@ -86,6 +89,38 @@ func (s assertEdge) Targets() iter.Seq[digitaltwin.Value] {
 	}
 }
 
+// An assertAssembly is a Step that ensures all nodes and edges of an assembly
+// exist in the graph.
+type assertAssembly struct {
+	Nodes []digitaltwin.Value
+	Edges []assertEdge
+}
+
+func (s assertAssembly) Do(ctx context.Context, w digitaltwin.GraphWriter) error {
+	for _, node := range s.Nodes {
+		if err := w.AssertNode(ctx, node); err != nil {
+			return err
+		}
+	}
+	for _, edge := range s.Edges {
+		if err := edge.Do(ctx, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s assertAssembly) Targets() iter.Seq[digitaltwin.Value] {
+	return func(yield func(digitaltwin.Value) bool) {
+		// Every edge connects nodes of the assembly, so yielding the nodes suffices.
+		for _, node := range s.Nodes {
+			if !yield(node) {
+				return
+			}
+		}
+	}
+}
+
 // A retractEdges is a Step that performs a bulk removal of outgoing
 // relationships from a node to nodes of a specific type.
 type retractEdges struct {
@@ -149,6 +184,26 @@ func (s retractEdges) Targets() iter.Seq[digitaltwin.Value] {
 	}
 }
 
+// A retractAllEdges is a Step that performs a bulk removal of all relationships
+// of a node, regardless of the types of the nodes on their other ends.
+type retractAllEdges struct {
+	Node digitaltwin.Value
+}
+
+func (s retractAllEdges) Do(ctx context.Context, w digitaltwin.GraphWriter) error {
+	// Like retractEdges, we disregard the count of retracted edges for now.
+	_, err := w.RetractAllEdges(ctx, s.Node)
+	return err
+}
+
+func (s retractAllEdges) Targets() iter.Seq[digitaltwin.Value] {
+	return func(yield func(digitaltwin.Value) bool) {
+		if !yield(s.Node) {
+			return
+		}
+	}
+}
+
 // assertOneToOne is a Step that asserts a one-to-one relationship between two nodes.
 type assertOneToOne struct {
 	Source digitaltwin.Value
@@ -232,3 +287,17 @@ func (s assertManyToMany) Targets() iter.Seq[digitaltwin.Value] {
 		}
 	}
 }
+
+// A barrier is a Step that marks a point in the recording (e.g. "everything
+// before this is the old state") without mutating the graph. See SplitAtBarriers.
+type barrier struct {
+	Tag string
+}
+
+func (s barrier) Do(context.Context, digitaltwin.GraphWriter) error {
+	return nil
+}
+
+func (s barrier) Targets() iter.Seq[digitaltwin.Value] {
+	return func(func(digitaltwin.Value) bool) {}
+}
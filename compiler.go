@@ -27,6 +27,21 @@ type WhatChangeder interface {
 // See the examples for demonstrations on how to write compilations.
 type Compilation func(ctx context.Context, w GraphWriter) error
 
+// Sequence returns a Compilation that calls the given compilations in order with
+// the same GraphWriter, so an Applier applies them as a single unit (e.g. within
+// a single transaction). It stops at the first compilation that fails, returning
+// its error, so the rest are never called.
+func Sequence(compilations ...Compilation) Compilation {
+	return func(ctx context.Context, w GraphWriter) error {
+		for _, c := range compilations {
+			if err := c(ctx, w); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
 // An Applier applies a Compilation to a graph atomically and concurrently.
 //
 // It is up to the Applier to maintain the graph's data integrity; therefore, any
@@ -89,4 +104,51 @@ type GraphWriter interface {
 	// The exact graph node is uniquely identified by the content-address of the
 	// given Value.
 	RetractEdges(ctx context.Context, node Value, kind reflect.Type) (n int, err error)
+
+	// RetractAllEdges guarantees that by the time it returns with a nil error, the
+	// given node will have had no edges to any other node in the digital-twin's
+	// graph, regardless of their kinds and of the edges' directions. It is the
+	// wildcard counterpart of RetractEdges, retiring the relationships of a node
+	// wholesale while keeping the node itself.
+	//
+	// If no such edges are present, the function has no meaningful effect and a nil
+	// error is returned. Either way, the number of detached relationships (i.e.
+	// removed edges) is returned.
+	//
+	// The exact graph node is uniquely identified by the content-address of the
+	// given Value.
+	RetractAllEdges(ctx context.Context, node Value) (n int, err error)
+
+	// DetachNode guarantees that by the time it returns with a nil error, the
+	// given node will have had no edges, yet will have remained present in the
+	// digital-twin's graph (e.g. for audit), as the root of its own single-node
+	// component. The components of its former neighbours change accordingly.
+	//
+	// Unlike RetractNode, which deletes the node, DetachNode retires it; unlike
+	// RetractAllEdges, it does not report the number of detached relationships,
+	// for compilations that only care about the outcome.
+	//
+	// The exact graph node is uniquely identified by the content-address of the
+	// given Value.
+	DetachNode(ctx context.Context, node Value) (err error)
+
+	// HasEdge reports whether the digital-twin's graph has an edge from the given
+	// node to the other, as of the mutations made so far (including those of the
+	// current compilation). It is the only read operation of a GraphWriter, so
+	// compilations may branch on the current graph (e.g. to avoid a redundant
+	// assertion) rather than blindly assert.
+	//
+	// The edge direction is significant, like in AssertEdge. Either node missing
+	// from the graph means there is no such edge, rather than an error.
+	HasEdge(ctx context.Context, from, to Value) (ok bool, err error)
+
+	// NodeExists reports whether the digital-twin's graph has the given node, as
+	// of the mutations made so far (including those of the current compilation).
+	// Like HasEdge, it lets compilations branch on the current graph, e.g. to
+	// create and initialise a node only if it is absent, which AssertNode (an
+	// upsert) cannot express.
+	//
+	// The exact graph node is uniquely identified by the content-address of the
+	// given Value.
+	NodeExists(ctx context.Context, node Value) (ok bool, err error)
 }
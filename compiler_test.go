@@ -2,6 +2,7 @@ package digitaltwin_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
 
@@ -53,6 +54,35 @@ func ExampleApplier() {
 	// (A) <-/-> digitaltwin_test.dummyNode
 }
 
+// This example composes several compilations into one, which the Applier
+// applies as a single unit. The second compilation fails, so the third is never
+// called.
+func ExampleSequence() {
+	applier := printApplier{}
+
+	assert := func(from, to string) digitaltwin.Compilation {
+		return func(ctx context.Context, w digitaltwin.GraphWriter) error {
+			return w.AssertEdge(ctx, dummyNode{Value: from}, dummyNode{Value: to})
+		}
+	}
+	fail := func(ctx context.Context, w digitaltwin.GraphWriter) error {
+		_ = w.AssertNode(ctx, dummyNode{Value: "C"})
+		return errors.New("invalid node (C)")
+	}
+
+	err := applier.Apply(context.Background(), digitaltwin.Sequence(assert("A", "B"), assert("B", "C")))
+	fmt.Println("error:", err)
+	err = applier.Apply(context.Background(), digitaltwin.Sequence(assert("A", "B"), fail, assert("B", "C")))
+	fmt.Println("error:", err)
+	// Output:
+	// (A) -> (B)
+	// (B) -> (C)
+	// error: <nil>
+	// (A) -> (B)
+	// + (C)
+	// error: invalid node (C)
+}
+
 // A dummyNode demonstrates a node in the graph for the examples in this package.
 // Each digital-twin domain has its own complex types of values.
 type dummyNode struct {
@@ -91,3 +121,23 @@ func (x printApplier) RetractEdges(_ context.Context, node digitaltwin.Value, ki
 	fmt.Println(node, "<-/->", kind)
 	return 0, nil
 }
+
+func (x printApplier) RetractAllEdges(_ context.Context, node digitaltwin.Value) (n int, err error) {
+	fmt.Println(node, "<-/-> *")
+	return 0, nil
+}
+
+func (x printApplier) DetachNode(_ context.Context, node digitaltwin.Value) (err error) {
+	fmt.Println(node, "<-/-> *")
+	return nil
+}
+
+func (x printApplier) HasEdge(_ context.Context, from, to digitaltwin.Value) (ok bool, err error) {
+	fmt.Println(from, "-?->", to)
+	return false, nil
+}
+
+func (x printApplier) NodeExists(_ context.Context, node digitaltwin.Value) (ok bool, err error) {
+	fmt.Println("?", node)
+	return false, nil
+}
@@ -9,8 +9,11 @@ import (
 	"fmt"
 	"hash"
 	"io"
+	"math/rand/v2"
 	"reflect"
+	"slices"
 	"sort"
+	"strings"
 )
 
 // ContentAddresser is the interface describing a node (of a graph) that provides
@@ -25,6 +28,19 @@ type ContentAddresser interface {
 	ContentAddress(h hash.Hash) error
 }
 
+// CanonicalValuer is the interface describing a field (of a node) that provides
+// its own logical representation for hashing, as a string. The reflection-based
+// content-address hashes a CanonicalValuer field as if it were a string field
+// holding its canonical value, regardless of its underlying kind.
+//
+// It suits enum-like types, whose content-address should be stable as their
+// representation evolves. For example, an enum migrated from a named string type
+// to a named int type keeps the content-addresses of its nodes, as long as its
+// CanonicalValue method returns the string the enum used to hold.
+type CanonicalValuer interface {
+	CanonicalValue() string
+}
+
 // ContentAddress returns a NodeHash for the given node.
 //
 // If the node implements ContentAddresser, then the hash is computed using the
@@ -52,6 +68,9 @@ type ContentAddresser interface {
 //   - the Go type reorders its exported fields
 //   - the Go type changes the type of its exported field, but effective values remain
 //     binary-compatible (e.g. int32 to int64) - see below
+//   - the Go type changes the type of its exported string field, but the new type
+//     implements CanonicalValuer returning the old values (e.g. an enum migrated
+//     from string to int)
 //
 // A content-address should be resilient to changes in exported field types,
 // within the same value ranges. For example, changing a field from int32 to
@@ -111,6 +130,13 @@ func reflectiveContentAddress(digest hash.Hash, node reflect.Value) error {
 			continue
 		}
 
+		// enum-like types hash as strings of their canonical value; nil pointers hash
+		// as the canonical value of their zero-value (see below)
+		if x, ok := canonicalValuer(value); ok {
+			digest.Write([]byte(x.CanonicalValue()))
+			continue
+		}
+
 		// fast-path for types that implement encoding.BinaryMarshaler
 		if x, ok := value.Interface().(encoding.BinaryMarshaler); ok {
 			b, err := x.MarshalBinary()
@@ -191,6 +217,16 @@ func reflectiveContentAddress(digest hash.Hash, node reflect.Value) error {
 				return fmt.Errorf("field %s: %w", field.Name, err)
 			}
 		case reflect.Array, reflect.Slice:
+			// slices of enum-like types hash like slices of strings of their
+			// canonical values, and nil elements like nil fields
+			if value.Type().Elem().Implements(reflect.TypeFor[CanonicalValuer]()) {
+				for i := 0; i < value.Len(); i++ {
+					if x, ok := canonicalValuer(value.Index(i)); ok {
+						digest.Write([]byte(x.CanonicalValue()))
+					}
+				}
+				continue
+			}
 			// fast-path for numeric slices and byte-arrays
 			switch value.Type().Elem().Kind() {
 			case reflect.Int:
@@ -217,6 +253,19 @@ func reflectiveContentAddress(digest hash.Hash, node reflect.Value) error {
 				for i := 0; i < value.Len(); i++ {
 					digest.Write([]byte(value.Index(i).String()))
 				}
+			case reflect.Struct, reflect.Pointer, reflect.Interface:
+				// slices of structured sub-records are hashed element by element, in
+				// order, as the order of a slice is semantically significant. we prefix
+				// the number of elements, so elements never run into each other.
+				buf := make([]byte, binary.MaxVarintLen64)
+				n := binary.PutUvarint(buf, uint64(value.Len()))
+				digest.Write(buf[:n])
+				for i := 0; i < value.Len(); i++ {
+					err := elementContentAddress(digest, value.Index(i))
+					if err != nil {
+						return fmt.Errorf("slice field %s: element %d: %w", field.Name, i, err)
+					}
+				}
 			default:
 				// all other slice types may or may not be hashable; although we could
 				// recursively call reflectiveContentAddress, we choose to not do so, as it
@@ -232,6 +281,55 @@ func reflectiveContentAddress(digest hash.Hash, node reflect.Value) error {
 	return nil
 }
 
+// The elementContentAddress function hashes a single element of a slice of
+// structs (or of pointers or interfaces to structs), treating interfaces and
+// pointers just like reflectiveContentAddress treats fields of such types.
+func elementContentAddress(digest hash.Hash, elem reflect.Value) error {
+	if elem.Kind() == reflect.Interface {
+		if elem.IsNil() {
+			return nil // like nil interface fields, see reflectiveContentAddress
+		}
+		elem = elem.Elem()
+	}
+	if elem.Kind() == reflect.Pointer {
+		if elem.IsNil() {
+			elem = reflect.New(elem.Type().Elem()).Elem() // like nil pointer fields
+		} else {
+			elem = elem.Elem()
+		}
+	}
+	if x, ok := elem.Interface().(ContentAddresser); ok {
+		return x.ContentAddress(digest)
+	}
+	if x, ok := elem.Interface().(encoding.BinaryMarshaler); ok {
+		b, err := x.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		digest.Write(b)
+		return nil
+	}
+	if elem.Kind() != reflect.Struct {
+		return fmt.Errorf("unsupported %s %v", elem.Kind(), elem.Type())
+	}
+	return reflectiveContentAddress(digest, elem)
+}
+
+// The canonicalValuer function returns the CanonicalValuer of the given field
+// (or slice element), if it implements one. Calling a value receiver through a
+// nil pointer panics, so we consult a pointer to the zero-value of its type
+// instead, just like reflectiveContentAddress treats nil pointers.
+func canonicalValuer(v reflect.Value) (CanonicalValuer, bool) {
+	if v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Pointer && v.IsNil() {
+		v = reflect.New(v.Type().Elem())
+	}
+	x, ok := v.Interface().(CanonicalValuer)
+	return x, ok
+}
+
 func MustContentAddress(node Value) NodeHash {
 	h, err := ContentAddress(node)
 	if err != nil {
@@ -258,6 +356,18 @@ func (h NodeHash) MarshalText() ([]byte, error)     { return contentAddress(h).M
 func (h *NodeHash) UnmarshalText(text []byte) error { return (*contentAddress)(h).UnmarshalText(text) }
 func (h NodeHash) String() string                   { return "node(" + contentAddress(h).String() + ")" }
 func (h NodeHash) IsZero() bool                     { return contentAddress(h).IsZero() }
+func (h NodeHash) Compare(other NodeHash) int {
+	return contentAddress(h).Compare(contentAddress(other))
+}
+func (h NodeHash) Less(other NodeHash) bool { return h.Compare(other) < 0 }
+
+// ParseNodeHash is the inverse of NodeHash.String. It accepts either the
+// prefixed form (i.e. "node(<hex>)") or the bare hex form returned by
+// NodeHash.MarshalText.
+func ParseNodeHash(s string) (NodeHash, error) {
+	h, err := parseContentAddress("node", s)
+	return NodeHash(h), err
+}
 
 // newNodeHash returns a unique hash based on the type of the given Node. Callers
 // are expected to write to the returned hash.Hash in order to compute their
@@ -294,6 +404,18 @@ func (h *ComponentID) UnmarshalText(text []byte) error {
 }
 func (h ComponentID) String() string { return "component(" + contentAddress(h).String() + ")" }
 func (h ComponentID) IsZero() bool   { return contentAddress(h).IsZero() }
+func (h ComponentID) Compare(other ComponentID) int {
+	return contentAddress(h).Compare(contentAddress(other))
+}
+func (h ComponentID) Less(other ComponentID) bool { return h.Compare(other) < 0 }
+
+// ParseComponentID is the inverse of ComponentID.String. It accepts either the
+// prefixed form (i.e. "component(<hex>)") or the bare hex form returned by
+// ComponentID.MarshalText.
+func ParseComponentID(s string) (ComponentID, error) {
+	h, err := parseContentAddress("component", s)
+	return ComponentID(h), err
+}
 
 // ComponentHash is a consistent hash (i.e., content address) over the entire
 // Assembly. Hence, two assemblies with the same ComponentHash are equal.
@@ -311,6 +433,18 @@ func (h *ComponentHash) UnmarshalText(text []byte) error {
 }
 func (h ComponentHash) String() string { return "assembly(" + contentAddress(h).String() + ")" }
 func (h ComponentHash) IsZero() bool   { return contentAddress(h).IsZero() }
+func (h ComponentHash) Compare(other ComponentHash) int {
+	return contentAddress(h).Compare(contentAddress(other))
+}
+func (h ComponentHash) Less(other ComponentHash) bool { return h.Compare(other) < 0 }
+
+// ParseComponentHash is the inverse of ComponentHash.String. It accepts either
+// the prefixed form (i.e. "assembly(<hex>)") or the bare hex form returned by
+// ComponentHash.MarshalText.
+func ParseComponentHash(s string) (ComponentHash, error) {
+	h, err := parseContentAddress("assembly", s)
+	return ComponentHash(h), err
+}
 
 // ForestHash is a consistent hash (i.e., content address) over different graphs.
 // A graph may contain none, one or more components (i.e., disjoint sub-graphs,
@@ -329,6 +463,18 @@ func (h *ForestHash) UnmarshalText(text []byte) error {
 }
 func (h ForestHash) String() string { return "graph(" + contentAddress(h).String() + ")" }
 func (h ForestHash) IsZero() bool   { return contentAddress(h).IsZero() }
+func (h ForestHash) Compare(other ForestHash) int {
+	return contentAddress(h).Compare(contentAddress(other))
+}
+func (h ForestHash) Less(other ForestHash) bool { return h.Compare(other) < 0 }
+
+// ParseForestHash is the inverse of ForestHash.String. It accepts either the
+// prefixed form (i.e. "graph(<hex>)") or the bare hex form returned by
+// ForestHash.MarshalText.
+func ParseForestHash(s string) (ForestHash, error) {
+	h, err := parseContentAddress("graph", s)
+	return ForestHash(h), err
+}
 
 // HashComponents digests the given components into a ForestHash.
 // This function provides a different API than ComputeForestHash, but is
@@ -341,9 +487,7 @@ func HashComponents(components map[ComponentID]ComponentHash) ForestHash {
 
 	// lexicographic sort keeps a reproducible hash based on the content of the
 	// components, without relying on the order of the input slice
-	sort.Slice(refs, func(i, j int) bool {
-		return bytes.Compare(refs[i][:], refs[j][:]) < 0
-	})
+	slices.SortFunc(refs, ComponentID.Compare)
 
 	h := sha1.New()
 	for _, ref := range refs {
@@ -353,6 +497,150 @@ func HashComponents(components map[ComponentID]ComponentHash) ForestHash {
 	return ForestHash(h.Sum(nil))
 }
 
+// A ForestHasher maintains the ForestHash of a changing set of components. It
+// produces the same ForestHash as HashComponents over the same components, but
+// keeps its components sorted across calls instead of sorting them every time.
+//
+// Add and Remove take logarithmic time: the components are kept in a treap,
+// a binary search tree balanced by random priorities. Sum is cached until the
+// next modification; otherwise, it still hashes every component because the
+// ForestHash digests all components in order. An order-independent combiner
+// (e.g. XOR-ing the component hashes) would avoid that, but would not agree
+// with HashComponents.
+//
+// The zero value is ready to use. A ForestHasher is not safe for concurrent
+// use.
+type ForestHasher struct {
+	root       *forestNode // sorted lexicographically, see HashComponents
+	components map[ComponentID]*forestNode
+	sum        ForestHash
+	valid      bool // whether sum is up-to-date with the components
+}
+
+// A forestNode is a component in the treap of a ForestHasher. Nodes are ordered
+// by their id as a binary search tree, and by their priority as a max-heap.
+type forestNode struct {
+	id          ComponentID
+	hash        ComponentHash
+	priority    uint64
+	left, right *forestNode
+}
+
+// Add adds the given component to the forest, or replaces its hash if the
+// component is already part of it.
+func (f *ForestHasher) Add(id ComponentID, hash ComponentHash) {
+	if f.components == nil {
+		f.components = make(map[ComponentID]*forestNode)
+	}
+	if n, exists := f.components[id]; exists {
+		n.hash = hash
+	} else {
+		n = &forestNode{id: id, hash: hash, priority: rand.Uint64()}
+		f.root = f.root.insert(n)
+		f.components[id] = n
+	}
+	f.valid = false
+}
+
+// Remove removes the given component from the forest. Removing a component that
+// is not part of the forest has no effect.
+func (f *ForestHasher) Remove(id ComponentID) {
+	if _, exists := f.components[id]; !exists {
+		return
+	}
+	delete(f.components, id)
+	f.root = f.root.remove(id)
+	f.valid = false
+}
+
+// Len returns the number of components in the forest.
+func (f *ForestHasher) Len() int {
+	return len(f.components)
+}
+
+// Sum returns the ForestHash of the components currently in the forest.
+func (f *ForestHasher) Sum() ForestHash {
+	if !f.valid {
+		h := sha1.New()
+		f.root.walk(func(n *forestNode) { h.Write(n.hash[:]) })
+		f.sum = ForestHash(h.Sum(nil))
+		f.valid = true
+	}
+	return f.sum
+}
+
+// insert adds n, which must not already be part of the treap rooted at t, and
+// returns the new root.
+func (t *forestNode) insert(n *forestNode) *forestNode {
+	switch {
+	case t == nil:
+		return n
+	case n.priority > t.priority:
+		n.left, n.right = t.split(n.id)
+		return n
+	case n.id.Less(t.id):
+		t.left = t.left.insert(n)
+	default:
+		t.right = t.right.insert(n)
+	}
+	return t
+}
+
+// remove removes the node with the given id from the treap rooted at t, and
+// returns the new root.
+func (t *forestNode) remove(id ComponentID) *forestNode {
+	switch c := id.Compare(t.id); {
+	case c < 0:
+		t.left = t.left.remove(id)
+	case c > 0:
+		t.right = t.right.remove(id)
+	default:
+		return t.left.merge(t.right)
+	}
+	return t
+}
+
+// split partitions the treap rooted at t into the nodes ordered before id and
+// the nodes ordered after it.
+func (t *forestNode) split(id ComponentID) (before, after *forestNode) {
+	if t == nil {
+		return nil, nil
+	}
+	if t.id.Less(id) {
+		t.right, after = t.right.split(id)
+		return t, after
+	}
+	before, t.left = t.left.split(id)
+	return before, t
+}
+
+// merge joins the treap rooted at t with the treap rooted at after, whose nodes
+// are all ordered after the nodes of t.
+func (t *forestNode) merge(after *forestNode) *forestNode {
+	switch {
+	case t == nil:
+		return after
+	case after == nil:
+		return t
+	case t.priority > after.priority:
+		t.right = t.right.merge(after)
+		return t
+	default:
+		after.left = t.merge(after.left)
+		return after
+	}
+}
+
+// walk calls fn on every node of the treap rooted at t, in order.
+func (t *forestNode) walk(fn func(*forestNode)) {
+	if t == nil {
+		return
+	}
+	t.left.walk(fn)
+	fn(t)
+	t.right.walk(fn)
+}
+
 // contentAddress is a consistent hash primitive serving as the base for strongly
 // typed hashes, like NodeHash, ForestHash, and others here-forth.
 type contentAddress [sha1.Size]byte
@@ -382,3 +670,30 @@ func (h contentAddress) String() string {
 func (h contentAddress) IsZero() bool {
 	return h == contentAddress{}
 }
+
+// Compare returns an integer comparing h and other lexicographically (by their
+// bytes). The result is 0 if h == other, -1 if h < other, and +1 if h > other.
+func (h contentAddress) Compare(other contentAddress) int {
+	return bytes.Compare(h[:], other[:])
+}
+
+// parseContentAddress parses the String form of the strongly typed hashes, whose
+// prefix is given as kind (e.g. "node" for "node(<hex>)"). The bare hex form
+// (without the prefix and parenthesis) is accepted as well.
+func parseContentAddress(kind, s string) (h contentAddress, err error) {
+	if inner, ok := strings.CutPrefix(s, kind+"("); ok {
+		s, ok = strings.CutSuffix(inner, ")")
+		if !ok {
+			return h, fmt.Errorf("parse %s: missing closing parenthesis", kind)
+		}
+	}
+	// hex.Decode does not guard against overflowing its destination, so we check
+	// the length before calling UnmarshalText.
+	if len(s) != hex.EncodedLen(len(h)) {
+		return h, fmt.Errorf("parse %s: got %d hex digits, want %d", kind, len(s), hex.EncodedLen(len(h)))
+	}
+	if err := h.UnmarshalText([]byte(s)); err != nil {
+		return contentAddress{}, fmt.Errorf("parse %s: %w", kind, err)
+	}
+	return h, nil
+}
@@ -6,9 +6,12 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"math/rand/v2"
 	"reflect"
 	"runtime"
+	"slices"
 	"sort"
+	"strconv"
 	"testing"
 )
 
@@ -90,6 +93,68 @@ func TestContentAddress(t *testing.T) {
 	}
 }
 
+func TestContentAddress_scalar(t *testing.T) {
+	type name string
+
+	tests := []struct {
+		Name        string
+		Left, Right Value
+		Equals      bool
+	}{
+		{
+			Name:   "types=same,values=same",
+			Left:   Scalar[string]{Value: "left"},
+			Right:  Scalar[string]{Value: "left"},
+			Equals: true,
+		},
+		{
+			Name:   "types=same,values=different",
+			Left:   Scalar[int]{Value: 1},
+			Right:  Scalar[int]{Value: 2},
+			Equals: false,
+		},
+		{
+			Name:   "types=named,values=same",
+			Left:   Scalar[string]{Value: "left"},
+			Right:  Scalar[name]{Value: "left"},
+			Equals: false,
+		},
+		{
+			Name:   "types=different,values=zero",
+			Left:   Scalar[int]{},
+			Right:  Scalar[int64]{},
+			Equals: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			l, err := ContentAddress(tt.Left)
+			if err != nil {
+				t.Fatalf("ContentAddress(%#v): %v", tt.Left, err)
+			}
+			r, err := ContentAddress(tt.Right)
+			if err != nil {
+				t.Fatalf("ContentAddress(%#v): %v", tt.Right, err)
+			}
+			if (l == r) != tt.Equals {
+				t.Errorf("ContentAddress(%#v) == ContentAddress(%#v) = %v, want %v", tt.Left, tt.Right, l == r, tt.Equals)
+			}
+		})
+	}
+
+	// The content-address of a Scalar is that of any other struct with a single
+	// field, so it is as stable as theirs.
+	h := sha1.New()
+	h.Write([]byte("github.com/go-digitaltwin/go-digitaltwin"))
+	h.Write([]byte("Scalar[string]"))
+	h.Write([]byte("Value"))
+	h.Write([]byte("left"))
+	if got, want := MustContentAddress(Scalar[string]{Value: "left"}), NodeHash(h.Sum(nil)); got != want {
+		t.Errorf("ContentAddress(Scalar[string]) = %v, want %v", got, want)
+	}
+}
+
 // newNodeHash salts the hash with the runtime type of the value.
 func TestContentAddress_typePreamble(t *testing.T) {
 	type (
@@ -247,6 +312,168 @@ func TestContentAddress_reflectionTypes(t *testing.T) {
 	}
 }
 
+func TestContentAddress_sliceOfStructs(t *testing.T) {
+	type record struct {
+		A int
+		B string
+	}
+	type node struct {
+		InformationElement
+		Records []record
+	}
+	hash := func(records ...record) NodeHash {
+		t.Helper()
+		h, err := ContentAddress(node{Records: records})
+		if err != nil {
+			t.Fatalf("ContentAddress(%v): %v", records, err)
+		}
+		return h
+	}
+
+	base := hash(record{A: 1, B: "x"}, record{A: 2, B: "y"})
+	if again := hash(record{A: 1, B: "x"}, record{A: 2, B: "y"}); again != base {
+		t.Errorf("ContentAddress() is not deterministic: %v != %v", again, base)
+	}
+	tests := []struct {
+		name    string
+		records []record
+	}{
+		{name: "Reordered", records: []record{{A: 2, B: "y"}, {A: 1, B: "x"}}},
+		{name: "ChangedInt", records: []record{{A: 1, B: "x"}, {A: 3, B: "y"}}},
+		{name: "ChangedString", records: []record{{A: 1, B: "x"}, {A: 2, B: "z"}}},
+		{name: "Truncated", records: []record{{A: 1, B: "x"}}},
+		{name: "Empty", records: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if h := hash(tt.records...); h == base {
+				t.Errorf("ContentAddress(%v) = %v, same as the original records", tt.records, h)
+			}
+		})
+	}
+
+	// Elements behind pointers and interfaces hash like the records they hold,
+	// with nil pointers hashing like zero-valued records.
+	pointers, err := ContentAddress(genericNode{V: []*record{{A: 1, B: "x"}, nil}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := ContentAddress(genericNode{V: []record{{A: 1, B: "x"}, {}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pointers != values {
+		t.Errorf("ContentAddress([]*record) = %v, want %v (as []record)", pointers, values)
+	}
+	interfaces, err := ContentAddress(genericNode{V: []any{record{A: 1, B: "x"}, record{}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if interfaces != values {
+		t.Errorf("ContentAddress([]any) = %v, want %v (as []record)", interfaces, values)
+	}
+
+	// Elements must still be structs.
+	if _, err := ContentAddress(genericNode{V: []any{1}}); err == nil {
+		t.Errorf("ContentAddress([]any{1}) = nil; want error")
+	}
+}
+
+// An enum migrated from a named string type to a named int type should keep
+// the content-address of its nodes, as long as it implements CanonicalValuer.
+//
+// for this test we call reflectiveContentAddress directly to avoid the
+// type-preamble that newNodeHash adds, as the migrated nodes are different Go
+// types in this test (unlike in real migrations).
+func TestContentAddress_canonicalValue(t *testing.T) {
+	type (
+		stringStatus struct {
+			Status   statusString
+			Statuses []statusString
+		}
+		intStatus struct {
+			Status   statusInt
+			Statuses []statusInt
+		}
+		rawIntStatus struct {
+			Status   int
+			Statuses []int
+		}
+	)
+	hash := func(v any) string {
+		t.Helper()
+		h := sha1.New()
+		if err := reflectiveContentAddress(h, reflect.ValueOf(v)); err != nil {
+			t.Fatalf("reflectiveContentAddress(%#v): %v", v, err)
+		}
+		return hex.EncodeToString(h.Sum(nil))
+	}
+
+	before := hash(stringStatus{Status: "active", Statuses: []statusString{"active", "retired"}})
+	after := hash(intStatus{Status: statusActive, Statuses: []statusInt{statusActive, statusRetired}})
+	if after != before {
+		t.Errorf("ContentAddress() of the migrated enum = %v, want %v", after, before)
+	}
+	// Without CanonicalValue, the migration changes the content-address.
+	if raw := hash(rawIntStatus{Status: int(statusActive), Statuses: []int{int(statusActive), int(statusRetired)}}); raw == before {
+		t.Errorf("ContentAddress() of the plain int = %v, same as the original enum", raw)
+	}
+	// Different logical values still hash differently.
+	if other := hash(intStatus{Status: statusRetired, Statuses: []statusInt{statusActive, statusRetired}}); other == after {
+		t.Errorf("ContentAddress() of a different status = %v, same as the original", other)
+	}
+}
+
+// Nil pointers to enum-like types hash as the canonical value of their
+// zero-value, both as fields and as slice elements, rather than panicking.
+func TestContentAddress_canonicalValueNil(t *testing.T) {
+	type (
+		pointerStatus struct {
+			Status   *statusInt
+			Statuses []*statusInt
+		}
+		intStatus struct {
+			Status   statusInt
+			Statuses []statusInt
+		}
+	)
+	hash := func(v any) string {
+		t.Helper()
+		h := sha1.New()
+		if err := reflectiveContentAddress(h, reflect.ValueOf(v)); err != nil {
+			t.Fatalf("reflectiveContentAddress(%#v): %v", v, err)
+		}
+		return hex.EncodeToString(h.Sum(nil))
+	}
+
+	retired := statusRetired
+	got := hash(pointerStatus{Status: nil, Statuses: []*statusInt{nil, &retired, nil}})
+	want := hash(intStatus{Statuses: []statusInt{0, statusRetired, 0}})
+	if got != want {
+		t.Errorf("ContentAddress() with nil pointers = %v, want %v (as zero-values)", got, want)
+	}
+}
+
+type statusString string
+
+type statusInt int
+
+const (
+	statusActive statusInt = iota + 1
+	statusRetired
+)
+
+func (s statusInt) CanonicalValue() string {
+	switch s {
+	case statusActive:
+		return "active"
+	case statusRetired:
+		return "retired"
+	default:
+		return strconv.Itoa(int(s))
+	}
+}
+
 // genericNode is a Value with a single field of the type 'any' to help test the
 // ContentAddress implementation.
 type genericNode struct {
@@ -388,3 +615,228 @@ func BenchmarkHashComponents(b *testing.B) {
 		})
 	}
 }
+
+// Each hash type parses its own String and MarshalText forms, and rejects
+// malformed input.
+func TestParseContentAddress(t *testing.T) {
+	raw := contentAddress{0xde, 0xad, 0xbe, 0xef, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	bare := raw.String()
+
+	// Every parser is adapted to return the underlying contentAddress so that all
+	// the hash types share the same test-cases.
+	parsers := []struct {
+		name   string
+		prefix string
+		parse  func(string) (contentAddress, error)
+		format func(contentAddress) string
+	}{
+		{
+			name:   "NodeHash",
+			prefix: "node",
+			parse: func(s string) (contentAddress, error) {
+				h, err := ParseNodeHash(s)
+				return contentAddress(h), err
+			},
+			format: func(h contentAddress) string { return NodeHash(h).String() },
+		},
+		{
+			name:   "ComponentID",
+			prefix: "component",
+			parse: func(s string) (contentAddress, error) {
+				h, err := ParseComponentID(s)
+				return contentAddress(h), err
+			},
+			format: func(h contentAddress) string { return ComponentID(h).String() },
+		},
+		{
+			name:   "ComponentHash",
+			prefix: "assembly",
+			parse: func(s string) (contentAddress, error) {
+				h, err := ParseComponentHash(s)
+				return contentAddress(h), err
+			},
+			format: func(h contentAddress) string { return ComponentHash(h).String() },
+		},
+		{
+			name:   "ForestHash",
+			prefix: "graph",
+			parse: func(s string) (contentAddress, error) {
+				h, err := ParseForestHash(s)
+				return contentAddress(h), err
+			},
+			format: func(h contentAddress) string { return ForestHash(h).String() },
+		},
+	}
+
+	for _, p := range parsers {
+		t.Run(p.name, func(t *testing.T) {
+			valid := []string{
+				p.format(raw), // the String form, e.g. "node(<hex>)"
+				bare,          // the MarshalText form
+			}
+			for _, s := range valid {
+				got, err := p.parse(s)
+				if err != nil {
+					t.Errorf("Parse%s(%q) = %v", p.name, s, err)
+					continue
+				}
+				if got != raw {
+					t.Errorf("Parse%s(%q) = %v, want %v", p.name, s, got, raw)
+				}
+			}
+
+			malformed := []string{
+				"",
+				p.prefix + "()",
+				p.prefix + "(" + bare,           // missing closing parenthesis
+				"other(" + bare + ")",           // another type's prefix
+				bare[:len(bare)-2],              // too short
+				bare + "00",                     // too long
+				"zz" + bare[2:],                 // not hex
+				p.prefix + "(" + bare[2:] + ")", // too short, prefixed
+			}
+			for _, s := range malformed {
+				if got, err := p.parse(s); err == nil {
+					t.Errorf("Parse%s(%q) = %v, want error", p.name, s, got)
+				}
+			}
+		})
+	}
+}
+
+// The ordering of every hash type matches bytes.Compare over its underlying
+// array.
+func TestContentAddress_Compare(t *testing.T) {
+	hashes := []contentAddress{
+		{},
+		{0},
+		{1},
+		{0, 1},
+		{0xff},
+		{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1},
+	}
+	for i := 0; i < 16; i++ {
+		hashes = append(hashes, contentAddress(sha1.Sum([]byte{byte(i)})))
+	}
+
+	for _, l := range hashes {
+		for _, r := range hashes {
+			want := bytes.Compare(l[:], r[:])
+			got := []int{
+				NodeHash(l).Compare(NodeHash(r)),
+				ComponentID(l).Compare(ComponentID(r)),
+				ComponentHash(l).Compare(ComponentHash(r)),
+				ForestHash(l).Compare(ForestHash(r)),
+			}
+			for _, c := range got {
+				if c != want {
+					t.Errorf("Compare(%v, %v) = %v, want %v", l, r, c, want)
+				}
+			}
+			less := []bool{
+				NodeHash(l).Less(NodeHash(r)),
+				ComponentID(l).Less(ComponentID(r)),
+				ComponentHash(l).Less(ComponentHash(r)),
+				ForestHash(l).Less(ForestHash(r)),
+			}
+			for _, b := range less {
+				if b != (want < 0) {
+					t.Errorf("Less(%v, %v) = %v, want %v", l, r, b, want < 0)
+				}
+			}
+		}
+	}
+
+	// Sorting with the method expressions agrees with sorting the raw bytes.
+	ids := make([]ComponentID, len(hashes))
+	for i, h := range hashes {
+		ids[i] = ComponentID(h)
+	}
+	slices.SortFunc(ids, ComponentID.Compare)
+	if !sort.SliceIsSorted(ids, func(i, j int) bool { return bytes.Compare(ids[i][:], ids[j][:]) < 0 }) {
+		t.Errorf("slices.SortFunc(ids, ComponentID.Compare) is not sorted by bytes.Compare: %v", ids)
+	}
+}
+
+// A ForestHasher must always agree with HashComponents over the same
+// components, regardless of the sequence of modifications leading to them.
+func TestForestHasher(t *testing.T) {
+	var zero ForestHasher
+	if got, want := zero.Sum(), HashComponents(nil); got != want {
+		t.Errorf("ForestHasher{}.Sum() = %v, want %v", got, want)
+	}
+
+	// A small pool of ids makes re-adding and removing existing components likely.
+	ids := make([]ComponentID, 64)
+	for i := range ids {
+		ids[i] = ComponentID(sha1.Sum([]byte(fmt.Sprint("id", i))))
+	}
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	for seq := 0; seq < 16; seq++ {
+		var f ForestHasher
+		components := make(map[ComponentID]ComponentHash)
+		for step := 0; step < 256; step++ {
+			id := ids[rng.IntN(len(ids))]
+			if rng.IntN(3) == 0 {
+				f.Remove(id)
+				delete(components, id)
+			} else {
+				hash := ComponentHash(sha1.Sum([]byte(fmt.Sprint("hash", rng.Int()))))
+				f.Add(id, hash)
+				components[id] = hash
+			}
+
+			if got, want := f.Sum(), HashComponents(components); got != want {
+				t.Fatalf("sequence #%d, step #%d: Sum() = %v, want %v", seq, step, got, want)
+			}
+			if f.Len() != len(components) {
+				t.Fatalf("sequence #%d, step #%d: Len() = %v, want %v", seq, step, f.Len(), len(components))
+			}
+		}
+	}
+}
+
+func BenchmarkForestHasher(b *testing.B) {
+	// Component IDs are big-endian counters, so they sort in the order they are
+	// added.
+	componentID := func(i int) (id ComponentID) {
+		binary.BigEndian.PutUint64(id[:], uint64(i))
+		return id
+	}
+
+	for _, size := range []int{128, 4096, 65536} {
+		var f ForestHasher
+		assemblies := make(map[ComponentID]ComponentHash, size)
+		for i := 0; i < size; i++ {
+			var hash ComponentHash
+			binary.BigEndian.PutUint64(hash[:], uint64(i))
+
+			f.Add(componentID(i), hash)
+			assemblies[componentID(i)] = hash
+		}
+
+		// Each iteration modifies a handful of components before hashing the forest,
+		// just like consecutive sweeps of a digital twin.
+		const changes = 8
+		b.Run(fmt.Sprintf("Incremental(len=%d)", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for c := 0; c < changes; c++ {
+					f.Add(componentID((i*changes+c)%size), ComponentHash{byte(i)})
+				}
+				f.Sum()
+			}
+			b.ReportAllocs()
+		})
+		b.Run(fmt.Sprintf("HashComponents(len=%d)", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for c := 0; c < changes; c++ {
+					assemblies[componentID((i*changes+c)%size)] = ComponentHash{byte(i)}
+				}
+				HashComponents(assemblies)
+			}
+			b.ReportAllocs()
+		})
+	}
+}
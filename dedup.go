@@ -0,0 +1,80 @@
+package digitaltwin
+
+import (
+	"container/list"
+	"sync"
+)
+
+// A dedupWindow remembers the most recently published ComponentChanged
+// notifications, forgetting the least recently published ones once it holds
+// more than its size; see WithDedupWindow.
+//
+// The methods of a nil dedupWindow are no-ops, so callers need not check whether
+// the disassembler was configured with one.
+//
+// A dedupWindow is safe for concurrent-use.
+type dedupWindow struct {
+	size    int
+	entries map[dedupKey]*list.Element // Elements hold a dedupKey.
+	recency list.List                  // Most recently published first.
+	mu      sync.Mutex
+}
+
+// A dedupKey identifies a ComponentChanged notification: the same change of the
+// same component, as part of the same graph change.
+type dedupKey struct {
+	id    ComponentID
+	hash  ComponentHash
+	graph ForestHash
+}
+
+// The keyOf function returns the dedupKey of the given notification.
+func keyOf(c ComponentChanged) dedupKey {
+	return dedupKey{id: c.AssemblyID(), hash: c.AssemblyHash(), graph: c.GraphHash}
+}
+
+// The newDedupWindow function returns an empty dedupWindow of the given size,
+// which must be positive.
+func newDedupWindow(size int) *dedupWindow {
+	return &dedupWindow{size: size, entries: make(map[dedupKey]*list.Element, size)}
+}
+
+// The tryAdd method remembers the given key as published, forgetting the least
+// recently published key if the window is full. It reports false if the key was
+// already published within the window, marking it as the most recently
+// published instead.
+//
+// Checking and adding the key at once lets concurrent duplicates agree on which
+// of them publishes the notification.
+func (w *dedupWindow) tryAdd(key dedupKey) bool {
+	if w == nil {
+		return true
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if e, ok := w.entries[key]; ok {
+		w.recency.MoveToFront(e)
+		return false
+	}
+	w.entries[key] = w.recency.PushFront(key)
+	if w.recency.Len() > w.size {
+		oldest := w.recency.Back()
+		w.recency.Remove(oldest)
+		delete(w.entries, oldest.Value.(dedupKey))
+	}
+	return true
+}
+
+// The remove method forgets the given key, e.g. because publishing its
+// notification failed after tryAdd, so a redelivery publishes it again.
+func (w *dedupWindow) remove(key dedupKey) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if e, ok := w.entries[key]; ok {
+		w.recency.Remove(e)
+		delete(w.entries, key)
+	}
+}
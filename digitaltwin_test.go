@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"encoding/gob"
 	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 var marshalTests = []struct {
@@ -86,6 +88,474 @@ var marshalTests = []struct {
 	},
 }
 
+func TestGraphChanged_Filter(t *testing.T) {
+	everything := marshalTests[len(marshalTests)-1].Value
+	keep := func(a Assembly) bool {
+		for v := range a.Values() {
+			if v == (testValue{Value: "51"}) {
+				return true
+			}
+		}
+		return false
+	}
+
+	want := GraphChanged{
+		GraphBefore: everything.GraphBefore,
+		Updated:     []AssemblyUpdated{everything.Updated[1]},
+		GraphAfter:  everything.GraphAfter,
+	}
+	if diff := cmp.Diff(want, everything.Filter(keep)); diff != "" {
+		t.Errorf("Filter() mismatch (-want +got):\n%s", diff)
+	}
+	// The original changeset must remain intact.
+	if len(everything.Created) != 3 || len(everything.Updated) != 3 || len(everything.Removed) != 1 {
+		t.Errorf("Filter() modified the original changeset: %+v", everything)
+	}
+}
+
+func TestGraphChanged_Follows(t *testing.T) {
+	empty := ComputeForestHash()
+	tests := []struct {
+		name       string
+		prev, next GraphChanged
+		want       bool
+	}{
+		{
+			name: "Continuous",
+			prev: GraphChanged{GraphBefore: ForestHash{1}, GraphAfter: ForestHash{2}},
+			next: GraphChanged{GraphBefore: ForestHash{2}, GraphAfter: ForestHash{3}},
+			want: true,
+		},
+		{
+			name: "Gap",
+			prev: GraphChanged{GraphBefore: ForestHash{1}, GraphAfter: ForestHash{2}},
+			next: GraphChanged{GraphBefore: ForestHash{3}, GraphAfter: ForestHash{4}},
+			want: false,
+		},
+		{
+			name: "Reordered",
+			prev: GraphChanged{GraphBefore: ForestHash{2}, GraphAfter: ForestHash{3}},
+			next: GraphChanged{GraphBefore: ForestHash{1}, GraphAfter: ForestHash{2}},
+			want: false,
+		},
+		{
+			name: "ZeroBaseline",
+			prev: GraphChanged{},
+			next: GraphChanged{GraphBefore: ForestHash{1}, GraphAfter: ForestHash{2}},
+			want: true,
+		},
+		{
+			name: "EmptyGraph",
+			prev: GraphChanged{GraphBefore: ForestHash{1}, GraphAfter: empty},
+			next: GraphChanged{GraphBefore: ForestHash{}, GraphAfter: ForestHash{2}},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.next.Follows(tt.prev); got != tt.want {
+				t.Errorf("Follows() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+	if empty == (ForestHash{}) {
+		t.Errorf("ComputeForestHash() of an empty graph is the zero ForestHash")
+	}
+}
+
+func TestCoalesceChanges(t *testing.T) {
+	// The component function returns an assembly of a root connected to the given
+	// leaf, so components of the same root share an ID but not a hash.
+	component := func(root, leaf string) Assembly {
+		var b AssemblyBuilder
+		b.Roots(testValue{Value: root})
+		b.Connect(testValue{Value: root}, testValue{Value: leaf})
+		return b.Assemble()
+	}
+	v1, v2, v3 := component("a", "1"), component("a", "2"), component("a", "3")
+	other := component("b", "1")
+	// The forest function returns arbitrary but distinct graph hashes.
+	forest := func(i byte) ForestHash { return ForestHash{i} }
+
+	tests := []struct {
+		name    string
+		changes []GraphChanged
+		want    GraphChanged
+	}{
+		{
+			name: "CreateUpdate",
+			changes: []GraphChanged{
+				{GraphBefore: forest(0), Created: []AssemblyCreated{{v1}}, GraphAfter: forest(1)},
+				{GraphBefore: forest(1), Updated: []AssemblyUpdated{{Baseline: v1.AssemblyHash(), Assembly: v2}}, GraphAfter: forest(2)},
+			},
+			want: GraphChanged{GraphBefore: forest(0), Created: []AssemblyCreated{{v2}}, GraphAfter: forest(2)},
+		},
+		{
+			name: "CreateRemove",
+			changes: []GraphChanged{
+				{GraphBefore: forest(0), Created: []AssemblyCreated{{v1}}, GraphAfter: forest(1)},
+				{GraphBefore: forest(1), Removed: []AssemblyRemoved{{v1.AssemblyID(), v1.AssemblyHash()}}, GraphAfter: forest(0)},
+			},
+			want: GraphChanged{GraphBefore: forest(0), GraphAfter: forest(0)},
+		},
+		{
+			name: "UpdateUpdate",
+			changes: []GraphChanged{
+				{GraphBefore: forest(0), Updated: []AssemblyUpdated{{Baseline: v1.AssemblyHash(), Assembly: v2}}, Created: []AssemblyCreated{{other}}, GraphAfter: forest(1)},
+				{GraphBefore: forest(1), Updated: []AssemblyUpdated{{Baseline: v2.AssemblyHash(), Assembly: v3}}, GraphAfter: forest(2)},
+			},
+			want: GraphChanged{
+				GraphBefore: forest(0),
+				Created:     []AssemblyCreated{{other}},
+				Updated:     []AssemblyUpdated{{Baseline: v1.AssemblyHash(), Assembly: v3}},
+				GraphAfter:  forest(2),
+			},
+		},
+		{
+			name: "UpdateRemove",
+			changes: []GraphChanged{
+				{GraphBefore: forest(0), Updated: []AssemblyUpdated{{Baseline: v1.AssemblyHash(), Assembly: v2}}, GraphAfter: forest(1)},
+				{GraphBefore: forest(1), Removed: []AssemblyRemoved{{v2.AssemblyID(), v2.AssemblyHash()}}, GraphAfter: forest(2)},
+			},
+			want: GraphChanged{GraphBefore: forest(0), Removed: []AssemblyRemoved{{v1.AssemblyID(), v1.AssemblyHash()}}, GraphAfter: forest(2)},
+		},
+		{
+			name: "RemoveCreate",
+			changes: []GraphChanged{
+				{GraphBefore: forest(0), Removed: []AssemblyRemoved{{v1.AssemblyID(), v1.AssemblyHash()}}, GraphAfter: forest(1)},
+				{GraphBefore: forest(1), Created: []AssemblyCreated{{v2}}, GraphAfter: forest(2)},
+			},
+			want: GraphChanged{GraphBefore: forest(0), Updated: []AssemblyUpdated{{Baseline: v1.AssemblyHash(), Assembly: v2}}, GraphAfter: forest(2)},
+		},
+		{
+			name: "UpdateRevert",
+			changes: []GraphChanged{
+				{GraphBefore: forest(0), Updated: []AssemblyUpdated{{Baseline: v1.AssemblyHash(), Assembly: v2}}, GraphAfter: forest(1)},
+				{GraphBefore: forest(1), Updated: []AssemblyUpdated{{Baseline: v2.AssemblyHash(), Assembly: v1}}, GraphAfter: forest(0)},
+			},
+			want: GraphChanged{GraphBefore: forest(0), GraphAfter: forest(0)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CoalesceChanges(tt.changes...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("CoalesceChanges() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	errorTests := []struct {
+		name    string
+		changes []GraphChanged
+	}{
+		{name: "NoChanges"},
+		{
+			name: "Discontinuity",
+			changes: []GraphChanged{
+				{GraphBefore: forest(0), Created: []AssemblyCreated{{v1}}, GraphAfter: forest(1)},
+				{GraphBefore: forest(2), Created: []AssemblyCreated{{other}}, GraphAfter: forest(3)},
+			},
+		},
+		{
+			name: "UpdateRemoved",
+			changes: []GraphChanged{
+				{GraphBefore: forest(0), Removed: []AssemblyRemoved{{v1.AssemblyID(), v1.AssemblyHash()}}, GraphAfter: forest(1)},
+				{GraphBefore: forest(1), Updated: []AssemblyUpdated{{Baseline: v1.AssemblyHash(), Assembly: v2}}, GraphAfter: forest(2)},
+			},
+		},
+		{
+			name: "CreateExisting",
+			changes: []GraphChanged{
+				{GraphBefore: forest(0), Created: []AssemblyCreated{{v1}}, GraphAfter: forest(1)},
+				{GraphBefore: forest(1), Created: []AssemblyCreated{{v2}}, GraphAfter: forest(2)},
+			},
+		},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := CoalesceChanges(tt.changes...); err == nil {
+				t.Errorf("CoalesceChanges() = %+v, want an error", got)
+			}
+		})
+	}
+}
+
+func TestFormatChangesVerbose(t *testing.T) {
+	// The tree function returns an assembly of the given edges, rooted at "a".
+	tree := func(edges ...string) Assembly {
+		var b AssemblyBuilder
+		b.Roots(testValue{Value: "a"})
+		for _, e := range edges {
+			from, to, _ := strings.Cut(e, "->")
+			b.Connect(testValue{Value: from}, testValue{Value: to})
+		}
+		return b.Assemble()
+	}
+	baseline := tree("a->b", "a->c")
+	updated := tree("a->b", "b->d")
+	changes := GraphChanged{
+		GraphBefore: ForestHash{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		Updated:     []AssemblyUpdated{{Assembly: updated, Baseline: baseline.AssemblyHash()}},
+		GraphAfter:  ForestHash{9, 8, 7, 6, 5, 4, 3, 2, 1, 0},
+	}
+
+	t.Run("Baseline", func(t *testing.T) {
+		lookup := func(id ComponentID) (Assembly, bool) {
+			return baseline, id == baseline.AssemblyID()
+		}
+		want := strings.Join([]string{
+			"\tbaseline snapshot: " + changes.GraphBefore.String(),
+			"\t* " + updated.AssemblyID().String() + " | " + updated.AssemblyHash().String(),
+			"\t  - {{} c}",
+			"\t  + {{} d}",
+			"\t  - {{} a} -> {{} c}",
+			"\t  + {{} b} -> {{} d}",
+			"\tcurrent snapshot: " + changes.GraphAfter.String(),
+		}, "\n") + "\n"
+		if diff := cmp.Diff(want, FormatChangesVerbose(changes, "\t", lookup)); diff != "" {
+			t.Errorf("FormatChangesVerbose() mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("NoBaseline", func(t *testing.T) {
+		// Without a baseline, there is nothing to diff against, so the changeset is
+		// rendered exactly as FormatChanges renders it. However, FormatChanges visits
+		// edges in no particular order, so we compare the rendered lines as sets.
+		lines := func(s string) []string { return strings.Split(s, "\n") }
+		sorted := cmpopts.SortSlices(func(a, b string) bool { return a < b })
+		lookup := func(ComponentID) (Assembly, bool) { return nil, false }
+		if diff := cmp.Diff(lines(FormatChanges(changes, "")), lines(FormatChangesVerbose(changes, "", lookup)), sorted); diff != "" {
+			t.Errorf("FormatChangesVerbose() mismatch (-want +got):\n%s", diff)
+		}
+		if diff := cmp.Diff(lines(FormatChanges(changes, "")), lines(FormatChangesVerbose(changes, "", nil)), sorted); diff != "" {
+			t.Errorf("FormatChangesVerbose(nil) mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestDescribe(t *testing.T) {
+	type Person struct {
+		InformationElement
+		Name string
+		Age  int
+	}
+	type Audit struct {
+		CreatedBy string
+	}
+	type Employee struct {
+		InformationElement
+		Person
+		*Audit
+		Title string
+		Name  string // Hides Person.Name.
+	}
+
+	tests := []struct {
+		name  string
+		value Value
+		want  map[string]any
+	}{
+		{
+			name:  "Person",
+			value: Person{Name: "Alice", Age: 42},
+			want:  map[string]any{"Name": "Alice", "Age": 42},
+		},
+		{
+			name:  "Pointer",
+			value: &Person{Name: "Alice", Age: 42},
+			want:  map[string]any{"Name": "Alice", "Age": 42},
+		},
+		{
+			name: "Embedded",
+			value: Employee{
+				Person: Person{Name: "Alice", Age: 42},
+				Audit:  &Audit{CreatedBy: "Bob"},
+				Title:  "Engineer",
+				Name:   "Alice Smith",
+			},
+			want: map[string]any{"Name": "Alice Smith", "Age": 42, "CreatedBy": "Bob", "Title": "Engineer"},
+		},
+		{
+			name:  "NilEmbeddedPointer",
+			value: Employee{Title: "Engineer"},
+			want:  map[string]any{"Name": "", "Age": 0, "Title": "Engineer"},
+		},
+		{
+			name:  "Scalar",
+			value: Scalar[string]{Value: "42"},
+			want:  map[string]any{"Value": "42"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, Describe(tt.value)); diff != "" {
+				t.Errorf("Describe() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEqualAssemblies(t *testing.T) {
+	// The build function returns a fresh tree assembly, modified by the given
+	// function, so every test case starts from the same graph.
+	build := func(modify func(a *AssemblyGraph)) Assembly {
+		a := AssemblyGraph{
+			Root: []NodeHash{{1}},
+			Vertices: map[NodeHash]Value{
+				{1}: testValue{Value: "1"},
+				{2}: testValue{Value: "2"},
+				{3}: testValue{Value: "3"},
+			},
+			Neighbours: map[NodeHash][]NodeHash{
+				{1}: {{2}, {3}},
+			},
+		}
+		if modify != nil {
+			modify(&a)
+		}
+		return a
+	}
+
+	tests := []struct {
+		name string
+		a, b Assembly
+		want bool
+	}{
+		{
+			name: "Equal",
+			a:    build(nil),
+			b:    build(nil),
+			want: true,
+		},
+		{
+			name: "EdgeOrder",
+			a:    build(nil),
+			b:    build(func(a *AssemblyGraph) { a.Neighbours[NodeHash{1}] = []NodeHash{{3}, {2}} }),
+			want: true,
+		},
+		{
+			name: "DifferentEdges",
+			a:    build(nil),
+			b:    build(func(a *AssemblyGraph) { a.Neighbours = map[NodeHash][]NodeHash{{1}: {{2}}, {2}: {{3}}} }),
+			want: false,
+		},
+		{
+			name: "DifferentValues",
+			a:    build(nil),
+			b:    build(func(a *AssemblyGraph) { a.Vertices[NodeHash{3}] = testValue{Value: "three"} }),
+			want: false,
+		},
+		{
+			name: "DifferentNodes",
+			a:    build(nil),
+			b:    build(func(a *AssemblyGraph) { a.Vertices[NodeHash{4}] = testValue{Value: "4"} }),
+			want: false,
+		},
+		{
+			name: "DifferentRoots",
+			a:    build(nil),
+			b:    build(func(a *AssemblyGraph) { a.Root = []NodeHash{{2}} }),
+			want: false,
+		},
+		{
+			name: "Removed",
+			a:    AssemblyRemoved{ID: ComponentID{1}},
+			b:    AssemblyRemoved{ID: ComponentID{2}},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EqualAssemblies(tt.a, tt.b); got != tt.want {
+				t.Errorf("EqualAssemblies(a, b) = %v, want %v", got, tt.want)
+			}
+			if got := EqualAssemblies(tt.b, tt.a); got != tt.want {
+				t.Errorf("EqualAssemblies(b, a) = %v, want %v", got, tt.want)
+			}
+			// Structurally equal graphs must hash the same (but not vice versa, as
+			// AssemblyHash trusts the content-addresses of the values).
+			if _, removed := tt.a.(AssemblyRemoved); tt.want && !removed && tt.a.AssemblyHash() != tt.b.AssemblyHash() {
+				t.Errorf("EqualAssemblies() = true, but AssemblyHash() differs")
+			}
+		})
+	}
+}
+
+func TestDetectMergeSplit(t *testing.T) {
+	// The assemble function returns a tree assembly rooted at the first of the
+	// given values, with an edge from the root to each of the rest.
+	assemble := func(root string, leaves ...string) Assembly {
+		var b AssemblyBuilder
+		b.Roots(testValue{Value: root})
+		for _, leaf := range leaves {
+			b.Connect(testValue{Value: root}, testValue{Value: leaf})
+		}
+		return b.Assemble()
+	}
+	var (
+		whole = assemble("A", "B", "C", "D")
+		left  = assemble("A", "B")
+		right = assemble("C", "D")
+		other = assemble("X", "Y")
+		moved = assemble("Z", "Y")
+	)
+
+	tests := []struct {
+		name       string
+		created    []Assembly
+		removed    []Assembly
+		wantMerges []Lineage
+		wantSplits []Lineage
+	}{
+		{
+			name:    "Split",
+			created: []Assembly{left, right},
+			removed: []Assembly{whole},
+			wantSplits: []Lineage{
+				{Sources: []ComponentID{whole.AssemblyID()}, Targets: []ComponentID{left.AssemblyID(), right.AssemblyID()}},
+			},
+		},
+		{
+			name:    "Merge",
+			created: []Assembly{whole},
+			removed: []Assembly{left, right},
+			wantMerges: []Lineage{
+				{Sources: []ComponentID{left.AssemblyID(), right.AssemblyID()}, Targets: []ComponentID{whole.AssemblyID()}},
+			},
+		},
+		{
+			// Sharing nodes with a single component is neither a merge nor a split.
+			name:    "Neither",
+			created: []Assembly{moved, left},
+			removed: []Assembly{other, right},
+		},
+		{
+			// Unrelated changes do not interfere with the detection.
+			name:    "MergeAmongOthers",
+			created: []Assembly{moved, whole},
+			removed: []Assembly{left, other, right},
+			wantMerges: []Lineage{
+				{Sources: []ComponentID{left.AssemblyID(), right.AssemblyID()}, Targets: []ComponentID{whole.AssemblyID()}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merges, splits := DetectMergeSplit(tt.created, tt.removed)
+			if diff := cmp.Diff(tt.wantMerges, merges); diff != "" {
+				t.Errorf("DetectMergeSplit() merges mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantSplits, splits); diff != "" {
+				t.Errorf("DetectMergeSplit() splits mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestGobMarshalling(t *testing.T) {
 	for i := range marshalTests {
 		tt := marshalTests[i]
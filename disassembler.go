@@ -30,6 +30,11 @@ type disassembler struct {
 	graphName string
 	source    *pubsub.Subscription
 	sink      *pubsub.Topic
+	logger    *slog.Logger // Configured by WithDisassemblerLogger; nil means the logger of the component.
+	dedup     *dedupWindow // Configured by WithDedupWindow; nil means every notification is published.
+	// Configured by WithLagObserver; nil means the lag is only measured.
+	observeLag func(graphName string, lag time.Duration)
+	now        func() time.Time // Overridden by tests; nil means time.Now.
 }
 
 // NewDisassembler returns a [component.Procedure] that disassembles a digital
@@ -41,18 +46,74 @@ type disassembler struct {
 // digitaltwin.ComponentChanged notifications.
 //
 // The disassembler measures the duration of processing each graph change
-// notification and labels each measurement record with the provided graph name
-// (e.g. "assettwin").
-func NewDisassembler(graphName string, source *pubsub.Subscription, sink *pubsub.Topic) component.Procedure {
-	return disassembler{
+// notification, as well as its age upon receipt, and labels each measurement
+// record with the provided graph name (e.g. "assettwin").
+//
+// Further configure the disassembler with options, such as
+// WithDisassemblerLogger.
+func NewDisassembler(graphName string, source *pubsub.Subscription, sink *pubsub.Topic, opts ...DisassemblerOption) component.Procedure {
+	d := disassembler{
 		graphName: graphName,
 		source:    source,
 		sink:      sink,
 	}
+	for _, opt := range opts {
+		opt(&d)
+	}
+	return d
+}
+
+// A DisassemblerOption configures the disassembler returned by NewDisassembler.
+type DisassemblerOption func(*disassembler)
+
+// WithDisassemblerLogger configures the disassembler to log through the given
+// logger.
+//
+// By default, the disassembler logs through the logger of the component running
+// it (see component.Logger).
+func WithDisassemblerLogger(logger *slog.Logger) DisassemblerOption {
+	return func(d *disassembler) {
+		d.logger = logger
+	}
+}
+
+// WithLagObserver configures the disassembler to call the given function with
+// the age of each GraphChanged notification it receives, i.e. the time elapsed
+// since the graph change was computed (see GraphChanged.Timestamp). A growing
+// lag indicates the disassembler is falling behind its source.
+//
+// The disassembler measures this lag regardless (see disassemblyLag); the
+// observer merely allows callers to act upon it directly. The observer is called
+// synchronously, so it must not block.
+func WithLagObserver(observe func(graphName string, lag time.Duration)) DisassemblerOption {
+	return func(d *disassembler) {
+		d.observeLag = observe
+	}
+}
+
+// WithDedupWindow configures the disassembler to skip publishing a
+// ComponentChanged notification identical to one of the last n it has published
+// (i.e. of the same component, assembly hash, and graph hash). Under
+// at-least-once delivery, a redelivered GraphChanged notification would
+// otherwise be disassembled and published all over again.
+//
+// Consumers must remain idempotent regardless, as the window is bounded and
+// held in memory alone. A non-positive n disables deduplication, which is the
+// default.
+func WithDedupWindow(n int) DisassemblerOption {
+	return func(d *disassembler) {
+		d.dedup = nil
+		if n > 0 {
+			d.dedup = newDedupWindow(n)
+		}
+	}
 }
 
 func (d disassembler) Exec(l *component.L) {
-	logger := component.Logger(l.Context())
+	logger := d.logger
+	if logger == nil {
+		logger = component.Logger(l.Context())
+	}
 	for l.Continue() {
 		msg, err := d.source.Receive(l.GraceContext())
 		if err != nil {
@@ -116,6 +177,8 @@ func (d disassembler) handleMessage(ctx context.Context, logger *slog.Logger, ms
 		return err
 	}
 
+	d.measureLag(ctx, logger, changed)
+
 	if changed.IsEmpty() {
 		// As noted in the IsEmpty() documentation, it returns true when the graph hash
 		// before and after are the same, indicating no changes in the graph. In this
@@ -130,7 +193,7 @@ func (d disassembler) handleMessage(ctx context.Context, logger *slog.Logger, ms
 		slog.Any("graph-after-hash", changed.GraphAfter),
 	)
 	logger.Debug("Disassembling graph change into graph component changes...")
-	componentsChanges := disassembleGraph(changed)
+	componentsChanges := Disassemble(changed)
 
 	g, ctx := errgroup.WithContext(ctx)
 	for _, c := range componentsChanges {
@@ -150,7 +213,27 @@ func (d disassembler) handleMessage(ctx context.Context, logger *slog.Logger, ms
 	return nil
 }
 
-func (d disassembler) notifyChange(ctx context.Context, logger *slog.Logger, c ComponentChanged) error {
+// The measureLag method measures the age of the given notification, and reports
+// it to the observer configured by WithLagObserver (if any). Notifications
+// without a timestamp (e.g. published by older engines) have no age, so their
+// lag is not measured at all.
+func (d disassembler) measureLag(ctx context.Context, logger *slog.Logger, changed GraphChanged) {
+	if changed.Timestamp.IsZero() {
+		logger.Debug("GraphChanged message has no timestamp, lag not measured")
+		return
+	}
+	now := time.Now
+	if d.now != nil {
+		now = d.now
+	}
+	lag := now().Sub(changed.Timestamp)
+	measureDisassemblyLag(ctx, d.graphName, lag)
+	if d.observeLag != nil {
+		d.observeLag(d.graphName, lag)
+	}
+}
+
+func (d disassembler) notifyChange(ctx context.Context, logger *slog.Logger, c ComponentChanged) (err error) {
 	ctx, span := tracer.Start(ctx, "disassembler.handleMessage", trace.WithAttributes(
 		attribute.Stringer("graph.hash", c.GraphHash),
 		attribute.Stringer("component.id", c.AssemblyHash()),
@@ -160,6 +243,18 @@ func (d disassembler) notifyChange(ctx context.Context, logger *slog.Logger, c C
 	logger = logger.With(
 		slog.Any("component-id", c.AssemblyID()),
 	)
+	// We claim the key before publishing, so a concurrent duplicate (e.g. of the
+	// same GraphChanged notification) skips it, and release it unless published.
+	key := keyOf(c)
+	if !d.dedup.tryAdd(key) {
+		logger.Debug("ComponentChanged message was published recently, message skipped")
+		return nil
+	}
+	defer func() {
+		if err != nil {
+			d.dedup.remove(key)
+		}
+	}()
 	logger.Debug("Encoding ComponentChanged message using gob...")
 	var b bytes.Buffer
 	enc := gob.NewEncoder(&b)
@@ -242,11 +337,14 @@ func (c ComponentChanged) IsRemoved() bool {
 	return false
 }
 
-// disassembleGraph disassembles the provided GraphChanged message into
-// individual ComponentChanged messages, one for each graph component change
-// (AssemblyCreated, AssemblyUpdated, AssemblyRemoved). It returns a slice of
-// ComponentChanged messages.
-func disassembleGraph(graph GraphChanged) (changes []ComponentChanged) {
+// Disassemble disassembles the provided GraphChanged message into individual
+// ComponentChanged messages, one for each graph component change
+// (AssemblyCreated, AssemblyUpdated, AssemblyRemoved), in that order. Every
+// message carries the GraphAfter and Timestamp of the provided message.
+//
+// The Disassembler publishes exactly these messages; call Disassemble directly
+// to react to per-component changes in-process, without a pubsub topic.
+func Disassemble(graph GraphChanged) (changes []ComponentChanged) {
 	for _, c := range graph.Created {
 		changes = append(changes, ComponentChanged{
 			Assembly:  c,
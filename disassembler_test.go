@@ -2,12 +2,19 @@ package digitaltwin
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"log/slog"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"gocloud.dev/pubsub"
+	"gocloud.dev/pubsub/mempubsub"
 
 	"github.com/danielorbach/go-component"
 )
@@ -65,6 +72,206 @@ func TestComponentChangedGobMarshalling(t *testing.T) {
 	}
 }
 
+func TestDisassemble(t *testing.T) {
+	everything := marshalTests[len(marshalTests)-1].Value
+	everything.Timestamp = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var want []ComponentChanged
+	for _, c := range everything.Created {
+		want = append(want, ComponentChanged{Assembly: c, GraphHash: everything.GraphAfter, Timestamp: everything.Timestamp})
+	}
+	for _, c := range everything.Updated {
+		want = append(want, ComponentChanged{Assembly: c, GraphHash: everything.GraphAfter, Timestamp: everything.Timestamp})
+	}
+	for _, c := range everything.Removed {
+		want = append(want, ComponentChanged{Assembly: c, GraphHash: everything.GraphAfter, Timestamp: everything.Timestamp})
+	}
+	if diff := cmp.Diff(want, Disassemble(everything)); diff != "" {
+		t.Errorf("Disassemble() mismatch (-want +got):\n%s", diff)
+	}
+
+	if got := Disassemble(GraphChanged{}); len(got) != 0 {
+		t.Errorf("Disassemble(GraphChanged{}) = %v, want none", got)
+	}
+}
+
+func TestWithDedupWindow(t *testing.T) {
+	ctx := context.Background()
+	assemblyOf := func(v Value) Assembly {
+		var b AssemblyBuilder
+		b.Roots(v)
+		return b.Assemble()
+	}
+	// Four distinct component changes, and an explicit duplicate of the first.
+	changed := GraphChanged{
+		GraphBefore: ForestHash{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		Created: []AssemblyCreated{
+			{Assembly: assemblyOf(testValue{Value: "1"})},
+			{Assembly: assemblyOf(testValue{Value: "2"})},
+			{Assembly: assemblyOf(testValue{Value: "1"})},
+		},
+		Updated: []AssemblyUpdated{
+			{Assembly: assemblyOf(testValue{Value: "3"}), Baseline: ComponentHash{0xaa}},
+		},
+		Removed: []AssemblyRemoved{
+			{ID: ComponentID{0xd}, Hash: ComponentHash{0xdd}},
+		},
+		GraphAfter: ForestHash{9, 8, 7, 6, 5, 4, 3, 2, 1, 0},
+	}
+	const want = 4
+	var body bytes.Buffer
+	if err := gob.NewEncoder(&body).Encode(changed); err != nil {
+		t.Fatal(err)
+	}
+
+	d := disassembler{graphName: t.Name()}
+	WithDedupWindow(16)(&d)
+
+	// A failed delivery must not count as published, so the redelivery of the
+	// same GraphChanged notification publishes every change.
+	closed := mempubsub.NewTopic()
+	if err := closed.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	d.sink = closed
+	if err := d.handleMessage(ctx, slog.Default(), &pubsub.Message{Body: body.Bytes()}); err == nil {
+		t.Fatalf("handleMessage() to a closed topic = nil; want error")
+	}
+
+	topic := mempubsub.NewTopic()
+	defer topic.Shutdown(ctx)
+	sub := mempubsub.NewSubscription(topic, time.Minute)
+	defer sub.Shutdown(ctx)
+	d.sink = topic
+	// We hand the same GraphChanged notification over twice, as if it were
+	// redelivered by the source subscription.
+	for range 2 {
+		if err := d.handleMessage(ctx, slog.Default(), &pubsub.Message{Body: body.Bytes()}); err != nil {
+			t.Fatalf("handleMessage() failed: %v", err)
+		}
+	}
+
+	got := 0
+	for {
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		msg, err := sub.Receive(ctx)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Receive() failed: %v", err)
+		}
+		msg.Ack()
+		got++
+	}
+	if got != want {
+		t.Errorf("WithDedupWindow(16) published %d ComponentChanged messages, want %d", got, want)
+	}
+}
+
+func TestWithLagObserver(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	histogram, err := provider.Meter(t.Name()).Float64Histogram("graphChanged.disassembly.lag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := disassemblyLag
+	disassemblyLag = histogram
+	t.Cleanup(func() { disassemblyLag = original })
+
+	ctx := context.Background()
+	computed := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	// An empty GraphChanged notification is never published, yet its lag is
+	// measured all the same.
+	var body bytes.Buffer
+	if err := gob.NewEncoder(&body).Encode(GraphChanged{Timestamp: computed}); err != nil {
+		t.Fatal(err)
+	}
+
+	var observed []time.Duration
+	d := disassembler{graphName: t.Name()}
+	d.now = func() time.Time { return computed.Add(3 * time.Second) }
+	WithLagObserver(func(graphName string, lag time.Duration) {
+		if graphName != t.Name() {
+			t.Errorf("observer called with graph name %q, want %q", graphName, t.Name())
+		}
+		observed = append(observed, lag)
+	})(&d)
+	if err := d.handleMessage(ctx, slog.Default(), &pubsub.Message{Body: body.Bytes()}); err != nil {
+		t.Fatalf("handleMessage() failed: %v", err)
+	}
+
+	// A notification without a timestamp has no age, so its lag is not measured.
+	body.Reset()
+	if err := gob.NewEncoder(&body).Encode(GraphChanged{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.handleMessage(ctx, slog.Default(), &pubsub.Message{Body: body.Bytes()}); err != nil {
+		t.Fatalf("handleMessage() failed: %v", err)
+	}
+
+	if diff := cmp.Diff([]time.Duration{3 * time.Second}, observed); diff != "" {
+		t.Errorf("observed lag mismatch (-want +got):\n%s", diff)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatal(err)
+	}
+	var got []float64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if h, ok := m.Data.(metricdata.Histogram[float64]); ok {
+				for _, dp := range h.DataPoints {
+					if name, _ := dp.Attributes.Value(digitaltwinGraphName); name.AsString() != t.Name() {
+						t.Errorf("lag recorded for graph %q, want %q", name.AsString(), t.Name())
+					}
+					got = append(got, dp.Sum)
+				}
+			}
+		}
+	}
+	if diff := cmp.Diff([]float64{3000}, got); diff != "" {
+		t.Errorf("recorded lag (ms) mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDedupWindow(t *testing.T) {
+	w := newDedupWindow(2)
+	a, b, c := dedupKey{id: ComponentID{1}}, dedupKey{id: ComponentID{2}}, dedupKey{id: ComponentID{3}}
+	w.tryAdd(a)
+	w.tryAdd(b)
+	// We mark a as the most recently published, so adding c forgets b instead.
+	if w.tryAdd(a) {
+		t.Fatalf("tryAdd(a) = true after tryAdd(a)")
+	}
+	w.tryAdd(c)
+	// Removing c releases it, so it may be added again.
+	w.remove(c)
+	for _, tt := range []struct {
+		Name string
+		Key  dedupKey
+		Want bool
+	}{
+		{"a", a, false},
+		{"b", b, true},
+		{"c", c, true},
+	} {
+		if got := w.tryAdd(tt.Key); got != tt.Want {
+			t.Errorf("tryAdd(%s) = %t, want %t", tt.Name, got, tt.Want)
+		}
+	}
+
+	// The methods of a nil window are no-ops.
+	var off *dedupWindow
+	off.remove(a)
+	if !off.tryAdd(a) || !off.tryAdd(a) {
+		t.Errorf("tryAdd(a) = false on a nil window, want true")
+	}
+}
+
 // ExampleDisassembler an example [component.Descriptor] for a digital-twin
 // disassembler with an example bootstrap function.
 func ExampleNewDisassembler() {
@@ -99,6 +99,17 @@ func removed(components ...digitaltwin.AssemblyRef) check {
 	}
 }
 
+// Checks that the changes leave the graph exactly as it was, as reported by
+// digitaltwin.GraphChanged.IsEmpty.
+func unchanged() check {
+	return func(changed digitaltwin.GraphChanged) string {
+		if !changed.IsEmpty() {
+			return fmt.Sprintf(".IsEmpty() = false, want true: graph changed from %v to %v", changed.GraphBefore, changed.GraphAfter)
+		}
+		return ""
+	}
+}
+
 // A snapshot is used by sequential test-cases to check a sequence of discrete
 // graph snapshots.
 //
@@ -114,7 +125,7 @@ type snapshot []digitaltwin.AssemblyRef
 func (after snapshot) Checks(before snapshot) []check {
 	// We check that this snapshot directly follows the previous snapshot.
 	continuousDiff := func(changed digitaltwin.GraphChanged) string {
-		if h := digitaltwin.ComputeForestHash(before...); changed.GraphBefore != h {
+		if h := digitaltwin.ComputeForestHash(before...); !changed.Follows(digitaltwin.GraphChanged{GraphAfter: h}) {
 			return fmt.Sprintf(".GraphBefore = %v, want %v: discontinuity", changed.GraphBefore, h)
 		}
 		return ""
@@ -33,6 +33,7 @@ import (
 	"fmt"
 	"reflect"
 	"runtime"
+	"sync"
 	"testing"
 
 	"github.com/go-digitaltwin/go-digitaltwin"
@@ -44,6 +45,7 @@ func init() {
 	gob.Register(NodeB{})
 	gob.Register(NodeC{})
 	gob.Register(NodeD{})
+	gob.Register(NodeN{})
 }
 
 type NodeA struct{ digitaltwin.InformationElement }
@@ -51,6 +53,13 @@ type NodeB struct{ digitaltwin.InformationElement }
 type NodeC struct{ digitaltwin.InformationElement }
 type NodeD struct{ digitaltwin.InformationElement }
 
+// A NodeN is a numbered node, for test-cases that need arbitrarily many distinct
+// nodes (e.g. wide components). Engines must register it like the other nodes.
+type NodeN struct {
+	digitaltwin.InformationElement
+	N int
+}
+
 type testCase struct {
 	// Subtest name.
 	name string
@@ -228,6 +237,220 @@ var cases = []testCase{
 			removed(),
 		},
 	},
+	{
+		name:     "connect-several-kinds",
+		location: locateSource(),
+		compilation: func(ctx context.Context, w digitaltwin.GraphWriter) error {
+			return w.AssertEdge(ctx, NodeB{}, NodeD{})
+		},
+		graph: snapshot{fork(NodeA{}, NodeB{}, NodeC{}, NodeD{})},
+		checks: []check{
+			created(),
+			updated(fork(NodeA{}, NodeB{}, NodeC{}, NodeD{})),
+			removed(tree(NodeD{})),
+		},
+	},
+	{
+		name:     "retract-all-edges",
+		location: locateSource(),
+		compilation: func(ctx context.Context, w digitaltwin.GraphWriter) error {
+			n, err := w.RetractAllEdges(ctx, NodeB{})
+			if err != nil {
+				return err
+			}
+			if n != 3 {
+				return fmt.Errorf("expected 3 edges, got %d", n)
+			}
+			return nil
+		},
+		graph: snapshot{tree(NodeA{}), tree(NodeB{}), tree(NodeC{}), tree(NodeD{})},
+		checks: []check{
+			created(tree(NodeB{}), tree(NodeC{}), tree(NodeD{})),
+			updated(tree(NodeA{})),
+			removed(),
+		},
+	},
+	{
+		// By now, NodeA was asserted and swept by previous cases, so asserting it again
+		// must neither taint nor re-hash its component.
+		name:     "reassert-node",
+		location: locateSource(),
+		compilation: func(ctx context.Context, w digitaltwin.GraphWriter) error {
+			return w.AssertNode(ctx, NodeA{})
+		},
+		graph: snapshot{tree(NodeA{}), tree(NodeB{}), tree(NodeC{}), tree(NodeD{})},
+		checks: []check{
+			created(),
+			updated(),
+			removed(),
+			unchanged(),
+		},
+	},
+	{
+		name:     "wide-component",
+		location: locateSource(),
+		compilation: func(ctx context.Context, w digitaltwin.GraphWriter) error {
+			for _, leaf := range numbered(1, 20) {
+				if err := w.AssertEdge(ctx, NodeN{N: 0}, leaf); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		graph: snapshot{tree(NodeA{}), tree(NodeB{}), tree(NodeC{}), tree(NodeD{}), star(NodeN{N: 0}, numbered(1, 20)...)},
+		checks: []check{
+			created(star(NodeN{N: 0}, numbered(1, 20)...)),
+			updated(),
+			removed(),
+		},
+	},
+	{
+		name:     "widen-component",
+		location: locateSource(),
+		compilation: func(ctx context.Context, w digitaltwin.GraphWriter) error {
+			return w.AssertEdge(ctx, NodeN{N: 0}, NodeN{N: 21})
+		},
+		graph: snapshot{tree(NodeA{}), tree(NodeB{}), tree(NodeC{}), tree(NodeD{}), star(NodeN{N: 0}, numbered(1, 21)...)},
+		checks: []check{
+			created(),
+			updated(star(NodeN{N: 0}, numbered(1, 21)...)),
+			removed(),
+		},
+	},
+	{
+		// A DAG whose roots converge on a shared node is a single component of all of
+		// its roots, so the components of the roots and of the shared node merge.
+		name:     "converge",
+		location: locateSource(),
+		compilation: func(ctx context.Context, w digitaltwin.GraphWriter) error {
+			if err := w.AssertEdge(ctx, NodeB{}, NodeD{}); err != nil {
+				return err
+			}
+			return w.AssertEdge(ctx, NodeC{}, NodeD{})
+		},
+		graph: snapshot{tree(NodeA{}), converging(NodeD{}, NodeB{}, NodeC{}), star(NodeN{N: 0}, numbered(1, 21)...)},
+		checks: []check{
+			created(converging(NodeD{}, NodeB{}, NodeC{})),
+			updated(),
+			removed(tree(NodeB{}), tree(NodeC{}), tree(NodeD{})),
+		},
+	},
+	{
+		// Detaching NodeD splits the converging component into single-node components
+		// of its former roots, while NodeD survives as its own.
+		name:     "detach-node",
+		location: locateSource(),
+		compilation: func(ctx context.Context, w digitaltwin.GraphWriter) error {
+			return w.DetachNode(ctx, NodeD{})
+		},
+		graph: snapshot{tree(NodeA{}), tree(NodeB{}), tree(NodeC{}), tree(NodeD{}), star(NodeN{N: 0}, numbered(1, 21)...)},
+		checks: []check{
+			created(tree(NodeB{}), tree(NodeC{}), tree(NodeD{})),
+			updated(),
+			removed(converging(NodeD{}, NodeB{}, NodeC{})),
+		},
+	},
+	{
+		// HasEdge reflects the edges of the graph, including those asserted and
+		// retracted earlier in the same compilation, so compilations may branch on it.
+		name:     "has-edge",
+		location: locateSource(),
+		compilation: func(ctx context.Context, w digitaltwin.GraphWriter) error {
+			expect := func(from, to digitaltwin.Value, want bool) error {
+				ok, err := w.HasEdge(ctx, from, to)
+				if err != nil {
+					return err
+				}
+				if ok != want {
+					return fmt.Errorf("HasEdge(%v, %v) = %t; want %t", from, to, ok, want)
+				}
+				return nil
+			}
+			// Edges asserted (and retracted) by previous cases, in either direction.
+			if err := expect(NodeN{N: 0}, NodeN{N: 1}, true); err != nil {
+				return err
+			}
+			if err := expect(NodeN{N: 1}, NodeN{N: 0}, false); err != nil {
+				return err
+			}
+			if err := expect(NodeB{}, NodeD{}, false); err != nil {
+				return err
+			}
+			// Edges asserted and retracted within this compilation.
+			if err := expect(NodeA{}, NodeB{}, false); err != nil {
+				return err
+			}
+			if err := w.AssertEdge(ctx, NodeA{}, NodeB{}); err != nil {
+				return err
+			}
+			if err := expect(NodeA{}, NodeB{}, true); err != nil {
+				return err
+			}
+			if _, err := w.RetractEdges(ctx, NodeA{}, reflect.TypeFor[NodeB]()); err != nil {
+				return err
+			}
+			if err := expect(NodeA{}, NodeB{}, false); err != nil {
+				return err
+			}
+			// Asserting an edge only if it is missing is idempotent by inspection.
+			ok, err := w.HasEdge(ctx, NodeA{}, NodeB{})
+			if err != nil {
+				return err
+			}
+			if !ok {
+				if err := w.AssertEdge(ctx, NodeA{}, NodeB{}); err != nil {
+					return err
+				}
+			}
+			return expect(NodeA{}, NodeB{}, true)
+		},
+		graph: snapshot{tree(NodeA{}, NodeB{}), tree(NodeC{}), tree(NodeD{}), star(NodeN{N: 0}, numbered(1, 21)...)},
+		checks: []check{
+			created(),
+			updated(tree(NodeA{}, NodeB{})),
+			removed(tree(NodeB{})),
+		},
+	},
+	{
+		// NodeExists reflects the nodes of the graph, including those asserted and
+		// retracted earlier in the same compilation. The node is gone by the end of
+		// the compilation, so no component changes.
+		name:     "node-exists",
+		location: locateSource(),
+		compilation: func(ctx context.Context, w digitaltwin.GraphWriter) error {
+			expect := func(node digitaltwin.Value, want bool) error {
+				ok, err := w.NodeExists(ctx, node)
+				if err != nil {
+					return err
+				}
+				if ok != want {
+					return fmt.Errorf("NodeExists(%v) = %t; want %t", node, ok, want)
+				}
+				return nil
+			}
+			if err := expect(NodeA{}, true); err != nil {
+				return err
+			}
+			absent := NodeN{N: 100}
+			if err := expect(absent, false); err != nil {
+				return err
+			}
+			if err := w.AssertNode(ctx, absent); err != nil {
+				return err
+			}
+			if err := expect(absent, true); err != nil {
+				return err
+			}
+			if err := w.RetractNode(ctx, absent); err != nil {
+				return err
+			}
+			return expect(absent, false)
+		},
+		graph: snapshot{tree(NodeA{}, NodeB{}), tree(NodeC{}), tree(NodeD{}), star(NodeN{N: 0}, numbered(1, 21)...)},
+		checks: []check{
+			unchanged(),
+		},
+	},
 }
 
 // Run executes a sequence of test cases on a digitaltwin engine using the given
@@ -297,6 +520,65 @@ func Run(t *testing.T, applier digitaltwin.Applier, changeder digitaltwin.WhatCh
 	}
 }
 
+// RunConcurrent checks the concurrency contract of a digitaltwin engine using the
+// given digitaltwin.Applier and digitaltwin.WhatChangeder interfaces. It applies
+// many compilations concurrently, each building its own disjoint component, and
+// then verifies that a single call to WhatChanged observes every component
+// exactly once.
+//
+// Unlike Run, this test-suite is optional: engines opt in by calling it from
+// their own test. It expects a fresh engine with an empty graph.
+func RunConcurrent(t *testing.T, applier digitaltwin.Applier, changeder digitaltwin.WhatChangeder) {
+	t.Helper()
+
+	// We deliberately use the background context for the same reasons as Run.
+	ctx := context.Background()
+
+	const concurrency = 16
+	var (
+		wg   sync.WaitGroup
+		want snapshot
+	)
+	for i := range concurrency {
+		// Every compilation connects its own pair of nodes, so no two compilations
+		// touch the same component.
+		from, to := NodeN{N: 2 * i}, NodeN{N: 2*i + 1}
+		want = append(want, tree(from, to))
+		wg.Go(func() {
+			// A panicking engine would otherwise crash the entire test binary, hiding
+			// which compilation it panicked on.
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("Apply(%v -> %v) panicked: %v", from, to, r)
+				}
+			}()
+			err := applier.Apply(ctx, func(ctx context.Context, w digitaltwin.GraphWriter) error {
+				return w.AssertEdge(ctx, from, to)
+			})
+			if err != nil {
+				t.Errorf("Apply(%v -> %v) failed: %v", from, to, err)
+			}
+		})
+	}
+	wg.Wait()
+	if t.Failed() {
+		t.FailNow()
+	}
+
+	changes, err := changeder.WhatChanged(ctx)
+	if err != nil {
+		t.Fatalf("WhatChanged() failed: %v", err)
+	}
+	// The created check fails for missing components as well as for duplicate ones,
+	// as it counts them before comparing.
+	checks := append([]check{created(want...), updated(), removed()}, want.Checks(nil)...)
+	for _, check := range checks {
+		if problem := check(changes); problem != "" {
+			t.Errorf("Check concurrent changes: %v", problem)
+		}
+	}
+}
+
 // We support only narrow trees here to focus on depth progression (sequential
 // dependency), which is a common pattern in digital twin modelling, representing
 // chained events or dependencies. The emphasis on narrow trees allows the
@@ -318,6 +600,52 @@ func tree(root digitaltwin.Value, children ...digitaltwin.Value) digitaltwin.Ass
 	return b.Assemble()
 }
 
+// A fork is the narrow tree of root and stem, with the stem branching out to all
+// the given leaves. It lets a single node connect to nodes of several kinds.
+func fork(root, stem digitaltwin.Value, leaves ...digitaltwin.Value) digitaltwin.Assembly {
+	var b digitaltwin.AssemblyBuilder
+	b.Roots(root)
+	b.Connect(root, stem)
+	for _, leaf := range leaves {
+		b.Connect(stem, leaf)
+	}
+	return b.Assemble()
+}
+
+// Unlike the narrow trees of the tree function, a star fans out: the root
+// connects directly to every one of the given leaves. Real components often take
+// this shape (e.g. a device with many interfaces), which stresses engines
+// differently than depth.
+func star(root digitaltwin.Value, leaves ...digitaltwin.Value) digitaltwin.Assembly {
+	var b digitaltwin.AssemblyBuilder
+	b.Roots(root)
+	for _, leaf := range leaves {
+		b.Connect(root, leaf)
+	}
+	return b.Assemble()
+}
+
+// A converging DAG is a single component of all the given roots, each connected
+// to the shared node.
+func converging(shared digitaltwin.Value, roots ...digitaltwin.Value) digitaltwin.Assembly {
+	var b digitaltwin.AssemblyBuilder
+	b.Roots(roots...)
+	for _, root := range roots {
+		b.Connect(root, shared)
+	}
+	return b.Assemble()
+}
+
+// The numbered function returns the NodeN values numbered from first to last,
+// inclusive.
+func numbered(first, last int) []digitaltwin.Value {
+	var nodes []digitaltwin.Value
+	for n := first; n <= last; n++ {
+		nodes = append(nodes, NodeN{N: n})
+	}
+	return nodes
+}
+
 // Call this function to set the location of every test-case in the source file.
 // The returned string is used to guide developers of digital-twin engines to the
 // appropriate test-case.
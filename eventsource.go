@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/danielorbach/go-component"
 	"gocloud.dev/pubsub"
@@ -26,14 +27,13 @@ type Compiler func(GraphChanged) (Compilation, error)
 // subscription, decodes incoming GraphChanged messages, compiles them using
 // the provided Compiler, and applies the resulting Compilation using the
 // DigitalTwin's Applier.
+//
+// Messages are acknowledged only after their Compilation has been applied
+// successfully (see WithAckAfterHandle), so a crash before then causes them to
+// be redelivered rather than lost. Redelivery is safe because graph assertions
+// are idempotent.
 func (d DigitalTwin) CompileChanges(sub *pubsub.Subscription, process Compiler) component.Proc {
-	source := EventSource{
-		subscription: sub,
-		eventType:    reflect.TypeFor[GraphChanged](),
-		decoder: func(p []byte, v reflect.Value) error {
-			return gob.NewDecoder(bytes.NewReader(p)).DecodeValue(v)
-		},
-	}
+	source := NewGobEventSource(sub, reflect.TypeFor[GraphChanged]())
 	return source.Stream(func(ctx context.Context, msg any) error {
 		changed := msg.(GraphChanged)
 		compilation, err := process(changed)
@@ -45,7 +45,143 @@ func (d DigitalTwin) CompileChanges(sub *pubsub.Subscription, process Compiler)
 			return fmt.Errorf("apply: %w", err)
 		}
 		return nil
-	})
+	}, WithAckAfterHandle())
+}
+
+// PublishChanges returns a component.Proc that calls WhatChanged every interval,
+// and publishes the GraphChanged notifications it returns to the given sink,
+// encoded with gob. Empty notifications (see GraphChanged.IsEmpty) are not
+// published. It is the producer counterpart of consumers such as CompileChanges,
+// NewDisassembler and TrackAttribute.
+//
+// Whenever WhatChanged fails, the returned procedure backs off before calling it
+// again, so as not to hammer a struggling database; the backoff grows
+// exponentially with consecutive failures and resets on success. Configure it
+// with options, such as WithBackoff and WithSelfHealing.
+//
+// The returned procedure stops gracefully when its lifecycle is signalled to
+// stop, and with a fatal error as soon as it fails to publish changes. Beware, a
+// WhatChangeder has already moved on by the time publishing fails, so the
+// changes it returned are lost; consumers detect such gaps with
+// GraphChanged.Follows.
+//
+// It panics if interval is not positive.
+func PublishChanges(changeder WhatChangeder, sink *pubsub.Topic, interval time.Duration, opts ...PublishOption) component.Proc {
+	if interval <= 0 {
+		panic("digitaltwin: non-positive interval for PublishChanges")
+	}
+	options := publishOptions{
+		initialBackoff: interval,
+		maxBackoff:     defaultMaxBackoffFactor * interval,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return func(l *component.L) {
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+		var failures int // Consecutive failures of WhatChanged.
+		for l.Continue() {
+			select {
+			case <-l.Stopping():
+				return
+			case <-l.Context().Done():
+				return
+			case <-timer.C:
+			}
+
+			changes, err := changeder.WhatChanged(l.Context())
+			if err != nil {
+				if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+					// we're shutting down
+					return
+				}
+				failures++
+				backoff := options.backoff(failures, err)
+				component.Logger(l.Context()).Warn("Failed to observe what changed, backing off",
+					"error", err,
+					"failures", failures,
+					"backoff", backoff,
+				)
+				timer.Reset(backoff)
+				continue
+			}
+			failures = 0
+			timer.Reset(interval)
+			if changes.IsEmpty() {
+				continue
+			}
+
+			var body bytes.Buffer
+			if err := gob.NewEncoder(&body).Encode(changes); err != nil {
+				l.Fatal(fmt.Errorf("encode: %w", err))
+			}
+			if err := sink.Send(l.Context(), &pubsub.Message{Body: body.Bytes()}); err != nil {
+				l.Fatal(fmt.Errorf("publish: %w", err))
+			}
+		}
+	}
+}
+
+// A PublishOption configures the component.Proc returned by PublishChanges.
+type PublishOption func(*publishOptions)
+
+type publishOptions struct {
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	selfHealing    func(error) bool // Configured by WithSelfHealing; nil matches no errors.
+}
+
+// By default, PublishChanges caps its backoff at this many intervals.
+const defaultMaxBackoffFactor = 16
+
+// The backoff method returns how long to wait after the given number of
+// consecutive failures, the last of which failed with err.
+func (o publishOptions) backoff(failures int, err error) time.Duration {
+	if o.selfHealing != nil && o.selfHealing(err) {
+		return o.initialBackoff
+	}
+	backoff := o.initialBackoff
+	for range failures - 1 {
+		if backoff >= o.maxBackoff/2 {
+			return o.maxBackoff
+		}
+		backoff *= 2
+	}
+	return min(backoff, o.maxBackoff)
+}
+
+// WithBackoff configures PublishChanges to wait initial after WhatChanged fails,
+// doubling the wait with every consecutive failure, up to limit.
+//
+// By default, the backoff starts at the interval of PublishChanges, and is
+// capped at 16 intervals.
+//
+// It panics if initial is not positive, or if limit is less than initial.
+func WithBackoff(initial, limit time.Duration) PublishOption {
+	if initial <= 0 || limit < initial {
+		panic("digitaltwin: invalid backoff for PublishChanges")
+	}
+	return func(o *publishOptions) {
+		o.initialBackoff = initial
+		o.maxBackoff = limit
+	}
+}
+
+// WithSelfHealing configures PublishChanges to retry sooner after errors known
+// to heal by themselves, as reported by the given function; it always waits the
+// initial backoff after such errors, regardless of any consecutive failures.
+//
+// For example, a neo4jengine.Engine fails with a RootlessAssembliesError while
+// another process is still modifying the graph:
+//
+//	digitaltwin.WithSelfHealing(func(err error) bool {
+//		return errors.As(err, new(neo4jengine.RootlessAssembliesError))
+//	})
+func WithSelfHealing(match func(error) bool) PublishOption {
+	return func(o *publishOptions) {
+		o.selfHealing = match
+	}
 }
 
 // EventSource wraps a pubsub subscription and decodes incoming messages into
@@ -56,13 +192,69 @@ type EventSource struct {
 	decoder      func(p []byte, v reflect.Value) error
 }
 
+// NewEventSource returns an EventSource that decodes each message received from
+// the given subscription into a new value of eventType, using the given decoder.
+//
+// The decoder is called with the body of the message and a pointer to a new
+// zero value of eventType (i.e. the result of reflect.New), which it must fill
+// in. For example, to consume JSON-encoded events:
+//
+//	digitaltwin.NewEventSource(sub, reflect.TypeFor[digitaltwin.GraphChanged](), func(p []byte, v reflect.Value) error {
+//		return json.Unmarshal(p, v.Interface())
+//	})
+func NewEventSource(sub *pubsub.Subscription, eventType reflect.Type, decoder func([]byte, reflect.Value) error) EventSource {
+	return EventSource{
+		subscription: sub,
+		eventType:    eventType,
+		decoder:      decoder,
+	}
+}
+
+// NewGobEventSource returns an EventSource that decodes each message received
+// from the given subscription into a new value of eventType, using gob; as do
+// the producers of this package, such as PublishChanges.
+func NewGobEventSource(sub *pubsub.Subscription, eventType reflect.Type) EventSource {
+	return NewEventSource(sub, eventType, func(p []byte, v reflect.Value) error {
+		return gob.NewDecoder(bytes.NewReader(p)).DecodeValue(v)
+	})
+}
+
 // EventHandler is a function that processes a decoded event message.
 type EventHandler func(ctx context.Context, msg any) error
 
+// A StreamOption configures the component.Proc returned by EventSource.Stream.
+type StreamOption func(*streamOptions)
+
+type streamOptions struct {
+	ackAfterHandle bool
+}
+
+// WithAckAfterHandle configures the stream to acknowledge each message only
+// after the EventHandler has handled it successfully, providing at-least-once
+// semantics. If the handler fails, the message is not acknowledged (it is
+// nacked, if the subscription supports it), so it will be redelivered; hence,
+// the handler must be safe to call again with the same event.
+//
+// By default, the stream acknowledges each message as soon as it is received,
+// providing at-most-once semantics.
+func WithAckAfterHandle() StreamOption {
+	return func(o *streamOptions) {
+		o.ackAfterHandle = true
+	}
+}
+
 // Stream returns a component.Proc that continuously receives messages from the
 // subscription, decodes them using the configured decoder, and passes them to
 // the provided EventHandler.
-func (s EventSource) Stream(h EventHandler) component.Proc {
+//
+// The returned procedure stops with a fatal error as soon as it fails to
+// receive, decode, or handle a message. Further configure when messages are
+// acknowledged with options, such as WithAckAfterHandle.
+func (s EventSource) Stream(h EventHandler, opts ...StreamOption) component.Proc {
+	var options streamOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
 	return func(l *component.L) {
 		for l.Continue() {
 			msg, err := s.subscription.Receive(l.Context())
@@ -73,19 +265,32 @@ func (s EventSource) Stream(h EventHandler) component.Proc {
 				}
 				l.Fatal(fmt.Errorf("receive: %w", err))
 			}
-			// always ack, even if we fail to decode.
-			// otherwise, we might get stuck processing
-			// the same failed message
-			msg.Ack()
+			if !options.ackAfterHandle {
+				// always ack, even if we fail to decode.
+				// otherwise, we might get stuck processing
+				// the same failed message
+				msg.Ack()
+			}
 
 			v := reflect.New(s.eventType)
 			if err := s.decoder(msg.Body, v); err != nil {
+				if options.ackAfterHandle {
+					// A message that fails to decode will never succeed, so we ack it
+					// anyway rather than get stuck on its redelivery.
+					msg.Ack()
+				}
 				l.Fatal(fmt.Errorf("decode: %w", err))
 			}
 
 			if err := h(l.Context(), v.Elem().Interface()); err != nil {
+				if options.ackAfterHandle && msg.Nackable() {
+					msg.Nack()
+				}
 				l.Fatal(fmt.Errorf("process: %w", err))
 			}
+			if options.ackAfterHandle {
+				msg.Ack()
+			}
 		}
 	}
 }
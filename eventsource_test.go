@@ -0,0 +1,225 @@
+package digitaltwin
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/danielorbach/go-component"
+	"github.com/google/go-cmp/cmp"
+	"gocloud.dev/pubsub"
+	"gocloud.dev/pubsub/mempubsub"
+)
+
+func TestCompileChanges_ackAfterApply(t *testing.T) {
+	ctx := context.Background()
+	topic := mempubsub.NewTopic()
+	defer topic.Shutdown(ctx)
+	sub := mempubsub.NewSubscription(topic, time.Minute)
+	defer sub.Shutdown(ctx)
+
+	var body bytes.Buffer
+	if err := gob.NewEncoder(&body).Encode(GraphChanged{GraphBefore: ForestHash{1}, GraphAfter: ForestHash{2}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := topic.Send(ctx, &pubsub.Message{Body: body.Bytes()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The compilation fails to apply, so CompileChanges stops without
+	// acknowledging the message.
+	twin := DigitalTwin{Applier: failingApplier{}}
+	noop := func(GraphChanged) (Compilation, error) {
+		return func(context.Context, GraphWriter) error { return nil }, nil
+	}
+	component.RunProc(twin.CompileChanges(sub, noop))
+
+	// Had the message been acknowledged, it would never be redelivered and the
+	// call to Receive would block until its deadline.
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	msg, err := sub.Receive(ctx)
+	if err != nil {
+		t.Fatalf("Receive() failed to receive the redelivered message: %v", err)
+	}
+	msg.Ack()
+}
+
+// A failingApplier fails to apply any compilation.
+type failingApplier struct{}
+
+func (failingApplier) Apply(context.Context, Compilation) error {
+	return errors.New("failing applier")
+}
+
+func TestNewEventSource(t *testing.T) {
+	ctx := context.Background()
+	topic := mempubsub.NewTopic()
+	defer topic.Shutdown(ctx)
+	sub := mempubsub.NewSubscription(topic, time.Minute)
+	defer sub.Shutdown(ctx)
+
+	want := GraphChanged{
+		GraphBefore: ForestHash{1},
+		GraphAfter:  ForestHash{2},
+		Timestamp:   time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	body, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := topic.Send(ctx, &pubsub.Message{Body: body}); err != nil {
+		t.Fatal(err)
+	}
+
+	source := NewEventSource(sub, reflect.TypeFor[GraphChanged](), func(p []byte, v reflect.Value) error {
+		return json.Unmarshal(p, v.Interface())
+	})
+	var got []any
+	component.RunProc(func(l *component.L) {
+		l.Go("stream", source.Stream(func(ctx context.Context, msg any) error {
+			got = append(got, msg)
+			// Signal the stream to stop gracefully once it handles the only message.
+			l.Stop(0)
+			return nil
+		}))
+	})
+
+	if diff := cmp.Diff([]any{want}, got); diff != "" {
+		t.Errorf("Stream() handled events mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestPublishChanges(t *testing.T) {
+	ctx := context.Background()
+	topic := mempubsub.NewTopic()
+	defer topic.Shutdown(ctx)
+	sub := mempubsub.NewSubscription(topic, time.Minute)
+	defer sub.Shutdown(ctx)
+
+	// The first observation is empty, so only the second one is published.
+	want := GraphChanged{GraphBefore: ForestHash{1}, GraphAfter: ForestHash{2}}
+	changeder := &fakeChangeder{changes: []GraphChanged{{GraphBefore: ForestHash{1}, GraphAfter: ForestHash{1}}, want}}
+
+	received := make(chan GraphChanged, 1)
+	component.RunProc(func(l *component.L) {
+		l.Go("publish", PublishChanges(changeder, topic, time.Millisecond))
+
+		msg, err := sub.Receive(l.Context())
+		if err != nil {
+			l.Fatal(err)
+		}
+		msg.Ack()
+		var got GraphChanged
+		if err := gob.NewDecoder(bytes.NewReader(msg.Body)).Decode(&got); err != nil {
+			l.Fatal(err)
+		}
+		received <- got
+		// Signal the publisher to stop gracefully, without waiting for this very
+		// lifecycle to complete.
+		l.Stop(0)
+	})
+
+	select {
+	case got := <-received:
+		if got.GraphBefore != want.GraphBefore || got.GraphAfter != want.GraphAfter {
+			t.Errorf("PublishChanges() published %v -> %v, want %v -> %v", got.GraphBefore, got.GraphAfter, want.GraphBefore, want.GraphAfter)
+		}
+	default:
+		t.Fatal("PublishChanges() published nothing")
+	}
+}
+
+func TestPublishChanges_backoff(t *testing.T) {
+	ctx := context.Background()
+	topic := mempubsub.NewTopic()
+	defer topic.Shutdown(ctx)
+	sub := mempubsub.NewSubscription(topic, time.Minute)
+	defer sub.Shutdown(ctx)
+
+	// The changeder fails twice before it succeeds, so the publisher backs off
+	// twice, waiting longer the second time.
+	const initial = 20 * time.Millisecond
+	changeder := &fakeChangeder{
+		errs:    []error{errors.New("first failure"), errors.New("second failure")},
+		changes: []GraphChanged{{GraphBefore: ForestHash{1}, GraphAfter: ForestHash{2}}},
+	}
+	component.RunProc(func(l *component.L) {
+		l.Go("publish", PublishChanges(changeder, topic, time.Millisecond, WithBackoff(initial, time.Second)))
+
+		msg, err := sub.Receive(l.Context())
+		if err != nil {
+			l.Fatal(err)
+		}
+		msg.Ack()
+		// Signal the publisher to stop gracefully, without waiting for this very
+		// lifecycle to complete.
+		l.Stop(0)
+	})
+
+	if len(changeder.calls) < 3 {
+		t.Fatalf("PublishChanges() called WhatChanged %d times, want at least 3", len(changeder.calls))
+	}
+	first := changeder.calls[1].Sub(changeder.calls[0])
+	second := changeder.calls[2].Sub(changeder.calls[1])
+	if first < initial {
+		t.Errorf("PublishChanges() backed off %v after the first failure, want at least %v", first, initial)
+	}
+	if second < 2*initial {
+		t.Errorf("PublishChanges() backed off %v after the second failure, want at least %v", second, 2*initial)
+	}
+}
+
+func TestPublishOptions_backoff(t *testing.T) {
+	selfHealing := errors.New("self-healing")
+	o := publishOptions{
+		initialBackoff: time.Second,
+		maxBackoff:     5 * time.Second,
+		selfHealing:    func(err error) bool { return errors.Is(err, selfHealing) },
+	}
+	tests := []struct {
+		failures int
+		err      error
+		want     time.Duration
+	}{
+		{failures: 1, err: errors.New("transient"), want: time.Second},
+		{failures: 2, err: errors.New("transient"), want: 2 * time.Second},
+		{failures: 3, err: errors.New("transient"), want: 4 * time.Second},
+		{failures: 4, err: errors.New("transient"), want: 5 * time.Second},
+		{failures: 100, err: errors.New("transient"), want: 5 * time.Second},
+		{failures: 3, err: selfHealing, want: time.Second},
+	}
+	for _, tt := range tests {
+		if got := o.backoff(tt.failures, tt.err); got != tt.want {
+			t.Errorf("backoff(%d, %v) = %v, want %v", tt.failures, tt.err, got, tt.want)
+		}
+	}
+}
+
+// A fakeChangeder fails with its errors one by one, then returns its changes
+// one by one, and then empty changes. It records the time of every call.
+type fakeChangeder struct {
+	errs    []error
+	changes []GraphChanged
+	calls   []time.Time
+}
+
+func (c *fakeChangeder) WhatChanged(context.Context) (GraphChanged, error) {
+	c.calls = append(c.calls, time.Now())
+	if len(c.errs) > 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		return GraphChanged{}, err
+	}
+	if len(c.changes) == 0 {
+		return GraphChanged{}, nil
+	}
+	next := c.changes[0]
+	c.changes = c.changes[1:]
+	return next, nil
+}
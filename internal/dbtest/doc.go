@@ -13,6 +13,11 @@ after a test failure. To do this, set the Inspect flag to true:
 
 	go test -dbtest.inspect
 
+Similarly, to run the tests against another version of Neo4j, set the
+Neo4jImageName flag to the desired image:
+
+	go test -dbtest.neo4j.image=docker.io/neo4j:2025-enterprise
+
 This package is intended to be used in tests only. It is not suitable for
 production use.
 */
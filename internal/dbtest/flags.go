@@ -15,6 +15,19 @@ import (
 // information.
 var Inspect = flag.Bool("dbtest.inspect", false, "keep test container running for inspection after a failed test completes")
 
+// Neo4jImageName can be set to override the image SetupNeo4j uses for its
+// containers, which defaults to Neo4jImage. This is useful for validating
+// compatibility with other versions of Neo4j without changing code:
+//
+//	go test -dbtest.neo4j.image=docker.io/neo4j:2025-enterprise ./...
+//
+// A single test may override it with WithNeo4jImage instead.
+//
+// Beware that tests relying on enterprise-only features fail with community
+// images. For example, Bootstrap creates NODE KEY constraints, which the
+// community edition does not support.
+var Neo4jImageName = flag.String("dbtest.neo4j.image", Neo4jImage, "override the image of neo4j test containers")
+
 // waitForInspection blocks until the user signals that they are done inspecting
 // the database by sending a SIGINT (Ctrl+C).
 func waitForInspection() {
@@ -14,7 +14,7 @@ import (
 // Neo4jImage exposes the image to use for the Neo4j container.
 //
 // The enterprise variant is chosen because it is the variant we use in
-// production.
+// production. Override it with the Neo4jImageName flag.
 //
 // See <https://hub.docker.com/_/neo4j> for more images.
 const Neo4jImage = "docker.io/neo4j:5-enterprise"
@@ -45,7 +45,32 @@ const (
 // testcontainers-go modules directly. Otherwise, you may find that your tests
 // break, implying that you depend on a deployment detail no-longer considered
 // "standard" and thus may break in production too.
-func SetupNeo4j(t *testing.T) neo4j.DriverWithContext {
+//
+// Further configure the container with options, such as WithNeo4jImage.
+func SetupNeo4j(t *testing.T, opts ...Neo4jOption) neo4j.DriverWithContext {
+	t.Helper()
+	driver, _ := setupNeo4j(t, opts...)
+	return driver
+}
+
+// A Neo4jOption configures the container spun up by SetupNeo4j.
+type Neo4jOption func(*neo4jConfig)
+
+type neo4jConfig struct {
+	image string
+}
+
+// WithNeo4jImage configures SetupNeo4j to spin up a container of the given
+// image, overriding the Neo4jImageName flag for a single test.
+func WithNeo4jImage(image string) Neo4jOption {
+	return func(c *neo4jConfig) {
+		c.image = image
+	}
+}
+
+// The setupNeo4j function is SetupNeo4j, but also returns the container it
+// spins up for tests that need to inspect it.
+func setupNeo4j(t *testing.T, opts ...Neo4jOption) (neo4j.DriverWithContext, *neo4jtest.Neo4jContainer) {
 	t.Helper()
 
 	// Container-based tests are long-running and should respect the '-short' flag.
@@ -53,6 +78,11 @@ func SetupNeo4j(t *testing.T) neo4j.DriverWithContext {
 		t.Skip("Skipping container-based test in short mode...")
 	}
 
+	config := neo4jConfig{image: *Neo4jImageName}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
 	// Always run container-based tests in parallel.
 	t.Parallel()
 
@@ -60,12 +90,12 @@ func SetupNeo4j(t *testing.T) neo4j.DriverWithContext {
 
 	// Spin up a database container and tear it down gracefully
 	// after the test completes.
-	opts := containerOptions(t,
+	customizers := containerOptions(t,
 		neo4jtest.WithoutAuthentication(),
 		neo4jtest.WithAcceptCommercialLicenseAgreement(),
 	)
 
-	container, err := neo4jtest.Run(ctx, Neo4jImage, opts...)
+	container, err := neo4jtest.Run(ctx, config.image, customizers...)
 	if err != nil {
 		t.Fatal("Failed to run neo4j container:", err)
 	}
@@ -116,7 +146,7 @@ func SetupNeo4j(t *testing.T) neo4j.DriverWithContext {
 		}
 	})
 
-	return driver
+	return driver, container
 }
 
 // Call verifyConnectivityWithRetries to check if there is a working connection
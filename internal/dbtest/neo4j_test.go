@@ -0,0 +1,23 @@
+package dbtest
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSetupNeo4j_image(t *testing.T) {
+	// Use an image other than the one set by the flag (or the default one).
+	want := "docker.io/neo4j:5.26-enterprise"
+	if *Neo4jImageName == want {
+		want = Neo4jImage
+	}
+
+	_, container := setupNeo4j(t, WithNeo4jImage(want))
+	inspect, err := container.Inspect(context.Background())
+	if err != nil {
+		t.Fatal("Inspect:", err)
+	}
+	if got := inspect.Config.Image; got != want {
+		t.Errorf("container image = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,132 @@
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // Registers the "pgx" database/sql driver.
+	postgrestest "github.com/testcontainers/testcontainers-go/modules/postgres"
+)
+
+// PostgresImage exposes the image to use for the PostgreSQL container.
+//
+// See <https://hub.docker.com/_/postgres> for more images.
+const PostgresImage = "docker.io/postgres:17-alpine"
+
+// SetupPostgres spins up a new PostgreSQL Docker container and returns a
+// database handle connected to it. The returned handle is closed during cleanup
+// of the provided [*testing.T].
+//
+// The provided [*testing.T] is used to:
+//   - skip the test if the '-short' flag is set,
+//   - clean up the container after the test completes, and
+//   - mark the test as parallel to avoid blocking other long-running tests.
+//
+// The returned handle uses the "pgx" driver, see
+// <https://pkg.go.dev/github.com/jackc/pgx/v5/stdlib>.
+//
+// This is the PostgreSQL equivalent of SetupNeo4j, and the same caveats apply:
+// this function may change its definition of a "standard" PostgreSQL instance
+// over time. If you need a specific customisation of PostgreSQL, you should use
+// the testcontainers-go modules directly.
+func SetupPostgres(t *testing.T) *sql.DB {
+	t.Helper()
+
+	// Container-based tests are long-running and should respect the '-short' flag.
+	if testing.Short() {
+		t.Skip("Skipping container-based test in short mode...")
+	}
+
+	// Always run container-based tests in parallel.
+	t.Parallel()
+
+	ctx := context.Background()
+
+	// Spin up a database container and tear it down gracefully
+	// after the test completes.
+	opts := containerOptions(t,
+		postgrestest.WithDatabase("digitaltwin"),
+		postgrestest.WithUsername("digitaltwin"),
+		postgrestest.WithPassword("digitaltwin"),
+		postgrestest.BasicWaitStrategies(),
+	)
+
+	container, err := postgrestest.Run(ctx, PostgresImage, opts...)
+	if err != nil {
+		t.Fatal("Failed to run postgres container:", err)
+	}
+	t.Cleanup(func() {
+		t.Logf("Terminating postgres container %q...", container.GetContainerID())
+		if err := container.Terminate(ctx); err != nil {
+			t.Error("Encountered an error during cleanup; terminate container:", err)
+		}
+	})
+
+	// First, get runtime information about the container.
+	dsn, err := container.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		t.Fatal("Failed to get connection string:", err)
+	}
+
+	// Connect to the container database and cleanup by the time the test ends.
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal("Failed to open postgres database:", err)
+	}
+	t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			t.Error("Encountered an error during cleanup while closing the postgres database:", err)
+		}
+	})
+
+	// Verify that the connection is working and the database is ready.
+	if err := pingWithRetries(t, ctx, db); err != nil {
+		t.Fatalf("Failed to establish a connection with the remote postgres server after retries: %v", err)
+	}
+
+	// Keep the container running for manual debugging of the database.
+	t.Cleanup(func() {
+		if t.Failed() && *Inspect {
+			t.Logf("Container %v is still running for inspection (Ctrl+C to terminate)...", container.GetContainerID())
+			t.Logf("Connection string = %s", dsn)
+			waitForInspection()
+		}
+	})
+
+	return db
+}
+
+// Call pingWithRetries to check if there is a working connection to PostgreSQL
+// while also performing retries, like verifyConnectivityWithRetries does for
+// Neo4j.
+func pingWithRetries(t *testing.T, ctx context.Context, db *sql.DB) error {
+	t.Helper()
+
+	const retryLimit = 5
+	const retryPause = 100 * time.Millisecond
+
+	// Initial attempt to verify the connection without a wait.
+	err := db.PingContext(ctx)
+	if err == nil {
+		return nil
+	}
+	// Prefix each subsequent retry with a short wait.
+	for r := range retryLimit {
+		t.Logf("Attempting retry [%d/%d] after failing to establish a connection with the remote postgres server: %v", r, retryLimit, err)
+		// Wait, while honouring context cancellations.
+		select {
+		case <-time.After(retryPause):
+		case <-ctx.Done():
+			return fmt.Errorf("retry pause interrupted")
+		}
+		// Now, rerun the direct connection verification.
+		err = db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
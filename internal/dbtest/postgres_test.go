@@ -0,0 +1,20 @@
+package dbtest
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSetupPostgres(t *testing.T) {
+	db := SetupPostgres(t)
+	if err := db.PingContext(context.Background()); err != nil {
+		t.Fatal("Ping:", err)
+	}
+	var one int
+	if err := db.QueryRowContext(context.Background(), "SELECT 1").Scan(&one); err != nil {
+		t.Fatal("SELECT 1:", err)
+	}
+	if one != 1 {
+		t.Errorf("SELECT 1 = %d, want 1", one)
+	}
+}
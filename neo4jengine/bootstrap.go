@@ -2,8 +2,10 @@ package neo4jengine
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 )
@@ -13,6 +15,7 @@ import (
 //
 // Index by content-address for optimised lookups, and constraint uniqueness by
 // content-address to prevent duplicate nodes (caused by concurrent MERGEs).
+// Additionally, index the properties declared by WithIndexes for each label.
 //
 // To execute queries against the created database, open a session with the
 // database name as the default database. For example:
@@ -22,26 +25,78 @@ import (
 //	... use s ...
 //
 // This function is idempotent.
-func BootstrapDatabase(ctx context.Context, d neo4j.DriverWithContext, name string) error {
-	if err := createDatabase(ctx, d, name); err != nil {
-		return fmt.Errorf("create database: %w", err)
+//
+// Every statement runs with the given context, so a deadline on the context
+// bounds the entire bootstrap. Further bound every statement on its own with
+// WithStatementTimeout.
+func BootstrapDatabase(ctx context.Context, d neo4j.DriverWithContext, name string, opts ...BootstrapOption) error {
+	var c bootstrapConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	err := c.run(ctx, func(ctx context.Context) error {
+		return createDatabase(ctx, d, name)
+	})
+	if err != nil {
+		return fmt.Errorf("create database: %v: %w", name, err)
 	}
 
 	s := d.NewSession(ctx, neo4j.SessionConfig{DatabaseName: name})
 	defer func() { _ = s.Close(ctx) }()
 
+	// We only create the key constraints the database lacks, as issuing no-op
+	// DDL for hundreds of labels on every startup churns the cluster. The end
+	// state is the same either way (the statements are idempotent).
+	var missing map[string]bool
+	err = c.run(ctx, func(ctx context.Context) (err error) {
+		missing, err = missingKeyConstraints(ctx, s, KnownLabels(), c.keyProperties())
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("show constraints: %w", err)
+	}
+
 	// create constraints and indexes for all known labels
-	_, err := s.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+	_, err = s.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
 		for _, l := range KnownLabels() {
-			// we use key constraint instead of uniqueness constraint because we can
-			// (it is only available in the enterprise edition).
-			_, err := s.Run(ctx, `
-				CREATE CONSTRAINT IF NOT EXISTS
-				FOR (n:`+l+`)
-				REQUIRE n._contentAddress IS NODE KEY
-			`, nil)
-			if err != nil {
-				return nil, fmt.Errorf("key constraint: label %v: %w", l, err)
+			if missing[l] {
+				// we use key constraint instead of uniqueness constraint because we can
+				// (it is only available in the enterprise edition).
+				err := c.run(ctx, func(ctx context.Context) error {
+					result, err := s.Run(ctx, `
+						CREATE CONSTRAINT IF NOT EXISTS
+						FOR (n:`+l+`)
+						REQUIRE `+c.keyPattern("n")+` IS NODE KEY
+					`, nil)
+					if err != nil {
+						return err
+					}
+					_, err = result.Consume(ctx)
+					return err
+				})
+				if err != nil {
+					return nil, fmt.Errorf("key constraint: label %v: %w", l, err)
+				}
+			}
+			// Secondary indexes, as declared by WithIndexes. We quote properties
+			// because qualified keys contain dots (see fieldKeys).
+			for _, prop := range globalNodeRegistry.indexesOf(l) {
+				err := c.run(ctx, func(ctx context.Context) error {
+					result, err := s.Run(ctx, `
+						CREATE INDEX IF NOT EXISTS
+						FOR (n:`+l+`)
+						ON (n.`+cypherProperty(prop)+`)
+					`, nil)
+					if err != nil {
+						return err
+					}
+					_, err = result.Consume(ctx)
+					return err
+				})
+				if err != nil {
+					return nil, fmt.Errorf("index: label %v: property %v: %w", l, prop, err)
+				}
 			}
 		}
 		return nil, nil
@@ -52,6 +107,132 @@ func BootstrapDatabase(ctx context.Context, d neo4j.DriverWithContext, name stri
 	return s.Close(ctx)
 }
 
+// The missingKeyConstraints function returns the given labels that lack the
+// NODE KEY constraint on the given properties which BootstrapDatabase creates.
+func missingKeyConstraints(ctx context.Context, s neo4j.SessionWithContext, labels []string, properties []string) (map[string]bool, error) {
+	result, err := s.Run(ctx, `
+		SHOW CONSTRAINTS
+		YIELD type, entityType, labelsOrTypes, properties
+		WHERE type = 'NODE_KEY' AND entityType = 'NODE' AND properties = $properties
+		RETURN labelsOrTypes
+	`, map[string]any{"properties": properties})
+	if err != nil {
+		return nil, fmt.Errorf("run: %w", err)
+	}
+	records, err := result.Collect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("collect: %w", err)
+	}
+
+	missing := make(map[string]bool, len(labels))
+	for _, l := range labels {
+		missing[l] = true
+	}
+	for _, r := range records {
+		v, _ := r.Get("labelsOrTypes")
+		ls, _ := v.([]any)
+		for _, l := range ls {
+			if l, ok := l.(string); ok {
+				delete(missing, l)
+			}
+		}
+	}
+	return missing, nil
+}
+
+// A BootstrapOption configures BootstrapDatabase.
+type BootstrapOption func(*bootstrapConfig)
+
+// A bootstrapConfig holds the configuration of BootstrapDatabase, as set by its
+// options.
+type bootstrapConfig struct {
+	statementTimeout time.Duration // Configured by WithStatementTimeout; non-positive means unbounded.
+	keyProp          string        // Configured by WithNodeKeyProperty; empty means DefaultContentAddressProperty.
+	tenantKey        bool          // Configured by WithTenantKey.
+}
+
+// The keyProperties method returns the properties by which BootstrapDatabase
+// constrains the nodes of every label.
+func (c bootstrapConfig) keyProperties() []string {
+	props := []string{DefaultContentAddressProperty}
+	if c.keyProp != "" {
+		props[0] = c.keyProp
+	}
+	if c.tenantKey {
+		props = append(props, "_tenant")
+	}
+	return props
+}
+
+// The keyPattern method returns the Cypher expression of the key properties of
+// the given node variable, as expected by CREATE CONSTRAINT.
+func (c bootstrapConfig) keyPattern(v string) string {
+	var exprs []string
+	for _, p := range c.keyProperties() {
+		exprs = append(exprs, v+"."+cypherProperty(p))
+	}
+	return "(" + strings.Join(exprs, ", ") + ")"
+}
+
+// WithStatementTimeout configures BootstrapDatabase to fail any single statement
+// (e.g. creating the database, or the constraint of a single label) that does
+// not complete within the given timeout. The returned error names the statement
+// that timed out, and wraps context.DeadlineExceeded.
+//
+// On a slow cluster, a stuck statement otherwise blocks the bootstrap (and
+// usually the startup of its caller) indefinitely. A non-positive timeout
+// restores the default, which bounds statements by the given context alone.
+func WithStatementTimeout(timeout time.Duration) BootstrapOption {
+	return func(c *bootstrapConfig) {
+		c.statementTimeout = timeout
+	}
+}
+
+// WithNodeKeyProperty configures BootstrapDatabase to constrain the nodes of
+// every label by the property of the given name, rather than by
+// DefaultContentAddressProperty. Use it with the same name the Engine is
+// configured with, see WithContentAddressProperty.
+func WithNodeKeyProperty(name string) BootstrapOption {
+	return func(c *bootstrapConfig) {
+		c.keyProp = name
+	}
+}
+
+// WithTenantKey configures BootstrapDatabase to constrain the nodes of every
+// label by their content-address and their tenant together, so the same value
+// may be asserted by several tenants, see WithTenant. Beware, a node key
+// requires every node to carry all of its properties, so an Engine without a
+// tenant can no longer write to the bootstrapped database.
+func WithTenantKey() BootstrapOption {
+	return func(c *bootstrapConfig) {
+		c.tenantKey = true
+	}
+}
+
+// The run method calls fn with the given context, bounded by the configured
+// statement timeout. Callers name the statement when wrapping its error.
+//
+// The driver streams results lazily, so fn must consume the result of its
+// statement (e.g. with Consume or Collect) for the timeout to bound the time the
+// server spends running it, not just the time it takes to send it.
+func (c bootstrapConfig) run(ctx context.Context, fn func(context.Context) error) error {
+	// We check the context upfront, as the driver may block on connecting to the
+	// server before it ever looks at the context.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if c.statementTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.statementTimeout)
+		defer cancel()
+	}
+	err := fn(ctx)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out: %w: %w", ctx.Err(), err)
+	}
+	return err
+}
+
 func createDatabase(ctx context.Context, d neo4j.DriverWithContext, name string) error {
 	if name == "" {
 		panic("neo4jengine: database name must not be empty")
@@ -67,10 +248,14 @@ func createDatabase(ctx context.Context, d neo4j.DriverWithContext, name string)
 	defer func() { _ = s.Close(ctx) }()
 
 	// create a new database if it does not exist
-	_, err := s.Run(ctx, `
+	result, err := s.Run(ctx, `
 			CREATE DATABASE $name IF NOT EXISTS
 		`, map[string]any{
 		"name": name,
 	})
+	if err != nil {
+		return err
+	}
+	_, err = result.Consume(ctx)
 	return err
 }
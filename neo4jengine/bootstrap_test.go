@@ -2,9 +2,12 @@ package neo4jengine
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 
@@ -122,6 +125,235 @@ func TestBootstrapDatabase(t *testing.T) {
 	})
 }
 
+func TestBootstrapDatabase_indexes(t *testing.T) {
+	d := dbtest.SetupNeo4j(t)
+	ctx := context.Background()
+
+	type IMSI struct {
+		digitaltwin.InformationElement
+		Value string
+	}
+	RegisterLabelWithIndexes(IMSI{}, "TestBootstrapDatabaseIndexes", "Value")
+
+	if err := BootstrapDatabase(ctx, d, "indexes"); err != nil {
+		t.Fatalf("BootstrapDatabase() error = %v", err)
+	}
+
+	session := d.NewSession(ctx, neo4j.SessionConfig{DatabaseName: "indexes"})
+	defer func() {
+		if err := session.Close(ctx); err != nil {
+			t.Fatal("Failed to close session:", err)
+		}
+	}()
+	// see https://neo4j.com/docs/cypher-manual/current/indexes/search-performance-indexes/managing-indexes/#list-indexes
+	result, err := session.Run(ctx, "SHOW INDEXES WHERE $label IN labelsOrTypes", map[string]any{
+		"label": "TestBootstrapDatabaseIndexes",
+	})
+	if err != nil {
+		t.Fatal("Failed to list indexes:", err)
+	}
+	var found bool
+	for result.Next(ctx) {
+		t.Log(formatRecord(result.Record()))
+
+		props, ok := result.Record().Get("properties")
+		if !ok {
+			t.Fatal("Indexes table contains no properties column")
+		}
+		if props, ok := props.([]any); ok && len(props) == 1 && props[0] == "Value" {
+			found = true
+		}
+	}
+	if err := result.Err(); err != nil {
+		t.Fatal("Failed to list indexes:", err)
+	}
+	if !found {
+		t.Error("Index on property Value of label TestBootstrapDatabaseIndexes not found")
+	}
+}
+
+func TestBootstrapDatabase_existingConstraints(t *testing.T) {
+	d := dbtest.SetupNeo4j(t)
+
+	type existingConstraintNode struct {
+		digitaltwin.InformationElement
+	}
+	label := registerTestLabel(t, existingConstraintNode{})
+
+	ctx := context.Background()
+	const database = "existing-constraints"
+	s := d.NewSession(ctx, neo4j.SessionConfig{DatabaseName: database})
+	defer func() { _ = s.Close(ctx) }()
+
+	if err := BootstrapDatabase(ctx, d, database); err != nil {
+		t.Fatalf("BootstrapDatabase() error = %v", err)
+	}
+	// After the first bootstrap, no constraint is missing, so the second one
+	// issues no CREATE CONSTRAINT statement at all.
+	recorder := &statementRecordingDriver{DriverWithContext: d}
+	if err := BootstrapDatabase(ctx, recorder, database); err != nil {
+		t.Fatalf("BootstrapDatabase() error = %v", err)
+	}
+	if created := recorder.constraintsCreated(); len(created) != 0 {
+		t.Errorf("BootstrapDatabase() created constraints %q, want none", created)
+	}
+
+	// We drop the constraint of a single label to make sure the second bootstrap
+	// restores it (and only it).
+	result, err := s.Run(ctx, "SHOW CONSTRAINTS YIELD name, labelsOrTypes WHERE labelsOrTypes = [$label] RETURN name",
+		map[string]any{"label": label})
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := result.Single(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, _ := record.Get("name")
+	if _, err := s.Run(ctx, fmt.Sprintf("DROP CONSTRAINT `%s`", name), nil); err != nil {
+		t.Fatal(err)
+	}
+	missing, err := missingKeyConstraints(ctx, s, KnownLabels(), []string{DefaultContentAddressProperty})
+	if err != nil {
+		t.Fatalf("missingKeyConstraints() error = %v", err)
+	}
+	if want := map[string]bool{label: true}; !reflect.DeepEqual(missing, want) {
+		t.Errorf("missingKeyConstraints() = %v, want %v", missing, want)
+	}
+
+	recorder = &statementRecordingDriver{DriverWithContext: d}
+	if err := BootstrapDatabase(ctx, recorder, database); err != nil {
+		t.Fatalf("BootstrapDatabase() error = %v", err)
+	}
+	if created, want := recorder.constraintsCreated(), []string{label}; !reflect.DeepEqual(created, want) {
+		t.Errorf("BootstrapDatabase() created constraints %q, want %q", created, want)
+	}
+	missing, err = missingKeyConstraints(ctx, s, KnownLabels(), []string{DefaultContentAddressProperty})
+	if err != nil {
+		t.Fatalf("missingKeyConstraints() error = %v", err)
+	}
+	if len(missing) != 0 {
+		t.Errorf("missingKeyConstraints() = %v, want none", missing)
+	}
+}
+
+// A statementRecordingDriver is a neo4j.DriverWithContext that records every
+// statement its sessions run, before running it with the wrapped driver.
+type statementRecordingDriver struct {
+	neo4j.DriverWithContext
+	statements []string
+}
+
+func (d *statementRecordingDriver) NewSession(ctx context.Context, config neo4j.SessionConfig) neo4j.SessionWithContext {
+	return &statementRecordingSession{SessionWithContext: d.DriverWithContext.NewSession(ctx, config), driver: d}
+}
+
+// The constraintsCreated method returns the labels of the CREATE CONSTRAINT
+// statements recorded so far, in order.
+func (d *statementRecordingDriver) constraintsCreated() []string {
+	var labels []string
+	for _, stmt := range d.statements {
+		fields := strings.Fields(stmt)
+		if len(fields) < 7 || fields[0] != "CREATE" || fields[1] != "CONSTRAINT" {
+			continue
+		}
+		// CREATE CONSTRAINT IF NOT EXISTS FOR (n:Label) ...
+		_, label, _ := strings.Cut(strings.TrimSuffix(fields[6], ")"), ":")
+		labels = append(labels, label)
+	}
+	return labels
+}
+
+type statementRecordingSession struct {
+	neo4j.SessionWithContext
+	driver *statementRecordingDriver
+}
+
+func (s *statementRecordingSession) Run(ctx context.Context, cypher string, params map[string]any, configurers ...func(*neo4j.TransactionConfig)) (neo4j.ResultWithContext, error) {
+	s.driver.statements = append(s.driver.statements, cypher)
+	return s.SessionWithContext.Run(ctx, cypher, params, configurers...)
+}
+
+func TestBootstrapDatabase_cancelled(t *testing.T) {
+	// We point the driver at a port nobody listens on, so a bootstrap that does
+	// not honour the context would block on connecting.
+	d, err := neo4j.NewDriverWithContext("neo4j://127.0.0.1:1", neo4j.NoAuth())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = d.Close(context.Background()) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	err = BootstrapDatabase(ctx, d, "cancelled", WithStatementTimeout(time.Minute))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("BootstrapDatabase() error = %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("BootstrapDatabase() returned after %v, want promptly", elapsed)
+	}
+}
+
+func TestWithStatementTimeout(t *testing.T) {
+	ctx := context.Background()
+	start := time.Now()
+	err := BootstrapDatabase(ctx, stallingDriver{}, "stalled", WithStatementTimeout(50*time.Millisecond))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("BootstrapDatabase() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("BootstrapDatabase() returned after %v, want promptly", elapsed)
+	}
+}
+
+// A stallingDriver is a neo4j.DriverWithContext whose statements are sent
+// immediately but never complete, as if the server was stuck running them.
+// Consuming their results blocks until the context is done, whereas collecting
+// their records (as queries do) returns none at once.
+type stallingDriver struct {
+	neo4j.DriverWithContext // Panics if the code under test calls anything else.
+}
+
+func (stallingDriver) NewSession(context.Context, neo4j.SessionConfig) neo4j.SessionWithContext {
+	return stallingSession{}
+}
+
+type stallingSession struct {
+	emptySession
+}
+
+func (stallingSession) Run(context.Context, string, map[string]any, ...func(*neo4j.TransactionConfig)) (neo4j.ResultWithContext, error) {
+	return stallingResult{}, nil
+}
+
+type stallingResult struct {
+	neo4j.ResultWithContext // Panics if the code under test calls anything else.
+}
+
+func (stallingResult) Consume(ctx context.Context) (neo4j.ResultSummary, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (stallingResult) Collect(context.Context) ([]*neo4j.Record, error) {
+	return nil, nil
+}
+
+func TestWithIndexes(t *testing.T) {
+	type indexedNode struct {
+		digitaltwin.InformationElement
+		Value string
+	}
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("WithIndexes() of a missing property did not panic")
+		}
+	}()
+	WithIndexes("Missing")(reflect.TypeFor[indexedNode](), &registration{})
+}
+
 func formatRecord(r *neo4j.Record) string {
 	var fields []string
 	for i, key := range r.Keys {
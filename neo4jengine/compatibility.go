@@ -3,10 +3,14 @@ package neo4jengine
 import (
 	"context"
 	"fmt"
+	"maps"
+	"strings"
 
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 
 	"github.com/danielorbach/go-component"
+
+	"github.com/go-digitaltwin/go-digitaltwin"
 )
 
 // RewriteNodesContentAddress changes the content-address stored for all nodes to
@@ -63,3 +67,338 @@ func RewriteNodesContentAddress(ctx context.Context, d neo4j.DriverWithContext,
 	logger.Info("All content-addresses in the graph were successfully rewritten", "count", affected)
 	return nil
 }
+
+// RelabelNodes renames the label of all nodes labelled oldLabel to newLabel,
+// along with their NODE KEY constraints (see BootstrapDatabase). It migrates a
+// graph after renaming a Go type, which changes its default label (see
+// Register), as the nodes would otherwise keep the old label and become
+// unreadable.
+//
+// No node labelled newLabel may share the key of a node labelled oldLabel (i.e.
+// the properties of its NODE KEY constraint, or its content-address), as the
+// two would become duplicates of the same value. RelabelNodes checks this
+// upfront, and fails without modifying the graph otherwise.
+//
+// RelabelNodes is idempotent: once no nodes carry the old label, it leaves the
+// graph as is. Secondary indexes (see WithIndexes) are not migrated, but
+// BootstrapDatabase creates them for the new label anyway. Run it before any
+// Engine uses the graph, as nodes are relabelled in batches of separate
+// transactions that Engines are oblivious to. Should a batch fail, run it again
+// to relabel the rest.
+func RelabelNodes(ctx context.Context, d neo4j.DriverWithContext, database, oldLabel, newLabel string) error {
+	if oldLabel == "" || newLabel == "" {
+		return fmt.Errorf("relabel %q to %q: empty label", oldLabel, newLabel)
+	}
+	if oldLabel == newLabel {
+		return nil
+	}
+	logger := component.Logger(ctx).With("neo4j.database", database, "label.old", oldLabel, "label.new", newLabel)
+
+	s := d.NewSession(ctx, neo4j.SessionConfig{DatabaseName: database, AccessMode: neo4j.AccessModeWrite})
+	defer func() {
+		if err := s.Close(ctx); err != nil {
+			logger.Error("Failed to close neo4j session", "error", err)
+		}
+	}()
+
+	constraints, err := nodeKeyConstraints(ctx, s, oldLabel)
+	if err != nil {
+		return fmt.Errorf("show constraints: %w", err)
+	}
+
+	key := []string{DefaultContentAddressProperty}
+	if len(constraints) > 0 {
+		key = constraints[0].properties
+	}
+	clashes, err := clashingNodes(ctx, s, oldLabel, newLabel, key)
+	if err != nil {
+		return fmt.Errorf("find clashing nodes: %w", err)
+	}
+	if clashes > 0 {
+		return fmt.Errorf("relabel %q to %q: %d nodes already carry the new label with the same key %q", oldLabel, newLabel, clashes, key)
+	}
+
+	// We constrain the new label before relabelling the nodes, so they are never
+	// left unconstrained. Labels are quoted just like properties.
+	for _, c := range constraints {
+		var exprs []string
+		for _, p := range c.properties {
+			exprs = append(exprs, "n."+cypherProperty(p))
+		}
+		_, err := s.Run(ctx, `
+			CREATE CONSTRAINT IF NOT EXISTS
+			FOR (n:`+cypherProperty(newLabel)+`)
+			REQUIRE (`+strings.Join(exprs, ", ")+`) IS NODE KEY
+		`, nil)
+		if err != nil {
+			return fmt.Errorf("key constraint: label %v: %w", newLabel, err)
+		}
+	}
+
+	// Relabelling a large graph in a single transaction may exhaust the memory of
+	// the server, so we commit every batch on its own (which requires the implicit
+	// transaction of Run).
+	result, err := s.Run(ctx, `
+		MATCH (n:`+cypherProperty(oldLabel)+`)
+		CALL {
+			WITH n
+			SET n:`+cypherProperty(newLabel)+`
+			REMOVE n:`+cypherProperty(oldLabel)+`
+		} IN TRANSACTIONS OF $batch ROWS
+		RETURN count(n) as count
+	`, map[string]any{"batch": relabelBatchSize})
+	if err != nil {
+		return fmt.Errorf("relabel nodes: %w", err)
+	}
+	record, err := result.Single(ctx)
+	if err != nil {
+		return fmt.Errorf("query single result: %w", err)
+	}
+	affected, err := getRecordProperty[int64](record, "count")
+	if err != nil {
+		return fmt.Errorf("get number of affected nodes: %w", err)
+	}
+
+	for _, c := range constraints {
+		if _, err := s.Run(ctx, `DROP CONSTRAINT `+cypherProperty(c.name)+` IF EXISTS`, nil); err != nil {
+			return fmt.Errorf("drop constraint %v: %w", c.name, err)
+		}
+	}
+
+	logger.Info("All nodes in the graph were successfully relabelled", "count", affected, "constraints", len(constraints))
+	return nil
+}
+
+// The relabelBatchSize constant is the number of nodes RelabelNodes relabels in
+// every transaction.
+const relabelBatchSize = 10000
+
+// The clashingNodes function returns the number of nodes labelled oldLabel that
+// share the values of the given key properties with a node labelled newLabel.
+func clashingNodes(ctx context.Context, s neo4j.SessionWithContext, oldLabel, newLabel string, key []string) (int64, error) {
+	var conds []string
+	for _, p := range key {
+		conds = append(conds, "o."+cypherProperty(p)+" = n."+cypherProperty(p))
+	}
+	result, err := s.Run(ctx, `
+		MATCH (o:`+cypherProperty(oldLabel)+`), (n:`+cypherProperty(newLabel)+`)
+		WHERE `+strings.Join(conds, " AND ")+`
+		RETURN count(DISTINCT o) AS count
+	`, nil)
+	if err != nil {
+		return 0, fmt.Errorf("run: %w", err)
+	}
+	record, err := result.Single(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("query single result: %w", err)
+	}
+	return getRecordProperty[int64](record, "count")
+}
+
+// A nodeKeyConstraint describes a NODE KEY constraint of a single label.
+type nodeKeyConstraint struct {
+	name       string
+	properties []string
+}
+
+// The nodeKeyConstraints function returns the NODE KEY constraints of the given
+// label.
+func nodeKeyConstraints(ctx context.Context, s neo4j.SessionWithContext, label string) ([]nodeKeyConstraint, error) {
+	result, err := s.Run(ctx, `
+		SHOW CONSTRAINTS
+		YIELD name, type, entityType, labelsOrTypes, properties
+		WHERE type = 'NODE_KEY' AND entityType = 'NODE' AND labelsOrTypes = [$label]
+		RETURN name, properties
+	`, map[string]any{"label": label})
+	if err != nil {
+		return nil, fmt.Errorf("run: %w", err)
+	}
+	records, err := result.Collect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("collect: %w", err)
+	}
+
+	constraints := make([]nodeKeyConstraint, len(records))
+	for i, r := range records {
+		name, err := getRecordProperty[string](r, "name")
+		if err != nil {
+			return nil, fmt.Errorf("get name: %w", err)
+		}
+		props, err := getRecordProperty[[]any](r, "properties")
+		if err != nil {
+			return nil, fmt.Errorf("get properties: %w", err)
+		}
+		constraints[i].name = name
+		for _, p := range props {
+			if p, ok := p.(string); ok {
+				constraints[i].properties = append(constraints[i].properties, p)
+			}
+		}
+	}
+	return constraints, nil
+}
+
+// RecomputeContentAddresses rewrites the content-address (and the properties)
+// of all nodes labelled with the given label, after their registered type gained
+// or lost a field, which changes the content-addresses of its values (see
+// digitaltwin.ContentAddress).
+//
+// The transform function reconstructs the value of every node under the new
+// schema from its RawNode under the old one, e.g. by filling in a default for
+// the new field. It must return a value of the type registered with the label,
+// and may be called more than once per node, as the driver retries transient
+// failures of the entire transaction.
+// Nodes are rewritten in place, so their edges remain intact; nodes of the same
+// tenant (see WithTenant) whose values converge on the same content-address are
+// merged into a single node, along with their edges. Nodes of different tenants
+// are never merged.
+//
+// The options are those the database was bootstrapped with (see
+// BootstrapDatabase), so nodes are matched by the same key; of them, only
+// WithNodeKeyProperty changes how nodes are matched, as nodes are always scoped
+// to their tenant.
+//
+// RecomputeContentAddresses rewrites all nodes in a single transaction, which
+// Engines are oblivious to; run it before any Engine uses the graph. Running it
+// again is harmless, as long as the transform maps values under the new schema
+// to themselves.
+func RecomputeContentAddresses(ctx context.Context, d neo4j.DriverWithContext, database, label string, transform func(RawNode) (digitaltwin.Value, error), opts ...BootstrapOption) error {
+	var c bootstrapConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+	logger := component.Logger(ctx).With("neo4j.database", database, "node.label", label)
+
+	s := d.NewSession(ctx, neo4j.SessionConfig{DatabaseName: database, AccessMode: neo4j.AccessModeWrite})
+	defer func() {
+		if err := s.Close(ctx); err != nil {
+			logger.Error("Failed to close neo4j session", "error", err)
+		}
+	}()
+
+	affected, err := neo4j.ExecuteWrite(ctx, s, func(tx neo4j.ManagedTransaction) (int, error) {
+		return recomputeContentAddresses(ctx, tx, label, c.keyProperties()[0], transform)
+	})
+	if err != nil {
+		return fmt.Errorf("execute write: %w", err)
+	}
+
+	logger.Info("All content-addresses of the label were successfully recomputed", "count", affected)
+	return nil
+}
+
+// The recomputeContentAddresses function implements RecomputeContentAddresses
+// within the given transaction, reading and writing the content-address of every
+// node in the given property. It returns the number of rewritten nodes.
+func recomputeContentAddresses(ctx context.Context, tx neo4j.ManagedTransaction, label, caProperty string, transform func(RawNode) (digitaltwin.Value, error)) (int, error) {
+	ca := cypherProperty(caProperty)
+	l := cypherProperty(label)
+
+	// Nodes rewritten one after the other may swap content-addresses, so we first
+	// move every node of the label out of the way (under a temporary address), to
+	// only ever merge nodes that converge under the new schema.
+	result, err := tx.Run(ctx, `
+		MATCH (n:`+l+`)
+		SET n.`+ca+` = 'recompute:' + n.`+ca+`
+		RETURN n AS node
+	`, nil)
+	if err != nil {
+		return 0, fmt.Errorf("run: %w", err)
+	}
+	records, err := result.Collect(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("collect: %w", err)
+	}
+
+	// The same content-address may be asserted by several tenants, so we match
+	// the node being rewritten by its element ID, and only ever merge it into a
+	// node of its own tenant (the tenant is null when nodes are not scoped to one).
+	const sameTenant = `(x._tenant = n._tenant OR (x._tenant IS NULL AND n._tenant IS NULL))`
+	for i, record := range records {
+		node, err := getRecordProperty[neo4j.Node](record, "node")
+		if err != nil {
+			return 0, fmt.Errorf("get node #%v: %w", i, err)
+		}
+		old, _ := node.Props[caProperty].(string)
+		node.Props[caProperty] = strings.TrimPrefix(old, "recompute:")
+
+		raw, err := newRawNodeWithProperty(node, caProperty)
+		if err != nil {
+			return 0, fmt.Errorf("node %v: %w", node.ElementId, err)
+		}
+		v, err := transform(raw)
+		if err != nil {
+			return 0, fmt.Errorf("transform %v: %w", raw.ContentAddress, err)
+		}
+		next, err := FormatNode(v)
+		if err != nil {
+			return 0, fmt.Errorf("format %v: %w", raw.ContentAddress, err)
+		}
+		if next.Label != label {
+			return 0, fmt.Errorf("transform %v: %T is labelled %v, not %v", raw.ContentAddress, v, next.Label, label)
+		}
+		addr, err := next.ContentAddress.MarshalText()
+		if err != nil {
+			return 0, fmt.Errorf("marshal content address: %w", err)
+		}
+
+		// We keep the metadata of the node as is (including its tenant), other than
+		// its content-address.
+		props := maps.Clone(raw.Metadata)
+		maps.Copy(props, next.Props)
+		props[caProperty] = string(addr)
+
+		params := map[string]any{
+			"id":    node.ElementId,
+			"ca":    string(addr),
+			"props": props,
+		}
+		result, err := tx.Run(ctx, `
+			MATCH (n:`+l+`) WHERE elementId(n) = $id
+			OPTIONAL MATCH (x:`+l+` {`+ca+`: $ca}) WHERE `+sameTenant+`
+			RETURN count(x) AS nodes
+		`, params)
+		if err != nil {
+			return 0, fmt.Errorf("run: %w", err)
+		}
+		record, err := result.Single(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("query single result: %w", err)
+		}
+		existing, err := getRecordProperty[int64](record, "nodes")
+		if err != nil {
+			return 0, fmt.Errorf("get nodes: %w", err)
+		}
+
+		statements := []string{`
+			MATCH (n:` + l + `) WHERE elementId(n) = $id
+			SET n = $props
+		`}
+		// A node already rewritten to the same content-address absorbs the edges of
+		// this one, which is then deleted. All edges are CONNECTS (see AssertEdge).
+		if existing > 0 {
+			statements = []string{`
+				MATCH (n:` + l + `)-[:CONNECTS]->(to) WHERE elementId(n) = $id
+				MATCH (x:` + l + ` {` + ca + `: $ca}) WHERE ` + sameTenant + `
+				MERGE (x)-[:CONNECTS]->(to)
+			`, `
+				MATCH (from)-[:CONNECTS]->(n:` + l + `) WHERE elementId(n) = $id
+				MATCH (x:` + l + ` {` + ca + `: $ca}) WHERE ` + sameTenant + `
+				MERGE (from)-[:CONNECTS]->(x)
+			`, `
+				MATCH (n:` + l + `) WHERE elementId(n) = $id
+				DETACH DELETE n
+			`}
+		}
+		for _, statement := range statements {
+			result, err := tx.Run(ctx, statement, params)
+			if err != nil {
+				return 0, fmt.Errorf("rewrite %v: %w", raw.ContentAddress, err)
+			}
+			if _, err := result.Consume(ctx); err != nil {
+				return 0, fmt.Errorf("rewrite %v: %w", raw.ContentAddress, err)
+			}
+		}
+	}
+	return len(records), nil
+}
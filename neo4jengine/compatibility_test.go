@@ -2,12 +2,16 @@ package neo4jengine
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 
+	"github.com/go-digitaltwin/go-digitaltwin"
+	"github.com/go-digitaltwin/go-digitaltwin/enginetest"
 	"github.com/go-digitaltwin/go-digitaltwin/internal/dbtest"
 )
 
@@ -52,6 +56,253 @@ func TestRewriteNodesContentAddress(t *testing.T) {
 	}
 }
 
+func TestRelabelNodes(t *testing.T) {
+	type renamedNode struct {
+		digitaltwin.InformationElement
+		Value string
+	}
+	newLabel := registerTestLabel(t, renamedNode{})
+	oldLabel := newLabel + "Old"
+
+	ctx := context.Background()
+	d := dbtest.SetupNeo4j(t)
+	s := writeSession(t, d)
+
+	// We seed the graph as an older version of the code would have, before the Go
+	// type was renamed.
+	value := renamedNode{Value: "42"}
+	ca, err := digitaltwin.MustContentAddress(value).MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seedGraph(t, s, map[string]any{"ca": string(ca)},
+		"CREATE CONSTRAINT FOR (n:"+oldLabel+") REQUIRE n._contentAddress IS NODE KEY",
+		"CREATE (:"+oldLabel+" {_contentAddress: $ca, Value: '42'})",
+	)
+
+	// Relabelling twice must be harmless.
+	for range 2 {
+		if err := RelabelNodes(ctx, d, "neo4j", oldLabel, newLabel); err != nil {
+			t.Fatalf("RelabelNodes() = %v", err)
+		}
+	}
+
+	engine, err := NewEngine(ctx, d, "neo4j")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b digitaltwin.AssemblyBuilder
+	b.Roots(value)
+	got, found, err := engine.GetComponent(ctx, b.Assemble().AssemblyID())
+	if err != nil || !found {
+		t.Fatalf("GetComponent() = %v, %v; want the relabelled node", found, err)
+	}
+	var values []digitaltwin.Value
+	for v := range got.Values() {
+		values = append(values, v)
+	}
+	if diff := cmp.Diff([]digitaltwin.Value{value}, values); diff != "" {
+		t.Errorf("GetComponent() mismatch (-want +got):\n%s", diff)
+	}
+
+	// The constraint must have moved along with the nodes.
+	for label, want := range map[string]int{oldLabel: 0, newLabel: 1} {
+		constraints, err := nodeKeyConstraints(ctx, s, label)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(constraints) != want {
+			t.Errorf("nodeKeyConstraints(%s) = %v, want %d", label, constraints, want)
+		}
+	}
+
+	// A node of the old label that duplicates a node of the new one must fail the
+	// relabelling upfront, leaving the graph as is.
+	seedGraph(t, s, map[string]any{"ca": string(ca)}, "CREATE (:"+oldLabel+" {_contentAddress: $ca, Value: '42'})")
+	if err := RelabelNodes(ctx, d, "neo4j", oldLabel, newLabel); err == nil {
+		t.Errorf("RelabelNodes() of a duplicate node = nil; want error")
+	}
+	result, err := s.Run(ctx, "MATCH (n:"+oldLabel+") RETURN count(n) AS count", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := result.Single(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := record.Get("count"); count != int64(1) {
+		t.Errorf("RelabelNodes() left %v nodes of the old label, want 1", count)
+	}
+}
+
+func TestRecomputeContentAddresses(t *testing.T) {
+	// The schema of the node before and after it gained the Unit field.
+	type measurementV1 struct {
+		digitaltwin.InformationElement
+		Value string
+	}
+	type measurement struct {
+		digitaltwin.InformationElement
+		Value string
+		Unit  string
+	}
+	label := registerTestLabel(t, measurement{})
+
+	ctx := context.Background()
+	d := dbtest.SetupNeo4j(t)
+	s := writeSession(t, d)
+
+	// We seed the graph as an older version of the code would have, before the
+	// field was added: a measurement connected to a node of another label.
+	old, err := digitaltwin.MustContentAddress(measurementV1{Value: "42"}).MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := FormatNode(enginetest.NodeA{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := leaf.ContentAddress.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seedGraph(t, s, map[string]any{"old": string(old), "ca": string(ca)}, `
+		CREATE (:`+label+` {_contentAddress: $old, Value: '42'})-[:CONNECTS]->(:`+leaf.Label+` {_contentAddress: $ca})
+	`)
+
+	transform := func(raw RawNode) (digitaltwin.Value, error) {
+		v, _ := raw.Props["Value"].(string)
+		return measurement{Value: v, Unit: "cm"}, nil
+	}
+	// Recomputing twice must be harmless.
+	for range 2 {
+		if err := RecomputeContentAddresses(ctx, d, "neo4j", label, transform); err != nil {
+			t.Fatalf("RecomputeContentAddresses() = %v", err)
+		}
+	}
+
+	engine, err := NewEngine(ctx, d, "neo4j")
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := measurement{Value: "42", Unit: "cm"}
+	var b digitaltwin.AssemblyBuilder
+	b.Roots(value)
+	got, found, err := engine.GetComponent(ctx, b.Assemble().AssemblyID())
+	if err != nil || !found {
+		t.Fatalf("GetComponent() = %v, %v; want the recomputed node", found, err)
+	}
+	var edges [][2]digitaltwin.Value
+	got.VisitEdges(func(from, to digitaltwin.Value) bool {
+		edges = append(edges, [2]digitaltwin.Value{from, to})
+		return true
+	})
+	if diff := cmp.Diff([][2]digitaltwin.Value{{value, enginetest.NodeA{}}}, edges); diff != "" {
+		t.Errorf("GetComponent() edges mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRecomputeContentAddresses_tenants(t *testing.T) {
+	// The schema of the node before and after it gained the Unit field.
+	type measurementV1 struct {
+		digitaltwin.InformationElement
+		Value string
+	}
+	type measurement struct {
+		digitaltwin.InformationElement
+		Value string
+		Unit  string
+	}
+	label := registerTestLabel(t, measurement{})
+
+	ctx := context.Background()
+	d := dbtest.SetupNeo4j(t)
+	s := writeSession(t, d)
+
+	address := func(v digitaltwin.Value) string {
+		ca, err := digitaltwin.MustContentAddress(v).MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(ca)
+	}
+	// Both tenants assert the same measurement, yet acme also asserts one that
+	// converges on it under the new schema.
+	seedGraph(t, s, map[string]any{
+		"old":    address(measurementV1{Value: "42"}),
+		"padded": address(measurementV1{Value: " 42"}),
+		"a":      address(enginetest.NodeA{}),
+		"b":      address(enginetest.NodeB{}),
+	}, `
+		CREATE (:`+label+` {_contentAddress: $old, Value: '42', _tenant: 'acme'})-[:CONNECTS]->(:NodeA {_contentAddress: $a, _tenant: 'acme'})
+		CREATE (:`+label+` {_contentAddress: $padded, Value: ' 42', _tenant: 'acme'})-[:CONNECTS]->(:NodeB {_contentAddress: $b, _tenant: 'acme'})
+		CREATE (:`+label+` {_contentAddress: $old, Value: '42', _tenant: 'globex'})-[:CONNECTS]->(:NodeA {_contentAddress: $a, _tenant: 'globex'})
+	`)
+
+	transform := func(raw RawNode) (digitaltwin.Value, error) {
+		v, _ := raw.Props["Value"].(string)
+		return measurement{Value: strings.TrimSpace(v), Unit: "cm"}, nil
+	}
+	if err := RecomputeContentAddresses(ctx, d, "neo4j", label, transform); err != nil {
+		t.Fatalf("RecomputeContentAddresses() = %v", err)
+	}
+
+	// The nodes of acme merge, but never with the node of globex.
+	value := measurement{Value: "42", Unit: "cm"}
+	want := map[string][][2]digitaltwin.Value{
+		"acme":   {{value, enginetest.NodeA{}}, {value, enginetest.NodeB{}}},
+		"globex": {{value, enginetest.NodeA{}}},
+	}
+	for tenant, want := range want {
+		engine, err := NewEngine(ctx, d, "neo4j", WithTenant(tenant))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b digitaltwin.AssemblyBuilder
+		b.Roots(value)
+		got, found, err := engine.GetComponent(ctx, b.Assemble().AssemblyID())
+		if err != nil || !found {
+			t.Fatalf("GetComponent() of %s = %v, %v; want the recomputed node", tenant, found, err)
+		}
+		var edges [][2]digitaltwin.Value
+		got.VisitEdges(func(from, to digitaltwin.Value) bool {
+			edges = append(edges, [2]digitaltwin.Value{from, to})
+			return true
+		})
+		less := func(x, y [2]digitaltwin.Value) bool { return fmt.Sprintf("%T", x[1]) < fmt.Sprintf("%T", y[1]) }
+		if diff := cmp.Diff(want, edges, cmpopts.SortSlices(less)); diff != "" {
+			t.Errorf("GetComponent() of %s edges mismatch (-want +got):\n%s", tenant, diff)
+		}
+	}
+}
+
+// The writeSession function opens a write session on the default database of the
+// given driver, which it closes when the test ends.
+func writeSession(t *testing.T, d neo4j.DriverWithContext) neo4j.SessionWithContext {
+	t.Helper()
+	s := d.NewSession(context.Background(), neo4j.SessionConfig{
+		DatabaseName: "neo4j",
+		AccessMode:   neo4j.AccessModeWrite,
+	})
+	t.Cleanup(func() {
+		if err := s.Close(context.Background()); err != nil {
+			t.Errorf("Failed to close neo4j session: %v", err)
+		}
+	})
+	return s
+}
+
+// The seedGraph function runs the given queries in order, as an older version of
+// the code (or a manual Cypher query) would have shaped the graph.
+func seedGraph(t *testing.T, s neo4j.SessionWithContext, params map[string]any, queries ...string) {
+	t.Helper()
+	for _, query := range queries {
+		if _, err := s.Run(context.Background(), query, params); err != nil {
+			t.Fatalf("Failed to seed graph with testdata: %v", err)
+		}
+	}
+}
+
 func contentAddresses(t *testing.T, s neo4j.SessionWithContext) []string {
 	t.Helper()
 
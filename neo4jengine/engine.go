@@ -4,12 +4,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"maps"
 	"reflect"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/danielorbach/go-component"
 	"github.com/go-digitaltwin/go-digitaltwin"
+	"github.com/go-digitaltwin/go-digitaltwin/compilation"
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
@@ -35,23 +40,62 @@ type Engine struct {
 	driver   neo4j.DriverWithContext // Connection to the neo4j server/cluster.
 	database string                  // Target database name that identifies the specific underlying neo4j graph.
 	snapshot snapshot
+	roots    rootIndex // The roots of the multi-root components of snapshot.
+	// Guards snapshot, roots and retained. Sweeps update them after releasing txMutex
+	// (see fetchTaintedAssemblies), so concurrent sweeps must not interleave their
+	// bookkeeping.
+	snapshotMu sync.Mutex
 
 	taintedNodes nodeMap // Maps digitaltwin.NodeHash to RawNode for tracking changes of disjoint graph components.
 	// Ensures multiple concurrent write transactions can safely modify the Neo4j
 	// graph, while read transactions get an exclusive lock to maintain data
 	// integrity.
 	txMutex graphWRMutex
+
+	logger            *slog.Logger          // Configured by WithLogger; nil means the logger of each call's context.
+	softDelete        bool                  // Configured by WithSoftDelete.
+	snapshotBatchSize int                   // Configured by WithSnapshotBatchSize; non-positive means a single query.
+	withoutTainting   bool                  // Configured by WithoutTainting.
+	maxMutations      int                   // Configured by WithMaxMutationsPerApply; non-positive means unlimited.
+	bookmarks         neo4j.BookmarkManager // Configured by WithBookmarks; nil means sessions are not causally chained.
+	sessionTemplate   neo4j.SessionConfig   // Configured by WithSessionConfig.
+	readAccessMode    neo4j.AccessMode      // Configured by WithReadAccessMode.
+	skipVerification  bool                  // Configured by WithoutContentAddressVerification.
+	parseCache        *parseCache           // Configured by WithParseCache; nil means nodes are parsed every time.
+	skipMalformed     bool                  // Configured by WithSkipMalformedNodes.
+	// Configured by WithRetainAssemblies; nil means assemblies are not retained.
+	retained map[digitaltwin.ComponentID]digitaltwin.Assembly
+	// Configured by WithCorruptionHandler; nil means the Engine panics.
+	corruptionHandler func(ctx context.Context, reason string) error
+	// Configured by WithMaxComponentNodes; non-positive means unlimited.
+	maxComponentNodes int
+	// Configured by WithContentAddressProperty; empty means
+	// DefaultContentAddressProperty.
+	caProperty string
+	// Configured by WithTenant; empty means the Engine is not scoped to a tenant.
+	tenant       string
+	relaxedReads bool // Configured by WithRelaxedReadConsistency.
+	// Configured by WithAuditSink; nil means committed steps are not audited.
+	auditSink func(ctx context.Context, steps []compilation.Step) error
 }
 
 // A nodeMap stores the tainted nodes of disjoint graph components that were
 // modified during a compilation.
 //
-// The zero-value nodeMap is ready for use.
+// A nodeMap may be limited to a number of distinct tainted nodes, see
+// WithTaintLimit. Once it overflows, it discards all of its tainted nodes and
+// stops storing new ones until the next call to ClearTaints, which reports the
+// overflow instead.
+//
+// The zero-value nodeMap is ready for use, and is unlimited.
 //
 // A nodeMap is safe for concurrent-use.
 type nodeMap struct {
-	m  map[digitaltwin.NodeHash]RawNode
-	mu sync.Mutex
+	m          map[digitaltwin.NodeHash]RawNode
+	limit      int  // Non-positive means unlimited.
+	overflowed bool // Whether more than limit distinct nodes were tainted.
+	sizeHint   int  // The typical number of tainted nodes per sweep, see ClearTaints.
+	mu         sync.Mutex
 }
 
 // Taint marks the given RawNodes as "dirty", storing them for later use by
@@ -62,32 +106,65 @@ type nodeMap struct {
 func (t *nodeMap) Taint(nodes ...RawNode) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
+	// Once overflowed, we no longer care which nodes are tainted.
+	if t.overflowed {
+		return
+	}
 	// Make the zero-value meaningful.
 	if t.m == nil {
-		t.m = make(map[digitaltwin.NodeHash]RawNode)
+		t.m = make(map[digitaltwin.NodeHash]RawNode, t.sizeHint)
 	}
 	for _, node := range nodes {
 		t.m[node.ContentAddress] = node
 	}
+	if t.limit > 0 && len(t.m) > t.limit {
+		t.m = nil
+		t.overflowed = true
+	}
 }
 
 // ClearTaints returns the "dirty" nodes, as marked by prior calls to Taint, and
 // "cleans" the nodeMap. So, further calls to ClearTaints without calling Taint
 // return an empty slice.
-func (t *nodeMap) ClearTaints() []RawNode {
+//
+// If the nodeMap overflowed its limit since the last call, ClearTaints returns
+// no nodes and reports the overflow instead, as the nodes it returns would be
+// incomplete.
+func (t *nodeMap) ClearTaints() (nodes []RawNode, overflowed bool) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
+	overflowed, t.overflowed = t.overflowed, false
 	// Shortcut, do nothing.
 	if t.m == nil {
-		return nil
+		return nil, overflowed
 	}
 	// We need to both return the marked nodes and clear the internal memory.
-	nodes := make([]RawNode, 0, len(t.m))
+	nodes = make([]RawNode, 0, len(t.m))
 	for _, node := range t.m {
 		nodes = append(nodes, node)
 	}
+	// We drop the map rather than clear it, as a Go map never shrinks: a single
+	// bulk import would otherwise hold on to its capacity for good. Instead, we
+	// pre-size the next map to the typical number of tainted nodes, averaging
+	// the sizes of recent sweeps; so steady-state workloads rarely grow the map,
+	// and the memory of a burst is released within a few sweeps after it.
+	t.sizeHint = (t.sizeHint + len(t.m)) / 2
 	t.m = nil
-	return nodes
+	return nodes, overflowed
+}
+
+// Retaint undoes a call to ClearTaints whose nodes were not swept after all,
+// marking them (and the overflow, if reported) "dirty" again on top of any
+// nodes tainted since.
+func (t *nodeMap) Retaint(nodes []RawNode, overflowed bool) {
+	if overflowed {
+		t.mu.Lock()
+		t.m = nil
+		t.overflowed = true
+		t.mu.Unlock()
+		return
+	}
+	t.Taint(nodes...)
 }
 
 // NewEngine returns a ready-to-use Engine using the given database as the
@@ -97,16 +174,399 @@ func (t *nodeMap) ClearTaints() []RawNode {
 // graph components in the given graph. In the future, we plan to enable callers
 // to replace this (potentially expensive) initialisation with an externally
 // composed snapshot.
-func NewEngine(ctx context.Context, driver neo4j.DriverWithContext, database string) (*Engine, error) {
-	s, err := captureSnapshot(ctx, driver, database)
+//
+// Further configure the returned Engine with options, such as WithLogger.
+func NewEngine(ctx context.Context, driver neo4j.DriverWithContext, database string, opts ...Option) (*Engine, error) {
+	e := &Engine{
+		driver:         driver,
+		database:       database,
+		readAccessMode: neo4j.AccessModeRead,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	ctx = component.InjectLogger(ctx, e.loggerFrom(ctx))
+	s, roots, err := e.graphReader(ctx).captureSnapshot(ctx, driver, e.sessionConfig(neo4j.AccessModeRead), e.snapshotBatchSize)
 	if err != nil {
 		return nil, fmt.Errorf("capture initial snapshot: %w", err)
 	}
-	return &Engine{
-		driver:   driver,
-		database: database,
-		snapshot: s,
-	}, nil
+	e.snapshot = s
+	e.roots = roots
+	return e, nil
+}
+
+// An Option configures an Engine, see NewEngine.
+type Option func(*Engine)
+
+// WithLogger configures the Engine to log through the given logger.
+//
+// By default, the Engine logs through the logger of the context passed to each
+// of its methods (see component.Logger), which ties its users to the component
+// framework.
+func WithLogger(logger *slog.Logger) Option {
+	return func(e *Engine) {
+		e.logger = logger
+	}
+}
+
+// WithSoftDelete configures the Engine to tombstone retracted nodes instead of
+// deleting them, so the graph retains an audit trail of what once existed.
+//
+// A tombstoned node loses all of its edges and is marked with a "_deleted_at"
+// timestamp. The Engine ignores tombstoned nodes when reading the graph, so they
+// disappear from WhatChanged just like deleted nodes do, yet remain queryable
+// directly in Neo4j. Asserting a tombstoned node (or an edge to it) lifts its
+// tombstone.
+//
+// By default, the Engine deletes retracted nodes permanently.
+func WithSoftDelete() Option {
+	return func(e *Engine) {
+		e.softDelete = true
+	}
+}
+
+// WithSnapshotBatchSize configures the Engine to capture snapshots of the entire
+// graph (e.g. in NewEngine) in batches of at most n graph components, rather than
+// with a single query whose result is as large as the graph itself. This bounds
+// the memory the driver needs when sweeping huge graphs, at the cost of a few
+// more round-trips.
+//
+// The captured snapshot is identical either way. A non-positive n restores the
+// default, which captures snapshots with a single query.
+func WithSnapshotBatchSize(n int) Option {
+	return func(e *Engine) {
+		e.snapshotBatchSize = n
+	}
+}
+
+// WithoutTainting configures the Engine to skip tracking which nodes each
+// compilation modifies (i.e. tainting them). Instead, WhatChanged (and
+// StreamChanges) sweep the entire graph every time, just like NewEngine does,
+// and diff it against the stored snapshot.
+//
+// Tainting is pure overhead for bulk imports that are followed by a single call
+// to WhatChanged, as the memory it takes grows with every modified node. Beware,
+// every sweep reads the entire graph, which is as expensive as the graph is
+// large, so this option suits engines that rarely call WhatChanged.
+//
+// By default, the Engine taints modified nodes and only sweeps their components.
+func WithoutTainting() Option {
+	return func(e *Engine) {
+		e.withoutTainting = true
+	}
+}
+
+// WithTaintLimit configures the Engine to track at most n distinct modified
+// nodes (i.e. taints) between calls to WhatChanged. Once more nodes are
+// modified, the Engine discards its taints, and the next call to WhatChanged
+// (or StreamChanges) sweeps the entire graph instead, as if configured
+// WithoutTainting for that call alone.
+//
+// This bounds the memory taints take during bulk imports, which may otherwise
+// taint the entire graph; at which point sweeping only the components of the
+// tainted nodes is no cheaper than sweeping the entire graph anyway.
+//
+// A non-positive n restores the default, which tracks any number of taints.
+func WithTaintLimit(n int) Option {
+	return func(e *Engine) {
+		e.taintedNodes.limit = n
+	}
+}
+
+// WithMaxMutationsPerApply configures the Engine to fail any compilation that
+// performs more than n mutations (i.e. calls to the methods of its
+// digitaltwin.GraphWriter, asserting or retracting alike). Once a compilation
+// exceeds its budget, the Engine rolls back its transaction, and Apply (or
+// ApplyIfUnchanged) returns ErrMutationBudgetExceeded.
+//
+// A buggy compilation may otherwise issue an unbounded number of mutations in a
+// single transaction, locking huge portions of the graph until it commits.
+//
+// A non-positive n restores the default, which does not limit mutations.
+func WithMaxMutationsPerApply(n int) Option {
+	return func(e *Engine) {
+		e.maxMutations = n
+	}
+}
+
+// WithRelaxedReadConsistency configures the Engine to sweep the graph (see
+// WhatChanged) without excluding concurrent calls to Apply for the duration of
+// the sweep. By default, the Engine locks the graph exclusively while sweeping
+// it (see graphWRMutex), so a long sweep blocks all writes.
+//
+// Instead, the Engine only waits for the writes in flight to commit before it
+// sweeps, and relies on Neo4j to read (at least) the state they committed,
+// causally chaining its sessions with bookmarks (see WithBookmarks). Writes
+// that commit during the sweep are swept by the next call to WhatChanged, but
+// the sweep may already observe some of their effects; so a changeset may
+// include the (consistent) results of compilations applied after WhatChanged
+// was called, and a component read twice by the same sweep may change between
+// reads, in which case the Engine keeps its first read rather than fail the
+// sweep as corrupted. A sweep that fails (e.g. with RootlessAssembliesError)
+// is retried by the next call to WhatChanged, rather than lose the changes it
+// had to sweep.
+//
+// StreamChanges, ListComponents, ComponentCount, VerifySnapshot and
+// GetComponent still lock the graph exclusively.
+func WithRelaxedReadConsistency() Option {
+	return func(e *Engine) {
+		e.relaxedReads = true
+		if e.bookmarks == nil {
+			e.bookmarks = neo4j.NewBookmarkManager(neo4j.BookmarkManagerConfig{})
+		}
+	}
+}
+
+// WithBookmarks configures the Engine to causally chain its sessions with
+// bookmarks, so WhatChanged (and StreamChanges, and GetComponent) always observe
+// the writes of every prior call to Apply; even when the driver routes them to
+// different members of a cluster.
+//
+// The Engine captures the bookmark of every write transaction once it commits,
+// and passes the bookmarks it has captured to every session it opens (see
+// neo4j.SessionConfig.BookmarkManager), which waits for the server to catch up
+// with them before it reads.
+//
+// By default, sessions are not chained, which is cheaper, and suits engines that
+// talk to a single Neo4j server.
+func WithBookmarks() Option {
+	return func(e *Engine) {
+		e.bookmarks = neo4j.NewBookmarkManager(neo4j.BookmarkManagerConfig{})
+	}
+}
+
+// WithSessionConfig configures the Engine to open its sessions based on the
+// given template, e.g. to impersonate a user, or to tune the fetch size. The
+// Engine always overrides the database name and the access mode of the
+// template; and its bookmark manager too, if configured WithBookmarks.
+func WithSessionConfig(template neo4j.SessionConfig) Option {
+	return func(e *Engine) {
+		e.sessionTemplate = template
+	}
+}
+
+// WithReadAccessMode configures the access mode of the sessions the Engine opens
+// to read the graph (e.g. in WhatChanged), which a cluster routes accordingly.
+//
+// By default, the Engine reads with neo4j.AccessModeRead, so a cluster routes its
+// reads to followers and read-replicas, and spreads the load off the leader.
+// Such members may lag behind the leader; so either configure the Engine
+// WithBookmarks, or configure neo4j.AccessModeWrite to route reads to the leader
+// as well.
+func WithReadAccessMode(mode neo4j.AccessMode) Option {
+	return func(e *Engine) {
+		e.readAccessMode = mode
+	}
+}
+
+// WithoutContentAddressVerification configures the Engine to trust the
+// content-addresses stored in the graph, rather than recompute the
+// content-address of every node it parses and compare it to the stored one (see
+// ParseNode). This halves the hashing cost of sweeps, which parse every node of
+// the graph (or of the tainted components).
+//
+// Beware, the Engine then no longer detects nodes whose properties were modified
+// behind its back (e.g. by a manual Cypher query), and reports them with
+// content-addresses that do not match their values.
+//
+// By default, the Engine verifies the content-address of every node it parses.
+func WithoutContentAddressVerification() Option {
+	return func(e *Engine) {
+		e.skipVerification = true
+	}
+}
+
+// WithParseCache configures the Engine to memoise up to size of the values it
+// parses from the nodes of the graph, evicting the least recently used ones. A
+// node shared by many assemblies (e.g. a common child) is then parsed once per
+// sweep, rather than once per assembly. As nodes are immutable by their
+// content-address, memoised values are always valid.
+//
+// A non-positive size restores the default, which parses every node every time.
+func WithParseCache(size int) Option {
+	return func(e *Engine) {
+		e.parseCache = nil
+		if size > 0 {
+			e.parseCache = newParseCache(size)
+		}
+	}
+}
+
+// WithCorruptionHandler configures the Engine to call the given handler instead
+// of panicking when it detects that the graph has lost its integrity (e.g. a
+// write modified more nodes than it should have, or a read transaction observed
+// an assembly that was modified while it ran). The method that detected the
+// corruption (e.g. Apply or WhatChanged) then fails with the error returned by
+// the handler, or with ErrCorruptedGraph if the handler returns nil.
+//
+// A corrupted graph is unrecoverable by design, so the handler should prevent
+// further use of the Engine (e.g. quarantine its database); it suits servers
+// that host several databases, any one of which may be corrupted without
+// crashing the entire process. Beware, corruption detected by a
+// digitaltwin.GraphWriter surfaces as an error from its method, which the
+// compilation must return for Apply to roll back its transaction.
+//
+// By default, the Engine panics when it detects a corrupted graph.
+func WithCorruptionHandler(handler func(ctx context.Context, reason string) error) Option {
+	return func(e *Engine) {
+		e.corruptionHandler = handler
+	}
+}
+
+// WithAuditSink configures the Engine to hand the steps of every compilation it
+// commits by ApplySteps to the given sink (e.g. to append them to a Kafka topic),
+// keeping a replayable log of the graph for audit and disaster recovery (see
+// compilation.Replay). Compilations applied by Apply or ApplyIfUnchanged are not
+// audited, as arbitrary closures cannot be recorded.
+//
+// The Engine calls the sink after the write transaction commits, so a failing
+// sink cannot roll it back; the Engine logs the failure instead, and ApplySteps
+// succeeds regardless.
+func WithAuditSink(sink func(ctx context.Context, steps []compilation.Step) error) Option {
+	return func(e *Engine) {
+		e.auditSink = sink
+	}
+}
+
+// WithSkipMalformedNodes configures the Engine to skip the nodes of the graph
+// that lack the metadata it manages (e.g. nodes created by a manual Cypher query
+// without a content-address), rather than failing the entire sweep on them. The
+// Engine logs and counts every node it skips, see the
+// snapshot_malformed_node_counter metric.
+//
+// A skipped node is excluded from its assembly along with its edges, and so are
+// the nodes only reachable from the root through it; if it is the root of an
+// assembly, the entire assembly is skipped, as the rest of it is unreachable
+// without its root.
+func WithSkipMalformedNodes() Option {
+	return func(e *Engine) {
+		e.skipMalformed = true
+	}
+}
+
+// WithMaxComponentNodes configures the Engine to fail a sweep (see WhatChanged)
+// with a ComponentTooLargeError upon a component of more than n nodes, rather
+// than materialise its assembly. It is a safety valve for pathological graphs,
+// e.g. a runaway compilation merging most of the graph into a single component,
+// whose assembly would otherwise spike the memory of the process.
+//
+// The Engine counts the nodes of every swept component before parsing them, so
+// a component too large is never parsed. A non-positive n means unlimited,
+// which is the default.
+func WithMaxComponentNodes(n int) Option {
+	return func(e *Engine) {
+		e.maxComponentNodes = n
+	}
+}
+
+// WithContentAddressProperty configures the Engine to store the content-address
+// of every node under the property of the given name, rather than under
+// DefaultContentAddressProperty; e.g. to share a database with other systems
+// that reserve the underscore prefix, or that expect a name of their own.
+//
+// The Engine reads and writes the property by this name alone, so every Engine
+// (and every BootstrapDatabase, see WithNodeKeyProperty) of the same database
+// must agree on it. Changing it for an existing database requires migrating the
+// property of its nodes first. The property is metadata, so it is never parsed
+// into a field of a node, even if its name lacks the underscore prefix.
+func WithContentAddressProperty(name string) Option {
+	return func(e *Engine) {
+		e.caProperty = name
+	}
+}
+
+// WithTenant configures the Engine to scope every node it matches or merges to
+// the given tenant, by the _tenant property of the node. The Engine stamps the
+// nodes it creates with the tenant, and sweeps (e.g. WhatChanged) report only
+// the components of the tenant, so several tenants co-locate their components
+// in a single database, isolated from one another.
+//
+// Every node is identified by its content-address and its tenant, so the same
+// value asserted by two tenants results in two distinct nodes. Beware, the key
+// constraint created by BootstrapDatabase forbids that, unless bootstrapped
+// WithTenantKey. Nodes lacking the _tenant property (e.g. created by an Engine
+// without a tenant) belong to no tenant, and are invisible to a scoped Engine.
+func WithTenant(id string) Option {
+	return func(e *Engine) {
+		e.tenant = id
+	}
+}
+
+// WithRetainAssemblies configures the Engine to retain the latest assembly of
+// every component it reports as created or updated, and to include the retained
+// assembly as the BaselineAssembly of the component's next update (see
+// digitaltwin.AssemblyUpdated).
+//
+// Beware, the Engine then keeps (roughly) a copy of the entire graph in memory.
+// Also, components that predate the Engine are not retained until their first
+// update, which therefore lacks its BaselineAssembly.
+func WithRetainAssemblies() Option {
+	return func(e *Engine) {
+		e.retained = make(map[digitaltwin.ComponentID]digitaltwin.Assembly)
+	}
+}
+
+// The retain method records the assemblies of the given changes as the latest
+// ones of their components, if the Engine is configured WithRetainAssemblies.
+func (e *Engine) retain(changes digitaltwin.GraphChanged) {
+	if e.retained == nil {
+		return
+	}
+	for _, c := range changes.Created {
+		e.retained[c.AssemblyID()] = c.Assembly
+	}
+	for _, c := range changes.Updated {
+		e.retained[c.AssemblyID()] = c.Assembly
+	}
+	for _, c := range changes.Removed {
+		delete(e.retained, c.AssemblyID())
+	}
+}
+
+// The sessionConfig method returns the configuration of the sessions the Engine
+// opens with the given access mode, configured by the Engine's options. Reads
+// take the access mode configured by WithReadAccessMode instead.
+func (e *Engine) sessionConfig(mode neo4j.AccessMode) neo4j.SessionConfig {
+	config := e.sessionTemplate
+	config.DatabaseName = e.database
+	config.AccessMode = mode
+	if mode == neo4j.AccessModeRead {
+		config.AccessMode = e.readAccessMode
+	}
+	if e.bookmarks != nil {
+		config.BookmarkManager = e.bookmarks
+	}
+	return config
+}
+
+// Call loggerFrom to get the logger configured by WithLogger, falling back to
+// the logger of the given context.
+//
+// The engine's methods inject the returned logger into their context, so
+// functions further down the call-stack log through it as well.
+func (e *Engine) loggerFrom(ctx context.Context) *slog.Logger {
+	if e.logger != nil {
+		return e.logger
+	}
+	return component.Logger(ctx)
+}
+
+// Database returns the name of the database the Engine manages, as given to
+// NewEngine.
+func (e *Engine) Database() string {
+	return e.database
+}
+
+// Driver returns the driver the Engine connects to the database with, as given
+// to NewEngine. Advanced users may open their own sessions with it, e.g. to run
+// bespoke read queries against the database the Engine manages (see Database),
+// and parse their results with ParseAssemblyRecord.
+//
+// Beware, writing to the database behind the Engine's back bypasses tainting,
+// so WhatChanged may miss such changes.
+func (e *Engine) Driver() neo4j.DriverWithContext {
+	return e.driver
 }
 
 // WhatChanged reviews the entire graph to create a map of its disjoint graph
@@ -128,13 +588,24 @@ func (e *Engine) WhatChanged(ctx context.Context) (changes digitaltwin.GraphChan
 		attribute.String("neo4j.database", e.database),
 	))
 	defer span.End()
-	logger := component.Logger(ctx).With("neo4j.database", e.database)
+	logger := e.loggerFrom(ctx).With("neo4j.database", e.database)
 	ctx = component.InjectLogger(ctx, logger) // Inject for further logs down the call-stack.
 
-	taints, assemblies, err := e.fetchTaintedAssemblies(ctx)
+	taints, full, assemblies, err := e.fetchTaintedAssemblies(ctx)
 	if err != nil {
 		return digitaltwin.GraphChanged{}, fmt.Errorf("fetch tainted assemblies: %w", err)
 	}
+	// The taints were cleared before the sweep, so we restore them unless the sweep
+	// completes; otherwise, the components they belong to are never swept again.
+	defer func() {
+		if err != nil {
+			e.taintedNodes.Retaint(taints, full)
+		}
+	}()
+	// The graph is no longer locked by now (see fetchTaintedAssemblies), so we
+	// serialise the bookkeeping of concurrent sweeps on their own.
+	e.snapshotMu.Lock()
+	defer e.snapshotMu.Unlock()
 
 	// While iterating the disjoint graph components, we must store all assemblies
 	// that have changed between the previously stored and the currently fetched
@@ -152,9 +623,11 @@ func (e *Engine) WhatChanged(ctx context.Context) (changes digitaltwin.GraphChan
 	// We iterate over all disjoint graph components while building a new snapshot of
 	// the graph.
 	next := make(snapshot)
+	var roots []digitaltwin.NodeHash
 	for _, a := range assemblies {
 		// Add the assembly to the new snapshot.
 		next[a.AssemblyID()] = a.AssemblyHash()
+		roots = append(roots, a.Roots()...)
 		// If the stored snapshot does not contain the assembly (either because it is new
 		// or has changed), then add it to the list of changed assemblies.
 		if !e.snapshot.ContainsAssembly(a) {
@@ -169,20 +642,11 @@ func (e *Engine) WhatChanged(ctx context.Context) (changes digitaltwin.GraphChan
 		}
 	}
 
-	dirtyRoots := make([]digitaltwin.ComponentID, len(taints))
-	for i, n := range taints {
-		id, err := componentID(n)
-		if err != nil {
-			// The following error string is not typical. Here's an example:
-			//
-			//  IMSI component from node(abc..def): inner error...
-			return digitaltwin.GraphChanged{}, fmt.Errorf("%v component from %v: %w", n.Label, n.ContentAddress, err)
-		}
-		dirtyRoots[i] = id
-	}
-
 	// Diff snapshots to find out what has changed.
-	created, updated, removed := e.snapshot.PartialDiff(next, dirtyRoots)
+	created, updated, removed, err := e.diff(next, roots, taints, full)
+	if err != nil {
+		return digitaltwin.GraphChanged{}, err
+	}
 	// Now, we have all the information we need to populate the GraphChanged result.
 	changes.GraphBefore = e.snapshot.GraphHash()
 	changes.Timestamp = time.Now().UTC()
@@ -195,8 +659,9 @@ func (e *Engine) WhatChanged(ctx context.Context) (changes digitaltwin.GraphChan
 	for _, id := range updated {
 		// Since updated assemblies had a different hash in the previous snapshot, we
 		// have already stored them in the `changedAssemblies` map while iterating the
-		// graph above. We also know their previous hash from the previous snapshot.
-		changes.Updated = append(changes.Updated, digitaltwin.AssemblyUpdated{Baseline: e.snapshot[id], Assembly: changedAssemblies[id]})
+		// graph above. We also know their previous hash from the previous snapshot, and
+		// maybe their previous assembly too.
+		changes.Updated = append(changes.Updated, digitaltwin.AssemblyUpdated{Baseline: e.snapshot[id], Assembly: changedAssemblies[id], BaselineAssembly: e.retained[id]})
 	}
 	for _, id := range removed {
 		// Since removed assemblies were in the previous snapshot but not in the current
@@ -217,7 +682,8 @@ func (e *Engine) WhatChanged(ctx context.Context) (changes digitaltwin.GraphChan
 	// root nodes. The mitigation is to block graph change notifications containing
 	// rootless assemblies, allowing the next WhatChanged call to potentially recover.
 	if rootlessAssemblies > 0 {
-		trace.SpanFromContext(ctx).RecordError(errFoundRootlessAssemblies, trace.WithAttributes(
+		err := RootlessAssembliesError{Count: rootlessAssemblies}
+		trace.SpanFromContext(ctx).RecordError(err, trace.WithAttributes(
 			attribute.Int("changeset.rootless", rootlessAssemblies),
 			attribute.String("changeset.pretty", digitaltwin.FormatChanges(changes, "")),
 			// TODO(@danielorbach): attribute.String("changeset.binary", gob.Encode(changes)),
@@ -225,12 +691,14 @@ func (e *Engine) WhatChanged(ctx context.Context) (changes digitaltwin.GraphChan
 		rootlessAssemblyCounter.Add(ctx, int64(rootlessAssemblies), metric.WithAttributes(
 			attribute.String("neo4j.database", e.database),
 		))
-		return changes, errFoundRootlessAssemblies
+		return changes, err
 	}
 
 	// Before returning, we don't forget to update the previously stored snapshot for
 	// the next time this function is called.
 	e.snapshot.Update(changes)
+	e.roots.Update(changes)
+	e.retain(changes)
 	// As we handle partial snapshots, we must derive GraphAfter from the complete
 	// snapshot. This comprehensive state, GraphAfter, reflects the graph following
 	// the most recent updates. Therefore, the calculation should occur post the
@@ -240,22 +708,259 @@ func (e *Engine) WhatChanged(ctx context.Context) (changes digitaltwin.GraphChan
 	return changes, nil
 }
 
+// StreamChanges is the streaming variant of WhatChanged. Instead of returning
+// the entire changeset at once, it calls yield with every component change as
+// soon as it is computed, so only the bookkeeping required to update the
+// internal snapshot is kept in memory. The changes yielded are the same as
+// those in the [digitaltwin.GraphChanged] WhatChanged would have returned,
+// disassembled into [digitaltwin.ComponentChanged] notifications.
+//
+// To achieve that, StreamChanges reads the modified parts of the graph twice
+// during a single exclusive read: once to compute the new snapshot (and with it
+// the resulting graph hash), and once more to yield the changed assemblies. The
+// graph remains locked for writing (i.e. calls to Apply block) until the last
+// change is yielded, so callers are advised to keep yield short.
+//
+// If yield returns a non-nil error, StreamChanges stops and returns that error
+// without updating its internal records, just like WhatChanged does when its
+// sweep fails. Keep in mind that yield may have already been called with some
+// of the changes by then.
+func (e *Engine) StreamChanges(ctx context.Context, yield func(digitaltwin.ComponentChanged) error) (err error) {
+	ctx, span := tracer.Start(ctx, "StreamChanges", trace.WithAttributes(
+		attribute.String("neo4j.database", e.database),
+	))
+	defer span.End()
+	logger := e.loggerFrom(ctx).With("neo4j.database", e.database)
+	ctx = component.InjectLogger(ctx, logger) // Inject for further logs down the call-stack.
+
+	// We open a new session for every query cycle to ensure transactional isolation
+	// and to prevent any state carryover between different query executions.
+	s := e.driver.NewSession(ctx, e.sessionConfig(neo4j.AccessModeRead))
+	defer func() {
+		if err := s.Close(ctx); err != nil {
+			logger.Error("Failed to close session", "error", err, "mode", "read")
+		}
+	}()
+
+	// Unlike fetchTaintedAssemblies, we hold the exclusive lock for the entire
+	// stream, so both passes over the graph observe the same state.
+	e.txMutex.Lock()
+	defer e.txMutex.Unlock()
+	// A relaxed WhatChanged may be updating the snapshot without the lock, see
+	// WithRelaxedReadConsistency.
+	e.snapshotMu.Lock()
+	defer e.snapshotMu.Unlock()
+	taints, overflowed := e.taintedNodes.ClearTaints()
+	full := e.withoutTainting || overflowed
+	span.SetAttributes(attribute.Bool("sweep.full", full))
+	// Just like WhatChanged, we restore the taints unless the stream completes.
+	defer func() {
+		if err != nil {
+			e.taintedNodes.Retaint(taints, overflowed)
+		}
+	}()
+
+	// The first pass only builds the new (partial) snapshot, discarding the
+	// assemblies themselves as soon as they are hashed.
+	r := e.graphReader(ctx)
+	next := make(snapshot)
+	var roots []digitaltwin.NodeHash
+	var rootlessAssemblies int
+	_, err = s.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		clear(next) // The driver may retry this function on transient errors.
+		roots = nil
+		rootlessAssemblies = 0
+		return nil, r.visitTaintedAssemblies(ctx, tx, taints, full, func(a digitaltwin.Assembly) error {
+			next[a.AssemblyID()] = a.AssemblyHash()
+			roots = append(roots, a.Roots()...)
+			if len(a.Roots()) == 0 {
+				rootlessAssemblies++
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("hash tainted assemblies: execute read: %w", classifyError(err))
+	}
+	// See WhatChanged for why rootless assemblies invalidate the entire sweep. Since
+	// we have not yielded anything yet, the caller observes no partial changeset.
+	if rootlessAssemblies > 0 {
+		err := RootlessAssembliesError{Count: rootlessAssemblies}
+		span.RecordError(err, trace.WithAttributes(
+			attribute.Int("changeset.rootless", rootlessAssemblies),
+		))
+		rootlessAssemblyCounter.Add(ctx, int64(rootlessAssemblies), metric.WithAttributes(
+			attribute.String("neo4j.database", e.database),
+		))
+		return err
+	}
+
+	created, updated, removed, err := e.diff(next, roots, taints, full)
+	if err != nil {
+		return err
+	}
+
+	// We compute the resulting snapshot before yielding anything, because every
+	// yielded change carries the hash of the entire graph after the changes. The
+	// stored snapshot is replaced only once all changes were yielded successfully.
+	after := maps.Clone(e.snapshot)
+	for _, id := range slices.Concat(created, updated) {
+		after[id] = next[id]
+	}
+	for _, id := range removed {
+		delete(after, id)
+	}
+	graphAfter := after.GraphHash()
+	timestamp := time.Now().UTC()
+
+	// The second pass yields the created and updated assemblies. We remember which
+	// were already yielded, so a retry by the driver does not yield them again.
+	changed := make(map[digitaltwin.ComponentID]bool, len(created)+len(updated))
+	for _, id := range created {
+		changed[id] = true
+	}
+	for _, id := range updated {
+		changed[id] = false
+	}
+	yielded := make(map[digitaltwin.ComponentID]struct{}, len(changed))
+	// The yielded assemblies become the retained ones only once the stream ends.
+	retained := make(map[digitaltwin.ComponentID]digitaltwin.Assembly)
+	// So do the roots of the created multi-root components, see rootIndex.
+	var indexed digitaltwin.GraphChanged
+	_, err = s.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		return nil, r.visitTaintedAssemblies(ctx, tx, taints, full, func(a digitaltwin.Assembly) error {
+			id := a.AssemblyID()
+			isCreated, ok := changed[id]
+			if _, done := yielded[id]; !ok || done {
+				return nil
+			}
+			// We hold the exclusive lock, so the graph must not have changed since the
+			// first pass. See visitPartialAssemblies for why we panic when it did.
+			if a.AssemblyHash() != next[id] {
+				return corruptedGraph(ctx, r.onCorruption, "a neo4j assembly changed between two reads under lock")
+			}
+
+			var c digitaltwin.Assembly = digitaltwin.AssemblyUpdated{Baseline: e.snapshot[id], Assembly: a, BaselineAssembly: e.retained[id]}
+			if isCreated {
+				c = digitaltwin.AssemblyCreated{Assembly: a}
+				if len(a.Roots()) > 1 {
+					indexed.Created = append(indexed.Created, digitaltwin.AssemblyCreated{Assembly: a})
+				}
+			}
+			if e.retained != nil {
+				retained[id] = a
+			}
+			if err := yield(digitaltwin.ComponentChanged{Assembly: c, GraphHash: graphAfter, Timestamp: timestamp}); err != nil {
+				return errYield{err}
+			}
+			yielded[id] = struct{}{}
+			return nil
+		})
+	})
+	var yieldErr errYield
+	if errors.As(err, &yieldErr) {
+		return yieldErr.err
+	} else if err != nil {
+		return fmt.Errorf("stream tainted assemblies: execute read: %w", classifyError(err))
+	}
+
+	// Removed assemblies are not part of the graph anymore, so we yield them from
+	// what we know about them in the stored snapshot.
+	for _, id := range removed {
+		c := digitaltwin.AssemblyRemoved{ID: id, Hash: e.snapshot[id]}
+		if err := yield(digitaltwin.ComponentChanged{Assembly: c, GraphHash: graphAfter, Timestamp: timestamp}); err != nil {
+			return err
+		}
+		indexed.Removed = append(indexed.Removed, c)
+	}
+
+	e.snapshot = after
+	e.roots.Update(indexed)
+	if e.retained != nil {
+		maps.Copy(e.retained, retained)
+		for _, id := range removed {
+			delete(e.retained, id)
+		}
+	}
+	return nil
+}
+
+// The visitTaintedAssemblies method calls visitPartialAssemblies with the given
+// taints, or visits all assemblies in the graph if full is true (i.e. the
+// Engine is configured WithoutTainting, or its taints overflowed their limit).
+func (r graphReader) visitTaintedAssemblies(ctx context.Context, tx neo4j.ManagedTransaction, taints []RawNode, full bool, visit func(digitaltwin.Assembly) error) error {
+	if full {
+		return r.visitAllAssemblies(ctx, tx, visit)
+	}
+	return r.visitPartialAssemblies(ctx, tx, taints, visit)
+}
+
+// The diff method diffs the stored snapshot against the given next snapshot,
+// which holds the assemblies visited by visitTaintedAssemblies for the given
+// taints, and whose roots are given. That is, a partial snapshot unless full is
+// true, in which case next is a complete snapshot of the graph.
+//
+// Besides the components of the taints themselves, the components the visited
+// roots were part of are dirty too: roots converging on a tainted node merge
+// their components (see componentMerger), even though the roots themselves
+// were not tainted. Multi-root components are looked up in the stored rootIndex.
+func (e *Engine) diff(next snapshot, roots []digitaltwin.NodeHash, taints []RawNode, full bool) (created, updated, removed []digitaltwin.ComponentID, err error) {
+	if full {
+		created, updated, removed = e.snapshot.Diff(next)
+		return created, updated, removed, nil
+	}
+	dirtyRoots := make([]digitaltwin.ComponentID, 0, len(taints)+len(roots))
+	for _, n := range taints {
+		id, err := componentID(n)
+		if err != nil {
+			// The following error string is not typical. Here's an example:
+			//
+			//  IMSI component from node(abc..def): inner error...
+			return nil, nil, nil, fmt.Errorf("%v component from %v: %w", n.Label, n.ContentAddress, err)
+		}
+		dirtyRoots = append(dirtyRoots, id)
+		if id, ok := e.roots[n.ContentAddress]; ok {
+			dirtyRoots = append(dirtyRoots, id)
+		}
+	}
+	for _, root := range roots {
+		dirtyRoots = append(dirtyRoots, digitaltwin.AssemblyGraph{Root: []digitaltwin.NodeHash{root}}.AssemblyID())
+		if id, ok := e.roots[root]; ok {
+			dirtyRoots = append(dirtyRoots, id)
+		}
+	}
+	created, updated, removed = e.snapshot.PartialDiff(next, dirtyRoots)
+	return created, updated, removed, nil
+}
+
+// An errYield wraps errors returned by the yield function of
+// Engine.StreamChanges, so they can be told apart from errors returned by the
+// neo4j driver.
+type errYield struct{ err error }
+
+func (e errYield) Error() string { return e.err.Error() }
+
 // WhatChanged calls fetchTaintedAssemblies to exclusively read the graph,
 // without side effects from concurrent write-transactions (calls to Apply).
+// Unless the Engine is configured WithRelaxedReadConsistency, in which case it
+// only waits for the writes in flight to commit before it reads the graph.
+//
+// Either way, the graph is no longer locked once fetchTaintedAssemblies returns,
+// so callers guard the snapshot with snapshotMu instead.
 //
 // It uses the internal taintedNodes structure to "atomically" fetch all
 // assemblies that were modified by prior calls to Apply since the last call to
 // WhatChanged. We say "atomically" in the sense that the returned taints and
 // assemblies are a single unit.
-func (e *Engine) fetchTaintedAssemblies(ctx context.Context) (taints []RawNode, assemblies []digitaltwin.Assembly, err error) {
+//
+// It also reports whether it fetched all assemblies in the graph instead, see
+// WithoutTainting and WithTaintLimit.
+func (e *Engine) fetchTaintedAssemblies(ctx context.Context) (taints []RawNode, full bool, assemblies []digitaltwin.Assembly, err error) {
 	// We open a new session for every query cycle to ensure transactional isolation
 	// and to prevent any state carryover between different query executions.This
 	// practice enhances robustness because any session-specific errors or resources
 	// are contained and do not affect subsequent operations.
-	s := e.driver.NewSession(ctx, neo4j.SessionConfig{
-		DatabaseName: e.database,
-		AccessMode:   neo4j.AccessModeRead,
-	})
+	s := e.driver.NewSession(ctx, e.sessionConfig(neo4j.AccessModeRead))
 	defer func() {
 		if err := s.Close(ctx); err != nil {
 			component.Logger(ctx).Error("Failed to close session", "error", err, "mode", "read")
@@ -267,9 +972,6 @@ func (e *Engine) fetchTaintedAssemblies(ctx context.Context) (taints []RawNode,
 	// concurrent write transactions. See graphWRMutex documentation for more
 	// information.
 	e.txMutex.Lock()
-	// Release the exclusive lock to allow to write transactions to proceed now that
-	// the graph read operation is complete.
-	defer e.txMutex.Unlock()
 
 	// We take a snapshot of all the nodes that were tainted up to this point in
 	// time. This ensures that we consider all assemblies that may have changed in
@@ -277,18 +979,211 @@ func (e *Engine) fetchTaintedAssemblies(ctx context.Context) (taints []RawNode,
 	//
 	// The taints are cleared from the taintMap to prepare for the next call to
 	// WhatChanged.
-	taints = e.taintedNodes.ClearTaints()
+	taints, overflowed := e.taintedNodes.ClearTaints()
+	full = e.withoutTainting || overflowed
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("sweep.full", full))
+
+	if e.relaxedReads {
+		// Holding the lock this far waited for the writes in flight to commit (and to
+		// taint their nodes), so we let further writes proceed during the sweep; see
+		// WithRelaxedReadConsistency.
+		e.txMutex.Unlock()
+	} else {
+		// Release the exclusive lock to allow to write transactions to proceed now that
+		// the graph read operation is complete.
+		defer e.txMutex.Unlock()
+	}
+
+	assemblies, err = collectAssemblies(ctx, s, func(tx neo4j.ManagedTransaction, visit func(digitaltwin.Assembly) error) error {
+		return e.graphReader(ctx).visitTaintedAssemblies(ctx, tx, taints, full, visit)
+	})
+	if err != nil {
+		// Restore the taints, so the next call sweeps their components again.
+		e.taintedNodes.Retaint(taints, overflowed)
+		return nil, false, nil, err
+	}
+	return taints, full, assemblies, nil
+}
+
+// ListComponents returns the IDs of all disjoint graph components currently in
+// the graph, sorted in ascending order. It gives a cheap inventory of the graph
+// without diffing against the engine's internal snapshot, which it leaves
+// untouched.
+//
+// ListComponents sweeps the entire graph while exclusively locking it (see
+// graphWRMutex), so concurrent calls to Apply block until it returns.
+func (e *Engine) ListComponents(ctx context.Context) ([]digitaltwin.ComponentID, error) {
+	s, err := e.freshSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return slices.SortedFunc(maps.Keys(s), digitaltwin.ComponentID.Compare), nil
+}
+
+// ComponentCount returns the number of disjoint graph components currently in
+// the graph. See ListComponents for the implications of calling it.
+func (e *Engine) ComponentCount(ctx context.Context) (int, error) {
+	s, err := e.freshSnapshot(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return len(s), nil
+}
+
+// VerifySnapshot captures a fresh snapshot of the entire graph and compares it
+// against the engine's internal snapshot, which WhatChanged maintains
+// incrementally. It returns the IDs of the components whose hashes disagree
+// (including components missing from either snapshot), sorted, without modifying
+// the internal snapshot.
+//
+// Use it as a diagnostic: once WhatChanged has returned every change applied
+// through the engine, any drift indicates a bug, or another writer modifying the
+// graph behind the engine's back. Modifications applied since the last call to
+// WhatChanged show up as drift too, so call it right after WhatChanged.
+//
+// Like ListComponents, VerifySnapshot sweeps the entire graph while exclusively
+// locking it. It must not be called concurrently with WhatChanged (or
+// StreamChanges), which update the internal snapshot.
+func (e *Engine) VerifySnapshot(ctx context.Context) (drift []digitaltwin.ComponentID, err error) {
+	fresh, err := e.freshSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	e.snapshotMu.Lock()
+	created, updated, removed := e.snapshot.Diff(fresh)
+	e.snapshotMu.Unlock()
+	drift = slices.Concat(created, updated, removed)
+	slices.SortFunc(drift, digitaltwin.ComponentID.Compare)
+	if len(drift) > 0 {
+		e.loggerFrom(ctx).Warn("Snapshot drifted from the graph",
+			"neo4j.database", e.database,
+			"created", len(created),
+			"updated", len(updated),
+			"removed", len(removed),
+		)
+	}
+	return drift, nil
+}
+
+// GetComponent reads the current assembly of the disjoint graph component
+// identified by the given ID (e.g. from a ComponentChanged notification),
+// without sweeping the entire graph. It returns false if the graph no longer
+// contains such a component, e.g. because it was removed or merged into another
+// component.
+//
+// GetComponent reads the graph while exclusively locking it (see graphWRMutex),
+// so concurrent calls to Apply block until it returns. It leaves the engine's
+// internal snapshot untouched.
+func (e *Engine) GetComponent(ctx context.Context, id digitaltwin.ComponentID) (assembly digitaltwin.Assembly, found bool, err error) {
+	ctx, span := tracer.Start(ctx, "GetComponent", trace.WithAttributes(
+		attribute.String("neo4j.database", e.database),
+	))
+	defer span.End()
+	logger := e.loggerFrom(ctx).With("neo4j.database", e.database)
+	ctx = component.InjectLogger(ctx, logger) // Inject for further logs down the call-stack.
+
+	s := e.driver.NewSession(ctx, e.sessionConfig(neo4j.AccessModeRead))
+	defer func() {
+		if err := s.Close(ctx); err != nil {
+			logger.Error("Failed to close session", "error", err, "mode", "read")
+		}
+	}()
+
+	// The roots of a multi-root component are only known from the index.
+	e.snapshotMu.Lock()
+	roots := e.roots.rootsOf(id)
+	e.snapshotMu.Unlock()
 
-	assemblies, err = fetchPartialAssemblies(ctx, s, taints)
+	e.txMutex.Lock()
+	defer e.txMutex.Unlock()
+	return e.graphReader(ctx).fetchComponent(ctx, s, id, roots)
+}
+
+// NodeStats counts the nodes of the graph by their labels, e.g. to feed capacity
+// dashboards with the composition of the graph as it grows. A node carrying
+// marker labels (see newRawNode) counts towards its registered label alone,
+// while tombstoned nodes (see WithSoftDelete) and the nodes of other tenants
+// (see WithTenant) are not counted at all.
+//
+// Unlike ListComponents, NodeStats neither sweeps the graph nor locks it, so the
+// counts may include the modifications of concurrent calls to Apply.
+func (e *Engine) NodeStats(ctx context.Context) (counts map[string]int, err error) {
+	ctx, span := tracer.Start(ctx, "NodeStats", trace.WithAttributes(
+		attribute.String("neo4j.database", e.database),
+	))
+	defer func() { endSpan(span, err) }()
+	logger := e.loggerFrom(ctx).With("neo4j.database", e.database)
+
+	s := e.driver.NewSession(ctx, e.sessionConfig(neo4j.AccessModeRead))
+	defer func() {
+		if err := s.Close(ctx); err != nil {
+			logger.Error("Failed to close session", "error", err, "mode", "read")
+		}
+	}()
+
+	counts, err = neo4j.ExecuteRead(ctx, s, func(tx neo4j.ManagedTransaction) (map[string]int, error) {
+		result, err := tx.Run(ctx, `
+			MATCH (n) WHERE n._deleted_at IS NULL
+			AND ($tenant IS NULL OR n._tenant = $tenant)
+			RETURN labels(n) AS labels, count(n) AS nodes
+		`, nodeKey{tenant: e.tenant}.params(map[string]any{}))
+		if err != nil {
+			return nil, fmt.Errorf("run cypher: %w", err)
+		}
+		counts := make(map[string]int)
+		for result.Next(ctx) {
+			labels, err := getRecordProperty[[]any](result.Record(), "labels")
+			if err != nil {
+				return nil, fmt.Errorf("get labels: %w", err)
+			}
+			nodes, err := getRecordProperty[int64](result.Record(), "nodes")
+			if err != nil {
+				return nil, fmt.Errorf("get nodes: %w", err)
+			}
+			counts[statsLabel(labels)] += int(nodes)
+		}
+		if err := result.Err(); err != nil {
+			return nil, fmt.Errorf("iterate records: %w", err)
+		}
+		return counts, nil
+	})
 	if err != nil {
-		return nil, nil, err
+		return nil, fmt.Errorf("execute read: %w", classifyError(err))
+	}
+	return counts, nil
+}
+
+// The statsLabel function returns the label NodeStats counts a node with the
+// given labels towards: its registered label, or all of its labels joined by
+// colons (as in Cypher) if there is no single registered label among them.
+func statsLabel(labels []any) string {
+	s := make([]string, len(labels))
+	for i, l := range labels {
+		s[i] = fmt.Sprint(l)
 	}
-	return taints, assemblies, nil
+	if label, err := globalNodeRegistry.LabelAmong(s); err == nil {
+		return label
+	}
+	return strings.Join(s, ":")
 }
 
-// This error is returned from Engine.WhatChanged when any rootless assemblies
-// are found during a sweep.
-var errFoundRootlessAssemblies = errors.New("found rootless assemblies while sweeping the graph")
+// The freshSnapshot method captures a fresh snapshot of the entire graph,
+// under the same exclusive lock WhatChanged uses to read the graph.
+func (e *Engine) freshSnapshot(ctx context.Context) (snapshot, error) {
+	ctx, span := tracer.Start(ctx, "freshSnapshot", trace.WithAttributes(
+		attribute.String("neo4j.database", e.database),
+	))
+	defer span.End()
+	ctx = component.InjectLogger(ctx, e.loggerFrom(ctx))
+
+	e.txMutex.Lock()
+	defer e.txMutex.Unlock()
+	s, _, err := e.graphReader(ctx).captureSnapshot(ctx, e.driver, e.sessionConfig(neo4j.AccessModeRead), e.snapshotBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("capture snapshot: %w", err)
+	}
+	return s, nil
+}
 
 // Apply opens a new transaction and passes a [digitaltwin.GraphWriter] that
 // executes Cypher queries within that transaction to the given compilation.
@@ -311,16 +1206,129 @@ func (e *Engine) Apply(ctx context.Context, compilation digitaltwin.Compilation)
 		attribute.String("neo4j.database", e.database),
 	))
 	defer span.End()
-	logger := component.Logger(ctx).With("neo4j.database", e.database)
+	return e.apply(ctx, false, nil, compilation)
+}
+
+// ApplyIfUnchanged is like Apply, but only applies the given compilation if the
+// entire graph's hash still equals the expected hash (e.g. the GraphAfter of the
+// GraphChanged notification the compilation was derived from). Otherwise, the
+// transaction is rolled back and an error wrapping ErrGraphChanged is returned.
+// This gives compare-and-swap semantics to compilations derived from a known
+// baseline, so concurrent writers cannot silently overwrite each other.
+//
+// Neo4j reads at the read-committed isolation level, so two concurrent
+// transactions could both verify the same hash before either commits. Hence,
+// ApplyIfUnchanged exclusively locks the Engine (see graphWRMutex) for both the
+// verification and the compilation, just like sweeps do, so no other write of
+// this Engine interleaves with them. Writes of other Engines (e.g. in other
+// processes) to the same database are not serialised this way.
+//
+// Beware, verifying the hash sweeps the entire graph within the write
+// transaction, before the compilation is executed. This is as expensive as
+// NewEngine's initial snapshot, and it blocks all other operations of the
+// Engine for its entire duration. Prefer Apply for compilations that do not
+// depend on a specific baseline.
+func (e *Engine) ApplyIfUnchanged(ctx context.Context, expected digitaltwin.ForestHash, compilation digitaltwin.Compilation) (err error) {
+	ctx, span := tracer.Start(ctx, "ApplyIfUnchanged", trace.WithAttributes(
+		attribute.String("neo4j.database", e.database),
+		attribute.Stringer("graph.expected", expected),
+	))
+	defer span.End()
+
+	precondition := func(ctx context.Context, tx neo4j.ManagedTransaction) error {
+		s, _, err := e.graphReader(ctx).captureSnapshotTx(ctx, tx)
+		if err != nil {
+			return fmt.Errorf("capture snapshot: %w", err)
+		}
+		if actual := s.GraphHash(); actual != expected {
+			return fmt.Errorf("%w: expected %v, found %v", ErrGraphChanged, expected, actual)
+		}
+		return nil
+	}
+	return e.apply(ctx, true, precondition, compilation)
+}
+
+// ApplySteps is like Apply, but applies a compilation recorded as steps (see
+// compilation.Replay), and locks every node the steps target (see
+// compilation.Targets) at the start of its write transaction, before replaying
+// the steps themselves.
+//
+// Concurrent compilations that modify overlapping nodes in different orders may
+// deadlock, which Neo4j resolves by failing (and the driver by retrying) one of
+// them. Locking all targets upfront, always in the same order (that of their
+// content-addresses), serialises such compilations instead.
+//
+// Only nodes already in the graph are locked. Beware, wildcard retractions (see
+// digitaltwin.GraphWriter.RetractEdges) target no nodes other than their origin,
+// so the nodes at the other end of the retracted edges are not locked upfront.
+//
+// Once committed, the steps are handed to the sink configured by WithAuditSink,
+// if any.
+func (e *Engine) ApplySteps(ctx context.Context, steps []compilation.Step) (err error) {
+	ctx, span := tracer.Start(ctx, "ApplySteps", trace.WithAttributes(
+		attribute.String("neo4j.database", e.database),
+		attribute.Int("compilation.steps", len(steps)),
+	))
+	defer span.End()
+
+	var targets []RawNode
+	for target := range compilation.Targets(steps) {
+		x, err := FormatNode(target)
+		if err != nil {
+			return fmt.Errorf("format target: %w", err)
+		}
+		targets = append(targets, x)
+	}
+	slices.SortFunc(targets, func(a, b RawNode) int {
+		return a.ContentAddress.Compare(b.ContentAddress)
+	})
+	precondition := func(ctx context.Context, tx neo4j.ManagedTransaction) error {
+		for _, target := range targets {
+			if err := e.graphWriter(tx, nil).lockNode(ctx, target); err != nil {
+				return fmt.Errorf("lock node: %w", err)
+			}
+		}
+		return nil
+	}
+	if err := e.apply(ctx, false, precondition, compilation.Replay(steps)); err != nil {
+		return err
+	}
+	if e.auditSink != nil {
+		if err := e.auditSink(ctx, steps); err != nil {
+			e.loggerFrom(ctx).Error("Failed to audit committed steps", "error", err, "neo4j.database", e.database, "compilation.steps", len(steps))
+		}
+	}
+	return nil
+}
+
+// ErrGraphChanged is returned (wrapped) by Engine.ApplyIfUnchanged when the
+// graph no longer matches the expected hash.
+var ErrGraphChanged = errors.New("graph changed since the expected baseline")
+
+// ErrCorruptedGraph is returned (wrapped) by the Engine's methods when they
+// detect that the graph has lost its integrity, and the Engine is configured
+// WithCorruptionHandler whose handler returns nil.
+var ErrCorruptedGraph = errors.New("neo4j graph violates digital-twin axioms")
+
+// ErrMutationBudgetExceeded is returned by Apply and ApplyIfUnchanged when the
+// compilation performs more mutations than configured by
+// WithMaxMutationsPerApply. The Engine rolls back such compilations entirely.
+var ErrMutationBudgetExceeded = errors.New("compilation exceeded its mutation budget")
+
+// The apply method implements Apply, ApplyIfUnchanged, and ApplySteps. It
+// executes the given precondition (if not nil) within the same write transaction
+// as the compilation, before the compilation itself. If exclusive is true, it
+// locks the Engine exclusively rather than for writing, so no other transaction
+// of the Engine runs concurrently.
+func (e *Engine) apply(ctx context.Context, exclusive bool, precondition func(context.Context, neo4j.ManagedTransaction) error, compilation digitaltwin.Compilation) (err error) {
+	logger := e.loggerFrom(ctx).With("neo4j.database", e.database)
+	ctx = component.InjectLogger(ctx, logger) // Inject for further logs down the call-stack.
 
 	// We open a new session for every query cycle to ensure transactional isolation
 	// and to prevent any state carryover between different query executions.This
 	// practice enhances robustness because any session-specific errors or resources
 	// are contained and do not affect subsequent operations.
-	s := e.driver.NewSession(ctx, neo4j.SessionConfig{
-		DatabaseName: e.database,
-		AccessMode:   neo4j.AccessModeWrite,
-	})
+	s := e.driver.NewSession(ctx, e.sessionConfig(neo4j.AccessModeWrite))
 	defer func() {
 		if err := s.Close(ctx); err != nil {
 			logger.Error("Failed to close session", "error", err, "mode", "write")
@@ -333,25 +1341,80 @@ func (e *Engine) Apply(ctx context.Context, compilation digitaltwin.Compilation)
 	// write-transaction to prevent other read operations from happening, which could
 	// interfere with the consistent state of the graph as this transaction intends
 	// to modify it.
-	e.txMutex.WLock()
-	defer e.txMutex.WUnlock()
+	if exclusive {
+		e.txMutex.Lock()
+		defer e.txMutex.Unlock()
+	} else {
+		e.txMutex.WLock()
+		defer e.txMutex.WUnlock()
+	}
 
 	// We use write transactions because the neo4j SDK can provide transaction
 	// management features such as retries, error handling, and deadlock resolution.
 	_, err = s.ExecuteWrite(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
-		return nil, compilation(ctx, graphWriter{tx: tx, nodeTainter: &e.taintedNodes})
+		// Once the graph is known to be corrupted, the transaction must not commit,
+		// even if the compilation ignores the error of the write that detected it.
+		latch := new(corruptionLatch)
+		if precondition != nil {
+			if err := precondition(ctx, tx); err != nil {
+				return nil, err
+			}
+		}
+		// The budget covers a single attempt, as the driver may retry the entire
+		// transaction function.
+		var w digitaltwin.GraphWriter = e.graphWriter(tx, latch)
+		if e.maxMutations > 0 {
+			w = &budgetWriter{GraphWriter: w, remaining: e.maxMutations}
+		}
+		err := compilation(ctx, w)
+		if latch.err != nil {
+			return nil, latch.err
+		}
+		return nil, err
 	})
 	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
 		return err
 	} else if errors.Is(err, errPropertyNotFound) || errors.As(err, &unexpectedPropertyTypeError{}) {
-		component.Logger(ctx).Error("A Cypher query was modified without care", "error", err)
+		logger.Error("A Cypher query was modified without care", "error", err)
 		panic(fmt.Errorf("seek developer attention: neo4j cypher query: %w", err))
 	} else if err != nil {
-		return fmt.Errorf("neo4j execute: %w", err)
+		return fmt.Errorf("neo4j execute: %w", classifyError(err))
 	}
 	return nil
 }
 
+// The graphWriter method returns a graphWriter for the given transaction,
+// configured by the Engine's options, that latches corruption onto the given
+// latch (if not nil).
+func (e *Engine) graphWriter(tx neo4j.ManagedTransaction, latch *corruptionLatch) graphWriter {
+	w := graphWriter{tx: tx, nodeTainter: &e.taintedNodes, softDelete: e.softDelete, caProperty: e.caProperty, tenant: e.tenant, onCorruption: e.corruptionHandler, latch: latch}
+	if e.withoutTainting {
+		w.nodeTainter = noopTainter{}
+	}
+	return w
+}
+
+// The graphReader method returns a graphReader configured by the Engine's
+// options. It logs the malformed nodes it skips (see WithSkipMalformedNodes)
+// with the logger of the given context.
+func (e *Engine) graphReader(ctx context.Context) graphReader {
+	r := graphReader{
+		parser: nodeParser{
+			verify:     !e.skipVerification,
+			cache:      e.parseCache,
+			maxNodes:   e.maxComponentNodes,
+			caProperty: e.caProperty,
+		},
+		tenant:       e.tenant,
+		relaxed:      e.relaxedReads,
+		onCorruption: e.corruptionHandler,
+	}
+	if e.skipMalformed {
+		r.parser.onMalformed = skipMalformedNodes(ctx, e.database)
+	}
+	return r
+}
+
 // A errPropertyNotFound occurs when a property of Node/Edge is missing.
 //
 // When encountering this error, it most likely occurs when changing a Cypher
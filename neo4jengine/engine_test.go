@@ -1,11 +1,30 @@
 package neo4jengine
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/danielorbach/go-component"
+	"github.com/go-digitaltwin/go-digitaltwin"
+	"github.com/go-digitaltwin/go-digitaltwin/compilation"
 	"github.com/go-digitaltwin/go-digitaltwin/internal/dbtest"
 	"github.com/go-digitaltwin/go-digitaltwin/enginetest"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func init() {
@@ -13,6 +32,7 @@ func init() {
 	Register(enginetest.NodeB{})
 	Register(enginetest.NodeC{})
 	Register(enginetest.NodeD{})
+	Register(enginetest.NodeN{})
 }
 
 func TestEngine(t *testing.T) {
@@ -23,3 +43,1476 @@ func TestEngine(t *testing.T) {
 	}
 	enginetest.Run(t, engine, engine)
 }
+
+func TestWithContentAddressProperty(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	engine, err := NewEngine(context.Background(), driver, "neo4j", WithContentAddressProperty("contentHash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	enginetest.Run(t, engine, engine)
+}
+
+func TestEngine_concurrent(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	engine, err := NewEngine(context.Background(), driver, "neo4j")
+	if err != nil {
+		t.Fatal(err)
+	}
+	enginetest.RunConcurrent(t, engine, engine)
+}
+
+func TestWithoutTainting(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	engine, err := NewEngine(context.Background(), driver, "neo4j", WithoutTainting())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Sweeping the entire graph must detect the same changes as sweeping only the
+	// components of tainted nodes.
+	enginetest.Run(t, engine, engine)
+	if taints, _ := engine.taintedNodes.ClearTaints(); len(taints) != 0 {
+		t.Errorf("engine tainted %d nodes, want none", len(taints))
+	}
+}
+
+func TestWithTaintLimit(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	// Most test-cases modify more than a single node, so they overflow the limit
+	// and fall back to a full sweep, while the rest still sweep partially.
+	engine, err := NewEngine(context.Background(), driver, "neo4j", WithTaintLimit(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	enginetest.Run(t, engine, engine)
+}
+
+func TestNodeMap_limit(t *testing.T) {
+	a, b, c := RawNode{ContentAddress: digitaltwin.NodeHash{1}}, RawNode{ContentAddress: digitaltwin.NodeHash{2}}, RawNode{ContentAddress: digitaltwin.NodeHash{3}}
+	m := nodeMap{limit: 2}
+
+	// Tainting the same node twice counts once towards the limit.
+	m.Taint(a, b, a)
+	if nodes, overflowed := m.ClearTaints(); len(nodes) != 2 || overflowed {
+		t.Errorf("ClearTaints() = %d nodes, overflowed %t; want 2 nodes, not overflowed", len(nodes), overflowed)
+	}
+
+	m.Taint(a, b)
+	m.Taint(c)
+	m.Taint(a) // Ignored once overflowed.
+	if nodes, overflowed := m.ClearTaints(); len(nodes) != 0 || !overflowed {
+		t.Errorf("ClearTaints() = %d nodes, overflowed %t; want no nodes, overflowed", len(nodes), overflowed)
+	}
+
+	// Clearing the taints also clears the overflow.
+	m.Taint(c)
+	if nodes, overflowed := m.ClearTaints(); len(nodes) != 1 || overflowed {
+		t.Errorf("ClearTaints() after overflow = %d nodes, overflowed %t; want 1 node, not overflowed", len(nodes), overflowed)
+	}
+}
+
+// This test ensures the memory of a burst of tainted nodes (e.g. a bulk import)
+// is released after a few steady-state sweeps, rather than ratcheting to the
+// largest burst for good.
+func TestNodeMap_sizeHint(t *testing.T) {
+	taint := func(m *nodeMap, n int) {
+		for i := range n {
+			var h digitaltwin.NodeHash
+			binary.BigEndian.PutUint32(h[:], uint32(i))
+			m.Taint(RawNode{ContentAddress: h})
+		}
+	}
+
+	var m nodeMap
+	for range 3 {
+		taint(&m, 100_000)
+		if nodes, _ := m.ClearTaints(); len(nodes) != 100_000 {
+			t.Fatalf("ClearTaints() = %d nodes; want %d", len(nodes), 100_000)
+		}
+		for range 20 {
+			taint(&m, 10)
+			if nodes, _ := m.ClearTaints(); len(nodes) != 10 {
+				t.Fatalf("ClearTaints() = %d nodes; want %d", len(nodes), 10)
+			}
+		}
+		if m.sizeHint > 20 {
+			t.Errorf("sizeHint after steady-state sweeps = %d; want at most %d", m.sizeHint, 20)
+		}
+	}
+}
+
+func TestEngine_emptyGraph(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	ctx := context.Background()
+	// None of the engines modify the graph, so they all observe the same (empty)
+	// database regardless of their configuration.
+	configurations := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "Default"},
+		{name: "WithoutTainting", opts: []Option{WithoutTainting()}},
+		{name: "WithSnapshotBatchSize", opts: []Option{WithSnapshotBatchSize(1)}},
+	}
+	for _, c := range configurations {
+		engine, err := NewEngine(ctx, driver, "neo4j", c.opts...)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		// A compilation that modifies nothing must not change the empty graph either.
+		if err := engine.Apply(ctx, func(context.Context, digitaltwin.GraphWriter) error { return nil }); err != nil {
+			t.Fatalf("%s: apply: %v", c.name, err)
+		}
+		for i := range 2 {
+			changes, err := engine.WhatChanged(ctx)
+			if err != nil {
+				t.Fatalf("%s: what changed #%d: %v", c.name, i, err)
+			}
+			if !changes.IsEmpty() {
+				t.Errorf("%s: WhatChanged() #%d GraphBefore = %v and GraphAfter = %v, want equal", c.name, i, changes.GraphBefore, changes.GraphAfter)
+			}
+			if want := digitaltwin.ComputeForestHash(); changes.GraphAfter != want {
+				t.Errorf("%s: WhatChanged() #%d GraphAfter = %v, want the hash of an empty graph %v", c.name, i, changes.GraphAfter, want)
+			}
+			if changes.Created != nil || changes.Updated != nil || changes.Removed != nil {
+				t.Errorf("%s: WhatChanged() #%d = %+v, want no assemblies", c.name, i, changes)
+			}
+		}
+		err = engine.StreamChanges(ctx, func(c digitaltwin.ComponentChanged) error {
+			t.Errorf("StreamChanges() yielded %v, want nothing", c.AssemblyID())
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: stream changes: %v", c.name, err)
+		}
+	}
+}
+
+func TestEngine_StreamChanges(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	ctx := context.Background()
+	// Both engines observe the same (empty) graph, so they start with the same
+	// snapshot. We modify the graph through the first engine, and then hand its
+	// taints over to the second one so both sweep the same modifications.
+	whatChanged, err := NewEngine(ctx, driver, "neo4j")
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamChanges, err := NewEngine(ctx, driver, "neo4j")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compilations := []digitaltwin.Compilation{
+		func(ctx context.Context, w digitaltwin.GraphWriter) error {
+			if err := w.AssertEdge(ctx, enginetest.NodeA{}, enginetest.NodeB{}); err != nil {
+				return err
+			}
+			return w.AssertNode(ctx, enginetest.NodeC{})
+		},
+		func(ctx context.Context, w digitaltwin.GraphWriter) error {
+			if err := w.RetractNode(ctx, enginetest.NodeC{}); err != nil {
+				return err
+			}
+			return w.AssertEdge(ctx, enginetest.NodeA{}, enginetest.NodeD{})
+		},
+	}
+	for i, compilation := range compilations {
+		if err := whatChanged.Apply(ctx, compilation); err != nil {
+			t.Fatalf("apply #%d: %v", i, err)
+		}
+		streamChanges.taintedNodes.Taint(slices.Collect(maps.Values(whatChanged.taintedNodes.m))...)
+
+		changes, err := whatChanged.WhatChanged(ctx)
+		if err != nil {
+			t.Fatalf("what changed #%d: %v", i, err)
+		}
+		var want []componentChange
+		for _, c := range changes.Created {
+			want = append(want, componentChange{"created", c.AssemblyID(), c.AssemblyHash(), changes.GraphAfter})
+		}
+		for _, c := range changes.Updated {
+			want = append(want, componentChange{"updated", c.AssemblyID(), c.AssemblyHash(), changes.GraphAfter})
+		}
+		for _, c := range changes.Removed {
+			want = append(want, componentChange{"removed", c.AssemblyID(), c.AssemblyHash(), changes.GraphAfter})
+		}
+
+		var got []componentChange
+		err = streamChanges.StreamChanges(ctx, func(c digitaltwin.ComponentChanged) error {
+			kind := "removed"
+			if c.IsCreated() {
+				kind = "created"
+			} else if c.IsUpdated() {
+				kind = "updated"
+			}
+			got = append(got, componentChange{kind, c.AssemblyID(), c.AssemblyHash(), c.GraphHash})
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("stream changes #%d: %v", i, err)
+		}
+
+		// Neither method guarantees any order among the components it reports.
+		if diff := cmp.Diff(want, got, cmpopts.SortSlices(componentChange.less)); diff != "" {
+			t.Errorf("StreamChanges() #%d mismatch (-want +got):\n%s", i, diff)
+		}
+		if diff := cmp.Diff(whatChanged.snapshot, streamChanges.snapshot); diff != "" {
+			t.Errorf("snapshot #%d mismatch (-WhatChanged +StreamChanges):\n%s", i, diff)
+		}
+	}
+}
+
+// A componentChange summarises a digitaltwin.ComponentChanged, so changes can
+// be compared regardless of how their assemblies are represented.
+type componentChange struct {
+	Kind      string
+	ID        digitaltwin.ComponentID
+	Hash      digitaltwin.ComponentHash
+	GraphHash digitaltwin.ForestHash
+}
+
+func (c componentChange) less(other componentChange) bool {
+	return c.ID.Less(other.ID)
+}
+
+// A failed sweep must not lose the taints it cleared, so the next sweep still
+// reports the changes the failed one would have reported.
+func TestEngine_failedSweep(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	ctx := context.Background()
+	engine, err := NewEngine(ctx, driver, "neo4j")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = engine.Apply(ctx, func(ctx context.Context, w digitaltwin.GraphWriter) error {
+		return w.AssertEdge(ctx, enginetest.NodeA{}, enginetest.NodeB{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := engine.WhatChanged(cancelled); err == nil {
+		t.Fatal("WhatChanged() with a cancelled context succeeded, want an error")
+	}
+	changes, err := engine.WhatChanged(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Created) != 1 || changes.Created[0].AssemblyID() != componentOf(enginetest.NodeA{}).AssemblyID() {
+		t.Errorf("WhatChanged() after a failed sweep created %v, want the component of NodeA", changes.Created)
+	}
+
+	err = engine.Apply(ctx, func(ctx context.Context, w digitaltwin.GraphWriter) error {
+		return w.AssertEdge(ctx, enginetest.NodeA{}, enginetest.NodeC{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failure := errors.New("yield failure")
+	err = engine.StreamChanges(ctx, func(digitaltwin.ComponentChanged) error {
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("StreamChanges() error = %v, want %v", err, failure)
+	}
+	changes, err = engine.WhatChanged(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Updated) != 1 || changes.Updated[0].AssemblyID() != componentOf(enginetest.NodeA{}).AssemblyID() {
+		t.Errorf("WhatChanged() after a failed stream updated %v, want the component of NodeA", changes.Updated)
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	var logs, contextLogs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	ctx := component.InjectLogger(context.Background(), slog.New(slog.NewTextHandler(&contextLogs, nil)))
+
+	// A malformed node is skipped with a warning, so sweeping the graph logs
+	// something.
+	_, err := neo4j.ExecuteQuery(ctx, driver, "CREATE (:NodeC {manual: true})", nil,
+		neo4j.EagerResultTransformer,
+		neo4j.ExecuteQueryWithDatabase("neo4j"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine, err := NewEngine(ctx, driver, "neo4j", WithLogger(logger), WithSkipMalformedNodes(), WithoutTainting())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.WhatChanged(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The engine must log through the given logger, rather than the logger of the
+	// context.
+	if contextLogs.Len() > 0 {
+		t.Errorf("the logger of the context received logs:\n%s", contextLogs.String())
+	}
+	if !strings.Contains(logs.String(), "neo4j.database=neo4j") {
+		t.Errorf("the given logger did not receive the logs of the engine:\n%s", logs.String())
+	}
+}
+
+func TestEngine_ListComponents(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	ctx := context.Background()
+	engine, err := NewEngine(ctx, driver, "neo4j")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compilations := []struct {
+		compilation digitaltwin.Compilation
+		want        []digitaltwin.Assembly
+	}{
+		{
+			compilation: func(ctx context.Context, w digitaltwin.GraphWriter) error {
+				return w.AssertEdge(ctx, enginetest.NodeA{}, enginetest.NodeB{})
+			},
+			want: []digitaltwin.Assembly{componentOf(enginetest.NodeA{})},
+		},
+		{
+			compilation: func(ctx context.Context, w digitaltwin.GraphWriter) error {
+				if err := w.AssertNode(ctx, enginetest.NodeC{}); err != nil {
+					return err
+				}
+				return w.AssertNode(ctx, enginetest.NodeD{})
+			},
+			want: []digitaltwin.Assembly{
+				componentOf(enginetest.NodeA{}),
+				componentOf(enginetest.NodeC{}),
+				componentOf(enginetest.NodeD{}),
+			},
+		},
+		{
+			compilation: func(ctx context.Context, w digitaltwin.GraphWriter) error {
+				return w.AssertEdge(ctx, enginetest.NodeC{}, enginetest.NodeD{})
+			},
+			want: []digitaltwin.Assembly{
+				componentOf(enginetest.NodeA{}),
+				componentOf(enginetest.NodeC{}),
+			},
+		},
+	}
+	for i, c := range compilations {
+		if err := engine.Apply(ctx, c.compilation); err != nil {
+			t.Fatalf("apply #%d: %v", i, err)
+		}
+
+		var want []digitaltwin.ComponentID
+		for _, a := range c.want {
+			want = append(want, a.AssemblyID())
+		}
+		slices.SortFunc(want, digitaltwin.ComponentID.Compare)
+		got, err := engine.ListComponents(ctx)
+		if err != nil {
+			t.Fatalf("list components #%d: %v", i, err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("ListComponents() #%d mismatch (-want +got):\n%s", i, diff)
+		}
+
+		n, err := engine.ComponentCount(ctx)
+		if err != nil {
+			t.Fatalf("count components #%d: %v", i, err)
+		}
+		if n != len(want) {
+			t.Errorf("ComponentCount() #%d = %d, want %d", i, n, len(want))
+		}
+	}
+}
+
+// The componentOf function returns an assembly rooted at the given value. Its
+// AssemblyID identifies any component with that single root, regardless of the
+// component's other nodes.
+func componentOf(root digitaltwin.Value) digitaltwin.Assembly {
+	var b digitaltwin.AssemblyBuilder
+	b.Roots(root)
+	return b.Assemble()
+}
+
+func TestEngine_GetComponent(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	ctx := context.Background()
+	engine, err := NewEngine(ctx, driver, "neo4j")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = engine.Apply(ctx, func(ctx context.Context, w digitaltwin.GraphWriter) error {
+		if err := w.AssertEdge(ctx, enginetest.NodeA{}, enginetest.NodeB{}); err != nil {
+			return err
+		}
+		return w.AssertNode(ctx, enginetest.NodeC{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b digitaltwin.AssemblyBuilder
+	b.Roots(enginetest.NodeA{})
+	b.Connect(enginetest.NodeA{}, enginetest.NodeB{})
+	want := b.Assemble()
+
+	got, found, err := engine.GetComponent(ctx, want.AssemblyID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Fatalf("GetComponent(%v) found nothing", want.AssemblyID())
+	}
+	if got.AssemblyHash() != want.AssemblyHash() {
+		t.Errorf("GetComponent(%v).AssemblyHash() = %v, want %v", want.AssemblyID(), got.AssemblyHash(), want.AssemblyHash())
+	}
+
+	// NodeD was never asserted, so there is no such component.
+	missing := componentOf(enginetest.NodeD{}).AssemblyID()
+	if _, found, err := engine.GetComponent(ctx, missing); err != nil || found {
+		t.Errorf("GetComponent(%v) = _, %v, %v; want _, false, nil", missing, found, err)
+	}
+
+	// A root created behind the engine's back, without a content-address, must not
+	// fail the lookup of unrelated components.
+	_, err = neo4j.ExecuteQuery(ctx, driver, "CREATE (:NodeD {manual: true})", nil,
+		neo4j.EagerResultTransformer,
+		neo4j.ExecuteQueryWithDatabase("neo4j"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found, err := engine.GetComponent(ctx, want.AssemblyID()); err != nil || !found {
+		t.Errorf("GetComponent(%v) beside a malformed root = _, %v, %v; want _, true, nil", want.AssemblyID(), found, err)
+	}
+
+	// A component of several roots is identified by all of them, so it is found
+	// once the engine has reported it.
+	err = engine.Apply(ctx, func(ctx context.Context, w digitaltwin.GraphWriter) error {
+		if err := w.AssertEdge(ctx, enginetest.NodeC{}, enginetest.NodeD{}); err != nil {
+			return err
+		}
+		return w.AssertEdge(ctx, enginetest.NodeN{N: 1}, enginetest.NodeD{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.WhatChanged(ctx); err != nil {
+		t.Fatal(err)
+	}
+	b.Reset()
+	b.Roots(enginetest.NodeC{}, enginetest.NodeN{N: 1})
+	b.Connect(enginetest.NodeC{}, enginetest.NodeD{})
+	b.Connect(enginetest.NodeN{N: 1}, enginetest.NodeD{})
+	converging := b.Assemble()
+	got, found, err = engine.GetComponent(ctx, converging.AssemblyID())
+	if err != nil || !found {
+		t.Fatalf("GetComponent(%v) of several roots = _, %v, %v; want _, true, nil", converging.AssemblyID(), found, err)
+	}
+	if got.AssemblyHash() != converging.AssemblyHash() {
+		t.Errorf("GetComponent(%v).AssemblyHash() = %v, want %v", converging.AssemblyID(), got.AssemblyHash(), converging.AssemblyHash())
+	}
+}
+
+func TestEngine_VerifySnapshot(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	ctx := context.Background()
+	engine, err := NewEngine(ctx, driver, "neo4j")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = engine.Apply(ctx, func(ctx context.Context, w digitaltwin.GraphWriter) error {
+		return w.AssertNode(ctx, enginetest.NodeA{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.WhatChanged(ctx); err != nil {
+		t.Fatal(err)
+	}
+	drift, err := engine.VerifySnapshot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drift) != 0 {
+		t.Fatalf("VerifySnapshot() after WhatChanged = %v, want no drift", drift)
+	}
+
+	// Then, we create a node behind the engine's back, so its snapshot drifts.
+	node := enginetest.NodeB{}
+	ca, err := digitaltwin.MustContentAddress(node).MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = neo4j.ExecuteQuery(ctx, driver, "CREATE (:NodeB {_contentAddress: $ca})",
+		map[string]any{"ca": string(ca)},
+		neo4j.EagerResultTransformer,
+		neo4j.ExecuteQueryWithDatabase("neo4j"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drift, err = engine.VerifySnapshot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []digitaltwin.ComponentID{componentOf(node).AssemblyID()}
+	if diff := cmp.Diff(want, drift); diff != "" {
+		t.Errorf("VerifySnapshot() mismatch (-want +got):\n%s", diff)
+	}
+
+	// VerifySnapshot leaves the internal snapshot untouched, so calling it again
+	// reports the same drift.
+	if again, err := engine.VerifySnapshot(ctx); err != nil || len(again) != 1 {
+		t.Errorf("VerifySnapshot() again = %v, %v; want the same drift", again, err)
+	}
+}
+
+func TestWithBookmarks(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	ctx := context.Background()
+	engine, err := NewEngine(ctx, driver, "neo4j", WithBookmarks())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every change applied must be visible to the very next read, which runs in a
+	// session of its own.
+	for _, v := range []digitaltwin.Value{enginetest.NodeA{}, enginetest.NodeB{}, enginetest.NodeC{}} {
+		err := engine.Apply(ctx, func(ctx context.Context, w digitaltwin.GraphWriter) error {
+			return w.AssertNode(ctx, v)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		changes, err := engine.WhatChanged(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := componentOf(v).AssemblyHash()
+		if len(changes.Created) != 1 || changes.Created[0].AssemblyHash() != want {
+			t.Errorf("WhatChanged() after asserting %T created %d components, want only %v", v, len(changes.Created), want)
+		}
+	}
+}
+
+func TestWithSessionConfig(t *testing.T) {
+	ctx := context.Background()
+	template := neo4j.SessionConfig{ImpersonatedUser: "twin", FetchSize: 42}
+
+	tests := []struct {
+		name      string
+		opts      []Option
+		wantRead  neo4j.AccessMode
+		bookmarks bool
+	}{
+		{name: "Default", wantRead: neo4j.AccessModeRead},
+		{name: "ReadsOnLeader", opts: []Option{WithReadAccessMode(neo4j.AccessModeWrite)}, wantRead: neo4j.AccessModeWrite},
+		{name: "WithBookmarks", opts: []Option{WithBookmarks()}, wantRead: neo4j.AccessModeRead, bookmarks: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var driver sessionRecordingDriver
+			engine, err := NewEngine(ctx, &driver, "twin", append([]Option{WithSessionConfig(template)}, tt.opts...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = engine.Apply(ctx, func(context.Context, digitaltwin.GraphWriter) error { return nil })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(driver.configs) != 2 {
+				t.Fatalf("NewEngine() and Apply() opened %d sessions, want 2", len(driver.configs))
+			}
+
+			read, write := driver.configs[0], driver.configs[1]
+			for _, c := range []struct {
+				name   string
+				config neo4j.SessionConfig
+				mode   neo4j.AccessMode
+			}{
+				{name: "read", config: read, mode: tt.wantRead},
+				{name: "write", config: write, mode: neo4j.AccessModeWrite},
+			} {
+				if c.config.DatabaseName != "twin" || c.config.AccessMode != c.mode {
+					t.Errorf("%s session: database %q with access mode %v, want %q with %v", c.name, c.config.DatabaseName, c.config.AccessMode, "twin", c.mode)
+				}
+				if c.config.ImpersonatedUser != template.ImpersonatedUser || c.config.FetchSize != template.FetchSize {
+					t.Errorf("%s session: %+v, want the template's user and fetch size", c.name, c.config)
+				}
+				if (c.config.BookmarkManager != nil) != tt.bookmarks {
+					t.Errorf("%s session: bookmark manager %v, want bookmarks %v", c.name, c.config.BookmarkManager, tt.bookmarks)
+				}
+			}
+			// Both sessions must share the same bookmark manager to chain them.
+			if read.BookmarkManager != write.BookmarkManager {
+				t.Errorf("read and write sessions use different bookmark managers")
+			}
+		})
+	}
+}
+
+// A sessionRecordingDriver is a neo4j.DriverWithContext that records the
+// configuration of every session it opens. Its sessions run every query
+// against an empty graph.
+type sessionRecordingDriver struct {
+	neo4j.DriverWithContext // Panics if the code under test calls anything else.
+	configs                 []neo4j.SessionConfig
+}
+
+func (d *sessionRecordingDriver) NewSession(_ context.Context, config neo4j.SessionConfig) neo4j.SessionWithContext {
+	d.configs = append(d.configs, config)
+	return emptySession{}
+}
+
+// An emptySession is a neo4j.SessionWithContext of an empty graph.
+type emptySession struct {
+	neo4j.SessionWithContext // Panics if the code under test calls anything else.
+}
+
+func (emptySession) Run(context.Context, string, map[string]any, ...func(*neo4j.TransactionConfig)) (neo4j.ResultWithContext, error) {
+	return &fakeResult{}, nil
+}
+
+func (emptySession) ExecuteWrite(_ context.Context, work neo4j.ManagedTransactionWork, _ ...func(*neo4j.TransactionConfig)) (any, error) {
+	return work(&fakeTx{})
+}
+
+func (emptySession) Close(context.Context) error { return nil }
+
+func TestWithCorruptionHandler(t *testing.T) {
+	ctx := context.Background()
+	errQuarantined := errors.New("database quarantined")
+	assertNode := func(ctx context.Context, w digitaltwin.GraphWriter) error {
+		return w.AssertNode(ctx, enginetest.NodeA{})
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		engine, err := NewEngine(ctx, corruptingDriver{}, "twin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Apply() on a corrupted graph did not panic")
+			}
+		}()
+		_ = engine.Apply(ctx, assertNode)
+	})
+
+	t.Run("Handler", func(t *testing.T) {
+		var reasons []string
+		engine, err := NewEngine(ctx, corruptingDriver{}, "twin", WithCorruptionHandler(func(_ context.Context, reason string) error {
+			reasons = append(reasons, reason)
+			return errQuarantined
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := engine.Apply(ctx, assertNode); !errors.Is(err, errQuarantined) {
+			t.Errorf("Apply() error = %v, want %v", err, errQuarantined)
+		}
+		want := []string{"assert-node modified 2 nodes instead of 1"}
+		if diff := cmp.Diff(want, reasons); diff != "" {
+			t.Errorf("corruption reasons mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("NilHandlerError", func(t *testing.T) {
+		engine, err := NewEngine(ctx, corruptingDriver{}, "twin", WithCorruptionHandler(func(context.Context, string) error {
+			return nil
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := engine.Apply(ctx, assertNode); !errors.Is(err, ErrCorruptedGraph) {
+			t.Errorf("Apply() error = %v, want %v", err, ErrCorruptedGraph)
+		}
+	})
+
+	t.Run("SwallowedError", func(t *testing.T) {
+		engine, err := NewEngine(ctx, corruptingDriver{}, "twin", WithCorruptionHandler(func(context.Context, string) error {
+			return errQuarantined
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The compilation ignores the error, yet the transaction must not commit.
+		err = engine.Apply(ctx, func(ctx context.Context, w digitaltwin.GraphWriter) error {
+			_ = w.AssertNode(ctx, enginetest.NodeA{})
+			return nil
+		})
+		if !errors.Is(err, errQuarantined) {
+			t.Errorf("Apply() error = %v, want %v", err, errQuarantined)
+		}
+	})
+}
+
+// A corruptingDriver is a neo4j.DriverWithContext of an empty graph, whose write
+// transactions report modifying two nodes for every query, as if the graph had
+// lost its integrity.
+type corruptingDriver struct {
+	neo4j.DriverWithContext // Panics if the code under test calls anything else.
+}
+
+func (corruptingDriver) NewSession(context.Context, neo4j.SessionConfig) neo4j.SessionWithContext {
+	return corruptingSession{}
+}
+
+type corruptingSession struct {
+	emptySession
+}
+
+func (corruptingSession) ExecuteWrite(_ context.Context, work neo4j.ManagedTransactionWork, _ ...func(*neo4j.TransactionConfig)) (any, error) {
+	return work(&fakeTx{records: []*neo4j.Record{{Keys: []string{"nodes"}, Values: []any{int64(2)}}}})
+}
+
+func TestEngine_ApplyIfUnchanged(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	ctx := context.Background()
+	engine, err := NewEngine(ctx, driver, "neo4j")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Another service writing to the same graph concurrently.
+	concurrent, err := NewEngine(ctx, driver, "neo4j")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertNode := func(v digitaltwin.Value) digitaltwin.Compilation {
+		return func(ctx context.Context, w digitaltwin.GraphWriter) error {
+			return w.AssertNode(ctx, v)
+		}
+	}
+	if err := engine.Apply(ctx, assertNode(enginetest.NodeA{})); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := engine.WhatChanged(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseline := changes.GraphAfter
+
+	// The graph has not moved since the baseline, so the guarded apply succeeds.
+	if err := engine.ApplyIfUnchanged(ctx, baseline, assertNode(enginetest.NodeB{})); err != nil {
+		t.Fatalf("ApplyIfUnchanged() on an unchanged graph: %v", err)
+	}
+	changes, err = engine.WhatChanged(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseline = changes.GraphAfter
+
+	// Then, a concurrent write moves the graph away from the baseline, so the
+	// guarded apply must fail without modifying the graph.
+	if err := concurrent.Apply(ctx, assertNode(enginetest.NodeC{})); err != nil {
+		t.Fatal(err)
+	}
+	err = engine.ApplyIfUnchanged(ctx, baseline, assertNode(enginetest.NodeD{}))
+	if !errors.Is(err, ErrGraphChanged) {
+		t.Fatalf("ApplyIfUnchanged() error = %v, want %v", err, ErrGraphChanged)
+	}
+	if _, found, err := engine.GetComponent(ctx, componentOf(enginetest.NodeD{}).AssemblyID()); err != nil || found {
+		t.Errorf("GetComponent(NodeD) = _, %v, %v; want the rejected compilation to be rolled back", found, err)
+	}
+
+	// Finally, two guarded applies race from the same baseline. Whichever commits
+	// first moves the graph away from it, so the other must fail.
+	changes, err = engine.WhatChanged(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseline = changes.GraphAfter
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, v := range []digitaltwin.Value{enginetest.NodeD{}, enginetest.NodeN{N: 1}} {
+		wg.Go(func() {
+			errs[i] = engine.ApplyIfUnchanged(ctx, baseline, assertNode(v))
+		})
+	}
+	wg.Wait()
+	var succeeded, rejected int
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.Is(err, ErrGraphChanged):
+			rejected++
+		default:
+			t.Errorf("concurrent ApplyIfUnchanged() error = %v, want nil or %v", err, ErrGraphChanged)
+		}
+	}
+	if succeeded != 1 || rejected != 1 {
+		t.Errorf("concurrent ApplyIfUnchanged() succeeded %d times and was rejected %d times, want once each", succeeded, rejected)
+	}
+}
+
+func TestWithSkipMalformedNodes(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	ctx := context.Background()
+	skipped := countMalformedNodes(t)
+
+	// We create a node behind the engine's back, without its metadata, as a manual
+	// fix would. Capturing the initial snapshot must skip it already.
+	_, err := neo4j.ExecuteQuery(ctx, driver, "CREATE (:NodeC {manual: true})", nil,
+		neo4j.EagerResultTransformer,
+		neo4j.ExecuteQueryWithDatabase("neo4j"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Nothing taints the malformed node, so we sweep the entire graph to find it.
+	engine, err := NewEngine(ctx, driver, "neo4j", WithSkipMalformedNodes(), WithoutTainting())
+	if err != nil {
+		t.Fatalf("NewEngine() with a malformed node: %v", err)
+	}
+
+	err = engine.Apply(ctx, func(ctx context.Context, w digitaltwin.GraphWriter) error {
+		return w.AssertEdge(ctx, enginetest.NodeA{}, enginetest.NodeB{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := skipped()
+	changes, err := engine.WhatChanged(ctx)
+	if err != nil {
+		t.Fatalf("WhatChanged() with a malformed node: %v", err)
+	}
+	want := []digitaltwin.ComponentID{edgeComponent(enginetest.NodeA{}, enginetest.NodeB{}).AssemblyID()}
+	var got []digitaltwin.ComponentID
+	for _, c := range changes.Created {
+		got = append(got, c.AssemblyID())
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("WhatChanged() created mismatch (-want +got):\n%s", diff)
+	}
+	if n := skipped() - before; n != 1 {
+		t.Errorf("WhatChanged() skipped %d malformed nodes, want 1", n)
+	}
+}
+
+func TestEngine_accessors(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	ctx := context.Background()
+	engine, err := NewEngine(ctx, driver, "neo4j")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := engine.Database(); got != "neo4j" {
+		t.Errorf("Database() = %q, want %q", got, "neo4j")
+	}
+	if got := engine.Driver(); got != driver {
+		t.Errorf("Driver() = %v, want the driver given to NewEngine", got)
+	}
+}
+
+func TestEngine_NodeStats(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	ctx := context.Background()
+	engine, err := NewEngine(ctx, driver, "neo4j")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = engine.Apply(ctx, func(ctx context.Context, w digitaltwin.GraphWriter) error {
+		for n := 1; n <= 3; n++ {
+			if err := w.AssertEdge(ctx, enginetest.NodeA{}, enginetest.NodeN{N: n}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A marker label set by another system does not count as a label of its own.
+	_, err = neo4j.ExecuteQuery(ctx, driver, "MATCH (n:NodeN {N: 1}) SET n:Marker", nil,
+		neo4j.EagerResultTransformer,
+		neo4j.ExecuteQueryWithDatabase("neo4j"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := engine.NodeStats(ctx)
+	if err != nil {
+		t.Fatalf("NodeStats() error = %v", err)
+	}
+	want := map[string]int{"NodeA": 1, "NodeN": 3}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("NodeStats() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWithMaxComponentNodes(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	ctx := context.Background()
+	engine, err := NewEngine(ctx, driver, "neo4j", WithMaxComponentNodes(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two small components are merged into one too large, as a runaway compilation
+	// would do.
+	for _, leaves := range [][2]int{{1, 3}, {4, 6}} {
+		err = engine.Apply(ctx, func(ctx context.Context, w digitaltwin.GraphWriter) error {
+			for n := leaves[0]; n <= leaves[1]; n++ {
+				if err := w.AssertEdge(ctx, enginetest.NodeN{N: leaves[0] * 100}, enginetest.NodeN{N: n}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := engine.WhatChanged(ctx); err != nil {
+		t.Fatalf("WhatChanged() of small components: %v", err)
+	}
+	err = engine.Apply(ctx, func(ctx context.Context, w digitaltwin.GraphWriter) error {
+		if err := w.AssertEdge(ctx, enginetest.NodeN{N: 0}, enginetest.NodeN{N: 100}); err != nil {
+			return err
+		}
+		return w.AssertEdge(ctx, enginetest.NodeN{N: 0}, enginetest.NodeN{N: 400})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = engine.WhatChanged(ctx)
+	var tooLarge ComponentTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("WhatChanged() of a merged component error = %v, want %T", err, tooLarge)
+	}
+	if !errors.Is(err, ErrComponentTooLarge) {
+		t.Errorf("WhatChanged() error = %v, want %v", err, ErrComponentTooLarge)
+	}
+	// The ID of a component depends on its root alone.
+	var root digitaltwin.AssemblyBuilder
+	root.Roots(enginetest.NodeN{N: 0})
+	want := ComponentTooLargeError{ID: root.Assemble().AssemblyID(), Nodes: 9, Limit: 5}
+	if diff := cmp.Diff(want, tooLarge); diff != "" {
+		t.Errorf("ComponentTooLargeError mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWithRetainAssemblies(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	ctx := context.Background()
+	engine, err := NewEngine(ctx, driver, "neo4j", WithRetainAssemblies())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b, c := enginetest.NodeA{}, enginetest.NodeB{}, enginetest.NodeC{}
+
+	// The engine must observe a component before it can retain its assembly.
+	err = engine.Apply(ctx, func(ctx context.Context, w digitaltwin.GraphWriter) error {
+		return w.AssertNode(ctx, a)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.WhatChanged(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, to := range []digitaltwin.Value{b, c} {
+		err := engine.Apply(ctx, func(ctx context.Context, w digitaltwin.GraphWriter) error {
+			return w.AssertEdge(ctx, a, to)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	changes, err := engine.WhatChanged(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Updated) != 1 {
+		t.Fatalf("WhatChanged() updated %d components, want 1", len(changes.Updated))
+	}
+	got := changes.Updated[0].BaselineAssembly
+	if got == nil {
+		t.Fatal("WhatChanged() updated component without its BaselineAssembly")
+	}
+	if want := componentOf(a); got.AssemblyHash() != want.AssemblyHash() {
+		t.Errorf("BaselineAssembly hash = %v, want %v", got.AssemblyHash(), want.AssemblyHash())
+	}
+	if got.AssemblyHash() != changes.Updated[0].Baseline {
+		t.Errorf("BaselineAssembly hash = %v, want the Baseline %v", got.AssemblyHash(), changes.Updated[0].Baseline)
+	}
+}
+
+func TestWithMaxMutationsPerApply(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	ctx := context.Background()
+	engine, err := NewEngine(ctx, driver, "neo4j", WithMaxMutationsPerApply(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Connecting two nodes within the budget succeeds.
+	err = engine.Apply(ctx, func(ctx context.Context, w digitaltwin.GraphWriter) error {
+		return w.AssertEdge(ctx, enginetest.NodeA{}, enginetest.NodeB{})
+	})
+	if err != nil {
+		t.Fatalf("Apply() within the budget: %v", err)
+	}
+
+	// Then, a compilation exceeding the budget must be rolled back entirely, not
+	// just from the mutation that exceeded it onwards.
+	err = engine.Apply(ctx, func(ctx context.Context, w digitaltwin.GraphWriter) error {
+		for _, v := range []digitaltwin.Value{enginetest.NodeC{}, enginetest.NodeD{}, enginetest.NodeD{}} {
+			if err := w.AssertNode(ctx, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if !errors.Is(err, ErrMutationBudgetExceeded) {
+		t.Fatalf("Apply() error = %v, want %v", err, ErrMutationBudgetExceeded)
+	}
+	for _, v := range []digitaltwin.Value{enginetest.NodeC{}, enginetest.NodeD{}} {
+		if _, found, err := engine.GetComponent(ctx, componentOf(v).AssemblyID()); err != nil || found {
+			t.Errorf("GetComponent(%T) = _, %v, %v; want the rejected compilation to be rolled back", v, found, err)
+		}
+	}
+}
+
+func TestEngine_ApplySteps(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	ctx := context.Background()
+	engine, err := NewEngine(ctx, driver, "neo4j")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b, c := enginetest.NodeA{}, enginetest.NodeB{}, enginetest.NodeC{}
+	// The nodes must already be in the graph to be locked.
+	err = engine.Apply(ctx, func(ctx context.Context, w digitaltwin.GraphWriter) error {
+		for _, v := range []digitaltwin.Value{a, b, c} {
+			if err := w.AssertNode(ctx, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both recordings modify overlapping nodes, in opposite orders, which is prone
+	// to deadlocks unless their targets are locked upfront.
+	var forward, backward compilation.Recorder
+	forward.AssertEdge(a, b)
+	forward.AssertEdge(b, c)
+	backward.AssertNode(c)
+	backward.AssertEdge(a, c)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, steps := range [][]compilation.Step{forward.Steps(), backward.Steps()} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = engine.ApplySteps(ctx, steps)
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("ApplySteps() #%d error = %v", i, err)
+		}
+	}
+
+	// Both recordings must have been applied in full.
+	changes, err := engine.WhatChanged(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var edges []string
+	for _, created := range changes.Created {
+		created.VisitEdges(func(from, to digitaltwin.Value) bool {
+			edges = append(edges, fmt.Sprintf("%T -> %T", from, to))
+			return true
+		})
+	}
+	want := []string{
+		"enginetest.NodeA -> enginetest.NodeB",
+		"enginetest.NodeA -> enginetest.NodeC",
+		"enginetest.NodeB -> enginetest.NodeC",
+	}
+	if diff := cmp.Diff(want, edges, cmpopts.SortSlices(func(x, y string) bool { return x < y })); diff != "" {
+		t.Errorf("edges after ApplySteps() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWithAuditSink(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	ctx := context.Background()
+	var audited [][]compilation.Step
+	sink := func(ctx context.Context, steps []compilation.Step) error {
+		audited = append(audited, steps)
+		// A failing sink must not fail the committed application.
+		return errors.New("sink unavailable")
+	}
+	engine, err := NewEngine(ctx, driver, "neo4j", WithAuditSink(sink))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var r compilation.Recorder
+	r.AssertEdge(enginetest.NodeA{}, enginetest.NodeB{})
+	r.AssertNode(enginetest.NodeC{})
+	if err := engine.ApplySteps(ctx, r.Steps()); err != nil {
+		t.Fatalf("ApplySteps() error = %v", err)
+	}
+	// A failed application is not audited.
+	type unregisteredNode struct {
+		digitaltwin.InformationElement
+	}
+	var rejected compilation.Recorder
+	rejected.AssertNode(unregisteredNode{})
+	if err := engine.ApplySteps(ctx, rejected.Steps()); err == nil {
+		t.Fatal("ApplySteps() of an unregistered node succeeded")
+	}
+
+	if diff := cmp.Diff([][]compilation.Step{r.Steps()}, audited); diff != "" {
+		t.Errorf("audited steps mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWithTenant(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	ctx := context.Background()
+	// The node key must span the tenant, or the constraint on the content-address
+	// alone rejects the second tenant asserting the same node.
+	const database = "tenants"
+	if err := BootstrapDatabase(ctx, driver, database, WithTenantKey()); err != nil {
+		t.Fatalf("BootstrapDatabase() error = %v", err)
+	}
+	engines := make(map[string]*Engine)
+	for _, tenant := range []string{"acme", "globex"} {
+		engine, err := NewEngine(ctx, driver, database, WithTenant(tenant))
+		if err != nil {
+			t.Fatal(err)
+		}
+		engines[tenant] = engine
+	}
+
+	// Both tenants assert the same node, which must result in a node per tenant.
+	compilations := map[string]digitaltwin.Compilation{
+		"acme": func(ctx context.Context, w digitaltwin.GraphWriter) error {
+			return w.AssertEdge(ctx, enginetest.NodeA{}, enginetest.NodeD{})
+		},
+		"globex": func(ctx context.Context, w digitaltwin.GraphWriter) error {
+			if err := w.AssertNode(ctx, enginetest.NodeD{}); err != nil {
+				return err
+			}
+			return w.AssertNode(ctx, enginetest.NodeC{})
+		},
+	}
+	for tenant, compilation := range compilations {
+		if err := engines[tenant].Apply(ctx, compilation); err != nil {
+			t.Fatalf("Apply() of %s: %v", tenant, err)
+		}
+	}
+
+	want := map[string][]string{
+		"acme":   {"enginetest.NodeA -> enginetest.NodeD"},
+		"globex": {"enginetest.NodeC", "enginetest.NodeD"},
+	}
+	for tenant, engine := range engines {
+		changes, err := engine.WhatChanged(ctx)
+		if err != nil {
+			t.Fatalf("WhatChanged() of %s: %v", tenant, err)
+		}
+		if len(changes.Updated) != 0 || len(changes.Removed) != 0 {
+			t.Errorf("WhatChanged() of %s: got %d updated, %d removed; want none", tenant, len(changes.Updated), len(changes.Removed))
+		}
+		var got []string
+		for _, created := range changes.Created {
+			edges := len(got)
+			created.VisitEdges(func(from, to digitaltwin.Value) bool {
+				got = append(got, fmt.Sprintf("%T -> %T", from, to))
+				return true
+			})
+			if len(got) == edges { // An isolated node.
+				for v := range created.Values() {
+					got = append(got, fmt.Sprintf("%T", v))
+				}
+			}
+		}
+		if diff := cmp.Diff(want[tenant], got, cmpopts.SortSlices(func(x, y string) bool { return x < y })); diff != "" {
+			t.Errorf("WhatChanged() of %s mismatch (-want +got):\n%s", tenant, diff)
+		}
+
+		// A full sweep must be scoped to the tenant just the same.
+		components, err := engine.ListComponents(ctx)
+		if err != nil {
+			t.Fatalf("ListComponents() of %s: %v", tenant, err)
+		}
+		if len(components) != len(changes.Created) {
+			t.Errorf("ListComponents() of %s = %d components, want %d", tenant, len(components), len(changes.Created))
+		}
+	}
+}
+
+func TestWithRelaxedReadConsistency(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	ctx := context.Background()
+	engine, err := NewEngine(ctx, driver, "neo4j", WithRelaxedReadConsistency())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = engine.Apply(ctx, func(ctx context.Context, w digitaltwin.GraphWriter) error {
+		return w.AssertEdge(ctx, enginetest.NodeA{}, enginetest.NodeB{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// We block the sweep as soon as it starts reading the graph, restoring the
+	// package's tracer afterwards.
+	blocker := &sweepBlocker{started: make(chan struct{}), release: make(chan struct{})}
+	defer func(original trace.Tracer) { tracer = original }(tracer)
+	tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(blocker)).Tracer(t.Name())
+
+	swept := make(chan error, 1)
+	go func() {
+		_, err := engine.WhatChanged(ctx)
+		swept <- err
+	}()
+	<-blocker.started
+
+	// Apply must not wait for the sweep to complete.
+	applied := make(chan error, 1)
+	go func() {
+		applied <- engine.Apply(ctx, func(ctx context.Context, w digitaltwin.GraphWriter) error {
+			return w.AssertNode(ctx, enginetest.NodeC{})
+		})
+	}()
+	select {
+	case err := <-applied:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("Apply() blocked during a relaxed WhatChanged()")
+	}
+	close(blocker.release)
+	if err := <-swept; err != nil {
+		t.Fatal(err)
+	}
+
+	// The write applied during the sweep is reported by the next one.
+	changes, err := engine.WhatChanged(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b digitaltwin.AssemblyBuilder
+	b.Roots(enginetest.NodeC{})
+	if len(changes.Created) != 1 || changes.Created[0].AssemblyID() != b.Assemble().AssemblyID() {
+		t.Errorf("WhatChanged() created %v, want the component of NodeC", changes.Created)
+	}
+}
+
+func TestWithRelaxedReadConsistency_concurrentSweeps(t *testing.T) {
+	// Every read alternates the graph between two single-node components, so every
+	// sweep has changes to record.
+	record := func(v digitaltwin.Value) []*neo4j.Record {
+		return []*neo4j.Record{{
+			Keys:   []string{"root", "tuples"},
+			Values: []any{recordNode(t, v), []any{map[string]any{"from": nil, "to": nil}}},
+		}}
+	}
+	driver := alternatingDriver{graphs: [2][]*neo4j.Record{record(enginetest.NodeA{}), record(enginetest.NodeB{})}, reads: new(atomic.Int64)}
+	ctx := context.Background()
+	engine, err := NewEngine(ctx, driver, "twin", WithRelaxedReadConsistency(), WithRetainAssemblies(), WithoutTainting())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Relaxed sweeps do not exclude each other while reading the graph, yet their
+	// bookkeeping must not race (run with -race).
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Go(func() {
+			for range 50 {
+				if _, err := engine.WhatChanged(ctx); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		})
+	}
+	wg.Wait()
+}
+
+// An alternatingDriver is a neo4j.DriverWithContext whose read transactions
+// observe the given graphs in turns, as if the graph was concurrently rewritten
+// between reads.
+type alternatingDriver struct {
+	neo4j.DriverWithContext // Panics if the code under test calls anything else.
+	graphs                  [2][]*neo4j.Record
+	reads                   *atomic.Int64
+}
+
+func (d alternatingDriver) NewSession(context.Context, neo4j.SessionConfig) neo4j.SessionWithContext {
+	return alternatingSession{driver: d}
+}
+
+type alternatingSession struct {
+	emptySession
+	driver alternatingDriver
+}
+
+func (s alternatingSession) ExecuteRead(_ context.Context, work neo4j.ManagedTransactionWork, _ ...func(*neo4j.TransactionConfig)) (any, error) {
+	n := s.driver.reads.Add(1)
+	return work(&fakeTx{records: s.driver.graphs[n%2]})
+}
+
+// A sweepBlocker is a span processor that blocks the first sweep of the graph
+// (i.e. the first collectAssemblies span) until released.
+type sweepBlocker struct {
+	once    sync.Once
+	started chan struct{} // Closed once the sweep is blocked.
+	release chan struct{} // Close to unblock the sweep.
+}
+
+func (b *sweepBlocker) OnStart(_ context.Context, s sdktrace.ReadWriteSpan) {
+	if s.Name() != "collectAssemblies" {
+		return
+	}
+	b.once.Do(func() {
+		close(b.started)
+		<-b.release
+	})
+}
+
+func (*sweepBlocker) OnEnd(sdktrace.ReadOnlySpan)      {}
+func (*sweepBlocker) Shutdown(context.Context) error   { return nil }
+func (*sweepBlocker) ForceFlush(context.Context) error { return nil }
+
+func TestWithSoftDelete(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	ctx := context.Background()
+	engine, err := NewEngine(ctx, driver, "neo4j", WithSoftDelete())
+	if err != nil {
+		t.Fatal(err)
+	}
+	apply := func(compilation digitaltwin.Compilation) digitaltwin.GraphChanged {
+		t.Helper()
+		if err := engine.Apply(ctx, compilation); err != nil {
+			t.Fatal(err)
+		}
+		changes, err := engine.WhatChanged(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return changes
+	}
+	// The tombstoned function reports whether the node of the given value still
+	// exists in the graph, and whether it is tombstoned.
+	tombstoned := func(v digitaltwin.Value) (exists, tombstoned bool) {
+		t.Helper()
+		raw, err := FormatNode(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ca, err := raw.ContentAddress.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := neo4j.ExecuteQuery(ctx, driver,
+			"MATCH (n:"+raw.Label+" {_contentAddress: $ca}) RETURN n._deleted_at IS NOT NULL AS tombstoned",
+			map[string]any{"ca": string(ca)}, neo4j.EagerResultTransformer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Records) == 0 {
+			return false, false
+		}
+		deleted, _ := result.Records[0].Get("tombstoned")
+		return true, deleted.(bool)
+	}
+
+	apply(func(ctx context.Context, w digitaltwin.GraphWriter) error {
+		return w.AssertEdge(ctx, enginetest.NodeA{}, enginetest.NodeB{})
+	})
+
+	// Retracting a leaf updates its component, just like deleting it does.
+	changes := apply(func(ctx context.Context, w digitaltwin.GraphWriter) error {
+		return w.RetractNode(ctx, enginetest.NodeB{})
+	})
+	if len(changes.Created) != 0 || len(changes.Updated) != 1 || len(changes.Removed) != 0 {
+		t.Errorf("retract leaf: got %d created, %d updated, %d removed; want only 1 updated", len(changes.Created), len(changes.Updated), len(changes.Removed))
+	}
+	if exists, tombstoned := tombstoned(enginetest.NodeB{}); !exists || !tombstoned {
+		t.Errorf("retracted leaf: exists = %v, tombstoned = %v; want both true", exists, tombstoned)
+	}
+
+	// Retracting the root (now alone) removes its component, while the tombstoned
+	// node remains queryable directly.
+	changes = apply(func(ctx context.Context, w digitaltwin.GraphWriter) error {
+		return w.RetractNode(ctx, enginetest.NodeA{})
+	})
+	if len(changes.Created) != 0 || len(changes.Updated) != 0 || len(changes.Removed) != 1 {
+		t.Errorf("retract root: got %d created, %d updated, %d removed; want only 1 removed", len(changes.Created), len(changes.Updated), len(changes.Removed))
+	}
+	if exists, tombstoned := tombstoned(enginetest.NodeA{}); !exists || !tombstoned {
+		t.Errorf("retracted root: exists = %v, tombstoned = %v; want both true", exists, tombstoned)
+	}
+	if n, err := engine.ComponentCount(ctx); err != nil || n != 0 {
+		t.Errorf("ComponentCount() = %v, %v; want 0, nil", n, err)
+	}
+
+	// Asserting a tombstoned node lifts its tombstone.
+	changes = apply(func(ctx context.Context, w digitaltwin.GraphWriter) error {
+		return w.AssertNode(ctx, enginetest.NodeA{})
+	})
+	if len(changes.Created) != 1 || len(changes.Updated) != 0 || len(changes.Removed) != 0 {
+		t.Errorf("re-assert: got %d created, %d updated, %d removed; want only 1 created", len(changes.Created), len(changes.Updated), len(changes.Removed))
+	}
+	if exists, tombstoned := tombstoned(enginetest.NodeA{}); !exists || tombstoned {
+		t.Errorf("re-asserted node: exists = %v, tombstoned = %v; want true, false", exists, tombstoned)
+	}
+}
+
+func TestWithSnapshotBatchSize(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	ctx := context.Background()
+	engine, err := NewEngine(ctx, driver, "neo4j")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = engine.Apply(ctx, func(ctx context.Context, w digitaltwin.GraphWriter) error {
+		return errors.Join(
+			w.AssertEdge(ctx, enginetest.NodeA{}, enginetest.NodeB{}),
+			w.AssertEdge(ctx, enginetest.NodeB{}, enginetest.NodeC{}),
+			w.AssertNode(ctx, enginetest.NodeD{}),
+		)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := engine.freshSnapshot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range []int{1, 2, 10} {
+		batched, err := NewEngine(ctx, driver, "neo4j", WithSnapshotBatchSize(n))
+		if err != nil {
+			t.Fatalf("NewEngine(WithSnapshotBatchSize(%d)): %v", n, err)
+		}
+		if diff := cmp.Diff(want, batched.snapshot); diff != "" {
+			t.Errorf("WithSnapshotBatchSize(%d) snapshot mismatch (-want +got):\n%s", n, diff)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package neo4jengine
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/go-digitaltwin/go-digitaltwin"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// A ConnectivityError occurs when the engine cannot communicate with the Neo4j
+// server (or cluster), either because the driver failed to connect or because
+// the database is unavailable. Such failures are usually transient, so calling
+// the same method again later may succeed.
+//
+// Its message is the message of the underlying driver error, as-is.
+type ConnectivityError struct {
+	Err error // The underlying driver error.
+}
+
+func (e ConnectivityError) Error() string { return e.Err.Error() }
+func (e ConnectivityError) Unwrap() error { return e.Err }
+
+// A ConstraintViolationError occurs when a compilation attempts to modify the
+// graph in a way that violates one of its constraints (e.g. those created by
+// Bootstrap). Retrying the same compilation fails the same way.
+//
+// Its message is the message of the underlying driver error, as-is.
+type ConstraintViolationError struct {
+	Err error // The underlying driver error.
+}
+
+func (e ConstraintViolationError) Error() string { return e.Err.Error() }
+func (e ConstraintViolationError) Unwrap() error { return e.Err }
+
+// A RootlessAssembliesError is returned from Engine.WhatChanged (and its
+// streaming variant) when any rootless assemblies are found during a sweep. See
+// Engine.WhatChanged for why the sweep may recover when called again.
+type RootlessAssembliesError struct {
+	Count int // The number of rootless assemblies found during the sweep.
+}
+
+func (e RootlessAssembliesError) Error() string {
+	return "found rootless assemblies while sweeping the graph"
+}
+
+// ErrComponentTooLarge is matched (by errors.Is) by every ComponentTooLargeError.
+var ErrComponentTooLarge = errors.New("component too large")
+
+// A ComponentTooLargeError is returned from Engine.WhatChanged (and its
+// streaming variant) when a component of the graph has more nodes than
+// configured by WithMaxComponentNodes. The Engine fails the sweep rather than
+// materialise such an assembly.
+type ComponentTooLargeError struct {
+	ID    digitaltwin.ComponentID // The component that is too large.
+	Nodes int                     // The number of nodes of the component.
+	Limit int                     // The limit the component exceeds.
+}
+
+func (e ComponentTooLargeError) Error() string {
+	return fmt.Sprintf("component %v has %d nodes, more than %d", e.ID, e.Nodes, e.Limit)
+}
+
+func (e ComponentTooLargeError) Is(target error) bool { return target == ErrComponentTooLarge }
+
+// An UnregisteredLabelError occurs when parsing a node whose label was not
+// registered with Register (or its variants), e.g. a node written by a newer
+// version of the program during a rolling upgrade, or by another system sharing
+// the graph. Callers may use errors.As to skip such nodes rather than fail.
+type UnregisteredLabelError struct {
+	Label string // The label of the node.
+}
+
+func (e UnregisteredLabelError) Error() string {
+	return fmt.Sprintf("unregistered label %q", e.Label)
+}
+
+// An UnregisteredTypeError occurs when formatting a digitaltwin.Value whose Go
+// type was not registered with Register (or its variants).
+type UnregisteredTypeError struct {
+	Type reflect.Type // The Go type of the value.
+}
+
+func (e UnregisteredTypeError) Error() string {
+	return fmt.Sprintf("unregistered type %q", e.Type)
+}
+
+// An errMalformedNode occurs when a node of the graph lacks the metadata the
+// engine manages (e.g. a node created by a manual Cypher query), so it cannot be
+// parsed. See WithSkipMalformedNodes.
+var errMalformedNode = errors.New("malformed node")
+
+// An errSkippedAssembly occurs when the root of an assembly is a malformed node
+// that was skipped (see WithSkipMalformedNodes), so the entire assembly is
+// skipped as well.
+var errSkippedAssembly = errors.New("skipped assembly of a malformed root")
+
+// Neo4j status codes classified by classifyError, see
+// <https://neo4j.com/docs/status-codes/current/errors/all-errors/>.
+const (
+	codeDatabaseUnavailable        = "Neo.TransientError.General.DatabaseUnavailable"
+	codeConstraintValidationFailed = "Neo.ClientError.Schema.ConstraintValidationFailed"
+)
+
+// The classifyError function wraps the given error (usually returned from the
+// neo4j driver) in one of the typed errors of this package, so callers can tell
+// failures apart using errors.As. Errors that match none of the types are
+// returned as-is.
+func classifyError(err error) error {
+	var connectivityErr *neo4j.ConnectivityError
+	if errors.As(err, &connectivityErr) {
+		return ConnectivityError{Err: err}
+	}
+	var neo4jErr *neo4j.Neo4jError
+	if errors.As(err, &neo4jErr) {
+		switch neo4jErr.Code {
+		case codeDatabaseUnavailable:
+			return ConnectivityError{Err: err}
+		case codeConstraintValidationFailed:
+			return ConstraintViolationError{Err: err}
+		}
+	}
+	return err
+}
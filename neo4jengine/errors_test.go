@@ -0,0 +1,64 @@
+package neo4jengine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		wantConnection bool
+		wantConstraint bool
+	}{
+		{
+			name:           "DriverConnectivity",
+			err:            &neo4j.ConnectivityError{Inner: errors.New("dial tcp: connection refused")},
+			wantConnection: true,
+		},
+		{
+			name:           "DatabaseUnavailable",
+			err:            &neo4j.Neo4jError{Code: "Neo.TransientError.General.DatabaseUnavailable", Msg: "database unavailable"},
+			wantConnection: true,
+		},
+		{
+			name:           "ConstraintValidationFailed",
+			err:            &neo4j.Neo4jError{Code: "Neo.ClientError.Schema.ConstraintValidationFailed", Msg: "already exists"},
+			wantConstraint: true,
+		},
+		{
+			name: "SyntaxError",
+			err:  &neo4j.Neo4jError{Code: "Neo.ClientError.Statement.SyntaxError", Msg: "invalid input"},
+		},
+		{
+			name: "Canceled",
+			err:  context.Canceled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The engine wraps driver errors further up the call-stack.
+			err := fmt.Errorf("execute read: %w", classifyError(fmt.Errorf("run: %w", tt.err)))
+
+			if got := errors.As(err, &ConnectivityError{}); got != tt.wantConnection {
+				t.Errorf("errors.As(%v, ConnectivityError) = %v, want %v", err, got, tt.wantConnection)
+			}
+			if got := errors.As(err, &ConstraintViolationError{}); got != tt.wantConstraint {
+				t.Errorf("errors.As(%v, ConstraintViolationError) = %v, want %v", err, got, tt.wantConstraint)
+			}
+			// Classifying an error must neither hide the original error, nor modify its
+			// message.
+			if !errors.Is(err, tt.err) {
+				t.Errorf("errors.Is(%v, %v) = false, want true", err, tt.err)
+			}
+			if want := "execute read: run: " + tt.err.Error(); err.Error() != want {
+				t.Errorf("Error() = %q, want %q", err.Error(), want)
+			}
+		})
+	}
+}
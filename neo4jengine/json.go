@@ -0,0 +1,249 @@
+package neo4jengine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-digitaltwin/go-digitaltwin"
+)
+
+// We encode assemblies as JSON here, rather than with MarshalJSON methods on
+// digitaltwin.AssemblyGraph, because only this package knows the labels and
+// properties of nodes (see Register); the digitaltwin package cannot import it
+// without an import cycle.
+
+// A jsonAssembly is the JSON document of MarshalAssembly. Nodes and edges are
+// arrays ordered by content-address, so the same assembly always encodes to the
+// same document.
+type jsonAssembly struct {
+	Roots []digitaltwin.NodeHash `json:"roots"`
+	Nodes []jsonNode             `json:"nodes"`
+	Edges []jsonEdge             `json:"edges"`
+}
+
+// A jsonNode holds the registered label and the properties of a node, as
+// FormatNode returns them, keyed by its content-address (in hex).
+type jsonNode struct {
+	Hash  digitaltwin.NodeHash `json:"hash"`
+	Label string               `json:"label"`
+	Props map[string]any       `json:"props"`
+}
+
+type jsonEdge struct {
+	From digitaltwin.NodeHash `json:"from"`
+	To   digitaltwin.NodeHash `json:"to"`
+}
+
+// MarshalAssembly returns the JSON encoding of the given assembly, for external
+// tooling to consume. All nodes of the assembly must be registered (see
+// Register), and UnmarshalAssembly decodes the document back to an equal
+// assembly.
+//
+// The properties of each node are encoded as Neo4j would store them (see
+// FormatNode), except for binary properties and temporal values, which JSON
+// cannot represent unambiguously and MarshalAssembly rejects.
+func MarshalAssembly(a digitaltwin.Assembly) ([]byte, error) {
+	doc := jsonAssembly{
+		Roots: slices.SortedFunc(slices.Values(a.Roots()), digitaltwin.NodeHash.Compare),
+		Nodes: []jsonNode{},
+		Edges: []jsonEdge{},
+	}
+	nodes := a.Nodes()
+	for _, h := range slices.SortedFunc(maps.Keys(nodes), digitaltwin.NodeHash.Compare) {
+		raw, err := FormatNode(nodes[h])
+		if err != nil {
+			return nil, fmt.Errorf("format node %s: %w", h, err)
+		}
+		n, err := newJSONNode(raw)
+		if err != nil {
+			return nil, fmt.Errorf("node %s: %w", h, err)
+		}
+		doc.Nodes = append(doc.Nodes, n)
+		for _, to := range slices.SortedFunc(slices.Values(a.EdgesOf(h)), digitaltwin.NodeHash.Compare) {
+			doc.Edges = append(doc.Edges, jsonEdge{From: h, To: to})
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// UnmarshalAssembly decodes a JSON document returned by MarshalAssembly. It
+// fails if a node is of an unregistered label, if its properties no longer match
+// its content-address, or if a root or an edge refers to a node missing from the
+// document.
+func UnmarshalAssembly(data []byte) (digitaltwin.Assembly, error) {
+	// We decode numbers as json.Number to tell integers from floats, as Neo4j
+	// stores them (see jsonProperty).
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var doc jsonAssembly
+	if err := d.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decode json: %w", err)
+	}
+
+	var b digitaltwin.AssemblyBuilder
+	values := make(map[digitaltwin.NodeHash]digitaltwin.Value, len(doc.Nodes))
+	for _, n := range doc.Nodes {
+		v, err := n.parse()
+		if err != nil {
+			return nil, fmt.Errorf("parse node %s: %w", n.Hash, err)
+		}
+		values[n.Hash] = v
+		b.Nodes(v)
+	}
+	for _, h := range doc.Roots {
+		root, ok := values[h]
+		if !ok {
+			return nil, fmt.Errorf("root %s: no such node", h)
+		}
+		b.Roots(root)
+	}
+	for _, e := range doc.Edges {
+		from, ok := values[e.From]
+		if !ok {
+			return nil, fmt.Errorf("edge %s -> %s: no such node %s", e.From, e.To, e.From)
+		}
+		to, ok := values[e.To]
+		if !ok {
+			return nil, fmt.Errorf("edge %s -> %s: no such node %s", e.From, e.To, e.To)
+		}
+		b.Connect(from, to)
+	}
+	return b.Assemble(), nil
+}
+
+// EncodeValue returns the JSON encoding of the given value: its registered
+// label, its content-address and its properties, encoded like the nodes of
+// MarshalAssembly. Unlike gob, it needs no registration other than the one with
+// this package (see Register), and DecodeValue decodes it back to an equal
+// value.
+//
+// Like MarshalAssembly, it rejects values with binary properties or temporal
+// values.
+func EncodeValue(v digitaltwin.Value) ([]byte, error) {
+	raw, err := FormatNode(v)
+	if err != nil {
+		return nil, fmt.Errorf("format node: %w", err)
+	}
+	n, err := newJSONNode(raw)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(n)
+}
+
+// DecodeValue decodes a value encoded by EncodeValue. It fails if the value is
+// of an unregistered label (see UnregisteredLabelError), or if its properties no
+// longer match its content-address.
+func DecodeValue(data []byte) (digitaltwin.Value, error) {
+	// We decode numbers as json.Number to tell integers from floats, as Neo4j
+	// stores them (see jsonProperty).
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var n jsonNode
+	if err := d.Decode(&n); err != nil {
+		return nil, fmt.Errorf("decode json: %w", err)
+	}
+	v, err := n.parse()
+	if err != nil {
+		return nil, fmt.Errorf("parse node %s: %w", n.Hash, err)
+	}
+	return v, nil
+}
+
+// Call newJSONNode to encode the given RawNode (as FormatNode returns it) as a
+// jsonNode.
+func newJSONNode(raw RawNode) (jsonNode, error) {
+	props := make(map[string]any, len(raw.Props))
+	for name, prop := range raw.Props {
+		var err error
+		props[name], err = jsonProperty(reflect.ValueOf(prop))
+		if err != nil {
+			return jsonNode{}, fmt.Errorf("property %q: %w", name, err)
+		}
+	}
+	return jsonNode{Hash: raw.ContentAddress, Label: raw.Label, Props: props}, nil
+}
+
+// The parse method reverses newJSONNode, parsing the node as ParseNode does.
+func (n jsonNode) parse() (digitaltwin.Value, error) {
+	props := make(PropertyMap, len(n.Props))
+	for name, prop := range n.Props {
+		props[name] = storedJSONProperty(prop)
+	}
+	return parseJSONNode(RawNode{Label: n.Label, ContentAddress: n.Hash, Props: props})
+}
+
+// Call parseJSONNode to parse a node decoded from JSON, recovering from the
+// panics of the reflectionAdapter on properties of the wrong type (e.g. a string
+// where a list is expected), as the document is not under our control.
+func parseJSONNode(n RawNode) (v digitaltwin.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("parse: %v", r)
+		}
+	}()
+	return ParseNode(n)
+}
+
+// The jsonProperty function returns the given property as Neo4j would store it
+// (see storedProperty), with floats encoded so that they always decode as floats
+// (see storedJSONProperty), even when they hold whole numbers.
+func jsonProperty(v reflect.Value) (any, error) {
+	stored, err := storedProperty(v)
+	if err != nil {
+		return nil, err
+	}
+	switch x := stored.(type) {
+	case float64:
+		s := strconv.FormatFloat(x, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eE") {
+			s += ".0"
+		}
+		return json.Number(s), nil
+	case []byte:
+		return nil, fmt.Errorf("unsupported binary property")
+	case []any:
+		list := make([]any, len(x))
+		for i := range x {
+			list[i], err = jsonProperty(reflect.ValueOf(x[i]))
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+		return list, nil
+	case nil, bool, int64, string:
+		return x, nil
+	default:
+		return nil, fmt.Errorf("unsupported property type %T", x)
+	}
+}
+
+// The storedJSONProperty function reverses jsonProperty, returning a property
+// decoded from JSON as the Neo4j driver would return it: integers as int64, and
+// floats as float64.
+func storedJSONProperty(prop any) any {
+	switch x := prop.(type) {
+	case json.Number:
+		if !strings.ContainsAny(string(x), ".eE") {
+			if i, err := x.Int64(); err == nil {
+				return i
+			}
+		}
+		f, _ := x.Float64() // The decoder has already validated the number.
+		return f
+	case []any:
+		list := make([]any, len(x))
+		for i := range x {
+			list[i] = storedJSONProperty(x[i])
+		}
+		return list
+	default:
+		return x
+	}
+}
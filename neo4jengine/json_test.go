@@ -0,0 +1,154 @@
+package neo4jengine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/go-digitaltwin/go-digitaltwin"
+)
+
+type jsonNodeValue struct {
+	digitaltwin.InformationElement
+	Name   string
+	Count  int
+	Weight float64
+	Active bool
+}
+
+type (
+	encodedName  string
+	encodedValue struct {
+		digitaltwin.InformationElement
+		Size    uint16
+		Ratio   float64
+		Enabled bool
+	}
+)
+
+// We register the values of TestEncodeValue with this package alone, never with
+// gob, as that is the point of EncodeValue.
+func init() {
+	RegisterLabel(jsonNodeValue{}, "TestMarshalAssembly")
+	RegisterLabel(digitaltwin.Scalar[encodedName]{}, "TestEncodeValue_scalar")
+	RegisterLabel(encodedValue{}, "TestEncodeValue")
+}
+
+func TestMarshalAssembly(t *testing.T) {
+	// We mirror the shape of the digitaltwin package's test assemblies: a root,
+	// an edge between two other nodes, and a disconnected node. The weights are
+	// whole numbers on purpose, which JSON alone cannot tell from integers.
+	node := func(name string, n int) jsonNodeValue {
+		return jsonNodeValue{Name: name, Count: n, Weight: float64(n), Active: n%2 == 0}
+	}
+	var b digitaltwin.AssemblyBuilder
+	b.Roots(node("unique1", 1))
+	b.Connect(node("unique2", 2), node("unique3", 3))
+	b.Nodes(node("unique4", 4))
+	want := b.Assemble()
+
+	data, err := MarshalAssembly(want)
+	if err != nil {
+		t.Fatalf("MarshalAssembly() error = %v", err)
+	}
+	got, err := UnmarshalAssembly(data)
+	if err != nil {
+		t.Fatalf("UnmarshalAssembly(%s) error = %v", data, err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("UnmarshalAssembly(MarshalAssembly()) mismatch (-want +got):\n%s", diff)
+	}
+
+	// The encoding is deterministic, so re-encoding the decoded assembly yields
+	// the same document.
+	again, err := MarshalAssembly(got)
+	if err != nil {
+		t.Fatalf("MarshalAssembly() error = %v", err)
+	}
+	if diff := cmp.Diff(string(data), string(again)); diff != "" {
+		t.Errorf("MarshalAssembly() is not deterministic (-want +got):\n%s", diff)
+	}
+}
+
+func TestUnmarshalAssembly_invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{
+			name: "Syntax",
+			data: `{"roots": [`,
+		},
+		{
+			name: "UnregisteredLabel",
+			data: `{"nodes": [{"hash": "0100000000000000000000000000000000000000", "label": "TestUnregistered", "props": {}}]}`,
+		},
+		{
+			name: "ContentAddressMismatch",
+			data: `{"nodes": [{"hash": "0100000000000000000000000000000000000000", "label": "TestMarshalAssembly", "props": {"Name": "x"}}]}`,
+		},
+		{
+			name: "WrongPropertyType",
+			data: `{"nodes": [{"hash": "0100000000000000000000000000000000000000", "label": "TestMarshalAssembly", "props": {"Name": 1}}]}`,
+		},
+		{
+			name: "MissingRoot",
+			data: `{"roots": ["0100000000000000000000000000000000000000"]}`,
+		},
+		{
+			name: "MissingEdgeNode",
+			data: `{"edges": [{"from": "0100000000000000000000000000000000000000", "to": "0200000000000000000000000000000000000000"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := UnmarshalAssembly([]byte(tt.data)); err == nil {
+				t.Errorf("UnmarshalAssembly(%s) = nil; want error", tt.data)
+			}
+		})
+	}
+}
+
+func TestEncodeValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value digitaltwin.Value
+	}{
+		{name: "Struct", value: jsonNodeValue{Name: "node", Count: 42, Weight: 4, Active: true}},
+		{name: "Scalar", value: digitaltwin.Scalar[encodedName]{Value: "name"}},
+		{name: "Mixed", value: encodedValue{Size: 7, Ratio: 0.5, Enabled: true}},
+		{name: "Zero", value: encodedValue{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := EncodeValue(tt.value)
+			if err != nil {
+				t.Fatalf("EncodeValue() error = %v", err)
+			}
+			got, err := DecodeValue(data)
+			if err != nil {
+				t.Fatalf("DecodeValue(%s) error = %v", data, err)
+			}
+			if diff := cmp.Diff(tt.value, got); diff != "" {
+				t.Errorf("DecodeValue(EncodeValue()) mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEncodeValue_unregistered(t *testing.T) {
+	type unregisteredValue struct{ digitaltwin.InformationElement }
+	_, err := EncodeValue(unregisteredValue{})
+	var typeErr UnregisteredTypeError
+	if !errors.As(err, &typeErr) {
+		t.Errorf("EncodeValue() error = %v; want UnregisteredTypeError", err)
+	}
+
+	data := `{"hash": "0100000000000000000000000000000000000000", "label": "TestUnregistered", "props": {}}`
+	_, err = DecodeValue([]byte(data))
+	var labelErr UnregisteredLabelError
+	if !errors.As(err, &labelErr) {
+		t.Errorf("DecodeValue(%s) error = %v; want UnregisteredLabelError", data, err)
+	}
+}
@@ -0,0 +1,119 @@
+package neo4jengine
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+
+	"github.com/go-digitaltwin/go-digitaltwin"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// MultiEngine maintains a single digital-twin graph whose components are
+// sharded across several Neo4j databases (of the same server/cluster).
+//
+// It holds an Engine for every database. Each compilation applies to a single
+// database, chosen by a caller-supplied routing function, and WhatChanged fans
+// out to all databases, merging their changesets into one.
+//
+// Merging relies on component IDs being globally unique (they are content
+// addresses, after all), so a component must live entirely within a single
+// database. Callers are responsible for routing compilations such that no
+// component spans (or moves between) databases.
+type MultiEngine struct {
+	databases []string           // In the order given to NewMultiEngine.
+	engines   map[string]*Engine // Keyed by database name.
+	route     func(digitaltwin.Compilation) string
+
+	// Serialises calls to WhatChanged, which update the fields below.
+	mu sync.Mutex
+	// The union of the snapshots of all engines, as of the last call to
+	// WhatChanged that succeeded.
+	snapshot snapshot
+	// Changesets of engines that succeeded during a call to WhatChanged that failed
+	// on other engines. Their engines have already moved on, so we keep their
+	// changes until all engines succeed, rather than lose them.
+	pending map[string]digitaltwin.GraphChanged
+}
+
+// NewMultiEngine returns a ready-to-use MultiEngine over the given databases.
+//
+// It initialises an Engine (configured by the given options) for every
+// database, see NewEngine. The route function chooses the database that Apply
+// applies a compilation to; it must return one of the given databases.
+func NewMultiEngine(ctx context.Context, driver neo4j.DriverWithContext, databases []string, route func(digitaltwin.Compilation) string, opts ...Option) (*MultiEngine, error) {
+	m := &MultiEngine{
+		databases: databases,
+		engines:   make(map[string]*Engine, len(databases)),
+		route:     route,
+		snapshot:  make(snapshot),
+		pending:   make(map[string]digitaltwin.GraphChanged),
+	}
+	for _, database := range databases {
+		if _, dup := m.engines[database]; dup {
+			return nil, fmt.Errorf("duplicate database %q", database)
+		}
+		e, err := NewEngine(ctx, driver, database, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("engine for %q: %w", database, err)
+		}
+		m.engines[database] = e
+		// The engine is not shared yet, so we may read its snapshot freely.
+		maps.Copy(m.snapshot, e.snapshot)
+	}
+	return m, nil
+}
+
+// Apply applies the given compilation to the database chosen by the routing
+// function given to NewMultiEngine, see Engine.Apply.
+func (m *MultiEngine) Apply(ctx context.Context, compilation digitaltwin.Compilation) error {
+	database := m.route(compilation)
+	e, ok := m.engines[database]
+	if !ok {
+		return fmt.Errorf("route to unknown database %q", database)
+	}
+	if err := e.Apply(ctx, compilation); err != nil {
+		return fmt.Errorf("apply to %q: %w", database, err)
+	}
+	return nil
+}
+
+// WhatChanged calls WhatChanged on the engines of all databases, and merges
+// their changesets into a single changeset of the entire (sharded) graph. The
+// GraphBefore and GraphAfter hashes of the merged changeset cover the
+// components of all databases.
+//
+// If any engine fails, WhatChanged returns its error and the next call
+// recovers as if the failed call had never been made: it retries only the
+// engines that failed, and reports the changes of the others then.
+func (m *MultiEngine) WhatChanged(ctx context.Context) (digitaltwin.GraphChanged, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, database := range m.databases {
+		if _, ok := m.pending[database]; ok {
+			continue // Already succeeded during a previous call.
+		}
+		changes, err := m.engines[database].WhatChanged(ctx)
+		if err != nil {
+			return digitaltwin.GraphChanged{}, fmt.Errorf("what changed in %q: %w", database, err)
+		}
+		m.pending[database] = changes
+	}
+
+	merged := digitaltwin.GraphChanged{GraphBefore: m.snapshot.GraphHash()}
+	for _, database := range m.databases {
+		changes := m.pending[database]
+		merged.Created = append(merged.Created, changes.Created...)
+		merged.Updated = append(merged.Updated, changes.Updated...)
+		merged.Removed = append(merged.Removed, changes.Removed...)
+		if changes.Timestamp.After(merged.Timestamp) {
+			merged.Timestamp = changes.Timestamp
+		}
+		m.snapshot.Update(changes)
+	}
+	merged.GraphAfter = m.snapshot.GraphHash()
+	clear(m.pending)
+	return merged, nil
+}
@@ -0,0 +1,101 @@
+package neo4jengine
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/go-digitaltwin/go-digitaltwin"
+	"github.com/go-digitaltwin/go-digitaltwin/enginetest"
+	"github.com/go-digitaltwin/go-digitaltwin/internal/dbtest"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+func TestMultiEngine(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	ctx := context.Background()
+	// The default database exists already, so we only create the second one.
+	_, err := neo4j.ExecuteQuery(ctx, driver, "CREATE DATABASE shard WAIT", nil, neo4j.EagerResultTransformer,
+		neo4j.ExecuteQueryWithDatabase("system"))
+	if err != nil {
+		t.Fatal("create database:", err)
+	}
+
+	// Compilations cannot be inspected, so the test routes them by setting the
+	// target database before every call to Apply.
+	var target string
+	route := func(digitaltwin.Compilation) string { return target }
+	engine, err := NewMultiEngine(ctx, driver, []string{"neo4j", "shard"}, route)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apply := func(database string, compilation digitaltwin.Compilation) {
+		t.Helper()
+		target = database
+		if err := engine.Apply(ctx, compilation); err != nil {
+			t.Fatal(err)
+		}
+	}
+	apply("neo4j", func(ctx context.Context, w digitaltwin.GraphWriter) error {
+		return w.AssertEdge(ctx, enginetest.NodeA{}, enginetest.NodeB{})
+	})
+	apply("shard", func(ctx context.Context, w digitaltwin.GraphWriter) error {
+		return w.AssertEdge(ctx, enginetest.NodeC{}, enginetest.NodeD{})
+	})
+
+	changes, err := engine.WhatChanged(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created []digitaltwin.ComponentID
+	for _, c := range changes.Created {
+		created = append(created, c.AssemblyID())
+	}
+	want := []digitaltwin.ComponentID{
+		edgeComponent(enginetest.NodeA{}, enginetest.NodeB{}).AssemblyID(),
+		edgeComponent(enginetest.NodeC{}, enginetest.NodeD{}).AssemblyID(),
+	}
+	if !slices.Equal(created, want) {
+		t.Errorf("WhatChanged() created %v, want %v", created, want)
+	}
+	if len(changes.Updated) != 0 || len(changes.Removed) != 0 {
+		t.Errorf("WhatChanged() updated %d and removed %d components, want none", len(changes.Updated), len(changes.Removed))
+	}
+	wantAfter := digitaltwin.ComputeForestHash(
+		edgeComponent(enginetest.NodeA{}, enginetest.NodeB{}),
+		edgeComponent(enginetest.NodeC{}, enginetest.NodeD{}),
+	)
+	if changes.GraphAfter != wantAfter {
+		t.Errorf("WhatChanged() GraphAfter = %v, want %v", changes.GraphAfter, wantAfter)
+	}
+
+	// A change to one database leaves the components of the other intact.
+	apply("shard", func(ctx context.Context, w digitaltwin.GraphWriter) error {
+		return w.RetractNode(ctx, enginetest.NodeD{})
+	})
+	changes, err = engine.WhatChanged(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Created) != 0 || len(changes.Updated) != 1 || len(changes.Removed) != 0 {
+		t.Errorf("WhatChanged() after retract: got %d created, %d updated, %d removed; want only 1 updated", len(changes.Created), len(changes.Updated), len(changes.Removed))
+	}
+	if changes.GraphBefore != wantAfter {
+		t.Errorf("WhatChanged() GraphBefore = %v, want the previous GraphAfter %v", changes.GraphBefore, wantAfter)
+	}
+
+	// Compilations routed elsewhere fail without touching any database.
+	target = "unknown"
+	if err := engine.Apply(ctx, func(context.Context, digitaltwin.GraphWriter) error { return nil }); err == nil {
+		t.Error("Apply() routed to an unknown database succeeded, want an error")
+	}
+}
+
+// The edgeComponent function returns the assembly of a single edge.
+func edgeComponent(from, to digitaltwin.Value) digitaltwin.Assembly {
+	var b digitaltwin.AssemblyBuilder
+	b.Roots(from)
+	b.Connect(from, to)
+	return b.Assemble()
+}
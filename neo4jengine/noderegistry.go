@@ -2,9 +2,14 @@ package neo4jengine
 
 import (
 	"encoding"
+	"encoding/json"
 	"fmt"
+	"maps"
 	"reflect"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-digitaltwin/go-digitaltwin"
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
@@ -33,62 +38,122 @@ type RawNode struct {
 
 type PropertyMap map[string]any
 
+// Equal reports whether r and other describe the same node, that is, whether
+// they have the same Label, ContentAddress and Props. It ignores Metadata, which
+// the graph engine sets for its own (debugging) purposes.
+func (r RawNode) Equal(other RawNode) bool {
+	return r.Label == other.Label &&
+		r.ContentAddress == other.ContentAddress &&
+		len(DiffRawNodes(r, other)) == 0
+}
+
+// DiffRawNodes returns the Props that differ between a and b, keyed by property
+// name, with the value in a first and the value in b second. A property missing
+// from either node has a nil value on its side. DiffRawNodes returns an empty
+// map if the Props are the same.
+//
+// It is mostly useful for debugging content-address mismatches (see ParseNode),
+// where a is the stored node and b the node re-formatted from its parsed value.
+func DiffRawNodes(a, b RawNode) map[string][2]any {
+	diff := make(map[string][2]any)
+	for k, va := range a.Props {
+		vb, ok := b.Props[k]
+		if !ok || !reflect.DeepEqual(va, vb) {
+			diff[k] = [2]any{va, vb}
+		}
+	}
+	for k, vb := range b.Props {
+		if _, ok := a.Props[k]; !ok {
+			diff[k] = [2]any{nil, vb}
+		}
+	}
+	return diff
+}
+
 // Call newRawNode to construct a RawNode from the given neo4j.Node. This
 // package's digitaltwin.GraphWriter must adhere to the conventions set in this
 // function.
 //
 // The conventions (if you've reached this far, read the code anyway):
 //
-//   - The neo4j.Node must have only a single label.
+//   - The neo4j.Node must have a single label, or exactly one registered label
+//     among several (the rest are marker labels set by other systems, e.g.
+//     :IMSI:Identity).
+//   - A single label is taken as-is, registered or not; it is ParseNode that
+//     rejects unregistered labels, as it always did. Only nodes with several
+//     labels are checked against the registry here, because that is the only way
+//     to tell which of them identifies the Go type.
 //   - All values are stored as properties of the neo4j.Node.
 //   - Properties starting with underscore ('_') are considered metadata, and for
 //     internal use by this package only.
 //   - The rest of the properties are used to populate the PropertyMap for ParseNode.
 //   - RawNode.ContentAddress is stored in the metadata property and uses a string
 //     returned from [digitaltwin.NodeHash.MarshalText].
+//   - The metadata property is DefaultContentAddressProperty, unless the Engine
+//     is configured WithContentAddressProperty (see newRawNodeWithProperty); it
+//     is metadata regardless of its name.
 func newRawNode(node neo4j.Node) (RawNode, error) {
-	if len(node.Labels) != 1 {
-		return RawNode{}, fmt.Errorf("node must have a single label")
+	return newRawNodeWithProperty(node, DefaultContentAddressProperty)
+}
+
+// The newRawNodeWithProperty function is like newRawNode, but reads the
+// content-address of the node from the given property.
+func newRawNodeWithProperty(node neo4j.Node, caProperty string) (RawNode, error) {
+	label, err := globalNodeRegistry.LabelAmong(node.Labels)
+	if err != nil {
+		return RawNode{}, err
 	}
 
 	raw := RawNode{
-		Label:    node.Labels[0],
+		Label:    label,
 		Props:    make(map[string]any),
 		Metadata: make(map[string]any),
 	}
 	for key, value := range node.Props {
-		if key[0] == '_' {
+		if key[0] == '_' || key == caProperty {
 			raw.Metadata[key] = value
 		} else {
 			raw.Props[key] = value
 		}
 	}
-	v, ok := node.Props["_contentAddress"]
+	v, ok := node.Props[caProperty]
 	if !ok {
-		return RawNode{}, fmt.Errorf("key not found: _contentAddress")
+		return RawNode{}, fmt.Errorf("%w: key not found: %s", errMalformedNode, caProperty)
 	}
-	// The _contentAddress is a string property, but we don't want to panic in case
+	// The content-address is a string property, but we don't want to panic in case
 	// this changes without us knowing (bug or otherwise).
 	h, ok := v.(string)
 	if !ok {
-		return RawNode{}, fmt.Errorf("unexpected type: _contentAddress is %T", v)
+		return RawNode{}, fmt.Errorf("%w: unexpected type: %s is %T", errMalformedNode, caProperty, v)
 	}
 
-	err := raw.ContentAddress.UnmarshalText([]byte(h))
+	err = raw.ContentAddress.UnmarshalText([]byte(h))
 	if err != nil {
-		return RawNode{}, fmt.Errorf("unmarshal content address: %w", err)
+		return RawNode{}, fmt.Errorf("%w: unmarshal content address: %w", errMalformedNode, err)
 	}
 	return raw, nil
 }
 
+// DefaultContentAddressProperty is the property of every node holding its
+// content-address, unless configured otherwise by WithContentAddressProperty.
+const DefaultContentAddressProperty = "_contentAddress"
+
+// The cypherProperty function returns the given property name quoted for Cypher
+// queries, so any name (e.g. one configured by WithContentAddressProperty) is
+// safe to concatenate into a query.
+func cypherProperty(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
 // globalNodeRegistry is global for the entire package (hence, the entire
 // process). The type system put forth by this package asserts any Go type maps
 // to exactly one graph label; to support (read & write) that Go type in a graph.
 var globalNodeRegistry nodeRegistry
 
 type nodeRegistry struct {
-	mLabelToType sync.Map // map[string]reflect.Type
-	mTypeToLabel sync.Map // map[reflect.Type]string
+	mLabelToType   sync.Map // map[string]reflect.Type
+	mTypeToLabel   sync.Map // map[reflect.Type]string
+	mTypeToOptions sync.Map // map[reflect.Type]registration
 }
 
 // Register may cause panics, when used from different packages on structs
@@ -107,6 +172,233 @@ func RegisterLabel(node digitaltwin.Value, label string) {
 	globalNodeRegistry.RegisterLabel(label, reflect.TypeOf(node))
 }
 
+// MustRegisterRoundTrippable is like Register, but also validates that values of
+// the given type survive a round-trip through the graph (formatted by FormatNode,
+// stored in Neo4j, and parsed by ParseNode). It panics with an error naming the
+// offending field otherwise.
+//
+// Use it to discover types that cannot be stored (e.g. a field of an
+// unsupported type) while registering them, rather than when ParseNode fails
+// its defensive content-address check at runtime.
+//
+// The validation round-trips the zero value of the type, so it cannot catch
+// problems specific to other values. The type is registered only once validated,
+// so recovering from the panic leaves no unusable type registered.
+func MustRegisterRoundTrippable(node digitaltwin.Value) {
+	rt := reflect.TypeOf(node)
+	// The validation formats values of the type, which requires registering it, so
+	// we validate it on a scratch registry first.
+	var scratch nodeRegistry
+	scratch.RegisterLabel(rt.Name(), rt)
+	zero := reflect.Zero(rt).Interface().(digitaltwin.Value)
+	if err := scratch.validateRoundTrip(zero); err != nil {
+		panic(fmt.Sprintf("digitaltwin/engine: %T does not round-trip: %v", node, err))
+	}
+	Register(node)
+}
+
+// The validateRoundTrip method formats the given value, converts its properties
+// as Neo4j would store them, and parses them back one at a time, so it can name
+// the property that fails to round-trip.
+func (r *nodeRegistry) validateRoundTrip(v digitaltwin.Value) error {
+	// Properties Neo4j cannot store usually cannot be content-addressed either, so
+	// we check them before FormatNode does, to name the offending field the same
+	// way as the rest of this method.
+	props, err := formatProperties(v)
+	if err != nil {
+		return fmt.Errorf("format properties: %w", err)
+	}
+	for name, prop := range props {
+		if _, err := storedProperty(reflect.ValueOf(prop)); err != nil {
+			return fmt.Errorf("field %q: %w", name, err)
+		}
+	}
+	raw, err := r.FormatNode(v)
+	if err != nil {
+		return fmt.Errorf("format: %w", err)
+	}
+	rt := reflect.TypeOf(v)
+	parsed := reflect.New(rt)
+	for name, prop := range raw.Props {
+		stored, err := storedProperty(reflect.ValueOf(prop))
+		if err != nil {
+			return fmt.Errorf("field %q: %w", name, err)
+		}
+		if err := safelyParseProperty(parsed.Interface().(digitaltwin.Value), name, stored); err != nil {
+			return fmt.Errorf("field %q: %w", name, err)
+		}
+	}
+	// Format the parsed value again to find properties that changed on the way.
+	again, err := r.FormatNode(parsed.Elem().Interface().(digitaltwin.Value))
+	if err != nil {
+		return fmt.Errorf("format parsed: %w", err)
+	}
+	for name, prop := range raw.Props {
+		if !reflect.DeepEqual(prop, again.Props[name]) {
+			return fmt.Errorf("field %q: parsed %v, want %v", name, again.Props[name], prop)
+		}
+	}
+	if again.ContentAddress != raw.ContentAddress {
+		return fmt.Errorf("content address mismatch: %v != %v", again.ContentAddress, raw.ContentAddress)
+	}
+	return nil
+}
+
+// Call safelyParseProperty to parse a single property into the given value
+// (a pointer), recovering from the panics of reflect.Value.Set on unassignable
+// properties.
+func safelyParseProperty(v digitaltwin.Value, name string, prop any) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("parse: %v", r)
+		}
+	}()
+	return parseProperties(v, PropertyMap{name: prop})
+}
+
+// The storedProperty function returns the given property as the Neo4j driver
+// returns it once stored: integers as int64, floats as float64, and lists as
+// []any. It fails for properties Neo4j cannot store.
+func storedProperty(v reflect.Value) (any, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Bytes(), nil // Byte slices are stored as such.
+		}
+		list := make([]any, v.Len())
+		for i := range list {
+			x, err := storedProperty(v.Index(i))
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+			list[i] = x
+		}
+		return list, nil
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil // Neo4j does not store null properties.
+		}
+		return storedProperty(v.Elem())
+	default:
+		// The driver supports some struct types as temporal values.
+		switch x := v.Interface().(type) {
+		case time.Time, neo4j.Date, neo4j.LocalTime, neo4j.LocalDateTime, neo4j.Time, neo4j.Duration:
+			return x, nil
+		}
+		return nil, fmt.Errorf("unsupported property type %s", v.Type())
+	}
+}
+
+// RegisterLabelWithOptions is like RegisterLabel, but further configures how
+// nodes of the given type are stored, such as WithTransientFields.
+func RegisterLabelWithOptions(node digitaltwin.Value, label string, opts ...RegistrationOption) {
+	rt := reflect.TypeOf(node)
+	var reg registration
+	for _, opt := range opts {
+		opt(rt, &reg)
+	}
+	globalNodeRegistry.RegisterLabel(label, rt)
+	globalNodeRegistry.mTypeToOptions.Store(rt, reg)
+}
+
+// RegisterLabelWithIndexes is like RegisterLabel, but further declares secondary
+// indexes on the named properties of the registered type, which
+// BootstrapDatabase creates alongside its content-address constraint. It is a
+// shorthand for RegisterLabelWithOptions with WithIndexes.
+func RegisterLabelWithIndexes(node digitaltwin.Value, label string, indexedProps ...string) {
+	RegisterLabelWithOptions(node, label, WithIndexes(indexedProps...))
+}
+
+// A RegistrationOption configures how nodes of a registered type are stored,
+// see RegisterLabelWithOptions.
+type RegistrationOption func(rt reflect.Type, reg *registration)
+
+// A registration holds the options a type was registered with.
+type registration struct {
+	transient []string // Names of fields excluded from the stored properties.
+	indexed   []string // Keys of properties indexed by BootstrapDatabase.
+}
+
+// WithTransientFields excludes the named fields from the properties stored in
+// the graph, which is useful for large fields derived from other fields.
+//
+// Transient fields still participate in the content-address of their nodes,
+// which FormatNode computes from the entire value. However, as they are not
+// stored, ParseNode leaves them zeroed; so the content-address of a parsed value
+// may differ from that of its node in the graph. Hence, ParseNode skips its
+// defensive content-address check for types with transient fields, and callers
+// should re-derive transient fields before relying on the content-address of a
+// parsed value.
+//
+// It panics if the registered type is not a struct with the named fields.
+func WithTransientFields(names ...string) RegistrationOption {
+	return func(rt reflect.Type, reg *registration) {
+		for _, name := range names {
+			if rt.Kind() != reflect.Struct {
+				panic(fmt.Sprintf("digitaltwin/engine: transient field %q of non-struct type %s", name, rt))
+			}
+			if _, ok := rt.FieldByName(name); !ok {
+				panic(fmt.Sprintf("digitaltwin/engine: transient field %q not found in %s", name, rt))
+			}
+		}
+		reg.transient = append(reg.transient, names...)
+	}
+}
+
+// WithIndexes declares secondary indexes on the named properties of the
+// registered type, for queries that filter nodes by their business properties
+// (e.g. the value of an IMSI) rather than by their content-address.
+// BootstrapDatabase creates an index for each named property.
+//
+// Properties are named the way FormatNode keys them, which for most fields is
+// the name of the field (see fieldKeys).
+//
+// It panics if the registered type is not a struct with the named properties.
+func WithIndexes(props ...string) RegistrationOption {
+	return func(rt reflect.Type, reg *registration) {
+		for _, prop := range props {
+			if rt.Kind() != reflect.Struct {
+				panic(fmt.Sprintf("digitaltwin/engine: indexed property %q of non-struct type %s", prop, rt))
+			}
+			if _, ok := fieldKeys(rt)[prop]; !ok {
+				panic(fmt.Sprintf("digitaltwin/engine: indexed property %q not found in %s", prop, rt))
+			}
+		}
+		reg.indexed = append(reg.indexed, props...)
+	}
+}
+
+// The indexesOf method returns the keys of the properties indexed for the given
+// label, as declared by WithIndexes.
+func (r *nodeRegistry) indexesOf(label string) []string {
+	rt, ok := r.TypeOf(label)
+	if !ok {
+		return nil
+	}
+	return r.optionsOf(rt).indexed
+}
+
+// The optionsOf method returns the options the given type was registered with,
+// or the zero registration if it had none.
+func (r *nodeRegistry) optionsOf(rt reflect.Type) registration {
+	reg, _ := r.mTypeToOptions.Load(rt)
+	opts, _ := reg.(registration)
+	return opts
+}
+
 func (r *nodeRegistry) RegisterLabel(label string, rt reflect.Type) {
 	// Store the label and type provided by the user
 	if t, dup := r.mLabelToType.LoadOrStore(label, rt); dup && t != rt {
@@ -120,13 +412,15 @@ func (r *nodeRegistry) RegisterLabel(label string, rt reflect.Type) {
 }
 
 // KnownLabels returns a list of all labels registered with the global node
-// registry (i.e. all labels that can be used to identify a node).
+// registry (i.e. all labels that can be used to identify a node), sorted
+// lexicographically so callers (e.g. BootstrapDatabase) behave reproducibly.
 func KnownLabels() []string {
 	var labels []string
 	globalNodeRegistry.mLabelToType.Range(func(label, _ any) bool {
 		labels = append(labels, label.(string))
 		return true
 	})
+	slices.Sort(labels)
 	return labels
 }
 
@@ -136,6 +430,12 @@ func LabelOf(rt reflect.Type) (label string, ok bool) {
 	return globalNodeRegistry.LabelOf(rt)
 }
 
+// Labels returns a digitaltwin.LabelResolver backed by the global node registry,
+// for wiring into domain code that must not import this package.
+func Labels() digitaltwin.LabelResolver {
+	return &globalNodeRegistry
+}
+
 func (r *nodeRegistry) TypeOf(label string) (rt reflect.Type, ok bool) {
 	v, ok := r.mLabelToType.Load(label)
 	if !ok {
@@ -152,16 +452,62 @@ func (r *nodeRegistry) LabelOf(rt reflect.Type) (label string, ok bool) {
 	return v.(string), true
 }
 
+// LabelAmong picks the label that identifies the Go type of a node carrying the
+// given labels. A node with a single label is identified by it, registered or
+// not (ParseNode reports unregistered labels). A node with several labels is
+// identified by the one registered label among them; other labels are ignored,
+// as they are usually markers set by other systems sharing the graph.
+func (r *nodeRegistry) LabelAmong(labels []string) (label string, err error) {
+	if len(labels) == 1 {
+		return labels[0], nil
+	}
+
+	var registered []string
+	for _, l := range labels {
+		if _, ok := r.TypeOf(l); ok {
+			registered = append(registered, l)
+		}
+	}
+	switch len(registered) {
+	case 0:
+		return "", fmt.Errorf("node has no registered label among %q", labels)
+	case 1:
+		return registered[0], nil
+	default:
+		return "", fmt.Errorf("node has several registered labels %q", registered)
+	}
+}
+
 // ParseNode constructs a digitaltwin.Value from the given RawNode, decoding
 // according to the labels pre-registered by Register and RegisterLabel.
 func ParseNode(n RawNode) (digitaltwin.Value, error) {
 	return globalNodeRegistry.ParseNode(n)
 }
 
+// ParseNodeWithMetadata is like ParseNode, but also returns the metadata of the
+// given RawNode (e.g. its _created_at and _last_modified timestamps), for callers
+// that surface engine-managed attributes without querying the graph again.
+//
+// The returned PropertyMap is a copy; mutating it does not affect the RawNode.
+func ParseNodeWithMetadata(n RawNode) (digitaltwin.Value, PropertyMap, error) {
+	v, err := globalNodeRegistry.ParseNode(n)
+	if err != nil {
+		return nil, nil, err
+	}
+	return v, maps.Clone(n.Metadata), nil
+}
+
 func (r *nodeRegistry) ParseNode(n RawNode) (digitaltwin.Value, error) {
+	return r.parseNode(n, true)
+}
+
+// The parseNode method implements ParseNode, but only verifies the
+// content-address of the parsed value against that of the RawNode if verify is
+// true (see WithoutContentAddressVerification).
+func (r *nodeRegistry) parseNode(n RawNode, verify bool) (digitaltwin.Value, error) {
 	rt, ok := r.TypeOf(n.Label)
 	if !ok {
-		return nil, fmt.Errorf("unregistered label %q", n.Label) // TODO: custom error type
+		return nil, UnregisteredLabelError{Label: n.Label}
 	}
 
 	rv := reflect.New(rt) // Use a pointer to allow mutation by parseProperties.
@@ -179,12 +525,23 @@ func (r *nodeRegistry) ParseNode(n RawNode) (digitaltwin.Value, error) {
 	// in the code, the developer does not have control over the input, meaning that
 	// the error may not repeat itself - for example, by manually removing a
 	// problematic node from the graph).
+	// Unless the value is missing its transient fields, which we cannot verify, or
+	// the caller trusts the graph enough to spare the hashing.
+	if !verify || len(r.optionsOf(rt).transient) > 0 {
+		return v, nil
+	}
 	h, err := digitaltwin.ContentAddress(v)
 	if err != nil {
 		return nil, fmt.Errorf("content address: %w", err)
 	}
 	if h != n.ContentAddress {
-		return nil, fmt.Errorf("defensive: content address mismatch: %q != %q", h.String(), n.ContentAddress)
+		// We re-format the parsed value to tell which properties did not survive the
+		// round-trip, as the hashes alone make for a poor debugging experience.
+		got, err := r.FormatNode(v)
+		if err != nil {
+			return nil, fmt.Errorf("defensive: content address mismatch: %q != %q", h.String(), n.ContentAddress)
+		}
+		return nil, fmt.Errorf("defensive: content address mismatch: %q != %q: props diff (stored, parsed): %v", h.String(), n.ContentAddress, DiffRawNodes(n, got))
 	}
 
 	return v, nil
@@ -231,7 +588,7 @@ func (r *nodeRegistry) FormatNode(v digitaltwin.Value) (RawNode, error) {
 	t := reflect.TypeOf(v)
 	label, ok := r.LabelOf(t)
 	if !ok {
-		return RawNode{}, fmt.Errorf("unregistered type %q", t)
+		return RawNode{}, UnregisteredTypeError{Type: t}
 	}
 
 	h, err := digitaltwin.ContentAddress(v)
@@ -242,6 +599,9 @@ func (r *nodeRegistry) FormatNode(v digitaltwin.Value) (RawNode, error) {
 	if err != nil {
 		return RawNode{}, fmt.Errorf("format properties: %w", err)
 	}
+	for _, name := range r.optionsOf(t).transient {
+		delete(props, name)
+	}
 	return RawNode{
 		Label:          label,
 		ContentAddress: h,
@@ -302,6 +662,7 @@ type reflectionAdapter reflect.Value
 // Unexported fields are cannot be set.
 // Qualified (see FormatNode) fields may be omitted from the map, in which case
 // they are left unchanged.
+// Fields are keyed the same way FormatNode keys them, see fieldKeys.
 func (r reflectionAdapter) ParseNode(props PropertyMap) error {
 	v := reflect.Value(r)
 	switch v.Kind() {
@@ -311,11 +672,13 @@ func (r reflectionAdapter) ParseNode(props PropertyMap) error {
 		}
 		return reflectionAdapter(v.Elem()).ParseNode(props)
 	case reflect.Struct:
+		keys := fieldKeys(v.Type())
 		for field, value := range props {
-			f := v.FieldByName(field)
-			if !f.IsValid() {
+			index, ok := keys[field]
+			if !ok {
 				return fmt.Errorf("unknown field %q", field)
 			}
+			f := v.FieldByIndex(index)
 			if !f.CanSet() {
 				return fmt.Errorf("field %q is not settable", field)
 			}
@@ -331,8 +694,14 @@ func (r reflectionAdapter) ParseNode(props PropertyMap) error {
 				if err != nil {
 					return fmt.Errorf("unmarshal binary: %w", err)
 				}
+			} else if isStructSlice(f.Type()) {
+				x, err := parseStructSlice(value, f.Type())
+				if err != nil {
+					return fmt.Errorf("field %q: %w", field, err)
+				}
+				f.Set(x)
 			} else {
-				f.Set(reflect.ValueOf(value))
+				f.Set(convertProperty(reflect.ValueOf(value), f.Type()))
 			}
 		}
 		return nil
@@ -352,7 +721,7 @@ func (r reflectionAdapter) ParseNode(props PropertyMap) error {
 		if !ok {
 			return fmt.Errorf("missing value field")
 		}
-		v.Set(reflect.ValueOf(value))
+		v.Set(convertProperty(reflect.ValueOf(value), v.Type()))
 		return nil
 
 	case reflect.Array, reflect.Slice:
@@ -361,6 +730,14 @@ func (r reflectionAdapter) ParseNode(props PropertyMap) error {
 		if !ok {
 			return fmt.Errorf("missing values field")
 		}
+		if isStructSlice(v.Type()) {
+			x, err := parseStructSlice(values, v.Type())
+			if err != nil {
+				return fmt.Errorf("values: %w", err)
+			}
+			v.Set(x)
+			return nil
+		}
 		v.Set(reflect.ValueOf(values))
 		return nil
 
@@ -369,9 +746,159 @@ func (r reflectionAdapter) ParseNode(props PropertyMap) error {
 	}
 }
 
+// The fieldKeys function maps the property keys of the given struct type to the
+// index paths of their fields (see reflect.Value.FieldByIndex), shared by
+// FormatNode and ParseNode of the reflectionAdapter.
+//
+// Fields of embedded structs are flattened, unless the embedded struct
+// marshals itself (e.g. an embedded time.Time). A field is keyed by its name
+// when Go promotes it unambiguously (so FieldByName finds the same field);
+// otherwise, it is keyed by the dot-separated path of names leading to it. For
+// example, a struct embedding both A and B, each with a field named Field, has
+// the keys "A.Field" and "B.Field".
+func fieldKeys(root reflect.Type) map[string][]int {
+	keys := make(map[string][]int)
+	var walk func(t reflect.Type, index []int, names []string)
+	walk = func(t reflect.Type, index []int, names []string) {
+		for i := range t.NumField() {
+			f := t.Field(i)
+			// skip digitaltwin.InformationElement embedded inside every digitaltwin.Value
+			if f.Name == "InformationElement" && f.Type == reflect.TypeFor[digitaltwin.InformationElement]() {
+				continue
+			}
+			index := append(slices.Clone(index), i)
+			names := append(slices.Clone(names), f.Name)
+			if f.Anonymous && f.Type.Kind() == reflect.Struct && !marshalsItself(f.Type) {
+				walk(f.Type, index, names)
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+			key := f.Name
+			if promoted, ok := root.FieldByName(f.Name); !ok || !slices.Equal(promoted.Index, index) {
+				key = strings.Join(names, ".")
+			}
+			keys[key] = index
+		}
+	}
+	walk(root, nil, nil)
+	return keys
+}
+
+// The isStructSlice function reports whether the given type is a slice of
+// structs (or of pointers to structs) that do not marshal themselves. Neo4j
+// cannot store nested structs natively, so the reflectionAdapter stores each
+// element of such slices as a JSON string (see formatStructSlice).
+func isStructSlice(t reflect.Type) bool {
+	if t.Kind() != reflect.Slice {
+		return false
+	}
+	elem := t.Elem()
+	if elem.Kind() == reflect.Pointer {
+		elem = elem.Elem()
+	}
+	return elem.Kind() == reflect.Struct && !marshalsItself(elem)
+}
+
+// The formatStructSlice function encodes every element of the given slice of
+// structs as a JSON string, preserving their order.
+func formatStructSlice(v reflect.Value) ([]string, error) {
+	list := make([]string, v.Len())
+	for i := range list {
+		b, err := json.Marshal(v.Index(i).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		list[i] = string(b)
+	}
+	return list, nil
+}
+
+// The parseStructSlice function reverses formatStructSlice, decoding a list of
+// JSON strings into a slice of the given type. The list is either a []string (as
+// formatted) or a []any of strings (as returned by the Neo4j driver). An empty
+// list decodes to a nil slice, as the zero value it most likely was.
+func parseStructSlice(value any, t reflect.Type) (reflect.Value, error) {
+	var list []string
+	switch x := value.(type) {
+	case []string:
+		list = x
+	case []any:
+		list = make([]string, len(x))
+		for i := range x {
+			s, ok := x[i].(string)
+			if !ok {
+				return reflect.Value{}, fmt.Errorf("element %d: unexpected type %T", i, x[i])
+			}
+			list[i] = s
+		}
+	default:
+		return reflect.Value{}, fmt.Errorf("unexpected type %T", value)
+	}
+
+	slice := reflect.Zero(t)
+	if len(list) > 0 {
+		slice = reflect.MakeSlice(t, len(list), len(list))
+	}
+	for i, s := range list {
+		if err := json.Unmarshal([]byte(s), slice.Index(i).Addr().Interface()); err != nil {
+			return reflect.Value{}, fmt.Errorf("element %d: %w", i, err)
+		}
+	}
+	return slice, nil
+}
+
+// The marshalsItself function reports whether values of the given type marshal
+// themselves, which the reflectionAdapter prefers over reflecting their fields.
+func marshalsItself(t reflect.Type) bool {
+	return t.Implements(reflect.TypeFor[encoding.TextMarshaler]()) || t.Implements(reflect.TypeFor[encoding.BinaryMarshaler]())
+}
+
+// Neo4j stores primitives by their underlying types, and returns every integer
+// as an int64 and every float as a float64. Call convertProperty to convert such
+// a property value back to the (possibly named) type of the field it populates.
+//
+// The function converts only between types of the same kind family (integers,
+// floats, and so on); it returns any other value as-is, for reflect.Value.Set to
+// reject as it always has. In particular, it never converts an integer into a
+// string, which Go considers a conversion to a rune.
+func convertProperty(v reflect.Value, t reflect.Type) reflect.Value {
+	if !v.IsValid() || v.Type().AssignableTo(t) {
+		return v
+	}
+	if family := kindFamily(v.Kind()); family == reflect.Invalid || family != kindFamily(t.Kind()) {
+		return v
+	}
+	return v.Convert(t)
+}
+
+// The kindFamily function groups the kinds that convert to each other without
+// changing the meaning of their values.
+func kindFamily(k reflect.Kind) reflect.Kind {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return reflect.Int
+	case reflect.Float32, reflect.Float64:
+		return reflect.Float64
+	case reflect.Bool, reflect.String:
+		return k
+	default:
+		return reflect.Invalid // Never convert composite kinds.
+	}
+}
+
 // FormatNode implements Formatter for reflection-based types. It returns the
 // properties of the node as a map of field names to values. Unexported fields
 // are ignored.
+//
+// Fields of embedded structs are flattened into the properties of the node, as
+// Go promotes them. Promoted fields whose names are ambiguous (or shadowed) are
+// qualified by the path of names leading to them, see fieldKeys.
+//
+// Slices of structs are stored as lists of JSON strings, one per element, as
+// Neo4j cannot store nested structs natively (see isStructSlice).
 func (r reflectionAdapter) FormatNode() (props PropertyMap, err error) {
 	v := reflect.Value(r)
 	if !v.IsValid() {
@@ -384,29 +911,28 @@ func (r reflectionAdapter) FormatNode() (props PropertyMap, err error) {
 		return nil, fmt.Errorf("unsupported pointer type: %v", v.Type())
 
 	case reflect.Struct:
-		fields := reflect.VisibleFields(v.Type())
-		for _, f := range fields {
-			// skip digitaltwin.InformationElement embedded inside every digitaltwin.Value
-			if f.Name == "InformationElement" && f.Type == reflect.TypeFor[digitaltwin.InformationElement]() {
-				continue
-			}
-
-			v := v.FieldByIndex(f.Index).Interface()
+		for name, index := range fieldKeys(v.Type()) {
+			v := v.FieldByIndex(index).Interface()
 			// TODO: unit-test text/binary marshaller
 			if text, ok := v.(encoding.TextMarshaler); ok {
 				b, err := text.MarshalText()
 				if err != nil {
 					return nil, fmt.Errorf("marshal text: %w", err)
 				}
-				props[f.Name] = string(b)
+				props[name] = string(b)
 			} else if binary, ok := v.(encoding.BinaryMarshaler); ok {
 				b, err := binary.MarshalBinary()
 				if err != nil {
 					return nil, fmt.Errorf("marshal binary: %w", err)
 				}
-				props[f.Name] = b
+				props[name] = b
+			} else if f := reflect.ValueOf(v); f.IsValid() && isStructSlice(f.Type()) {
+				props[name], err = formatStructSlice(f)
+				if err != nil {
+					return nil, fmt.Errorf("field %q: %w", name, err)
+				}
 			} else {
-				props[f.Name] = v
+				props[name] = v
 			}
 		}
 		return props, nil
@@ -426,6 +952,13 @@ func (r reflectionAdapter) FormatNode() (props PropertyMap, err error) {
 		return props, nil
 
 	case reflect.Array, reflect.Slice:
+		if isStructSlice(v.Type()) {
+			props["values"], err = formatStructSlice(v)
+			if err != nil {
+				return nil, fmt.Errorf("values: %w", err)
+			}
+			return props, nil
+		}
 		// naive implementation: assume that the array/slice contains a supported type
 		props["values"] = v.Interface()
 		return props, nil
@@ -1,11 +1,16 @@
 package neo4jengine
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 
 	"github.com/go-digitaltwin/go-digitaltwin"
 )
@@ -18,14 +23,338 @@ func TestUnregisteredNode(t *testing.T) {
 
 	var value Unregistered
 	_, err := FormatNode(value)
-	if err == nil {
-		t.Errorf("FormatNode() = nil; want error")
+	var typeErr UnregisteredTypeError
+	if !errors.As(err, &typeErr) {
+		t.Errorf("FormatNode() error = %v; want UnregisteredTypeError", err)
+	} else if want := reflect.TypeFor[Unregistered](); typeErr.Type != want {
+		t.Errorf("UnregisteredTypeError.Type = %v; want %v", typeErr.Type, want)
 	}
 
 	node := RawNode{Label: "unregistered"}
 	_, err = ParseNode(node)
-	if err == nil {
-		t.Errorf("ParseNode() = nil; want error")
+	var labelErr UnregisteredLabelError
+	if !errors.As(err, &labelErr) {
+		t.Errorf("ParseNode() error = %v; want UnregisteredLabelError", err)
+	} else if labelErr.Label != node.Label {
+		t.Errorf("UnregisteredLabelError.Label = %q; want %q", labelErr.Label, node.Label)
+	}
+}
+
+// The registerTestLabel function registers the given node under the name of the
+// given test, which no other test shares, and returns that label.
+func registerTestLabel(tb testing.TB, node digitaltwin.Value, opts ...RegistrationOption) string {
+	tb.Helper()
+	label := tb.Name()
+	RegisterLabelWithOptions(node, label, opts...)
+	return label
+}
+
+// This test ensures the registered label is picked among marker labels (set by
+// other systems sharing the graph). It uses a local registry to avoid
+// registering its labels for the entire package (e.g. BootstrapDatabase creates
+// constraints for every known label).
+func TestLabelAmong(t *testing.T) {
+	type Business struct{ digitaltwin.InformationElement }
+	type OtherBusiness struct{ digitaltwin.InformationElement }
+	var r nodeRegistry
+	r.RegisterLabel("Business", reflect.TypeFor[Business]())
+	r.RegisterLabel("OtherBusiness", reflect.TypeFor[OtherBusiness]())
+
+	tests := []struct {
+		name    string
+		labels  []string
+		want    string
+		wantErr bool
+	}{
+		{name: "Single", labels: []string{"Business"}, want: "Business"},
+		// A single label is not checked against the registry; see newRawNode.
+		{name: "SingleUnregistered", labels: []string{"Identity"}, want: "Identity"},
+		{name: "MarkerAfter", labels: []string{"Business", "Identity"}, want: "Business"},
+		{name: "MarkerBefore", labels: []string{"Identity", "Business", "Audited"}, want: "Business"},
+		{name: "OnlyMarkers", labels: []string{"Identity", "Audited"}, wantErr: true},
+		{name: "SeveralRegistered", labels: []string{"Business", "OtherBusiness"}, wantErr: true},
+		{name: "NoLabels", labels: nil, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.LabelAmong(tt.labels)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LabelAmong(%q) error = %v, wantErr %v", tt.labels, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("LabelAmong(%q) = %q, want %q", tt.labels, got, tt.want)
+			}
+		})
+	}
+}
+
+// This test ensures marker labels do not get in the way of parsing a node as its
+// Go type, end-to-end through the global registry.
+func TestNewRawNodeWithMarkerLabels(t *testing.T) {
+	type markedNode struct {
+		digitaltwin.InformationElement
+		Value string
+	}
+	label := registerTestLabel(t, markedNode{})
+
+	value := markedNode{Value: "42"}
+	ca, err := digitaltwin.MustContentAddress(value).MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := newRawNode(neo4j.Node{
+		Labels: []string{"Identity", label, "Audited"},
+		Props:  map[string]any{"_contentAddress": string(ca), "Value": "42"},
+	})
+	if err != nil {
+		t.Fatal("newRawNode:", err)
+	}
+	got, err := ParseNode(raw)
+	if err != nil {
+		t.Fatal("ParseNode:", err)
+	}
+	if diff := cmp.Diff(value, got); diff != "" {
+		t.Errorf("ParseNode() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewRawNodeWithProperty(t *testing.T) {
+	type hashedNode struct {
+		digitaltwin.InformationElement
+		Value string
+	}
+	label := registerTestLabel(t, hashedNode{})
+
+	value := hashedNode{Value: "42"}
+	ca, err := digitaltwin.MustContentAddress(value).MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := neo4j.Node{
+		Labels: []string{label},
+		Props:  map[string]any{"contentHash": string(ca), "Value": "42"},
+	}
+	raw, err := newRawNodeWithProperty(node, "contentHash")
+	if err != nil {
+		t.Fatal("newRawNodeWithProperty:", err)
+	}
+	// The property is metadata, even though it lacks the underscore prefix.
+	if diff := cmp.Diff(PropertyMap{"contentHash": string(ca)}, raw.Metadata); diff != "" {
+		t.Errorf("newRawNodeWithProperty() metadata mismatch (-want +got):\n%s", diff)
+	}
+	got, err := ParseNode(raw)
+	if err != nil {
+		t.Fatal("ParseNode:", err)
+	}
+	if diff := cmp.Diff(value, got); diff != "" {
+		t.Errorf("ParseNode() mismatch (-want +got):\n%s", diff)
+	}
+
+	// The default property is no longer consulted.
+	if _, err := newRawNode(node); !errors.Is(err, errMalformedNode) {
+		t.Errorf("newRawNode() error = %v, want %v", err, errMalformedNode)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	type labelledNode struct {
+		digitaltwin.InformationElement
+	}
+	type unregisteredNode struct {
+		digitaltwin.InformationElement
+	}
+	want := registerTestLabel(t, labelledNode{})
+
+	// Domain code receives the resolver without importing this package.
+	var resolver digitaltwin.LabelResolver = Labels()
+	if label, ok := digitaltwin.LabelOfValue(resolver, labelledNode{}); !ok || label != want {
+		t.Errorf("LabelOfValue(labelledNode) = %q, %v; want %q, true", label, ok, want)
+	}
+	if label, ok := digitaltwin.LabelOfValue(resolver, unregisteredNode{}); ok {
+		t.Errorf("LabelOfValue(unregisteredNode) = %q, %v; want false", label, ok)
+	}
+}
+
+func TestKnownLabels(t *testing.T) {
+	want := KnownLabels()
+	if !slices.IsSorted(want) {
+		t.Errorf("KnownLabels() = %q; want sorted labels", want)
+	}
+	if !slices.Contains(want, "TestMarshalAssembly") {
+		t.Errorf("KnownLabels() = %q; want it to contain %q", want, "TestMarshalAssembly")
+	}
+	for range 10 {
+		if diff := cmp.Diff(want, KnownLabels()); diff != "" {
+			t.Fatalf("KnownLabels() is not deterministic (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestParseNodeWithMetadata(t *testing.T) {
+	type stampedNode struct {
+		digitaltwin.InformationElement
+		Value string
+	}
+	label := registerTestLabel(t, stampedNode{})
+
+	value := stampedNode{Value: "42"}
+	ca, err := digitaltwin.MustContentAddress(value).MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	lastModified := createdAt.Add(time.Hour)
+	raw, err := newRawNode(neo4j.Node{
+		Labels: []string{label},
+		Props: map[string]any{
+			"_contentAddress": string(ca),
+			"_created_at":     createdAt,
+			"_last_modified":  lastModified,
+			"Value":           "42",
+		},
+	})
+	if err != nil {
+		t.Fatal("newRawNode:", err)
+	}
+
+	got, metadata, err := ParseNodeWithMetadata(raw)
+	if err != nil {
+		t.Fatal("ParseNodeWithMetadata:", err)
+	}
+	if diff := cmp.Diff(value, got); diff != "" {
+		t.Errorf("ParseNodeWithMetadata() value mismatch (-want +got):\n%s", diff)
+	}
+	want := PropertyMap{
+		"_contentAddress": string(ca),
+		"_created_at":     createdAt,
+		"_last_modified":  lastModified,
+	}
+	if diff := cmp.Diff(want, metadata); diff != "" {
+		t.Errorf("ParseNodeWithMetadata() metadata mismatch (-want +got):\n%s", diff)
+	}
+
+	// Like ParseNode, it fails for unregistered labels.
+	if _, _, err := ParseNodeWithMetadata(RawNode{Label: "unregistered"}); err == nil {
+		t.Errorf("ParseNodeWithMetadata() = nil; want error")
+	}
+}
+
+func TestParseNode_contentAddressVerification(t *testing.T) {
+	type verifiedNode struct {
+		digitaltwin.InformationElement
+		Value string
+	}
+	registerTestLabel(t, verifiedNode{})
+
+	raw, err := FormatNode(verifiedNode{Value: "42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// We tamper with the stored properties, as a manual Cypher query would.
+	raw.Props = PropertyMap{"Value": "43"}
+
+	if _, err := ParseNode(raw); err == nil {
+		t.Errorf("ParseNode() of a tampered node = nil; want error")
+	}
+	if _, err := globalNodeRegistry.parseNode(raw, true); err == nil {
+		t.Errorf("parseNode(verify=true) of a tampered node = nil; want error")
+	}
+	got, err := globalNodeRegistry.parseNode(raw, false)
+	if err != nil {
+		t.Fatalf("parseNode(verify=false) error = %v", err)
+	}
+	if diff := cmp.Diff(verifiedNode{Value: "43"}, got); diff != "" {
+		t.Errorf("parseNode(verify=false) mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDiffRawNodes(t *testing.T) {
+	base := RawNode{
+		Label:          "TestDiffRawNodes",
+		ContentAddress: digitaltwin.NodeHash{1},
+		Props:          PropertyMap{"Name": "node", "Count": int64(42)},
+		Metadata:       PropertyMap{"_contentAddress": "stored"},
+	}
+	tests := []struct {
+		name      string
+		other     RawNode
+		wantDiff  map[string][2]any
+		wantEqual bool
+	}{
+		{
+			name:      "Same",
+			other:     RawNode{Label: base.Label, ContentAddress: base.ContentAddress, Props: PropertyMap{"Name": "node", "Count": int64(42)}},
+			wantDiff:  map[string][2]any{},
+			wantEqual: true,
+		},
+		{
+			name:     "PropertyValue",
+			other:    RawNode{Label: base.Label, ContentAddress: base.ContentAddress, Props: PropertyMap{"Name": "node", "Count": int64(43)}},
+			wantDiff: map[string][2]any{"Count": {int64(42), int64(43)}},
+		},
+		{
+			name:     "MissingProperty",
+			other:    RawNode{Label: base.Label, ContentAddress: base.ContentAddress, Props: PropertyMap{"Name": "node"}},
+			wantDiff: map[string][2]any{"Count": {int64(42), nil}},
+		},
+		{
+			name:     "ExtraProperty",
+			other:    RawNode{Label: base.Label, ContentAddress: base.ContentAddress, Props: PropertyMap{"Name": "node", "Count": int64(42), "Tags": []any{"a"}}},
+			wantDiff: map[string][2]any{"Tags": {nil, []any{"a"}}},
+		},
+		{
+			name:     "ContentAddress",
+			other:    RawNode{Label: base.Label, ContentAddress: digitaltwin.NodeHash{2}, Props: PropertyMap{"Name": "node", "Count": int64(42)}},
+			wantDiff: map[string][2]any{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.wantDiff, DiffRawNodes(base, tt.other)); diff != "" {
+				t.Errorf("DiffRawNodes() mismatch (-want +got):\n%s", diff)
+			}
+			if got := base.Equal(tt.other); got != tt.wantEqual {
+				t.Errorf("Equal() = %v; want %v", got, tt.wantEqual)
+			}
+		})
+	}
+}
+
+// We benchmark parsing a node with and without its defensive content-address
+// check, to measure the hashing cost that WithoutContentAddressVerification
+// saves during sweeps.
+func BenchmarkParseNode(b *testing.B) {
+	type parsedNode struct {
+		digitaltwin.InformationElement
+		Name    string
+		Count   int
+		Weight  float64
+		Enabled bool
+		Tags    []string
+	}
+	// The label is scoped to this benchmark, so it cannot clash with other tests.
+	RegisterLabel(parsedNode{}, "BenchmarkParseNode")
+
+	raw, err := FormatNode(parsedNode{Name: "node", Count: 42, Weight: 4.2, Enabled: true, Tags: []string{"a", "b", "c"}})
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarks := []struct {
+		name   string
+		verify bool
+	}{
+		{name: "Verified", verify: true},
+		{name: "WithoutContentAddressVerification", verify: false},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := globalNodeRegistry.parseNode(raw, bm.verify); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
 	}
 }
 
@@ -361,6 +690,33 @@ func TestReflectionAdapter(t *testing.T) {
 		},
 	)
 
+	// slices of structs (stored as JSON strings, one per element)
+	type Record struct {
+		A int
+		B string
+	}
+	type RecordsType struct {
+		Records  []Record
+		Pointers []*Record
+	}
+	tests = append(tests,
+		testcase{
+			name:  "StructSlice/Empty",
+			value: RecordsType{},
+		},
+		testcase{
+			name: "StructSlice/NonEmpty",
+			value: RecordsType{
+				Records:  []Record{{A: 1, B: "x"}, {A: 2, B: "y"}},
+				Pointers: []*Record{{A: 3, B: "z"}},
+			},
+		},
+		testcase{
+			name:  "StructSlice/Values",
+			value: []Record{{A: 1, B: "x"}, {A: 2, B: "y"}},
+		},
+	)
+
 	for i := range tests {
 		tt := tests[i]
 		t.Run(tt.name, func(t *testing.T) {
@@ -408,3 +764,316 @@ func TestReflectionAdapter(t *testing.T) {
 		})
 	}
 }
+
+// This test round-trips a node with a slice-of-struct field through FormatNode
+// and ParseNode, with its properties converted as Neo4j would store them (a
+// list of strings is read back as a []any).
+func TestReflectionAdapter_structSliceStored(t *testing.T) {
+	type record struct {
+		A int
+		B string
+	}
+	type recordsNode struct {
+		digitaltwin.InformationElement
+		Records []record
+	}
+	registerTestLabel(t, recordsNode{})
+
+	value := recordsNode{Records: []record{{A: 1, B: "x"}, {A: 2, B: "y"}}}
+	raw, err := FormatNode(value)
+	if err != nil {
+		t.Fatal("FormatNode:", err)
+	}
+	for name, prop := range raw.Props {
+		raw.Props[name], err = storedProperty(reflect.ValueOf(prop))
+		if err != nil {
+			t.Fatalf("storedProperty(%q): %v", name, err)
+		}
+	}
+	got, err := ParseNode(raw)
+	if err != nil {
+		t.Fatal("ParseNode:", err)
+	}
+	if diff := cmp.Diff(value, got); diff != "" {
+		t.Errorf("ParseNode(FormatNode()) mismatch (-want +got):\n%s", diff)
+	}
+
+	// Elements that are not JSON strings fail to parse, rather than panic.
+	raw.Props["Records"] = []any{1}
+	if _, err := ParseNode(raw); err == nil {
+		t.Errorf("ParseNode() of a malformed element = nil; want error")
+	}
+}
+
+func TestScalar(t *testing.T) {
+	type name string
+	RegisterLabel(digitaltwin.Scalar[string]{}, "TestScalarString")
+	RegisterLabel(digitaltwin.Scalar[int]{}, "TestScalarInt")
+	RegisterLabel(digitaltwin.Scalar[name]{}, "TestScalarName")
+
+	tests := []struct {
+		name  string
+		value digitaltwin.Value
+		// Neo4j returns properties by their underlying types.
+		stored any
+	}{
+		{name: "String", value: digitaltwin.Scalar[string]{Value: "42"}, stored: "42"},
+		{name: "Int", value: digitaltwin.Scalar[int]{Value: 42}, stored: int64(42)},
+		{name: "Named", value: digitaltwin.Scalar[name]{Value: "42"}, stored: "42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := FormatNode(tt.value)
+			if err != nil {
+				t.Fatal("FormatNode:", err)
+			}
+			got, err := ParseNode(raw)
+			if err != nil {
+				t.Fatal("ParseNode:", err)
+			}
+			if diff := cmp.Diff(tt.value, got); diff != "" {
+				t.Errorf("ParseNode(FormatNode()) mismatch (-want +got):\n%s", diff)
+			}
+
+			// Round-trip through the representation Neo4j returns.
+			raw.Props = PropertyMap{"Value": tt.stored}
+			got, err = ParseNode(raw)
+			if err != nil {
+				t.Fatal("ParseNode stored:", err)
+			}
+			if diff := cmp.Diff(tt.value, got); diff != "" {
+				t.Errorf("ParseNode(stored) mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWithTransientFields(t *testing.T) {
+	type derivedNode struct {
+		digitaltwin.InformationElement
+		Value   string
+		Derived string
+	}
+	registerTestLabel(t, derivedNode{}, WithTransientFields("Derived"))
+
+	value := derivedNode{Value: "42", Derived: "forty-two"}
+	raw, err := FormatNode(value)
+	if err != nil {
+		t.Fatal("FormatNode:", err)
+	}
+	if diff := cmp.Diff(PropertyMap{"Value": "42"}, raw.Props); diff != "" {
+		t.Errorf("FormatNode() props mismatch (-want +got):\n%s", diff)
+	}
+	// The transient field still participates in the content-address.
+	if want := digitaltwin.MustContentAddress(value); raw.ContentAddress != want {
+		t.Errorf("FormatNode() content address = %v, want %v", raw.ContentAddress, want)
+	}
+	if raw.ContentAddress == digitaltwin.MustContentAddress(derivedNode{Value: "42"}) {
+		t.Error("FormatNode() content address ignores the transient field")
+	}
+
+	// Parsing leaves the transient field zeroed, instead of failing the
+	// content-address check.
+	got, err := ParseNode(raw)
+	if err != nil {
+		t.Fatal("ParseNode:", err)
+	}
+	if diff := cmp.Diff(derivedNode{Value: "42"}, got); diff != "" {
+		t.Errorf("ParseNode() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWithTransientFields_unknownField(t *testing.T) {
+	type node struct {
+		digitaltwin.InformationElement
+		Value string
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("RegisterLabelWithOptions() did not panic on an unknown transient field")
+		}
+	}()
+	RegisterLabelWithOptions(node{}, "TestWithTransientFields_unknownField", WithTransientFields("Missing"))
+}
+
+func TestMustRegisterRoundTrippable(t *testing.T) {
+	type (
+		RoundTrippable struct {
+			digitaltwin.InformationElement
+			Name    string
+			Count   int
+			Ratio   float32
+			Enabled bool
+			Raw     []byte
+			When    time.Time
+		}
+		UnsupportedField struct {
+			digitaltwin.InformationElement
+			Name  string
+			Attrs map[string]string
+		}
+		ListField struct {
+			digitaltwin.InformationElement
+			Tags []string
+		}
+	)
+
+	tests := []struct {
+		name      string
+		node      digitaltwin.Value
+		wantPanic string // A substring of the panic message, if any.
+	}{
+		{name: "RoundTrippable", node: RoundTrippable{}},
+		{name: "UnsupportedField", node: UnsupportedField{}, wantPanic: `field "Attrs"`},
+		// Neo4j returns lists as []any, which ParseNode cannot assign to []string.
+		{name: "ListField", node: ListField{}, wantPanic: `field "Tags"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if tt.wantPanic == "" {
+					if r != nil {
+						t.Errorf("MustRegisterRoundTrippable() panicked: %v", r)
+					}
+					return
+				}
+				if msg, _ := r.(string); !strings.Contains(msg, tt.wantPanic) {
+					t.Errorf("MustRegisterRoundTrippable() panicked with %q, want it to mention %q", msg, tt.wantPanic)
+				}
+				if label, ok := globalNodeRegistry.LabelOf(reflect.TypeOf(tt.node)); ok {
+					t.Errorf("MustRegisterRoundTrippable() panicked, yet registered the type as %q", label)
+				}
+			}()
+			MustRegisterRoundTrippable(tt.node)
+		})
+	}
+}
+
+func TestReflectionAdapter_ambiguousEmbedded(t *testing.T) {
+	type (
+		Left  struct{ Field, Left string }
+		Right struct{ Field, Right string }
+		// Both embedded structs have a field named Field, so Go promotes neither.
+		Ambiguous struct {
+			Left
+			Right
+		}
+		// The outer field named Field shadows the promoted one.
+		Shadowed struct {
+			Left
+			Field string
+		}
+	)
+
+	tests := []struct {
+		name      string
+		value     any
+		wantProps PropertyMap
+	}{
+		{
+			name:  "Ambiguous",
+			value: Ambiguous{Left: Left{Field: "l", Left: "ll"}, Right: Right{Field: "r", Right: "rr"}},
+			wantProps: PropertyMap{
+				"Left.Field":  "l",
+				"Left.Left":   "ll", // Shadowed by the embedded struct Left itself.
+				"Right.Field": "r",
+				"Right.Right": "rr",
+			},
+		},
+		{
+			name:  "Shadowed",
+			value: Shadowed{Left: Left{Field: "l", Left: "ll"}, Field: "outer"},
+			wantProps: PropertyMap{
+				"Left.Field": "l",
+				"Left.Left":  "ll",
+				"Field":      "outer",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			props, err := reflectionAdapter(reflect.ValueOf(tt.value)).FormatNode()
+			if err != nil {
+				t.Fatal("FormatNode:", err)
+			}
+			if diff := cmp.Diff(tt.wantProps, props); diff != "" {
+				t.Errorf("FormatNode() mismatch (-want +got):\n%s", diff)
+			}
+
+			out := reflect.New(reflect.TypeOf(tt.value)).Elem()
+			if err := reflectionAdapter(out).ParseNode(props); err != nil {
+				t.Fatal("ParseNode:", err)
+			}
+			if diff := cmp.Diff(tt.value, out.Interface()); diff != "" {
+				t.Errorf("ParseNode() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// We fuzz the reflective content-address of a registered type against the two
+// invariants the engine relies upon: equal values have equal addresses, and a
+// value keeps its address after a round-trip through the graph (formatted by
+// FormatNode, stored in Neo4j, and parsed by ParseNode). Run it with:
+//
+//	go test ./neo4jengine -run '^$' -fuzz FuzzContentAddress
+func FuzzContentAddress(f *testing.F) {
+	type fuzzedNode struct {
+		digitaltwin.InformationElement
+		S   string
+		I32 int32
+		I64 int64
+		U   uint16
+		F   float64
+		B   bool
+		Raw []byte
+	}
+	registerTestLabel(f, fuzzedNode{})
+
+	// We seed the corpus with the values of the content-address tests in the root
+	// package.
+	f.Add("left", int32(0), int64(0), uint16(0), 0.0, false, []byte(nil))
+	f.Add("right", int32(1), int64(2), uint16(0), 0.0, false, []byte(nil))
+	f.Add("same", int32(-1), int64(-1), uint16(1), 4.2, true, []byte("same"))
+	f.Add("", int32(1<<31-1), int64(1<<31-1), uint16(1<<16-1), -0.0, true, []byte{})
+
+	f.Fuzz(func(t *testing.T, s string, i32 int32, i64 int64, u uint16, fl float64, b bool, raw []byte) {
+		build := func() fuzzedNode {
+			return fuzzedNode{S: s, I32: i32, I64: i64, U: u, F: fl, B: b, Raw: slices.Clone(raw)}
+		}
+		v := build()
+		ca, err := digitaltwin.ContentAddress(v)
+		if err != nil {
+			t.Fatalf("ContentAddress(%#v): %v", v, err)
+		}
+		if again := digitaltwin.MustContentAddress(build()); again != ca {
+			t.Fatalf("ContentAddress of equal values: %v != %v", again, ca)
+		}
+
+		node, err := FormatNode(v)
+		if err != nil {
+			t.Fatalf("FormatNode(%#v): %v", v, err)
+		}
+		// Neo4j returns the properties differently than they were formatted (e.g.
+		// integers as int64), so we parse them as stored.
+		stored := make(PropertyMap, len(node.Props))
+		for name, prop := range node.Props {
+			x, err := storedProperty(reflect.ValueOf(prop))
+			if err != nil {
+				t.Fatalf("store property %q: %v", name, err)
+			}
+			if x != nil {
+				stored[name] = x // Neo4j does not store null properties.
+			}
+		}
+		node.Props = stored
+		parsed, err := ParseNode(node)
+		if err != nil {
+			t.Fatalf("ParseNode(FormatNode(%#v)): %v", v, err)
+		}
+		if got := digitaltwin.MustContentAddress(parsed); got != ca {
+			t.Errorf("ContentAddress(ParseNode(FormatNode(%#v))) = %v, want %v", v, got, ca)
+		}
+	})
+}
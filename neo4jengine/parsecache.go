@@ -0,0 +1,77 @@
+package neo4jengine
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/go-digitaltwin/go-digitaltwin"
+)
+
+// A parseCache memoises the values parsed from RawNodes, keyed by their label and
+// content-address, evicting the least recently used values once it holds more
+// than its size; see WithParseCache.
+//
+// The methods of a nil parseCache are no-ops, so callers need not check whether
+// the Engine was configured with one.
+//
+// A parseCache is safe for concurrent-use.
+type parseCache struct {
+	size    int
+	entries map[parseKey]*list.Element // Elements hold a parseEntry.
+	recency list.List                  // Most recently used first.
+	mu      sync.Mutex
+}
+
+// A parseKey identifies a parsed node; the label tells apart nodes of
+// different types that share a content-address.
+type parseKey struct {
+	label string
+	ca    digitaltwin.NodeHash
+}
+
+type parseEntry struct {
+	key   parseKey
+	value digitaltwin.Value
+}
+
+// The newParseCache function returns an empty parseCache of the given size,
+// which must be positive.
+func newParseCache(size int) *parseCache {
+	return &parseCache{size: size, entries: make(map[parseKey]*list.Element, size)}
+}
+
+// The get method returns the value memoised for the given key, if any, marking
+// it as the most recently used.
+func (c *parseCache) get(key parseKey) (digitaltwin.Value, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.recency.MoveToFront(e)
+	return e.Value.(parseEntry).value, true
+}
+
+// The add method memoises the given value under the given key, evicting the
+// least recently used value if the cache is full.
+func (c *parseCache) add(key parseKey, v digitaltwin.Value) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.recency.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.recency.PushFront(parseEntry{key: key, value: v})
+	if c.recency.Len() > c.size {
+		oldest := c.recency.Back()
+		c.recency.Remove(oldest)
+		delete(c.entries, oldest.Value.(parseEntry).key)
+	}
+}
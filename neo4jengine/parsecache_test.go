@@ -0,0 +1,100 @@
+package neo4jengine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-digitaltwin/go-digitaltwin"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+func TestParseCache(t *testing.T) {
+	key := func(n byte) parseKey { return parseKey{label: "TestParseCache", ca: digitaltwin.NodeHash{n}} }
+	value := func(n byte) digitaltwin.Value { return digitaltwin.Scalar[byte]{Value: n} }
+
+	c := newParseCache(2)
+	c.add(key(1), value(1))
+	c.add(key(2), value(2))
+	// Using the first value makes the second one the least recently used.
+	if v, ok := c.get(key(1)); !ok || v != value(1) {
+		t.Errorf("get(1) = %v, %v; want %v, true", v, ok, value(1))
+	}
+	c.add(key(3), value(3))
+	if v, ok := c.get(key(2)); ok {
+		t.Errorf("get(2) = %v, true; want the least recently used value evicted", v)
+	}
+	for _, n := range []byte{1, 3} {
+		if v, ok := c.get(key(n)); !ok || v != value(n) {
+			t.Errorf("get(%d) = %v, %v; want %v, true", n, v, ok, value(n))
+		}
+	}
+	// The same content-address under another label is a different node.
+	if v, ok := c.get(parseKey{label: "Other", ca: key(1).ca}); ok {
+		t.Errorf("get(Other) = %v, true; want false", v)
+	}
+
+	// A nil parseCache memoises nothing.
+	var none *parseCache
+	none.add(key(1), value(1))
+	if v, ok := none.get(key(1)); ok {
+		t.Errorf("nil get(1) = %v, true; want false", v)
+	}
+}
+
+// We benchmark parsing an assembly whose nodes all share a single child, with
+// and without a parse cache, to measure the reflection and hashing that
+// WithParseCache saves on graphs with heavy node sharing.
+func BenchmarkParseAssemblyRecord_sharedNodes(b *testing.B) {
+	type sharedNode struct {
+		digitaltwin.InformationElement
+		Name  string
+		Count int
+	}
+	// The label is scoped to this benchmark, so it cannot clash with other tests.
+	RegisterLabel(sharedNode{}, "BenchmarkParseAssemblyRecord_sharedNodes")
+
+	node := func(v digitaltwin.Value) neo4j.Node {
+		raw, err := FormatNode(v)
+		if err != nil {
+			b.Fatal(err)
+		}
+		ca, err := raw.ContentAddress.MarshalText()
+		if err != nil {
+			b.Fatal(err)
+		}
+		props := map[string]any{"_contentAddress": string(ca)}
+		for key, value := range raw.Props {
+			props[key] = value
+		}
+		return neo4j.Node{Labels: []string{raw.Label}, Props: props}
+	}
+	root, shared := node(sharedNode{Name: "root"}), node(sharedNode{Name: "shared"})
+	var tuples []any
+	for i := range 100 {
+		child := node(sharedNode{Name: "child", Count: i})
+		tuples = append(tuples,
+			map[string]any{"from": root, "to": child},
+			map[string]any{"from": child, "to": shared},
+		)
+	}
+	record := &neo4j.Record{Keys: []string{"root", "tuples"}, Values: []any{root, tuples}}
+
+	ctx := context.Background()
+	benchmarks := []struct {
+		name   string
+		reader graphReader
+	}{
+		{name: "Uncached", reader: graphReader{parser: nodeParser{verify: true}}},
+		{name: "WithParseCache", reader: graphReader{parser: nodeParser{verify: true, cache: newParseCache(1024)}}},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := bm.reader.safelyParseAssembly(ctx, record); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -5,12 +5,16 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"reflect"
+	"slices"
 
 	"github.com/danielorbach/go-component"
 	"github.com/go-digitaltwin/go-digitaltwin"
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // A snapshot stores the current assembly-graphs in a digital-twin system. It is
@@ -18,29 +22,46 @@ import (
 // WhatChanged method.
 type snapshot map[digitaltwin.ComponentID]digitaltwin.ComponentHash
 
-// This function uses the given neo4j connection to iterate over the entire graph
-// (specified by the given database name) while identifying disjoint graph
-// components.
+// This method uses the given neo4j connection to iterate over the entire graph
+// (specified by the database name of the given session configuration) while
+// identifying disjoint graph components.
 //
-// The returned snapshot records all the identified disjoint graph components.
-func captureSnapshot(ctx context.Context, d neo4j.DriverWithContext, database string) (snapshot, error) {
-	logger := component.Logger(ctx).With("neo4j.database", database)
+// The returned snapshot records all the identified disjoint graph components,
+// and the returned rootIndex the roots of those with several roots.
+//
+// A positive batchSize makes the function fetch the graph components in batches
+// of (at most) that many roots, see WithSnapshotBatchSize. Otherwise, it fetches
+// them all with a single query.
+func (r graphReader) captureSnapshot(ctx context.Context, d neo4j.DriverWithContext, config neo4j.SessionConfig, batchSize int) (snapshot, rootIndex, error) {
+	logger := component.Logger(ctx).With("neo4j.database", config.DatabaseName)
 
-	s := d.NewSession(ctx, neo4j.SessionConfig{
-		DatabaseName: database,
-		AccessMode:   neo4j.AccessModeRead,
-	})
+	s := d.NewSession(ctx, config)
 	defer func() {
 		if err := s.Close(ctx); err != nil {
 			logger.Error("Failed to close engine's read session", "error", err)
 		}
 	}()
 
-	ss := make(snapshot)
+	if batchSize > 0 {
+		// We fetch all batches within a single transaction, so they observe the same
+		// graph; otherwise, the graph may change between batches such that roots slip
+		// between the pages.
+		var idx rootIndex
+		ss, err := neo4j.ExecuteRead(ctx, s, func(tx neo4j.ManagedTransaction) (ss snapshot, err error) {
+			ss, idx, err = r.captureSnapshotBatchesTx(ctx, tx, batchSize)
+			return ss, err
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("capture in batches: %w", classifyError(err))
+		}
+		return ss, idx, nil
+	}
+
+	ss, idx := make(snapshot), make(rootIndex)
 	// First, get a cursor into the entire graph.
-	result, err := fetchAssemblies(ctx, s)
+	result, err := r.fetchAssemblies(ctx, s)
 	if err != nil {
-		return ss, fmt.Errorf("fetch assemblies: %w", err)
+		return ss, idx, fmt.Errorf("fetch assemblies: %w", classifyError(err))
 	}
 	// Remember to consume (discards all remaining records) before exiting. Failing
 	// to do so may leak resources, we're not sure.
@@ -51,19 +72,117 @@ func captureSnapshot(ctx context.Context, d neo4j.DriverWithContext, database st
 		}
 	}()
 
-	for result.Next(ctx) {
-		a, err := safelyParseAssembly(ctx, result.Record())
-		if err != nil {
-			return ss, fmt.Errorf("parse assembly: %w", err)
+	m := newComponentMerger(r.parser.maxNodes)
+	for n := 1; result.Next(ctx); n++ {
+		if err := checkCancelled(ctx, n); err != nil {
+			return ss, idx, fmt.Errorf("iterate assemblies: %w", err)
 		}
-		ss[a.AssemblyID()] = a.AssemblyHash()
+		a, err := r.safelyParseAssembly(ctx, result.Record())
+		if errors.Is(err, errSkippedAssembly) {
+			continue
+		} else if err != nil {
+			return ss, idx, fmt.Errorf("parse assembly: %w", err)
+		}
+		m.add(a)
 	}
 	// Neo4j's result cursor is exhausted by now. We check its Err method to get the
 	// error that caused the iteration to stop, if any.
 	if err := result.Err(); err != nil {
-		return ss, fmt.Errorf("iterate assemblies: %w", err)
+		return ss, idx, fmt.Errorf("iterate assemblies: %w", classifyError(err))
+	}
+	assemblies, err := m.merge()
+	if err != nil {
+		return ss, idx, fmt.Errorf("merge assemblies: %w", err)
+	}
+	ss.addAll(assemblies)
+	idx.addAll(assemblies)
+	return ss, idx, nil
+}
+
+// The captureSnapshotTx method is like captureSnapshot, but iterates over the
+// entire graph within the given (already open) transaction.
+func (r graphReader) captureSnapshotTx(ctx context.Context, tx neo4j.ManagedTransaction) (snapshot, rootIndex, error) {
+	ss, idx := make(snapshot), make(rootIndex)
+	err := r.visitAllAssemblies(ctx, tx, func(a digitaltwin.Assembly) error {
+		ss[a.AssemblyID()] = a.AssemblyHash()
+		idx.add(a)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return ss, idx, nil
+}
+
+// The captureSnapshotBatchesTx method is like captureSnapshotTx, but fetches
+// the graph components in batches of (at most) the given number of roots. This
+// bounds the size of every result set, which is otherwise as large as the entire
+// graph.
+//
+// The returned snapshot is identical to the one captureSnapshotTx returns. Roots
+// of the same component may be fetched in different batches, so the assemblies
+// of all batches are merged into components only once the last one is fetched.
+func (r graphReader) captureSnapshotBatchesTx(ctx context.Context, tx neo4j.ManagedTransaction, batchSize int) (snapshot, rootIndex, error) {
+	m := newComponentMerger(r.parser.maxNodes)
+	for skip := 0; ; skip += batchSize {
+		result, err := tx.Run(ctx, fetchAssembliesBatchQuery, r.nodeKey().params(map[string]any{
+			"skip":  skip,
+			"limit": batchSize,
+		}))
+		if err != nil {
+			return nil, nil, fmt.Errorf("run batch at %d: %w", skip, err)
+		}
+		// We count every record of the batch, including those of skipped assemblies
+		// (see WithSkipMalformedNodes), as they take up their page all the same.
+		var n int
+		for result.Next(ctx) {
+			n++
+			if err := checkCancelled(ctx, skip+n); err != nil {
+				return nil, nil, fmt.Errorf("iterate batch at %d: %w", skip, err)
+			}
+			a, err := r.safelyParseAssembly(ctx, result.Record())
+			if errors.Is(err, errSkippedAssembly) {
+				continue
+			} else if err != nil {
+				return nil, nil, fmt.Errorf("parse assembly: %w", err)
+			}
+			m.add(a)
+		}
+		if err := result.Err(); err != nil {
+			return nil, nil, fmt.Errorf("iterate batch at %d: %w", skip, err)
+		}
+		// A partial (or empty) batch means we have run out of roots.
+		if n < batchSize {
+			break
+		}
+	}
+	assemblies, err := m.merge()
+	if err != nil {
+		return nil, nil, fmt.Errorf("merge assemblies: %w", err)
 	}
-	return ss, nil
+	ss, idx := make(snapshot), make(rootIndex)
+	ss.addAll(assemblies)
+	idx.addAll(assemblies)
+	return ss, idx, nil
+}
+
+// The cancellationCheckInterval is the number of records the engine reads
+// between consecutive checks for cancellation, see checkCancelled.
+const cancellationCheckInterval = 64
+
+// Call checkCancelled while iterating over the records of a (potentially huge)
+// result, passing the number of records read so far. Every so many records, it
+// returns the error of the given context, if any.
+//
+// The driver only notices a done context when it needs to fetch more records
+// from the server, which can take a long while when the records are buffered
+// locally. Sweeping the entire graph may take minutes, so we would rather stop
+// promptly once our caller is no longer interested.
+func checkCancelled(ctx context.Context, n int) error {
+	if n%cancellationCheckInterval != 0 {
+		return nil
+	}
+	return ctx.Err()
 }
 
 // GraphHash calculates and returns a consolidated hash representing the entire
@@ -83,6 +202,236 @@ func (s snapshot) ContainsAssembly(a digitaltwin.AssemblyRef) bool {
 	return exists && hash == a.AssemblyHash()
 }
 
+// The addAll method records the given assemblies in the snapshot.
+func (s snapshot) addAll(assemblies []digitaltwin.Assembly) {
+	for _, a := range assemblies {
+		s[a.AssemblyID()] = a.AssemblyHash()
+	}
+}
+
+// A rootIndex maps every root of a multi-root component (see componentMerger)
+// to the ID of that component. Single-root components are not indexed, as their
+// ID is derived from their root alone (see componentID).
+//
+// The Engine keeps one next to its snapshot, because a component is identified
+// by all of its roots: once a multi-root component splits, none of the IDs the
+// sweep derives from its taints and roots identify it anymore, so only the index
+// can tell the sweep it was removed.
+type rootIndex map[digitaltwin.NodeHash]digitaltwin.ComponentID
+
+// The add method indexes the roots of the given assembly, if it has several.
+func (idx rootIndex) add(a digitaltwin.Assembly) {
+	if len(a.Roots()) < 2 {
+		return
+	}
+	for _, root := range a.Roots() {
+		idx[root] = a.AssemblyID()
+	}
+}
+
+// The addAll method indexes the roots of the given assemblies, see add.
+func (idx rootIndex) addAll(assemblies []digitaltwin.Assembly) {
+	for _, a := range assemblies {
+		idx.add(a)
+	}
+}
+
+// Update modifies the index based on the changes observed in the digital twin's
+// graph, like snapshot.Update. Updated components keep their roots (their IDs
+// digest them), so only the created and removed ones matter.
+func (idx rootIndex) Update(changes digitaltwin.GraphChanged) {
+	removed := make(map[digitaltwin.ComponentID]bool, len(changes.Removed))
+	for _, c := range changes.Removed {
+		removed[c.AssemblyID()] = true
+	}
+	maps.DeleteFunc(idx, func(_ digitaltwin.NodeHash, id digitaltwin.ComponentID) bool {
+		return removed[id]
+	})
+	for _, c := range changes.Created {
+		idx.add(c)
+	}
+}
+
+// The rootsOf method returns the roots of the indexed component identified by
+// the given ID, if any.
+func (idx rootIndex) rootsOf(id digitaltwin.ComponentID) []digitaltwin.NodeHash {
+	var roots []digitaltwin.NodeHash
+	for root, other := range idx {
+		if other == id {
+			roots = append(roots, root)
+		}
+	}
+	return roots
+}
+
+// A componentMerger merges the assemblies of roots that converge on shared
+// nodes into a single multi-root assembly, such that every disjoint graph
+// component is reported once, identified by all of its roots. Our queries
+// return the nodes reachable from every root separately (see fetchAssemblies),
+// so the sweeps add those to a merger and visit the assemblies it merges.
+//
+// Beware, merging requires every assembly of the sweep to be held in memory
+// until the sweep ends, rather than visiting them one by one.
+type componentMerger struct {
+	maxNodes   int // Non-positive means merged assemblies of any size.
+	assemblies []digitaltwin.Assembly
+	seen       map[digitaltwin.ComponentID]struct{}
+	// A disjoint-set forest of the nodes of the added assemblies, so nodes of
+	// the same component share their representative (see find).
+	parent map[digitaltwin.NodeHash]digitaltwin.NodeHash
+}
+
+// The newComponentMerger function returns an empty componentMerger that fails
+// merged assemblies of more than maxNodes nodes, see WithMaxComponentNodes.
+func newComponentMerger(maxNodes int) *componentMerger {
+	return &componentMerger{
+		maxNodes: maxNodes,
+		seen:     make(map[digitaltwin.ComponentID]struct{}),
+		parent:   make(map[digitaltwin.NodeHash]digitaltwin.NodeHash),
+	}
+}
+
+// The add method adds the given single-root assembly to the merger, unless an
+// assembly of the same root was already added.
+func (m *componentMerger) add(a digitaltwin.Assembly) {
+	if _, ok := m.seen[a.AssemblyID()]; ok {
+		return
+	}
+	m.seen[a.AssemblyID()] = struct{}{}
+	m.assemblies = append(m.assemblies, a)
+	roots := a.Roots()
+	if len(roots) == 0 {
+		return // Rootless assemblies are kept on their own, see WhatChanged.
+	}
+	for n := range a.Nodes() {
+		m.union(roots[0], n)
+	}
+}
+
+// The find method returns the representative of the set of the given node.
+func (m *componentMerger) find(n digitaltwin.NodeHash) digitaltwin.NodeHash {
+	for {
+		p, ok := m.parent[n]
+		if !ok || p == n {
+			return n
+		}
+		// Halve the path on the way up, so later finds are cheaper.
+		if pp, ok := m.parent[p]; ok {
+			m.parent[n] = pp
+		}
+		n = p
+	}
+}
+
+// The union method merges the sets of the given nodes.
+func (m *componentMerger) union(x, y digitaltwin.NodeHash) {
+	if x, y = m.find(x), m.find(y); x != y {
+		m.parent[y] = x
+	}
+}
+
+// The merge method returns the added assemblies, merging those that share
+// nodes into a single assembly of all their roots. The assemblies are returned
+// in the order their first root was added.
+//
+// It fails with a ComponentTooLargeError when a merged assembly has more nodes
+// than the merger allows, just like parseAssemblyRecord does for single roots.
+func (m *componentMerger) merge() ([]digitaltwin.Assembly, error) {
+	var (
+		order  []digitaltwin.NodeHash
+		groups = make(map[digitaltwin.NodeHash][]digitaltwin.Assembly)
+		merged []digitaltwin.Assembly
+	)
+	for _, a := range m.assemblies {
+		if len(a.Roots()) == 0 {
+			merged = append(merged, a)
+			continue
+		}
+		key := m.find(a.Roots()[0])
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], a)
+	}
+	for _, key := range order {
+		group := groups[key]
+		if len(group) == 1 {
+			merged = append(merged, group[0])
+			continue
+		}
+		var (
+			b     digitaltwin.AssemblyBuilder
+			roots []digitaltwin.Value
+		)
+		for _, a := range group {
+			b.Nodes(slices.Collect(a.Values())...)
+			for from, to := range a.EdgePairs() {
+				b.Connect(from, to)
+			}
+			roots = append(roots, digitaltwin.RootValues(a)...)
+		}
+		// Roots replaces the roots of the builder, so we collect all of them first.
+		b.Roots(roots...)
+		a := b.Assemble()
+		if m.maxNodes > 0 && len(a.Nodes()) > m.maxNodes {
+			return nil, ComponentTooLargeError{ID: a.AssemblyID(), Nodes: len(a.Nodes()), Limit: m.maxNodes}
+		}
+		merged = append(merged, a)
+	}
+	return merged, nil
+}
+
+// The fetchAssembliesQuery returns every assembly in the graph, see
+// fetchAssemblies for the shape of its records. It expects the "tenant"
+// parameter to scope the assemblies to a tenant, or null for all of them (see
+// nodeKey.params).
+const fetchAssembliesQuery = `
+	CALL {
+		// find roots (of the tenant, if any; see WithTenant)
+		MATCH (root) WHERE NOT EXISTS {()-[]->(root)}
+		AND ($tenant IS NULL OR root._tenant = $tenant)
+
+		// find all paths possibly few paths from same root!!! be aware.
+		// only MATCH roots of path in length of 8 or less.
+		MATCH (root)-[*0..5]->(path_node)-[]->(adjacent_path_node)
+
+		// group all tuples by root, tuples are unique since they are added
+		WITH root, COLLECT({from: path_node, to: adjacent_path_node}) AS tuples
+		RETURN root, tuples
+		Union
+		MATCH (root) WHERE NOT EXISTS {()-[]->(root)} AND NOT EXISTS {()<-[]-(root)}
+		AND ($tenant IS NULL OR root._tenant = $tenant)
+		// ignore tombstoned nodes, which are always left without edges (see WithSoftDelete)
+		AND root._deleted_at IS NULL
+		RETURN root, [{from: null, to:null}] AS tuples
+	}
+	RETURN root, tuples
+`
+
+// The fetchAssembliesBatchQuery returns a single page of the assemblies
+// returned by fetchAssembliesQuery, in records of the same shape. It expects the
+// "skip" and "limit" parameters to select the page, and the "tenant" parameter
+// like fetchAssembliesQuery.
+//
+// It orders the roots by their element ID, which is stable within a single
+// transaction, so consecutive pages neither overlap nor miss roots.
+const fetchAssembliesBatchQuery = `
+	MATCH (root) WHERE NOT EXISTS {()-[]->(root)}
+	AND ($tenant IS NULL OR root._tenant = $tenant)
+	// ignore tombstoned nodes, which are always left without edges (see WithSoftDelete)
+	AND root._deleted_at IS NULL
+	WITH root ORDER BY elementId(root) SKIP $skip LIMIT $limit
+	CALL {
+		WITH root
+		// only MATCH roots of path in length of 8 or less, like fetchAssembliesQuery.
+		OPTIONAL MATCH (root)-[*0..5]->(path_node)-[]->(adjacent_path_node)
+		// isolated roots collect a single {from: null, to: null} tuple, just like the
+		// second branch of fetchAssembliesQuery returns for them.
+		RETURN COLLECT({from: path_node, to: adjacent_path_node}) AS tuples
+	}
+	RETURN root, tuples
+`
+
 // The fetchAssemblies function returns a list of assemblies from the Neo4j graph
 // associated with the given session.
 //
@@ -96,39 +445,122 @@ func (s snapshot) ContainsAssembly(a digitaltwin.AssemblyRef) bool {
 // We assume the following statements are true:
 //   - Assembly is DAG.
 //   - Assembly edges are not wighted (i.e. no properties).
-//   - Assembly has only one root.
 //
 // If any of those assumptions are false, then we cannot guarantee the behaviour
 // of the query.
-func fetchAssemblies(ctx context.Context, s neo4j.SessionWithContext) (neo4j.ResultWithContext, error) {
-	query := `
-		CALL {
-			// find roots
-			MATCH (root) WHERE NOT EXISTS {()-[]->(root)}
+//
+// Every record describes the nodes reachable from a single root. A DAG whose
+// roots converge on shared nodes is therefore returned as several overlapping
+// records, one per root. Callers merge those into a single multi-root assembly
+// (see componentMerger), so every disjoint graph component is identified by all
+// of its roots, like AssemblyBuilder.Roots describes.
+func (r graphReader) fetchAssemblies(ctx context.Context, s neo4j.SessionWithContext) (neo4j.ResultWithContext, error) {
+	result, err := s.Run(ctx, fetchAssembliesQuery, r.nodeKey().params(map[string]any{}))
+	if err != nil {
+		return nil, fmt.Errorf("run: %w", err)
+	}
+	return result, nil
+}
+
+// Call collectAssemblies to collect (from Neo4j graph associated with the given
+// session) the assemblies visited by the given sweep function, e.g.
+// visitPartialAssemblies for those that were touched, as marked by tainted
+// nodes.
+//
+// See visitPartialAssemblies for the assumptions this function makes about the
+// graph.
+func collectAssemblies(ctx context.Context, s neo4j.SessionWithContext, sweep func(neo4j.ManagedTransaction, func(digitaltwin.Assembly) error) error) (assemblies []digitaltwin.Assembly, err error) {
+	ctx, span := tracer.Start(ctx, "collectAssemblies")
+	defer span.End()
 
-			// find all paths possibly few paths from same root!!! be aware.
-			// only MATCH roots of path in length of 8 or less.
-			MATCH (root)-[*0..5]->(path_node)-[]->(adjacent_path_node)
+	// The work function below appends directly into the returned assemblies
+	// variable. The driver may retry the work function on transient errors, so it
+	// starts over with an empty slice every time.
+	_, err = s.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		assemblies = nil
+		return nil, sweep(tx, func(a digitaltwin.Assembly) error {
+			assemblies = append(assemblies, a)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("execute read: %w", classifyError(err))
+	}
+	return assemblies, nil
+}
 
-			// group all tuples by root, tuples are unique since they are added
-			WITH root, COLLECT({from: path_node, to: adjacent_path_node}) AS tuples
-			RETURN root, tuples
-			Union
-			MATCH (root) WHERE NOT EXISTS {()-[]->(root)} AND NOT EXISTS {()<-[]-(root)}
-			RETURN root, [{from: null, to:null}] AS tuples
+// Call visitAllAssemblies to iterate (within the given transaction) over all
+// assemblies in the graph. The visit function is called exactly once for every
+// assembly. The iteration stops as soon as visit returns a non-nil error, which
+// visitAllAssemblies returns as-is.
+//
+// Roots that converge on shared nodes are merged into a single assembly (see
+// componentMerger), so visit is only called once the entire graph was read.
+//
+// See fetchAssemblies for the shape of the records and the assumptions this
+// function makes about the graph.
+func (r graphReader) visitAllAssemblies(ctx context.Context, tx neo4j.ManagedTransaction, visit func(digitaltwin.Assembly) error) error {
+	result, err := tx.Run(ctx, fetchAssembliesQuery, r.nodeKey().params(map[string]any{}))
+	if err != nil {
+		return fmt.Errorf("run: %w", err)
+	}
+	m := newComponentMerger(r.parser.maxNodes)
+	for n := 1; result.Next(ctx); n++ {
+		if err := checkCancelled(ctx, n); err != nil {
+			return fmt.Errorf("iterate assemblies: %w", err)
 		}
-		RETURN root, tuples
-	`
-	result, err := s.Run(ctx, query, nil)
+		a, err := r.safelyParseAssembly(ctx, result.Record())
+		if errors.Is(err, errSkippedAssembly) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("parse assembly: %w", err)
+		}
+		m.add(a)
+	}
+	// Neo4j's result cursor is exhausted by now. We check its Err method to get the
+	// error that caused the iteration to stop, if any.
+	if err := result.Err(); err != nil {
+		return fmt.Errorf("iterate assemblies: %w", err)
+	}
+	assemblies, err := m.merge()
 	if err != nil {
-		return nil, fmt.Errorf("run: %w", err)
+		return fmt.Errorf("merge assemblies: %w", err)
 	}
-	return result, nil
+	for _, a := range assemblies {
+		if err := visit(a); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// Call fetchPartialAssemblies to fetch (from Neo4j graph associated with the
-// given session) the assemblies that were touched, as marked by the given
-// slice of tainted nodes.
+// The convergingRootsQuery returns the assemblies of the roots that converge on
+// nodes shared with the assemblies of the given roots, in records of the same
+// shape as fetchAssembliesQuery. It expects the "frontier" parameter to list the
+// element IDs of the given roots, the "known" parameter to list those of the
+// roots that should not be returned (again), and the "tenant" parameter like
+// fetchAssembliesQuery.
+//
+// Like the other queries in this file, it only considers nodes within the
+// depth our assemblies reach from their roots.
+const convergingRootsQuery = `
+	MATCH (known) WHERE elementId(known) IN $frontier
+	MATCH (known)-[*0..6]->(shared)
+	WITH DISTINCT shared
+	MATCH (shared)<-[*1..6]-(root)
+	WHERE NOT ()-->(root) AND NOT elementId(root) IN $known
+	AND ($tenant IS NULL OR root._tenant = $tenant)
+	WITH DISTINCT root
+	MATCH (root)-[*0..5]->(path_node)-[]->(adjacent_path_node)
+	WITH root, COLLECT({from: path_node, to: adjacent_path_node}) AS tuples
+	RETURN root, tuples
+`
+
+// Call visitPartialAssemblies to iterate (within the given transaction) over the
+// assemblies that were touched, as marked by the given slice of tainted nodes.
+// The visit function is called exactly once for every such assembly, even if
+// several taints belong to the same assembly. The iteration stops as soon as
+// visit returns a non-nil error, which visitPartialAssemblies returns as-is.
 //
 // Every record in the query results contains:
 //
@@ -140,105 +572,269 @@ func fetchAssemblies(ctx context.Context, s neo4j.SessionWithContext) (neo4j.Res
 // We assume the following statements are true:
 //   - Assembly is DAG.
 //   - Assembly edges are not wighted (i.e. no properties).
-//   - Assembly has only one root.
 //
 // If any of those assumptions are false, then we cannot guarantee the behaviour
 // of the query.
-func fetchPartialAssemblies(ctx context.Context, s neo4j.SessionWithContext, taints []RawNode) (assemblies []digitaltwin.Assembly, err error) {
-	ctx, span := tracer.Start(ctx, "fetchPartialAssemblies")
-	defer span.End()
+//
+// The roots reaching the taints may converge on nodes shared with other roots,
+// which the taints do not reach. Once the taints are swept, we repeatedly fetch
+// the assemblies of such converging roots (see convergingRootsQuery) until no
+// more are found, and then merge them into multi-root assemblies (see
+// componentMerger) before visiting any.
+func (r graphReader) visitPartialAssemblies(ctx context.Context, tx neo4j.ManagedTransaction, taints []RawNode, visit func(digitaltwin.Assembly) error) error {
+	span := trace.SpanFromContext(ctx)
 
-	work := func(tx neo4j.ManagedTransaction) (any, error) {
-		// We use a map to track disjoint graph components and their respective hashes,
-		// to ensure consistency during graph read iterations, since we do not fully
-		// understand Neo4j's isolation levels.
-		//
-		// We think that concurrent transactions might affect our data accuracy because
-		// we've noticed that modifications made in one write-transaction spill over into
-		// an already running read-transaction.
-		//
-		// As we read the graph during a single transaction, we must guarantee identical
-		// results for repeated reads of the same disjoint graph components. Any
-		// discrepancy in results would invalidate our ability to compare graph states,
-		// so we choose to immediately abort the operation and panic.
-		seen := make(map[digitaltwin.ComponentID]digitaltwin.ComponentHash)
-
-		// We are only collecting assemblies containing nodes we have already tainted.
-		for _, taint := range taints {
-			ca, err := taint.ContentAddress.MarshalText()
-			if err != nil {
-				return nil, fmt.Errorf("marshal content address: %w", err)
+	// We use a map to track disjoint graph components and their respective hashes,
+	// to ensure consistency during graph read iterations, since we do not fully
+	// understand Neo4j's isolation levels.
+	//
+	// We think that concurrent transactions might affect our data accuracy because
+	// we've noticed that modifications made in one write-transaction spill over into
+	// an already running read-transaction.
+	//
+	// As we read the graph during a single transaction, we must guarantee identical
+	// results for repeated reads of the same disjoint graph components. Any
+	// discrepancy in results would invalidate our ability to compare graph states,
+	// so we choose to immediately abort the operation and panic.
+	seen := make(map[digitaltwin.ComponentID]digitaltwin.ComponentHash)
+
+	// We count records across all queries, to check for cancellation periodically.
+	var n int
+
+	// The roots found so far (by their element IDs), and those among them whose
+	// converging roots were not fetched yet.
+	var known, frontier []string
+	isKnown := make(map[string]bool)
+
+	m := newComponentMerger(r.parser.maxNodes)
+	collect := func(result neo4j.ResultWithContext) error {
+		for result.Next(ctx) {
+			n++
+			if err := checkCancelled(ctx, n); err != nil {
+				return fmt.Errorf("iterate assembly: %w", err)
 			}
-			query := `
-				CALL{
-					MATCH (root)-[*]->(target:` + taint.Label + `{_contentAddress: $ca})
-					WHERE NOT ()-->(root) // No incoming of any type to root
-					WITH root
-					MATCH (root)-[*0..5]->(path_node)-[]->(adjacent_path_node)
-					WITH root, COLLECT({from: path_node, to: adjacent_path_node}) AS tuples
-					RETURN root, tuples
-
-					UNION
-
-					MATCH (root:` + taint.Label + `{_contentAddress: $ca})
-					WHERE NOT ()-->(root) AND NOT ()<--(root)
-					RETURN root, [{from: null, to: null}] AS tuples
-				}
-				return root, tuples
-			`
-			result, err := tx.Run(ctx, query, map[string]any{"ca": string(ca)})
-			if err != nil {
-				return nil, fmt.Errorf("run: %w", err)
+			a, err := r.safelyParseAssembly(ctx, result.Record())
+			if errors.Is(err, errSkippedAssembly) {
+				continue
+			} else if err != nil {
+				return fmt.Errorf("parse assembly: %w", err)
 			}
-			for result.Next(ctx) {
-				a, err := safelyParseAssembly(ctx, result.Record())
-				if err != nil {
-					return nil, fmt.Errorf("parse assembly: %w", err)
-				}
-
-				id := a.AssemblyID()
-				h, exists := seen[id]
-				// If it's the first time encountering this assembly, mark it.
-				if !exists {
-					seen[id] = a.AssemblyHash()
-					assemblies = append(assemblies, a)
-				}
-				// If the current assembly has been previously marked as seen, we check whether
-				// the stored hash matches the already seen hash.
-				//
-				// A mismatch indicates an inconsistency in the transaction's isolation, so we
-				// inevitably panic.
-				if exists && h != a.AssemblyHash() {
-					span.SetAttributes(
-						attribute.Stringer("assembly.id", id),
-						attribute.Stringer("assembly.hash", a.AssemblyHash()),
-						attribute.Stringer("seen.hash", h),
-					)
-					component.Logger(ctx).Error(
-						"An assembly was modified while in a read transaction, this should not happen",
-						slog.String("assembly.id", id.String()),
-						slog.String("assembly.hash", a.AssemblyHash().String()),
-						slog.String("assembly.seenHash", h.String()),
-					)
-					panic(fmt.Errorf("seek developer attention: a neo4j transaction isolation was violated"))
-				}
+			// The root was parsed above, so getting it again cannot fail.
+			root, _ := getRecordProperty[neo4j.Node](result.Record(), "root")
+			if !isKnown[root.ElementId] {
+				isKnown[root.ElementId] = true
+				known = append(known, root.ElementId)
+				frontier = append(frontier, root.ElementId)
 			}
-			// Neo4j's result cursor is exhausted by now. We check its Err method to get the
-			// error that caused the iteration to stop, if any.
-			if err := result.Err(); err != nil {
-				return nil, fmt.Errorf("iterate assembly: %w", err)
+
+			id := a.AssemblyID()
+			h, exists := seen[id]
+			// If it's the first time encountering this assembly, mark it.
+			if !exists {
+				seen[id] = a.AssemblyHash()
+				m.add(a)
+			}
+			// If the current assembly has been previously marked as seen, we check whether
+			// the stored hash matches the already seen hash.
+			//
+			// A mismatch indicates an inconsistency in the transaction's isolation, so we
+			// inevitably panic (unless configured WithCorruptionHandler). That is, unless
+			// the sweep does not exclude concurrent writes to begin with, in which case we
+			// keep the first read; the write tainted the assembly for the next sweep.
+			if exists && h != a.AssemblyHash() && r.relaxed {
+				component.Logger(ctx).Debug("An assembly was modified while in a relaxed read transaction",
+					slog.String("assembly.id", id.String()),
+				)
+			} else if exists && h != a.AssemblyHash() {
+				span.SetAttributes(
+					attribute.Stringer("assembly.id", id),
+					attribute.Stringer("assembly.hash", a.AssemblyHash()),
+					attribute.Stringer("seen.hash", h),
+				)
+				component.Logger(ctx).Error(
+					"An assembly was modified while in a read transaction, this should not happen",
+					slog.String("assembly.id", id.String()),
+					slog.String("assembly.hash", a.AssemblyHash().String()),
+					slog.String("assembly.seenHash", h.String()),
+				)
+				return corruptedGraph(ctx, r.onCorruption, "a neo4j transaction isolation was violated")
+			}
+		}
+		// Neo4j's result cursor is exhausted by now. We check its Err method to get the
+		// error that caused the iteration to stop, if any.
+		if err := result.Err(); err != nil {
+			return fmt.Errorf("iterate assembly: %w", err)
+		}
+		return nil
+	}
+
+	// We are only collecting assemblies containing nodes we have already tainted.
+	for _, taint := range taints {
+		// Every taint costs a round-trip, so we check for cancellation before each.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ca, err := taint.ContentAddress.MarshalText()
+		if err != nil {
+			return fmt.Errorf("marshal content address: %w", err)
+		}
+		key := r.nodeKey()
+		query := `
+			CALL{
+				// A tainted root is its own target, hence the paths of length 0.
+				MATCH (root)-[*0..]->(target:` + taint.Label + `{` + key.pattern("ca") + `})
+				WHERE NOT ()-->(root) // No incoming of any type to root
+				WITH root
+				MATCH (root)-[*0..5]->(path_node)-[]->(adjacent_path_node)
+				WITH root, COLLECT({from: path_node, to: adjacent_path_node}) AS tuples
+				RETURN root, tuples
+
+				UNION
+
+				MATCH (root:` + taint.Label + `{` + key.pattern("ca") + `})
+				WHERE NOT ()-->(root) AND NOT ()<--(root) AND root._deleted_at IS NULL
+				RETURN root, [{from: null, to: null}] AS tuples
 			}
+			return root, tuples
+		`
+		result, err := tx.Run(ctx, query, key.params(map[string]any{"ca": string(ca)}))
+		if err != nil {
+			return fmt.Errorf("run: %w", err)
+		}
+		if err := collect(result); err != nil {
+			return err
+		}
+	}
+
+	// Then, we are collecting the assemblies of the roots converging with those
+	// collected so far, until there are none left.
+	for len(frontier) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		params := r.nodeKey().params(map[string]any{"frontier": frontier, "known": known})
+		frontier = nil
+		result, err := tx.Run(ctx, convergingRootsQuery, params)
+		if err != nil {
+			return fmt.Errorf("run converging: %w", err)
+		}
+		if err := collect(result); err != nil {
+			return err
 		}
-		return nil, nil
 	}
 
-	// The work function above appends directly into the returned assemblies
-	// variable.
-	_, err = s.ExecuteRead(ctx, work)
+	assemblies, err := m.merge()
 	if err != nil {
-		return nil, fmt.Errorf("execute read: %w", err)
+		return fmt.Errorf("merge assemblies: %w", err)
 	}
-	return assemblies, nil
+	for _, a := range assemblies {
+		if err := visit(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Call fetchComponent to fetch (from Neo4j graph associated with the given
+// session) the assembly identified by the given component ID. It returns false
+// if the graph contains no such assembly.
+//
+// A component ID is a digest of the content-addresses of its roots, so it cannot
+// be looked up directly in the graph. Instead, we scan the content-addresses of
+// all roots (which is far cheaper than fetching every assembly) for one of the
+// component, and then sweep the component as if that root was tainted (see
+// visitPartialAssemblies). The given roots are those of the component if it has
+// several (see rootIndex), since its ID cannot be derived from any one of them.
+func (r graphReader) fetchComponent(ctx context.Context, s neo4j.SessionWithContext, id digitaltwin.ComponentID, roots []digitaltwin.NodeHash) (assembly digitaltwin.Assembly, found bool, err error) {
+	ctx, span := tracer.Start(ctx, "fetchComponent", trace.WithAttributes(
+		attribute.Stringer("component.id", id),
+	))
+	defer span.End()
+
+	work := func(tx neo4j.ManagedTransaction) (any, error) {
+		root, label, found, err := r.findRoot(ctx, tx, id, roots)
+		if err != nil || !found {
+			return nil, err
+		}
+		// The root may have diverged from the other roots of the component since it
+		// was indexed, in which case its component has another ID by now.
+		var assembly digitaltwin.Assembly
+		err = r.visitPartialAssemblies(ctx, tx, []RawNode{{Label: label, ContentAddress: root}}, func(a digitaltwin.Assembly) error {
+			if a.AssemblyID() == id {
+				assembly = a
+			}
+			return nil
+		})
+		if err != nil || assembly == nil {
+			return nil, err
+		}
+		return assembly, nil
+	}
+
+	v, err := s.ExecuteRead(ctx, work)
+	if err != nil {
+		return nil, false, fmt.Errorf("execute read: %w", classifyError(err))
+	}
+	if v == nil {
+		return nil, false, nil
+	}
+	return v.(digitaltwin.Assembly), true, nil
+}
+
+// The findRoot method scans the roots of all assemblies in the graph for the
+// one whose (single-root) assembly is identified by the given component ID, or
+// for any of the given roots of a multi-root component. It returns the
+// content-address and the registered label of that root.
+//
+// Roots without a valid content-address (e.g. created manually, behind the
+// Engine's back) cannot identify any component, so findRoot skips them rather
+// than failing the lookup of unrelated components.
+func (r graphReader) findRoot(ctx context.Context, tx neo4j.ManagedTransaction, id digitaltwin.ComponentID, roots []digitaltwin.NodeHash) (root digitaltwin.NodeHash, label string, found bool, err error) {
+	key := r.nodeKey()
+	query := `
+		MATCH (root) WHERE NOT ()-->(root) AND root._deleted_at IS NULL
+		AND ($tenant IS NULL OR root._tenant = $tenant)
+		AND root.` + cypherProperty(key.caProperty) + ` IS NOT NULL
+		RETURN root.` + cypherProperty(key.caProperty) + ` AS ca, labels(root) AS labels
+	`
+	result, err := tx.Run(ctx, query, key.params(map[string]any{}))
+	if err != nil {
+		return root, "", false, fmt.Errorf("run: %w", err)
+	}
+	for result.Next(ctx) {
+		ca, err := getRecordProperty[string](result.Record(), "ca")
+		if err != nil {
+			continue
+		}
+		if err := root.UnmarshalText([]byte(ca)); err != nil {
+			continue
+		}
+		if (digitaltwin.AssemblyGraph{Root: []digitaltwin.NodeHash{root}}).AssemblyID() != id && !slices.Contains(roots, root) {
+			continue
+		}
+
+		labels, err := getRecordProperty[[]any](result.Record(), "labels")
+		if err != nil {
+			return root, "", false, fmt.Errorf("get labels: %w", err)
+		}
+		names := make([]string, len(labels))
+		for i, l := range labels {
+			if names[i], _ = l.(string); names[i] == "" {
+				return root, "", false, fmt.Errorf("label #%v: %w", i, unexpectedPropertyTypeError{Type: reflect.TypeOf(l)})
+			}
+		}
+		label, err = globalNodeRegistry.LabelAmong(names)
+		if err != nil {
+			return root, "", false, fmt.Errorf("root %v: %w", root, err)
+		}
+		return root, label, true, nil
+	}
+	// Neo4j's result cursor is exhausted by now. We check its Err method to get the
+	// error that caused the iteration to stop, if any.
+	if err := result.Err(); err != nil {
+		return root, "", false, fmt.Errorf("iterate roots: %w", err)
+	}
+	return root, "", false, nil
 }
 
 // Computes the [digitaltwin.ComponentID] of an assembly containing only the given RawNode (as its root).
@@ -256,14 +852,95 @@ func componentID(taint RawNode) (id digitaltwin.ComponentID, err error) {
 	return b.Assemble().AssemblyID(), nil
 }
 
+// A graphReader reads the assemblies of the graph, configured by the Engine's
+// options (see Engine.graphReader), just like a graphWriter writes the graph.
+type graphReader struct {
+	parser nodeParser
+	// The tenant of every node the graphReader matches, see WithTenant; empty
+	// means nodes are not scoped to a tenant.
+	tenant string
+	// Whether to tolerate components modified while being read, see
+	// WithRelaxedReadConsistency.
+	relaxed bool
+	// Called when the graph is found corrupted, see WithCorruptionHandler; nil
+	// means the graphReader panics.
+	onCorruption func(ctx context.Context, reason string) error
+}
+
+// The nodeKey method returns the key by which the graphReader matches nodes.
+func (r graphReader) nodeKey() nodeKey {
+	return nodeKey{caProperty: r.parser.contentAddressProperty(), tenant: r.tenant}
+}
+
+// A nodeParser parses RawNodes with the global node registry, optionally
+// verifying their content-addresses (see ParseNode), and optionally memoising
+// them in a parseCache.
+type nodeParser struct {
+	verify bool
+	cache  *parseCache // Nil means nodes are parsed every time.
+	// Called with every malformed node the parser skips; nil means malformed nodes
+	// fail their assemblies instead.
+	onMalformed func(node neo4j.Node, err error)
+	maxNodes    int    // Non-positive means assemblies of any size are parsed.
+	caProperty  string // Empty means DefaultContentAddressProperty.
+}
+
+// The contentAddressProperty method returns the name of the property holding the
+// content-address of the nodes the parser parses.
+func (p nodeParser) contentAddressProperty() string {
+	if p.caProperty == "" {
+		return DefaultContentAddressProperty
+	}
+	return p.caProperty
+}
+
+// The skipMalformedNodes function returns a callback for nodeParser.onMalformed
+// that logs and counts every malformed node the parser skips in the given
+// database, see WithSkipMalformedNodes.
+func skipMalformedNodes(ctx context.Context, database string) func(node neo4j.Node, err error) {
+	return func(node neo4j.Node, err error) {
+		component.Logger(ctx).Warn("Skipped a malformed node", "error", err, "neo4j.element_id", node.ElementId)
+		malformedNodeCounter.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("neo4j.database", database),
+		))
+	}
+}
+
+// The skip method reports whether the parser skips the given node, which failed
+// to parse with the given error. It only skips malformed nodes (see
+// errMalformedNode), and only when configured to (see WithSkipMalformedNodes).
+func (p nodeParser) skip(node neo4j.Node, err error) bool {
+	if p.onMalformed == nil || !errors.Is(err, errMalformedNode) {
+		return false
+	}
+	p.onMalformed(node, err)
+	return true
+}
+
+// The parse method parses the given RawNode, or returns the value it has parsed
+// before for a node of the same label and content-address. As nodes are
+// immutable by their content-address, a memoised value never goes stale.
+func (p nodeParser) parse(raw RawNode) (digitaltwin.Value, error) {
+	key := parseKey{label: raw.Label, ca: raw.ContentAddress}
+	if v, ok := p.cache.get(key); ok {
+		return v, nil
+	}
+	v, err := globalNodeRegistry.parseNode(raw, p.verify)
+	if err != nil {
+		return nil, err
+	}
+	p.cache.add(key, v)
+	return v, nil
+}
+
 // Call this function to parse a record representing an assembly (as constructed
 // the Cypher query defined by fetchAssemblies) with a possible panic due to
 // developer errors.
 //
 // Developer errors happen when a developer had changed some code that depends on
 // the specifics of the Cypher query, but missed some bits.
-func safelyParseAssembly(ctx context.Context, record *neo4j.Record) (assembly digitaltwin.Assembly, err error) {
-	assembly, err = parseAssembly(record)
+func (r graphReader) safelyParseAssembly(ctx context.Context, record *neo4j.Record) (assembly digitaltwin.Assembly, err error) {
+	assembly, err = parseAssemblyRecord(record, r.parser)
 	if errors.Is(err, errPropertyNotFound) || errors.As(err, &unexpectedPropertyTypeError{}) {
 		component.Logger(ctx).Error("A Cypher query was modified without care", "error", err)
 		panic(fmt.Errorf("seek developer attention: neo4j cypher query: %w", err))
@@ -271,22 +948,65 @@ func safelyParseAssembly(ctx context.Context, record *neo4j.Record) (assembly di
 	return
 }
 
-// Call safelyParseAssembly instead of calling this function directly. Following
-// this directive ensures the same developer errors are panicked regardless of
-// the code-path that encounters them.
-func parseAssembly(record *neo4j.Record) (digitaltwin.Assembly, error) {
+// ParseAssemblyRecord parses a record of a Cypher query into an Assembly, such
+// that its AssemblyID and AssemblyHash are consistent with those of the
+// assemblies reported by the Engine. This enables advanced users to run their
+// own Cypher queries and still reconstruct proper assemblies.
+//
+// The record must have the same shape as the records returned by the engine's
+// own queries:
+//
+//   - A "root" property holding the root node of the assembly.
+//
+//   - A "tuples" property holding a list of maps, each with a "from" and a "to"
+//     node describing a single edge of the assembly. A root without any edges is
+//     described by a single tuple whose "from" and "to" are both null.
+//
+// For example:
+//
+//	MATCH (root) WHERE NOT ()-->(root)
+//	MATCH (root)-[*0..5]->(from)-->(to)
+//	RETURN root, COLLECT({from: from, to: to}) AS tuples
+//
+// Every node must be labelled with a registered label (see Register), and must
+// carry its content-address.
+//
+// Within this package, call safelyParseAssembly instead of calling this function
+// directly. Following this directive ensures the same developer errors are
+// panicked regardless of the code-path that encounters them.
+func ParseAssemblyRecord(record *neo4j.Record) (digitaltwin.Assembly, error) {
+	return parseAssemblyRecord(record, nodeParser{verify: true})
+}
+
+// The parseAssemblyRecord function implements ParseAssemblyRecord, parsing every
+// node with the given nodeParser.
+func parseAssemblyRecord(record *neo4j.Record, p nodeParser) (digitaltwin.Assembly, error) {
 	r, err := getRecordProperty[neo4j.Node](record, "root")
 	if err != nil {
 		return nil, fmt.Errorf("get root: %w", err)
 	}
-	root, err := parseNeo4jNode(r)
-	if err != nil {
+	root, err := parseNeo4jNode(r, p)
+	if p.skip(r, err) {
+		// Without its root, the rest of the assembly is unreachable anyway.
+		return nil, errSkippedAssembly
+	} else if err != nil {
 		return nil, fmt.Errorf("root: %w", err)
 	}
 
 	var builder digitaltwin.AssemblyBuilder
 	builder.Roots(root)
-	if err := parseNeighbours(record, &builder); err != nil {
+	if p.maxNodes > 0 {
+		// We count the nodes before parsing them, so a component too large is never
+		// materialised. Its ID depends on its root alone.
+		n, err := countNodes(record, r, p.contentAddressProperty())
+		if err != nil {
+			return nil, fmt.Errorf("count nodes: %w", err)
+		}
+		if n > p.maxNodes {
+			return nil, ComponentTooLargeError{ID: builder.Assemble().AssemblyID(), Nodes: n, Limit: p.maxNodes}
+		}
+	}
+	if err := parseNeighbours(record, &builder, p); err != nil {
 		return nil, fmt.Errorf("parse neighbours: %w", err)
 	}
 	return builder.Assemble(), nil
@@ -294,24 +1014,72 @@ func parseAssembly(record *neo4j.Record) (digitaltwin.Assembly, error) {
 
 // This function is here to make parsing neo4j.Node into digitaltwin.Value more
 // readable at the call-site.
-func parseNeo4jNode(node neo4j.Node) (digitaltwin.Value, error) {
-	raw, err := newRawNode(node)
+func parseNeo4jNode(node neo4j.Node, p nodeParser) (digitaltwin.Value, error) {
+	raw, err := newRawNodeWithProperty(node, p.contentAddressProperty())
 	if err != nil {
 		return nil, fmt.Errorf("construct raw node: %w", err)
 	}
-	v, err := ParseNode(raw)
+	v, err := p.parse(raw)
 	if err != nil {
 		return nil, fmt.Errorf("parse raw node: %w", err)
 	}
 	return v, nil
 }
 
-func parseNeighbours(record *neo4j.Record, builder *digitaltwin.AssemblyBuilder) error {
+// The countNodes function returns the number of distinct nodes of the assembly
+// described by the given record (see ParseAssemblyRecord for its shape), whose
+// root is the given node, without parsing any of them. Nodes are identified by
+// the given property holding their content-addresses.
+func countNodes(record *neo4j.Record, root neo4j.Node, caProperty string) (int, error) {
+	tuples, err := getRecordProperty[[]any](record, "tuples")
+	if err != nil {
+		return 0, fmt.Errorf("get tuples: %w", err)
+	}
+	seen := map[any]struct{}{nodeIdentity(root, caProperty): {}}
+	for _, tuple := range tuples {
+		edge, _ := tuple.(map[string]any)
+		for _, end := range []string{"from", "to"} {
+			if n, ok := edge[end].(neo4j.Node); ok {
+				seen[nodeIdentity(n, caProperty)] = struct{}{}
+			}
+		}
+	}
+	return len(seen), nil
+}
+
+// The nodeIdentity function returns a comparable identity of the given node
+// without parsing it: its content-address (held by the given property), as
+// parsing would identify it. Nodes lacking one (see errMalformedNode) are
+// identified by their element ID instead.
+func nodeIdentity(n neo4j.Node, caProperty string) any {
+	if ca, ok := n.Props[caProperty]; ok {
+		return ca
+	}
+	return n.ElementId
+}
+
+// ParseNeighbours parses the "tuples" property of a record (see
+// ParseAssemblyRecord for its shape), connecting the source and target nodes of
+// every tuple in the given builder.
+func ParseNeighbours(record *neo4j.Record, builder *digitaltwin.AssemblyBuilder) error {
+	return parseNeighbours(record, builder, nodeParser{verify: true})
+}
+
+// The parseNeighbours function implements ParseNeighbours, parsing every node
+// with the given nodeParser.
+//
+// When the parser skips a malformed node (see WithSkipMalformedNodes), the edges
+// to and from it are skipped too, so the nodes beyond it may no longer be
+// reachable from the root. Those are skipped as well, rather than left in the
+// assembly disconnected from its root.
+func parseNeighbours(record *neo4j.Record, builder *digitaltwin.AssemblyBuilder, p nodeParser) error {
 	tuples, err := getRecordProperty[[]any](record, "tuples")
 	if err != nil {
 		return fmt.Errorf("get tuples :%w", err)
 	}
 
+	neighbours := make([]neighbour, 0, len(tuples))
+	var skipped bool
 	for i, tuple := range tuples {
 		edge, ok := tuple.(map[string]any)
 		if !ok {
@@ -321,54 +1089,104 @@ func parseNeighbours(record *neo4j.Record, builder *digitaltwin.AssemblyBuilder)
 		// list as a single entry containing an edge [from: null, to: null]. This
 		// signifies that the node is an isolated root. The following check ensures we
 		// only process valid edges by skipping such standalone nodes as they already
-		// build on parseAssembly.
+		// build on ParseAssemblyRecord.
 		if edge["from"] == nil && edge["to"] == nil {
 			continue
 		}
 
-		err := parseNeighbour(edge, builder)
+		n, ok, err := parseNeighbour(edge, p)
 		if err != nil {
 			return fmt.Errorf("neighbour #%v: %w", i, err)
 		}
+		if !ok {
+			skipped = true
+			continue
+		}
+		neighbours = append(neighbours, n)
 	}
 
+	if skipped {
+		root, err := getRecordProperty[neo4j.Node](record, "root")
+		if err != nil {
+			return fmt.Errorf("get root: %w", err)
+		}
+		neighbours = reachableNeighbours(nodeIdentity(root, p.contentAddressProperty()), neighbours)
+	}
+	for _, n := range neighbours {
+		builder.Connect(n.source, n.target)
+	}
 	return nil
 }
 
+// A neighbour is a single edge of an assembly, parsed from a "tuple" of a record.
+type neighbour struct {
+	from, to       any // See nodeIdentity.
+	source, target digitaltwin.Value
+}
+
+// The reachableNeighbours function returns the neighbours reachable from the
+// node of the given identity (see nodeIdentity), following the direction of
+// their edges.
+func reachableNeighbours(root any, neighbours []neighbour) []neighbour {
+	outgoing := make(map[any][]neighbour)
+	for _, n := range neighbours {
+		outgoing[n.from] = append(outgoing[n.from], n)
+	}
+	var reachable []neighbour
+	visited := map[any]bool{root: true}
+	queue := []any{root}
+	for len(queue) > 0 {
+		from := queue[0]
+		queue = queue[1:]
+		for _, n := range outgoing[from] {
+			reachable = append(reachable, n)
+			if !visited[n.to] {
+				visited[n.to] = true
+				queue = append(queue, n.to)
+			}
+		}
+	}
+	return reachable
+}
+
 // Call parseNeighbour with a single "tuple" from the "tuples" slice, as
-// collected by the Cypher query defined at fetchAssemblies.
-func parseNeighbour(edge map[string]any, builder *digitaltwin.AssemblyBuilder) error {
+// collected by the Cypher query defined at fetchAssemblies. It reports false if
+// the parser skipped either node of the edge.
+func parseNeighbour(edge map[string]any, p nodeParser) (n neighbour, ok bool, err error) {
 	// Construct the source node of the edge.
 	from, ok := edge["from"]
 	if !ok {
-		return fmt.Errorf("get from: %w", errPropertyNotFound)
+		return n, false, fmt.Errorf("get from: %w", errPropertyNotFound)
 	}
 	fromNode, ok := from.(neo4j.Node)
 	if !ok {
-		return fmt.Errorf("get from: %w", unexpectedPropertyTypeError{Type: reflect.TypeOf(from)})
+		return n, false, fmt.Errorf("get from: %w", unexpectedPropertyTypeError{Type: reflect.TypeOf(from)})
 	}
-	source, err := parseNeo4jNode(fromNode)
-	if err != nil {
-		return fmt.Errorf("source node: %w", err)
+	source, err := parseNeo4jNode(fromNode, p)
+	if p.skip(fromNode, err) {
+		return n, false, nil // Skipping a node skips its edges too.
+	} else if err != nil {
+		return n, false, fmt.Errorf("source node: %w", err)
 	}
 
 	// Construct the target node of the edge.
 	to, ok := edge["to"]
 	if !ok {
-		return fmt.Errorf("get to: %w", errPropertyNotFound)
+		return n, false, fmt.Errorf("get to: %w", errPropertyNotFound)
 	}
 	toNode, ok := to.(neo4j.Node)
 	if !ok {
-		return fmt.Errorf("get to: %w", unexpectedPropertyTypeError{Type: reflect.TypeOf(to)})
+		return n, false, fmt.Errorf("get to: %w", unexpectedPropertyTypeError{Type: reflect.TypeOf(to)})
 	}
-	target, err := parseNeo4jNode(toNode)
-	if err != nil {
-		return fmt.Errorf("target node: %w", err)
+	target, err := parseNeo4jNode(toNode, p)
+	if p.skip(toNode, err) {
+		return n, false, nil // Skipping a node skips its edges too.
+	} else if err != nil {
+		return n, false, fmt.Errorf("target node: %w", err)
 	}
 
-	// Connect the two nodes of the edge.
-	builder.Connect(source, target)
-	return nil
+	caProperty := p.contentAddressProperty()
+	return neighbour{from: nodeIdentity(fromNode, caProperty), to: nodeIdentity(toNode, caProperty), source: source, target: target}, true, nil
 }
 
 // Diff calculates the difference between two snapshots, each containing the
@@ -399,6 +1217,40 @@ func (s snapshot) Diff(newer snapshot) (created, updated, removed []digitaltwin.
 	return created, updated, removed
 }
 
+// CompareDatabases captures the snapshots of two databases (of the same
+// server/cluster) and compares them, e.g. to verify that a blue/green migration
+// populated the new database faithfully. It returns the IDs of the components
+// found only in dbA, those found only in dbB, and those found in both but with
+// different hashes, each sorted.
+//
+// Each snapshot is captured in a single read transaction, but the two are
+// captured one after the other, so concurrent writes to either database show up
+// as differences; compare databases that are not written to.
+func CompareDatabases(ctx context.Context, driver neo4j.DriverWithContext, dbA, dbB string) (onlyA, onlyB, differ []digitaltwin.ComponentID, err error) {
+	ctx, span := tracer.Start(ctx, "CompareDatabases", trace.WithAttributes(
+		attribute.String("neo4j.database.a", dbA),
+		attribute.String("neo4j.database.b", dbB),
+	))
+	defer func() { endSpan(span, err) }()
+
+	// Neither database belongs to an Engine, so we read them as configured by default.
+	r := graphReader{parser: nodeParser{verify: true}}
+	snapshots := make([]snapshot, 2)
+	for i, database := range []string{dbA, dbB} {
+		config := neo4j.SessionConfig{DatabaseName: database, AccessMode: neo4j.AccessModeRead}
+		snapshots[i], _, err = r.captureSnapshot(ctx, driver, config, 0)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("capture snapshot of %q: %w", database, err)
+		}
+	}
+
+	onlyB, differ, onlyA = snapshots[0].Diff(snapshots[1])
+	for _, ids := range [][]digitaltwin.ComponentID{onlyA, onlyB, differ} {
+		slices.SortFunc(ids, digitaltwin.ComponentID.Compare)
+	}
+	return onlyA, onlyB, differ, nil
+}
+
 // PartialDiff calculate the difference between this full snapshot (containing
 // all disjoint graph components of a digital-twin graph) and a partial snapshot
 // containing some disjoint graph components.
@@ -418,7 +1270,8 @@ func (s snapshot) Diff(newer snapshot) (created, updated, removed []digitaltwin.
 // action.
 //
 // Hint, consider every dirtyRoot component to be a component build of a single
-// node that was tainted before calling this function.
+// node that was tainted (or whose component was swept) before calling this
+// function, or a multi-root component such a node was part of (see rootIndex).
 func (s snapshot) PartialDiff(partial snapshot, dirtyRoots []digitaltwin.ComponentID) (created, updated, removed []digitaltwin.ComponentID) {
 	// Assemblies that appear in the newer snapshot could be created, updated, or
 	// unchanged.
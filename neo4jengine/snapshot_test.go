@@ -0,0 +1,678 @@
+package neo4jengine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-digitaltwin/go-digitaltwin"
+	"github.com/go-digitaltwin/go-digitaltwin/enginetest"
+	"github.com/go-digitaltwin/go-digitaltwin/internal/dbtest"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestParseAssemblyRecord(t *testing.T) {
+	a, b, c := enginetest.NodeA{}, enginetest.NodeB{}, enginetest.NodeC{}
+
+	tests := []struct {
+		name   string
+		record *neo4j.Record
+		want   func(*digitaltwin.AssemblyBuilder)
+	}{
+		{
+			name: "Tree",
+			record: &neo4j.Record{
+				Keys: []string{"root", "tuples"},
+				Values: []any{
+					recordNode(t, a),
+					[]any{
+						map[string]any{"from": recordNode(t, a), "to": recordNode(t, b)},
+						map[string]any{"from": recordNode(t, a), "to": recordNode(t, c)},
+						map[string]any{"from": recordNode(t, b), "to": recordNode(t, c)},
+					},
+				},
+			},
+			want: func(builder *digitaltwin.AssemblyBuilder) {
+				builder.Roots(a)
+				builder.Connect(a, b)
+				builder.Connect(a, c)
+				builder.Connect(b, c)
+			},
+		},
+		{
+			name: "FloatingNode",
+			record: &neo4j.Record{
+				Keys:   []string{"root", "tuples"},
+				Values: []any{recordNode(t, a), []any{map[string]any{"from": nil, "to": nil}}},
+			},
+			want: func(builder *digitaltwin.AssemblyBuilder) {
+				builder.Roots(a)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAssemblyRecord(tt.record)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var builder digitaltwin.AssemblyBuilder
+			tt.want(&builder)
+			want := builder.Assemble()
+			if got.AssemblyID() != want.AssemblyID() {
+				t.Errorf("AssemblyID() = %v, want %v", got.AssemblyID(), want.AssemblyID())
+			}
+			if got.AssemblyHash() != want.AssemblyHash() {
+				t.Errorf("AssemblyHash() = %v, want %v", got.AssemblyHash(), want.AssemblyHash())
+			}
+		})
+	}
+}
+
+func TestParseAssemblyRecord_malformed(t *testing.T) {
+	record := &neo4j.Record{Keys: []string{"root"}, Values: []any{recordNode(t, enginetest.NodeA{})}}
+	if _, err := ParseAssemblyRecord(record); !errors.Is(err, errPropertyNotFound) {
+		t.Errorf("ParseAssemblyRecord() error = %v, want %v", err, errPropertyNotFound)
+	}
+}
+
+func TestSafelyParseAssembly_withoutContentAddressVerification(t *testing.T) {
+	// We store node A under the content-address of node B, as if node A were
+	// modified behind the engine's back.
+	tampered := recordNode(t, enginetest.NodeA{})
+	tampered.Props["_contentAddress"] = recordNode(t, enginetest.NodeB{}).Props["_contentAddress"]
+	record := &neo4j.Record{
+		Keys:   []string{"root", "tuples"},
+		Values: []any{tampered, []any{map[string]any{"from": nil, "to": nil}}},
+	}
+
+	ctx := context.Background()
+	r := graphReader{parser: nodeParser{verify: true}}
+	if _, err := r.safelyParseAssembly(ctx, record); err == nil {
+		t.Errorf("safelyParseAssembly() of a tampered node = nil; want error")
+	}
+	r.parser.verify = false
+	if _, err := r.safelyParseAssembly(ctx, record); err != nil {
+		t.Errorf("safelyParseAssembly() without verification error = %v", err)
+	}
+}
+
+func TestSafelyParseAssembly_skipMalformedNodes(t *testing.T) {
+	skipped := countMalformedNodes(t)
+	a, b, c, d := enginetest.NodeA{}, enginetest.NodeB{}, enginetest.NodeC{}, enginetest.NodeD{}
+	// A node created behind the engine's back, without its metadata.
+	malformed := neo4j.Node{ElementId: "malformed", Labels: []string{"NodeC"}}
+
+	tests := []struct {
+		name   string
+		record *neo4j.Record
+		want   digitaltwin.Assembly // Nil means the entire assembly is skipped.
+		// The number of times the malformed node is skipped, once per edge.
+		skipped int64
+	}{
+		{
+			name: "Neighbour",
+			record: &neo4j.Record{
+				Keys: []string{"root", "tuples"},
+				Values: []any{recordNode(t, a), []any{
+					map[string]any{"from": recordNode(t, a), "to": recordNode(t, b)},
+					map[string]any{"from": recordNode(t, b), "to": malformed},
+				}},
+			},
+			want: func() digitaltwin.Assembly {
+				var builder digitaltwin.AssemblyBuilder
+				builder.Roots(a)
+				builder.Connect(a, b)
+				return builder.Assemble()
+			}(),
+			skipped: 1,
+		},
+		{
+			// The malformed node is in the middle of a path, so the nodes beyond it are
+			// no longer reachable from the root, and are skipped with it.
+			name: "Middle",
+			record: &neo4j.Record{
+				Keys: []string{"root", "tuples"},
+				Values: []any{recordNode(t, a), []any{
+					map[string]any{"from": recordNode(t, a), "to": recordNode(t, b)},
+					map[string]any{"from": recordNode(t, a), "to": malformed},
+					map[string]any{"from": malformed, "to": recordNode(t, c)},
+					map[string]any{"from": recordNode(t, c), "to": recordNode(t, d)},
+				}},
+			},
+			want: func() digitaltwin.Assembly {
+				var builder digitaltwin.AssemblyBuilder
+				builder.Roots(a)
+				builder.Connect(a, b)
+				return builder.Assemble()
+			}(),
+			skipped: 2,
+		},
+		{
+			name: "Root",
+			record: &neo4j.Record{
+				Keys:   []string{"root", "tuples"},
+				Values: []any{malformed, []any{map[string]any{"from": nil, "to": nil}}},
+			},
+			want:    nil,
+			skipped: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			r := graphReader{parser: nodeParser{verify: true}}
+			if _, err := r.safelyParseAssembly(ctx, tt.record); !errors.Is(err, errMalformedNode) {
+				t.Errorf("safelyParseAssembly() error = %v, want %v", err, errMalformedNode)
+			}
+
+			before := skipped()
+			r.parser.onMalformed = skipMalformedNodes(ctx, "neo4j")
+			got, err := r.safelyParseAssembly(ctx, tt.record)
+			if tt.want == nil {
+				if !errors.Is(err, errSkippedAssembly) {
+					t.Errorf("safelyParseAssembly() skipping error = %v, want %v", err, errSkippedAssembly)
+				}
+			} else if err != nil {
+				t.Errorf("safelyParseAssembly() skipping error = %v", err)
+			} else if got.AssemblyHash() != tt.want.AssemblyHash() {
+				t.Errorf("AssemblyHash() = %v, want %v", got.AssemblyHash(), tt.want.AssemblyHash())
+			}
+			if n := skipped() - before; n != tt.skipped {
+				t.Errorf("skipped %d malformed nodes, want %d", n, tt.skipped)
+			}
+		})
+	}
+}
+
+func TestSafelyParseAssembly_maxComponentNodes(t *testing.T) {
+	root := enginetest.NodeN{N: 0}
+	// A star whose root connects to 4 leaves, one of which twice over: 5 nodes.
+	tuples := []any{
+		map[string]any{"from": recordNode(t, root), "to": recordNode(t, enginetest.NodeN{N: 1})},
+		map[string]any{"from": recordNode(t, root), "to": recordNode(t, enginetest.NodeN{N: 2})},
+		map[string]any{"from": recordNode(t, root), "to": recordNode(t, enginetest.NodeN{N: 3})},
+		map[string]any{"from": recordNode(t, enginetest.NodeN{N: 3}), "to": recordNode(t, enginetest.NodeN{N: 4})},
+		map[string]any{"from": recordNode(t, root), "to": recordNode(t, enginetest.NodeN{N: 4})},
+	}
+	record := &neo4j.Record{Keys: []string{"root", "tuples"}, Values: []any{recordNode(t, root), tuples}}
+
+	ctx := context.Background()
+	for _, limit := range []int{0, 5, 6} {
+		r := graphReader{parser: nodeParser{verify: true, maxNodes: limit}}
+		if _, err := r.safelyParseAssembly(ctx, record); err != nil {
+			t.Errorf("safelyParseAssembly() with limit %d error = %v", limit, err)
+		}
+	}
+
+	_, err := graphReader{parser: nodeParser{verify: true, maxNodes: 4}}.safelyParseAssembly(ctx, record)
+	var got ComponentTooLargeError
+	if !errors.As(err, &got) {
+		t.Fatalf("safelyParseAssembly() with limit 4 error = %v, want %T", err, got)
+	}
+	var b digitaltwin.AssemblyBuilder
+	b.Roots(root)
+	want := ComponentTooLargeError{ID: b.Assemble().AssemblyID(), Nodes: 5, Limit: 4}
+	if got != want {
+		t.Errorf("safelyParseAssembly() error = %+v, want %+v", got, want)
+	}
+	if !errors.Is(err, ErrComponentTooLarge) {
+		t.Errorf("safelyParseAssembly() error = %v, want %v", err, ErrComponentTooLarge)
+	}
+}
+
+// The countMalformedNodes function swaps malformedNodeCounter for one that
+// records its measurements for the duration of the test, and returns a function
+// that sums them.
+func countMalformedNodes(t *testing.T) func() int64 {
+	t.Helper()
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	counter, err := provider.Meter(t.Name()).Int64Counter("snapshot_malformed_node_counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := malformedNodeCounter
+	malformedNodeCounter = counter
+	t.Cleanup(func() { malformedNodeCounter = original })
+
+	return func() (n int64) {
+		var rm metricdata.ResourceMetrics
+		if err := reader.Collect(context.Background(), &rm); err != nil {
+			t.Fatal(err)
+		}
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				if sum, ok := m.Data.(metricdata.Sum[int64]); ok {
+					for _, dp := range sum.DataPoints {
+						n += dp.Value
+					}
+				}
+			}
+		}
+		return n
+	}
+}
+
+// The recordNode function returns the neo4j.Node representing the given value,
+// as returned by the engine's Cypher queries.
+func recordNode(t *testing.T, v digitaltwin.Value) neo4j.Node {
+	t.Helper()
+	raw, err := FormatNode(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := raw.ContentAddress.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	props := map[string]any{"_contentAddress": string(ca)}
+	for key, value := range raw.Props {
+		props[key] = value
+	}
+	return neo4j.Node{Labels: []string{raw.Label}, Props: props}
+}
+
+func TestCaptureSnapshotBatchesTx(t *testing.T) {
+	type numberedNode struct {
+		digitaltwin.InformationElement
+		N int
+	}
+	registerTestLabel(t, numberedNode{})
+
+	// Every odd root has a child, while every even root is isolated.
+	var records []*neo4j.Record
+	for i := range 25 {
+		root := numberedNode{N: i}
+		tuples := []any{map[string]any{"from": nil, "to": nil}}
+		if i%2 == 1 {
+			tuples = []any{map[string]any{"from": recordNode(t, root), "to": recordNode(t, numberedNode{N: 100 + i})}}
+		}
+		records = append(records, &neo4j.Record{
+			Keys:   []string{"root", "tuples"},
+			Values: []any{recordNode(t, root), tuples},
+		})
+	}
+	ctx := context.Background()
+	r := graphReader{parser: nodeParser{verify: true}}
+	want, _, err := r.captureSnapshotTx(ctx, &fakeTx{records: records})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want) != len(records) {
+		t.Fatalf("captureSnapshotTx() captured %d components, want %d", len(want), len(records))
+	}
+
+	tests := []struct {
+		batchSize int
+		wantRuns  int
+	}{
+		{batchSize: 1, wantRuns: 26},
+		{batchSize: 7, wantRuns: 4},
+		{batchSize: 25, wantRuns: 2},
+		{batchSize: 100, wantRuns: 1},
+	}
+	for _, tt := range tests {
+		tx := &fakeTx{records: records}
+		got, _, err := r.captureSnapshotBatchesTx(ctx, tx, tt.batchSize)
+		if err != nil {
+			t.Fatalf("captureSnapshotBatchesTx(%d): %v", tt.batchSize, err)
+		}
+		if !maps.Equal(got, want) {
+			t.Errorf("captureSnapshotBatchesTx(%d) = %v, want %v", tt.batchSize, got, want)
+		}
+		if tx.runs != tt.wantRuns {
+			t.Errorf("captureSnapshotBatchesTx(%d) ran %d queries, want %d", tt.batchSize, tx.runs, tt.wantRuns)
+		}
+	}
+}
+
+// A malformed root takes up its place in a batch, even though its assembly is
+// skipped, so the roots of the later batches are still captured.
+func TestCaptureSnapshotBatchesTx_skipMalformedNodes(t *testing.T) {
+	countMalformedNodes(t)
+	// A node created behind the engine's back, without its metadata.
+	malformed := neo4j.Node{ElementId: "malformed", Labels: []string{"NodeN"}}
+	isolated := []any{map[string]any{"from": nil, "to": nil}}
+
+	records := []*neo4j.Record{{Keys: []string{"root", "tuples"}, Values: []any{malformed, isolated}}}
+	for i := range 5 {
+		records = append(records, &neo4j.Record{
+			Keys:   []string{"root", "tuples"},
+			Values: []any{recordNode(t, enginetest.NodeN{N: i}), isolated},
+		})
+	}
+	ctx := context.Background()
+	r := graphReader{parser: nodeParser{verify: true, onMalformed: skipMalformedNodes(ctx, "neo4j")}}
+	want, _, err := r.captureSnapshotTx(ctx, &fakeTx{records: records})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want) != len(records)-1 {
+		t.Fatalf("captureSnapshotTx() captured %d components, want %d", len(want), len(records)-1)
+	}
+
+	for _, batchSize := range []int{1, 2, 3} {
+		got, _, err := r.captureSnapshotBatchesTx(ctx, &fakeTx{records: records}, batchSize)
+		if err != nil {
+			t.Fatalf("captureSnapshotBatchesTx(%d): %v", batchSize, err)
+		}
+		if !maps.Equal(got, want) {
+			t.Errorf("captureSnapshotBatchesTx(%d) = %v, want %v", batchSize, got, want)
+		}
+	}
+}
+
+// Roots converging on a shared node are swept as a single component of both
+// roots, however the records of their assemblies are fetched.
+func TestSweep_convergingRoots(t *testing.T) {
+	a, b, c, d := enginetest.NodeA{}, enginetest.NodeB{}, enginetest.NodeC{}, enginetest.NodeD{}
+	isolated := []any{map[string]any{"from": nil, "to": nil}}
+	records := []*neo4j.Record{
+		{Keys: []string{"root", "tuples"}, Values: []any{recordNode(t, b), []any{map[string]any{"from": recordNode(t, b), "to": recordNode(t, d)}}}},
+		{Keys: []string{"root", "tuples"}, Values: []any{recordNode(t, a), isolated}},
+		{Keys: []string{"root", "tuples"}, Values: []any{recordNode(t, c), []any{map[string]any{"from": recordNode(t, c), "to": recordNode(t, d)}}}},
+	}
+	var builder digitaltwin.AssemblyBuilder
+	builder.Roots(b, c)
+	builder.Connect(b, d)
+	builder.Connect(c, d)
+	converging := builder.Assemble()
+	builder.Reset()
+	builder.Roots(a)
+	want := []digitaltwin.Assembly{converging, builder.Assemble()}
+
+	ctx := context.Background()
+	r := graphReader{parser: nodeParser{verify: true}}
+	taint, err := FormatNode(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sweeps := map[string]func(tx neo4j.ManagedTransaction, visit func(digitaltwin.Assembly) error) error{
+		"visitAllAssemblies": func(tx neo4j.ManagedTransaction, visit func(digitaltwin.Assembly) error) error {
+			return r.visitAllAssemblies(ctx, tx, visit)
+		},
+		"visitPartialAssemblies": func(tx neo4j.ManagedTransaction, visit func(digitaltwin.Assembly) error) error {
+			return r.visitPartialAssemblies(ctx, tx, []RawNode{taint}, visit)
+		},
+	}
+	for name, sweep := range sweeps {
+		var got []digitaltwin.Assembly
+		err := sweep(&fakeTx{records: records}, func(a digitaltwin.Assembly) error {
+			got = append(got, a)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !slices.EqualFunc(got, want, digitaltwin.EqualAssemblies) {
+			t.Errorf("%s visited %v, want %v", name, got, want)
+		}
+	}
+
+	s, roots, err := r.captureSnapshotTx(ctx, &fakeTx{records: records})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wantSnapshot := (snapshot{want[0].AssemblyID(): want[0].AssemblyHash(), want[1].AssemblyID(): want[1].AssemblyHash()}); !maps.Equal(s, wantSnapshot) {
+		t.Errorf("captureSnapshotTx() = %v, want %v", s, wantSnapshot)
+	}
+	if wantRoots := (rootIndex{digitaltwin.MustContentAddress(b): converging.AssemblyID(), digitaltwin.MustContentAddress(c): converging.AssemblyID()}); !maps.Equal(roots, wantRoots) {
+		t.Errorf("captureSnapshotTx() indexed %v, want %v", roots, wantRoots)
+	}
+	// The roots of the converging component are fetched in different batches.
+	batched, batchedRoots, err := r.captureSnapshotBatchesTx(ctx, &fakeTx{records: records}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !maps.Equal(batched, s) || !maps.Equal(batchedRoots, roots) {
+		t.Errorf("captureSnapshotBatchesTx(1) = %v, %v; want %v, %v", batched, batchedRoots, s, roots)
+	}
+
+	// Once the shared node is detached, the index forgets the removed component.
+	roots.Update(digitaltwin.GraphChanged{
+		Created: []digitaltwin.AssemblyCreated{{Assembly: want[1]}},
+		Removed: []digitaltwin.AssemblyRemoved{{ID: converging.AssemblyID(), Hash: converging.AssemblyHash()}},
+	})
+	if len(roots) != 0 {
+		t.Errorf("rootIndex.Update() left %v, want an empty index", roots)
+	}
+}
+
+// A fakeTx is a neo4j.ManagedTransaction that answers every query with the
+// given records, paged by the "skip" and "limit" parameters when present. If a
+// result is given, it answers every query with that result instead.
+type fakeTx struct {
+	neo4j.ManagedTransaction // Panics if the code under test calls anything else.
+	records                  []*neo4j.Record
+	result                   neo4j.ResultWithContext
+	runs                     int
+}
+
+func (tx *fakeTx) Run(_ context.Context, _ string, params map[string]any) (neo4j.ResultWithContext, error) {
+	tx.runs++
+	if tx.result != nil {
+		return tx.result, nil
+	}
+	records := tx.records
+	if skip, ok := params["skip"].(int); ok {
+		records = records[min(skip, len(records)):]
+	}
+	if limit, ok := params["limit"].(int); ok {
+		records = records[:min(limit, len(records))]
+	}
+	return &fakeResult{records: records}, nil
+}
+
+// A fakeResult is a neo4j.ResultWithContext that iterates over the given records.
+type fakeResult struct {
+	neo4j.ResultWithContext // Panics if the code under test calls anything else.
+	records                 []*neo4j.Record
+	current                 *neo4j.Record
+}
+
+func (r *fakeResult) Next(context.Context) bool {
+	if len(r.records) == 0 {
+		return false
+	}
+	r.current, r.records = r.records[0], r.records[1:]
+	return true
+}
+
+func (r *fakeResult) Record() *neo4j.Record { return r.current }
+
+func (r *fakeResult) Err() error { return nil }
+
+func (r *fakeResult) Consume(context.Context) (neo4j.ResultSummary, error) { return nil, nil }
+
+func (r *fakeResult) Single(context.Context) (*neo4j.Record, error) {
+	if len(r.records) != 1 {
+		return nil, fmt.Errorf("fake result has %d records, want 1", len(r.records))
+	}
+	return r.records[0], nil
+}
+
+func TestSnapshot_emptyGraph(t *testing.T) {
+	ctx := context.Background()
+	// An empty graph has no roots, so every sweep returns no records at all.
+	r := graphReader{parser: nodeParser{verify: true}}
+	s, _, err := r.captureSnapshotTx(ctx, &fakeTx{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s) != 0 {
+		t.Errorf("captureSnapshotTx() = %v, want an empty snapshot", s)
+	}
+	if got, want := s.GraphHash(), digitaltwin.ComputeForestHash(); got != want {
+		t.Errorf("GraphHash() = %v, want %v", got, want)
+	}
+	err = r.visitAllAssemblies(ctx, &fakeTx{}, func(a digitaltwin.Assembly) error {
+		t.Errorf("visitAllAssemblies() visited %v, want nothing", a.AssemblyID())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Diffing an empty graph against itself finds no changes, either way.
+	if created, updated, removed := s.Diff(make(snapshot)); created != nil || updated != nil || removed != nil {
+		t.Errorf("Diff() = %v, %v, %v; want no changes", created, updated, removed)
+	}
+	if created, updated, removed := s.PartialDiff(make(snapshot), nil); created != nil || updated != nil || removed != nil {
+		t.Errorf("PartialDiff() = %v, %v, %v; want no changes", created, updated, removed)
+	}
+}
+
+func TestSweepCancellation(t *testing.T) {
+	a := enginetest.NodeA{}
+	record := &neo4j.Record{
+		Keys:   []string{"root", "tuples"},
+		Values: []any{recordNode(t, a), []any{map[string]any{"from": nil, "to": nil}}},
+	}
+	taint, err := FormatNode(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := graphReader{parser: nodeParser{verify: true}}
+
+	tests := []struct {
+		name  string
+		sweep func(ctx context.Context, tx neo4j.ManagedTransaction) error
+	}{
+		{
+			name: "captureSnapshotTx",
+			sweep: func(ctx context.Context, tx neo4j.ManagedTransaction) error {
+				_, _, err := r.captureSnapshotTx(ctx, tx)
+				return err
+			},
+		},
+		{
+			name: "captureSnapshotBatchesTx",
+			sweep: func(ctx context.Context, tx neo4j.ManagedTransaction) error {
+				_, _, err := r.captureSnapshotBatchesTx(ctx, tx, 1_000_000)
+				return err
+			},
+		},
+		{
+			name: "visitPartialAssemblies",
+			sweep: func(ctx context.Context, tx neo4j.ManagedTransaction) error {
+				return r.visitPartialAssemblies(ctx, tx, []RawNode{taint}, func(digitaltwin.Assembly) error { return nil })
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The result never runs out of records, so the sweep only stops once it
+			// notices the cancellation.
+			const cancelAfter = 100
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			result := &slowResult{record: record, delay: time.Millisecond, onNext: func(n int) {
+				if n == cancelAfter {
+					cancel()
+				}
+			}}
+
+			err := tt.sweep(ctx, &fakeTx{result: result})
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("sweep error = %v, want %v", err, context.Canceled)
+			}
+			if result.n > cancelAfter+cancellationCheckInterval {
+				t.Errorf("sweep read %d records, want at most %d", result.n, cancelAfter+cancellationCheckInterval)
+			}
+		})
+	}
+}
+
+// A slowResult is a neo4j.ResultWithContext that endlessly returns the same
+// record, slowly.
+type slowResult struct {
+	neo4j.ResultWithContext // Panics if the code under test calls anything else.
+	record                  *neo4j.Record
+	delay                   time.Duration
+	onNext                  func(n int) // Called with the number of records returned so far.
+	n                       int
+}
+
+func (r *slowResult) Next(context.Context) bool {
+	time.Sleep(r.delay)
+	r.n++
+	r.onNext(r.n)
+	return true
+}
+
+func (r *slowResult) Record() *neo4j.Record { return r.record }
+
+func (r *slowResult) Err() error { return nil }
+
+func TestCompareDatabases(t *testing.T) {
+	driver := dbtest.SetupNeo4j(t)
+	ctx := context.Background()
+	// The default database exists already, so we only create the second one.
+	_, err := neo4j.ExecuteQuery(ctx, driver, "CREATE DATABASE replica WAIT", nil, neo4j.EagerResultTransformer,
+		neo4j.ExecuteQueryWithDatabase("system"))
+	if err != nil {
+		t.Fatal("create database:", err)
+	}
+	apply := func(database string, compilation digitaltwin.Compilation) {
+		t.Helper()
+		engine, err := NewEngine(ctx, driver, database)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := engine.Apply(ctx, compilation); err != nil {
+			t.Fatal(err)
+		}
+	}
+	component := func(v digitaltwin.Value) digitaltwin.ComponentID {
+		var b digitaltwin.AssemblyBuilder
+		b.Roots(v)
+		return b.Assemble().AssemblyID()
+	}
+
+	// Both databases are populated identically at first.
+	for _, database := range []string{"neo4j", "replica"} {
+		apply(database, func(ctx context.Context, w digitaltwin.GraphWriter) error {
+			if err := w.AssertEdge(ctx, enginetest.NodeA{}, enginetest.NodeB{}); err != nil {
+				return err
+			}
+			return w.AssertNode(ctx, enginetest.NodeC{})
+		})
+	}
+	onlyA, onlyB, differ, err := CompareDatabases(ctx, driver, "neo4j", "replica")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(onlyA) != 0 || len(onlyB) != 0 || len(differ) != 0 {
+		t.Errorf("CompareDatabases() of identical databases = %v, %v, %v; want no differences", onlyA, onlyB, differ)
+	}
+
+	// Then, the source diverges: it connects C to the component of A, and gains D.
+	apply("neo4j", func(ctx context.Context, w digitaltwin.GraphWriter) error {
+		if err := w.AssertEdge(ctx, enginetest.NodeA{}, enginetest.NodeC{}); err != nil {
+			return err
+		}
+		return w.AssertNode(ctx, enginetest.NodeD{})
+	})
+	onlyA, onlyB, differ, err = CompareDatabases(ctx, driver, "neo4j", "replica")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]digitaltwin.ComponentID{
+		{component(enginetest.NodeD{})},
+		{component(enginetest.NodeC{})},
+		{component(enginetest.NodeA{})},
+	}
+	got := [][]digitaltwin.ComponentID{onlyA, onlyB, differ}
+	for i, name := range []string{"onlyA", "onlyB", "differ"} {
+		if !slices.Equal(got[i], want[i]) {
+			t.Errorf("CompareDatabases() %s = %v, want %v", name, got[i], want[i])
+		}
+	}
+}
@@ -15,6 +15,10 @@ var (
 	// a root while taking a snapshot of a digital twin. This counter will help us
 	// monitor the appearances of this scenario.
 	rootlessAssemblyCounter metric.Int64Counter
+	// malformedNodeCounter counts the malformed nodes (e.g. lacking their
+	// content-address) an engine configured WithSkipMalformedNodes skipped while
+	// sweeping the graph.
+	malformedNodeCounter metric.Int64Counter
 )
 
 func init() {
@@ -31,4 +35,12 @@ func init() {
 		s := fmt.Sprintf("snapshot: failed to init 'snapshot_assembly_without_root_counter' instrument: %v", err)
 		panic(s)
 	}
+	malformedNodeCounter, err = meter.Int64Counter(
+		"snapshot_malformed_node_counter",
+		metric.WithDescription("how many malformed nodes a digital twin snapshot has skipped"),
+	)
+	if err != nil {
+		s := fmt.Sprintf("snapshot: failed to init 'snapshot_malformed_node_counter' instrument: %v", err)
+		panic(s)
+	}
 }
@@ -2,13 +2,13 @@ package neo4jengine
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"reflect"
 
 	"github.com/danielorbach/go-component"
 	"github.com/go-digitaltwin/go-digitaltwin"
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -25,6 +25,152 @@ type graphWriter struct {
 	nodeTainter interface {
 		Taint(node ...RawNode)
 	}
+	// Whether to tombstone retracted nodes instead of deleting them, see
+	// WithSoftDelete.
+	softDelete bool
+	// The property holding the content-address of every node, see
+	// WithContentAddressProperty; empty means DefaultContentAddressProperty.
+	caProperty string
+	// The tenant of every node the graphWriter matches or merges, see WithTenant;
+	// empty means nodes are not scoped to a tenant.
+	tenant string
+	// Called when the graph is found corrupted, see WithCorruptionHandler; nil
+	// means the graphWriter panics.
+	onCorruption func(ctx context.Context, reason string) error
+	// Latches the error of the first write that found the graph corrupted within
+	// the transaction, if not nil; see corrupted.
+	latch *corruptionLatch
+}
+
+// The nodeKey method returns the key by which the graphWriter matches and
+// merges nodes.
+func (w graphWriter) nodeKey() nodeKey {
+	return nodeKey{caProperty: w.contentAddressProperty(), tenant: w.tenant}
+}
+
+// The contentAddressProperty method returns the name of the property holding
+// the content-address of every node written by the graphWriter.
+func (w graphWriter) contentAddressProperty() string {
+	if w.caProperty == "" {
+		return DefaultContentAddressProperty
+	}
+	return w.caProperty
+}
+
+// The corrupted method reports the graph corrupted for the given reason (see
+// corruptedGraph), latching the returned error onto the latch of the
+// graphWriter, so a compilation cannot ignore it and commit its transaction
+// regardless.
+func (w graphWriter) corrupted(ctx context.Context, reason string) error {
+	err := corruptedGraph(ctx, w.onCorruption, reason)
+	if w.latch != nil && w.latch.err == nil {
+		w.latch.err = err
+	}
+	return err
+}
+
+// A noopTainter discards all taints. A graphWriter uses it when the Engine is
+// configured WithoutTainting.
+type noopTainter struct{}
+
+func (noopTainter) Taint(...RawNode) {}
+
+// A nodeKey identifies nodes in Cypher queries: by the property holding their
+// content-address, and by their tenant (if any), see WithTenant.
+type nodeKey struct {
+	caProperty string
+	tenant     string // Empty means nodes are not scoped to a tenant.
+}
+
+// The pattern method returns the properties of a node pattern (without braces)
+// that match the node whose content-address is the given query parameter. A
+// MERGE of the pattern stamps new nodes with the tenant.
+func (k nodeKey) pattern(param string) string {
+	p := cypherProperty(k.caProperty) + ": $" + param
+	if k.tenant != "" {
+		p += ", _tenant: $tenant"
+	}
+	return p
+}
+
+// The params method adds the "tenant" parameter expected by the patterns of the
+// nodeKey to the given query parameters, and returns them. The parameter is null
+// when nodes are not scoped to a tenant.
+func (k nodeKey) params(m map[string]any) map[string]any {
+	if k.tenant != "" {
+		m["tenant"] = k.tenant
+	} else {
+		m["tenant"] = nil
+	}
+	return m
+}
+
+// A budgetWriter wraps a digitaltwin.GraphWriter, failing every mutation with
+// ErrMutationBudgetExceeded once it has performed the remaining number of
+// mutations, see WithMaxMutationsPerApply.
+type budgetWriter struct {
+	digitaltwin.GraphWriter
+	remaining int
+}
+
+func (w *budgetWriter) spend() error {
+	if w.remaining <= 0 {
+		return ErrMutationBudgetExceeded
+	}
+	w.remaining--
+	return nil
+}
+
+func (w *budgetWriter) AssertNode(ctx context.Context, node digitaltwin.Value) error {
+	if err := w.spend(); err != nil {
+		return err
+	}
+	return w.GraphWriter.AssertNode(ctx, node)
+}
+
+func (w *budgetWriter) RetractNode(ctx context.Context, node digitaltwin.Value) error {
+	if err := w.spend(); err != nil {
+		return err
+	}
+	return w.GraphWriter.RetractNode(ctx, node)
+}
+
+func (w *budgetWriter) AssertEdge(ctx context.Context, from, to digitaltwin.Value) error {
+	if err := w.spend(); err != nil {
+		return err
+	}
+	return w.GraphWriter.AssertEdge(ctx, from, to)
+}
+
+func (w *budgetWriter) RetractEdges(ctx context.Context, node digitaltwin.Value, kind reflect.Type) (int, error) {
+	if err := w.spend(); err != nil {
+		return 0, err
+	}
+	return w.GraphWriter.RetractEdges(ctx, node, kind)
+}
+
+func (w *budgetWriter) RetractAllEdges(ctx context.Context, node digitaltwin.Value) (int, error) {
+	if err := w.spend(); err != nil {
+		return 0, err
+	}
+	return w.GraphWriter.RetractAllEdges(ctx, node)
+}
+
+func (w *budgetWriter) DetachNode(ctx context.Context, node digitaltwin.Value) error {
+	if err := w.spend(); err != nil {
+		return err
+	}
+	return w.GraphWriter.DetachNode(ctx, node)
+}
+
+// HasEdge is not a mutation, so it does not spend the budget.
+func (w *budgetWriter) HasEdge(ctx context.Context, from, to digitaltwin.Value) (bool, error) {
+	return w.GraphWriter.HasEdge(ctx, from, to)
+}
+
+// NodeExists is not a mutation, so it does not spend the budget.
+func (w *budgetWriter) NodeExists(ctx context.Context, node digitaltwin.Value) (bool, error) {
+	return w.GraphWriter.NodeExists(ctx, node)
 }
 
 func (w graphWriter) AssertNode(ctx context.Context, node digitaltwin.Value) (err error) {
@@ -36,21 +182,28 @@ func (w graphWriter) AssertNode(ctx context.Context, node digitaltwin.Value) (er
 }
 
 func (w graphWriter) assertNode(ctx context.Context, node RawNode) (err error) {
+	ctx, span := tracer.Start(ctx, "AssertNode", trace.WithAttributes(
+		attribute.String("node.label", node.Label),
+		attribute.Stringer("node.content_address", node.ContentAddress),
+	))
+	defer func() { endSpan(span, err) }()
+
 	ca, err := node.ContentAddress.MarshalText()
 	if err != nil {
 		return fmt.Errorf("marshal content address: %w", err)
 	}
 
+	key := w.nodeKey()
 	query := `
-		MERGE (s:` + node.Label + ` {_contentAddress: $ca})
+		MERGE (s:` + node.Label + ` {` + key.pattern("ca") + `})
 		ON CREATE SET s._created_at = datetime()
-		SET s += $node_prop, s._last_modified = datetime()
+		SET s += $node_prop, s._last_modified = datetime(), s._deleted_at = null
 		RETURN count(s) as nodes
 	`
-	result, err := w.tx.Run(ctx, query, map[string]any{
+	result, err := w.tx.Run(ctx, query, key.params(map[string]any{
 		"ca":        string(ca),
 		"node_prop": node.Props,
-	})
+	}))
 	if err != nil {
 		return fmt.Errorf("run cypher: %w", err)
 	}
@@ -69,7 +222,7 @@ func (w graphWriter) assertNode(ctx context.Context, node RawNode) (err error) {
 	// single node, it implies the underlying graph has lost its integrity, so we
 	// cannot continue to operate on it.
 	if nodes != 1 {
-		panicWithCorruptedGraph(ctx, fmt.Sprintf("assert-node modified %v nodes instead of 1", nodes))
+		return w.corrupted(ctx, fmt.Sprintf("assert-node modified %v nodes instead of 1", nodes))
 	}
 
 	// We taint only the asserted node, as it is the sole node being created or
@@ -88,20 +241,41 @@ func (w graphWriter) RetractNode(ctx context.Context, node digitaltwin.Value) (e
 }
 
 func (w graphWriter) retractNode(ctx context.Context, node RawNode) (err error) {
+	ctx, span := tracer.Start(ctx, "RetractNode", trace.WithAttributes(
+		attribute.String("node.label", node.Label),
+		attribute.Stringer("node.content_address", node.ContentAddress),
+		attribute.Bool("node.soft_delete", w.softDelete),
+	))
+	defer func() { endSpan(span, err) }()
+
 	ca, err := node.ContentAddress.MarshalText()
 	if err != nil {
 		return fmt.Errorf("marshal content address: %w", err)
 	}
 
+	key := w.nodeKey()
 	query := `
-		MATCH (n :` + node.Label + `{ _contentAddress: $ca })
+		MATCH (n :` + node.Label + `{` + key.pattern("ca") + `})
 		OPTIONAL MATCH (n)-[]-(taint)
 		DETACH DELETE n
 		RETURN count(DISTINCT n) AS nodes, COLLECT(DISTINCT taint) AS taints
 	`
-	result, err := w.tx.Run(ctx, query, map[string]any{
+	// When soft-deleting, we tombstone the node instead of deleting it. Either way,
+	// its edges are deleted, so the graph components it was part of change exactly
+	// the same. We ignore nodes already tombstoned, as if they were deleted.
+	if w.softDelete {
+		query = `
+			MATCH (n :` + node.Label + `{` + key.pattern("ca") + `})
+			WHERE n._deleted_at IS NULL
+			OPTIONAL MATCH (n)-[e]-(taint)
+			DELETE e
+			SET n._deleted_at = datetime(), n._last_modified = datetime()
+			RETURN count(DISTINCT n) AS nodes, COLLECT(DISTINCT taint) AS taints
+		`
+	}
+	result, err := w.tx.Run(ctx, query, key.params(map[string]any{
 		"ca": string(ca),
-	})
+	}))
 	if err != nil {
 		return fmt.Errorf("run cypher: %w", err)
 	}
@@ -120,11 +294,11 @@ func (w graphWriter) retractNode(ctx context.Context, node RawNode) (err error)
 	// node, it implies the underlying graph has lost its integrity, so we cannot
 	// continue to operate on it.
 	if nodes != 1 && nodes != 0 {
-		panicWithCorruptedGraph(ctx, fmt.Sprintf("retract-node modified %v nodes instead of 0/1", nodes))
+		return w.corrupted(ctx, fmt.Sprintf("retract-node modified %v nodes instead of 0/1", nodes))
 	}
 
 	// Lastly, mark touched nodes as tainted.
-	taints, err := parseTaintedNodes(record)
+	taints, err := parseTaintedNodes(record, w.contentAddressProperty())
 	if err != nil {
 		return fmt.Errorf("parse taints: %w", err)
 	}
@@ -151,6 +325,14 @@ func (w graphWriter) AssertEdge(ctx context.Context, from, to digitaltwin.Value)
 }
 
 func (w graphWriter) assertEdge(ctx context.Context, from, to RawNode) (err error) {
+	ctx, span := tracer.Start(ctx, "AssertEdge", trace.WithAttributes(
+		attribute.String("from.label", from.Label),
+		attribute.Stringer("from.content_address", from.ContentAddress),
+		attribute.String("to.label", to.Label),
+		attribute.Stringer("to.content_address", to.ContentAddress),
+	))
+	defer func() { endSpan(span, err) }()
+
 	fromContentAddress, err := from.ContentAddress.MarshalText()
 	if err != nil {
 		return fmt.Errorf("marshal content address: %w", err)
@@ -161,14 +343,15 @@ func (w graphWriter) assertEdge(ctx context.Context, from, to RawNode) (err erro
 		return fmt.Errorf("marshal content address: %w", err)
 	}
 
+	key := w.nodeKey()
 	query := `
-		MERGE (s:` + from.Label + ` {_contentAddress: $from})
+		MERGE (s:` + from.Label + ` {` + key.pattern("from") + `})
 		ON CREATE SET s._created_at = datetime()
-		SET s += $src, s._last_modified = datetime()
+		SET s += $src, s._last_modified = datetime(), s._deleted_at = null
 
-		MERGE (d:` + to.Label + ` {_contentAddress: $to})
+		MERGE (d:` + to.Label + ` {` + key.pattern("to") + `})
 		ON CREATE SET d._created_at = datetime()
-		SET d += $dst, d._last_modified = datetime()
+		SET d += $dst, d._last_modified = datetime(), d._deleted_at = null
 
 		MERGE (s)-[e:CONNECTS]->(d)
 		ON CREATE SET e._created_at = datetime()
@@ -176,12 +359,12 @@ func (w graphWriter) assertEdge(ctx context.Context, from, to RawNode) (err erro
 
 		RETURN count(e) as edges
 	`
-	result, err := w.tx.Run(ctx, query, map[string]any{
+	result, err := w.tx.Run(ctx, query, key.params(map[string]any{
 		"from": string(fromContentAddress),
 		"src":  from.Props,
 		"to":   string(toContentAddress),
 		"dst":  to.Props,
-	})
+	}))
 	if err != nil {
 		return fmt.Errorf("run cypher: %w", err)
 	}
@@ -200,7 +383,7 @@ func (w graphWriter) assertEdge(ctx context.Context, from, to RawNode) (err erro
 	// creates more than a single edge, it implies the underlying graph has lost its
 	// integrity, so we cannot continue to operate on it.
 	if edges != 1 {
-		panicWithCorruptedGraph(ctx, fmt.Sprintf("assert-edge modified %v edges instead of 1", edges))
+		return w.corrupted(ctx, fmt.Sprintf("assert-edge modified %v edges instead of 1", edges))
 	}
 
 	// We taint the source and target nodes as they are directly involved in the
@@ -217,25 +400,33 @@ func (w graphWriter) RetractEdges(ctx context.Context, node digitaltwin.Value, k
 	}
 	label, ok := LabelOf(kind)
 	if !ok {
-		return 0, errors.New("unregistered node kind")
+		return 0, fmt.Errorf("node kind: %w", UnregisteredTypeError{Type: kind})
 	}
 	return w.retractEdges(ctx, x, label)
 }
 
 func (w graphWriter) retractEdges(ctx context.Context, node RawNode, label string) (n int, err error) {
+	ctx, span := tracer.Start(ctx, "RetractEdges", trace.WithAttributes(
+		attribute.String("node.label", node.Label),
+		attribute.Stringer("node.content_address", node.ContentAddress),
+		attribute.String("kind.label", label),
+	))
+	defer func() { endSpan(span, err) }()
+
 	ca, err := node.ContentAddress.MarshalText()
 	if err != nil {
 		return 0, fmt.Errorf("marshal content address: %w", err)
 	}
 
+	key := w.nodeKey()
 	query := `
-		Match (:` + node.Label + `{_contentAddress: $from})-[e]-(taint:` + label + `)
+		Match (:` + node.Label + `{` + key.pattern("from") + `})-[e]-(taint:` + label + `)
 		DELETE e
 		RETURN count(e) as edges, COLLECT(DISTINCT taint) AS taints
 	`
-	result, err := w.tx.Run(ctx, query, map[string]any{
+	result, err := w.tx.Run(ctx, query, key.params(map[string]any{
 		"from": string(ca),
-	})
+	}))
 	if err != nil {
 		return 0, fmt.Errorf("run cypher: %w", err)
 	}
@@ -250,7 +441,7 @@ func (w graphWriter) retractEdges(ctx context.Context, node RawNode, label strin
 	}
 
 	// Lastly, mark touched nodes as tainted.
-	taints, err := parseTaintedNodes(record)
+	taints, err := parseTaintedNodes(record, w.contentAddressProperty())
 	if err != nil {
 		return 0, fmt.Errorf("parse taints: %w", err)
 	}
@@ -264,6 +455,116 @@ func (w graphWriter) retractEdges(ctx context.Context, node RawNode, label strin
 	return int(edges), nil
 }
 
+func (w graphWriter) RetractAllEdges(ctx context.Context, node digitaltwin.Value) (n int, err error) {
+	x, err := FormatNode(node)
+	if err != nil {
+		return 0, fmt.Errorf("format node: %w", err)
+	}
+	return w.retractAllEdges(ctx, x)
+}
+
+// DetachNode runs the same query as RetractAllEdges, discarding the number of
+// detached relationships.
+func (w graphWriter) DetachNode(ctx context.Context, node digitaltwin.Value) error {
+	x, err := FormatNode(node)
+	if err != nil {
+		return fmt.Errorf("format node: %w", err)
+	}
+	_, err = w.retractAllEdges(ctx, x)
+	return err
+}
+
+func (w graphWriter) retractAllEdges(ctx context.Context, node RawNode) (n int, err error) {
+	ctx, span := tracer.Start(ctx, "RetractAllEdges", trace.WithAttributes(
+		attribute.String("node.label", node.Label),
+		attribute.Stringer("node.content_address", node.ContentAddress),
+	))
+	defer func() { endSpan(span, err) }()
+
+	ca, err := node.ContentAddress.MarshalText()
+	if err != nil {
+		return 0, fmt.Errorf("marshal content address: %w", err)
+	}
+
+	// Unlike retractEdges, we leave the far end of the relationships unlabelled, so
+	// every edge of the node matches regardless of the kind of its neighbour.
+	key := w.nodeKey()
+	query := `
+		Match (:` + node.Label + `{` + key.pattern("from") + `})-[e]-(taint)
+		DELETE e
+		RETURN count(e) as edges, COLLECT(DISTINCT taint) AS taints
+	`
+	result, err := w.tx.Run(ctx, query, key.params(map[string]any{
+		"from": string(ca),
+	}))
+	if err != nil {
+		return 0, fmt.Errorf("run cypher: %w", err)
+	}
+	record, err := result.Single(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("query single result: %w", err)
+	}
+
+	edges, err := getRecordProperty[int64](record, "edges")
+	if err != nil {
+		return 0, fmt.Errorf("get edges: %w", err)
+	}
+
+	taints, err := parseTaintedNodes(record, w.contentAddressProperty())
+	if err != nil {
+		return 0, fmt.Errorf("parse taints: %w", err)
+	}
+	// The originating node is tainted because it loses all of its connections,
+	// which likely splits its component apart.
+	w.nodeTainter.Taint(node)
+	// Every formerly connected node is tainted as well, as its direct link to the
+	// originating node has been removed, altering its adjacency.
+	w.nodeTainter.Taint(taints...)
+
+	return int(edges), nil
+}
+
+// The lockNode method acquires a write lock on the given node (if it is in the
+// graph) for the remainder of the given transaction, without modifying it.
+//
+// Neo4j has no explicit node locks outside of APOC, so we take the lock the same
+// way any write would: by setting (and immediately removing) a property.
+func (w graphWriter) lockNode(ctx context.Context, node RawNode) error {
+	ca, err := node.ContentAddress.MarshalText()
+	if err != nil {
+		return fmt.Errorf("marshal content address: %w", err)
+	}
+
+	key := w.nodeKey()
+	query := `
+		MATCH (n:` + node.Label + ` {` + key.pattern("ca") + `})
+		SET n._lock = true
+		REMOVE n._lock
+	`
+	result, err := w.tx.Run(ctx, query, key.params(map[string]any{
+		"ca": string(ca),
+	}))
+	if err != nil {
+		return fmt.Errorf("run cypher: %w", err)
+	}
+	if _, err := result.Consume(ctx); err != nil {
+		return fmt.Errorf("consume result: %w", err)
+	}
+	return nil
+}
+
+// Every graphWriter operation runs within its own span (a child of the span of
+// the compilation, e.g. Apply), so slow mutations stand out in traces. Call this
+// function to end such a span, recording the error the operation failed with (if
+// any).
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
 // We modify the underlying neo4j graph database in a way that prompts us when
 // the graph violates some of our basic constraints.
 //
@@ -271,17 +572,33 @@ func (w graphWriter) retractEdges(ctx context.Context, node RawNode, label strin
 // it. In which case, we must immediately stop all operations. This is achieved
 // with a panic preceded by telemetry signals (traces, metrics, and logs) to
 // bring the situation to our immediate attention.
-func panicWithCorruptedGraph(ctx context.Context, reason string) {
+//
+// Unless the Engine is configured WithCorruptionHandler, in which case we call
+// the given handler instead of panicking, and return the error to fail the
+// operation.
+func corruptedGraph(ctx context.Context, handler func(context.Context, string) error, reason string) error {
 	component.Logger(ctx).ErrorContext(ctx, "Encountered corrupted neo4j graph that violates digital-twin axioms", "error", reason)
 	trace.SpanFromContext(ctx).SetStatus(codes.Error, reason)
 	// TODO(@marombracha): let's measure the frequency of this fatality.
+	if handler != nil {
+		if err := handler(ctx, reason); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %v", ErrCorruptedGraph, reason)
+	}
 	panic(fmt.Errorf("neo4j graph violates digital-twin axioms: %v", reason))
 }
 
+// A corruptionLatch holds the first error returned by corruptedGraph within a
+// single transaction, whether or not the caller propagated it.
+type corruptionLatch struct {
+	err error
+}
+
 // Call this function to extract the tainted nodes (as defined by the Cypher
 // query in the individual graphWriter methods) that change during a graph
 // modification.
-func parseTaintedNodes(record *neo4j.Record) (taints []RawNode, err error) {
+func parseTaintedNodes(record *neo4j.Record, caProperty string) (taints []RawNode, err error) {
 	nodes, err := getRecordProperty[[]any](record, "taints")
 	if err != nil {
 		return nil, fmt.Errorf("get taints: %w", err)
@@ -292,7 +609,7 @@ func parseTaintedNodes(record *neo4j.Record) (taints []RawNode, err error) {
 		if !ok {
 			return nil, unexpectedPropertyTypeError{Type: reflect.TypeOf(n)}
 		}
-		taint, err := newRawNode(node)
+		taint, err := newRawNodeWithProperty(node, caProperty)
 		if err != nil {
 			return taints, fmt.Errorf("parse raw node: %w", err)
 		}
@@ -300,3 +617,105 @@ func parseTaintedNodes(record *neo4j.Record) (taints []RawNode, err error) {
 	}
 	return taints, nil
 }
+
+func (w graphWriter) HasEdge(ctx context.Context, from, to digitaltwin.Value) (ok bool, err error) {
+	src, err := FormatNode(from)
+	if err != nil {
+		return false, fmt.Errorf("format 'from' node: %w", err)
+	}
+	dst, err := FormatNode(to)
+	if err != nil {
+		return false, fmt.Errorf("format 'to' node: %w", err)
+	}
+	return w.hasEdge(ctx, src, dst)
+}
+
+func (w graphWriter) hasEdge(ctx context.Context, from, to RawNode) (ok bool, err error) {
+	ctx, span := tracer.Start(ctx, "HasEdge", trace.WithAttributes(
+		attribute.String("from.label", from.Label),
+		attribute.Stringer("from.content_address", from.ContentAddress),
+		attribute.String("to.label", to.Label),
+		attribute.Stringer("to.content_address", to.ContentAddress),
+	))
+	defer func() { endSpan(span, err) }()
+
+	fromContentAddress, err := from.ContentAddress.MarshalText()
+	if err != nil {
+		return false, fmt.Errorf("marshal content address: %w", err)
+	}
+
+	toContentAddress, err := to.ContentAddress.MarshalText()
+	if err != nil {
+		return false, fmt.Errorf("marshal content address: %w", err)
+	}
+
+	// We only read the graph, so nothing is tainted.
+	key := w.nodeKey()
+	query := `
+		OPTIONAL MATCH (:` + from.Label + ` {` + key.pattern("from") + `})-[e:CONNECTS]->(:` + to.Label + ` {` + key.pattern("to") + `})
+		RETURN count(e) as edges
+	`
+	result, err := w.tx.Run(ctx, query, key.params(map[string]any{
+		"from": string(fromContentAddress),
+		"to":   string(toContentAddress),
+	}))
+	if err != nil {
+		return false, fmt.Errorf("run cypher: %w", err)
+	}
+	record, err := result.Single(ctx)
+	if err != nil {
+		return false, fmt.Errorf("query single result: %w", err)
+	}
+
+	edges, err := getRecordProperty[int64](record, "edges")
+	if err != nil {
+		return false, fmt.Errorf("get edges: %w", err)
+	}
+	return edges > 0, nil
+}
+
+func (w graphWriter) NodeExists(ctx context.Context, node digitaltwin.Value) (ok bool, err error) {
+	x, err := FormatNode(node)
+	if err != nil {
+		return false, fmt.Errorf("format node: %w", err)
+	}
+	return w.nodeExists(ctx, x)
+}
+
+func (w graphWriter) nodeExists(ctx context.Context, node RawNode) (ok bool, err error) {
+	ctx, span := tracer.Start(ctx, "NodeExists", trace.WithAttributes(
+		attribute.String("node.label", node.Label),
+		attribute.Stringer("node.content_address", node.ContentAddress),
+	))
+	defer func() { endSpan(span, err) }()
+
+	ca, err := node.ContentAddress.MarshalText()
+	if err != nil {
+		return false, fmt.Errorf("marshal content address: %w", err)
+	}
+
+	// We read the graph only, so nothing is tainted. Tombstoned nodes (see
+	// WithSoftDelete) do not exist, as far as compilations are concerned.
+	key := w.nodeKey()
+	query := `
+		OPTIONAL MATCH (n :` + node.Label + `{` + key.pattern("ca") + `})
+		WHERE n._deleted_at IS NULL
+		RETURN count(n) AS nodes
+	`
+	result, err := w.tx.Run(ctx, query, key.params(map[string]any{
+		"ca": string(ca),
+	}))
+	if err != nil {
+		return false, fmt.Errorf("run cypher: %w", err)
+	}
+	record, err := result.Single(ctx)
+	if err != nil {
+		return false, fmt.Errorf("query single result: %w", err)
+	}
+
+	nodes, err := getRecordProperty[int64](record, "nodes")
+	if err != nil {
+		return false, fmt.Errorf("get nodes: %w", err)
+	}
+	return nodes > 0, nil
+}
@@ -0,0 +1,234 @@
+package neo4jengine
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/go-digitaltwin/go-digitaltwin"
+	"github.com/google/go-cmp/cmp"
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestBudgetWriter(t *testing.T) {
+	ctx := context.Background()
+	var counter countingWriter
+	w := &budgetWriter{GraphWriter: &counter, remaining: 5}
+
+	// Asserts and retracts alike spend the budget.
+	mutations := []func() error{
+		func() error { return w.AssertNode(ctx, nil) },
+		func() error { return w.AssertEdge(ctx, nil, nil) },
+		func() error { _, err := w.RetractEdges(ctx, nil, nil); return err },
+		func() error { _, err := w.RetractAllEdges(ctx, nil); return err },
+		func() error { return w.RetractNode(ctx, nil) },
+	}
+	for i, mutate := range mutations {
+		if err := mutate(); err != nil {
+			t.Fatalf("mutation %d within the budget: %v", i, err)
+		}
+	}
+	for i, mutate := range mutations {
+		if err := mutate(); !errors.Is(err, ErrMutationBudgetExceeded) {
+			t.Errorf("mutation %d beyond the budget: error = %v, want %v", i, err, ErrMutationBudgetExceeded)
+		}
+	}
+	if counter.n != len(mutations) {
+		t.Errorf("budgetWriter passed %d mutations through, want %d", counter.n, len(mutations))
+	}
+}
+
+// A countingWriter is a digitaltwin.GraphWriter that only counts its mutations.
+type countingWriter struct{ n int }
+
+func (w *countingWriter) AssertNode(context.Context, digitaltwin.Value) error {
+	w.n++
+	return nil
+}
+
+func (w *countingWriter) RetractNode(context.Context, digitaltwin.Value) error {
+	w.n++
+	return nil
+}
+
+func (w *countingWriter) AssertEdge(context.Context, digitaltwin.Value, digitaltwin.Value) error {
+	w.n++
+	return nil
+}
+
+func (w *countingWriter) RetractEdges(context.Context, digitaltwin.Value, reflect.Type) (int, error) {
+	w.n++
+	return 0, nil
+}
+
+func (w *countingWriter) RetractAllEdges(context.Context, digitaltwin.Value) (int, error) {
+	w.n++
+	return 0, nil
+}
+
+func (w *countingWriter) DetachNode(context.Context, digitaltwin.Value) error {
+	w.n++
+	return nil
+}
+
+// HasEdge is not a mutation, so it is not counted.
+func (w *countingWriter) HasEdge(context.Context, digitaltwin.Value, digitaltwin.Value) (bool, error) {
+	return false, nil
+}
+
+// NodeExists is not a mutation, so it is not counted.
+func (w *countingWriter) NodeExists(context.Context, digitaltwin.Value) (bool, error) {
+	return false, nil
+}
+
+func TestGraphWriter_spans(t *testing.T) {
+	type tracedNode struct {
+		digitaltwin.InformationElement
+		N int
+	}
+	label := registerTestLabel(t, tracedNode{})
+
+	// We record spans in memory, restoring the package's tracer afterwards.
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer func(original trace.Tracer) { tracer = original }(tracer)
+	tracer = provider.Tracer(t.Name())
+
+	ctx, apply := tracer.Start(context.Background(), "Apply")
+	tx := &fakeTx{records: []*neo4j.Record{{
+		Keys:   []string{"nodes", "edges", "taints"},
+		Values: []any{int64(1), int64(1), []any{}},
+	}}}
+	w := graphWriter{tx: tx, nodeTainter: noopTainter{}}
+	from, to := tracedNode{N: 1}, tracedNode{N: 2}
+	if err := w.AssertNode(ctx, from); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AssertEdge(ctx, from, to); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.HasEdge(ctx, from, to); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.NodeExists(ctx, to); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.RetractEdges(ctx, from, reflect.TypeFor[tracedNode]()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.RetractNode(ctx, to); err != nil {
+		t.Fatal(err)
+	}
+	// A failed operation marks its span as failed.
+	w.tx = &fakeTx{}
+	if err := w.AssertNode(ctx, to); err == nil {
+		t.Fatal("AssertNode() with no result = nil; want error")
+	}
+	apply.End()
+
+	type span struct {
+		Name       string
+		Status     codes.Code
+		Attributes map[attribute.Key]string
+	}
+	ca := func(v digitaltwin.Value) string {
+		h, err := digitaltwin.ContentAddress(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h.String()
+	}
+	want := []span{
+		{Name: "AssertNode", Attributes: map[attribute.Key]string{
+			"node.label":           label,
+			"node.content_address": ca(from),
+		}},
+		{Name: "AssertEdge", Attributes: map[attribute.Key]string{
+			"from.label":           label,
+			"from.content_address": ca(from),
+			"to.label":             label,
+			"to.content_address":   ca(to),
+		}},
+		{Name: "HasEdge", Attributes: map[attribute.Key]string{
+			"from.label":           label,
+			"from.content_address": ca(from),
+			"to.label":             label,
+			"to.content_address":   ca(to),
+		}},
+		{Name: "NodeExists", Attributes: map[attribute.Key]string{
+			"node.label":           label,
+			"node.content_address": ca(to),
+		}},
+		{Name: "RetractEdges", Attributes: map[attribute.Key]string{
+			"node.label":           label,
+			"node.content_address": ca(from),
+			"kind.label":           label,
+		}},
+		{Name: "RetractNode", Attributes: map[attribute.Key]string{
+			"node.label":           label,
+			"node.content_address": ca(to),
+			"node.soft_delete":     "false",
+		}},
+		{Name: "AssertNode", Status: codes.Error, Attributes: map[attribute.Key]string{
+			"node.label":           label,
+			"node.content_address": ca(to),
+		}},
+	}
+	var got []span
+	for _, s := range exporter.GetSpans() {
+		if s.Name == "Apply" {
+			continue
+		}
+		// Every operation must be a child of the enclosing compilation's span.
+		if s.Parent.SpanID() != apply.SpanContext().SpanID() {
+			t.Errorf("span %q is not a child of the Apply span", s.Name)
+		}
+		attrs := make(map[attribute.Key]string, len(s.Attributes))
+		for _, kv := range s.Attributes {
+			attrs[kv.Key] = kv.Value.Emit()
+		}
+		got = append(got, span{Name: s.Name, Status: s.Status.Code, Attributes: attrs})
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("graphWriter spans mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// We benchmark importing distinct nodes through a graphWriter with and without
+// tainting them, to measure the bookkeeping overhead that WithoutTainting saves.
+// The transaction is faked, so only the engine's side of the import is measured.
+func BenchmarkGraphWriter_import(b *testing.B) {
+	type importedNode struct {
+		digitaltwin.InformationElement
+		N int
+	}
+	// The label is scoped to this benchmark, so it cannot clash with other tests.
+	RegisterLabel(importedNode{}, "BenchmarkGraphWriter_import")
+
+	ctx := context.Background()
+	tx := &fakeTx{records: []*neo4j.Record{{Keys: []string{"nodes"}, Values: []any{int64(1)}}}}
+	benchmarks := []struct {
+		name    string
+		tainter interface{ Taint(...RawNode) }
+	}{
+		{name: "Tainting", tainter: &nodeMap{}},
+		{name: "WithoutTainting", tainter: noopTainter{}},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			w := graphWriter{tx: tx, nodeTainter: bm.tainter}
+			b.ReportAllocs()
+			for i := 0; b.Loop(); i++ {
+				if err := w.AssertNode(ctx, importedNode{N: i}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
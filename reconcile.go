@@ -0,0 +1,161 @@
+package digitaltwin
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+)
+
+// ReconcileCompiler returns a Compiler that converges every created or updated
+// component of a GraphChanged notification towards the shape returned by the
+// desired function, which is called with the component's (changed) assembly.
+//
+// The compilation it returns contains only the mutations needed to turn the
+// changed assembly into the desired one: it retracts nodes missing from the
+// desired assembly, retracts edges missing from it, and then asserts nodes and
+// edges missing from the changed assembly. Removed components are ignored, as
+// there is nothing left to reconcile.
+//
+// The desired function must not return nil; to retract all nodes of a
+// component, return an empty assembly (e.g. AssemblyRemoved{}) instead.
+//
+// Keep in mind that a GraphWriter cannot retract a single edge, only all edges
+// between a node and nodes of a given kind (see GraphWriter.RetractEdges). So,
+// whenever the compilation retracts an edge, it also asserts again any desired
+// edges that were retracted along with it.
+func ReconcileCompiler(desired func(Assembly) Assembly) Compiler {
+	return func(changed GraphChanged) (Compilation, error) {
+		var diffs []assemblyDiff
+		for _, created := range changed.Created {
+			diffs = append(diffs, diffAssemblies(created.Assembly, desired(created.Assembly)))
+		}
+		for _, updated := range changed.Updated {
+			diffs = append(diffs, diffAssemblies(updated.Assembly, desired(updated.Assembly)))
+		}
+		return func(ctx context.Context, w GraphWriter) error {
+			for _, d := range diffs {
+				if err := d.apply(ctx, w); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, nil
+	}
+}
+
+// An assemblyDiff holds the mutations that converge one assembly to another.
+type assemblyDiff struct {
+	retractNodes []Value
+	retractEdges []kindOfEdges
+	assertNodes  []Value
+	assertEdges  [][2]Value
+}
+
+// A kindOfEdges identifies all edges between a node and nodes of a given kind,
+// as retracted by GraphWriter.RetractEdges.
+type kindOfEdges struct {
+	node Value
+	kind reflect.Type
+}
+
+func (d assemblyDiff) apply(ctx context.Context, w GraphWriter) error {
+	for _, node := range d.retractNodes {
+		if err := w.RetractNode(ctx, node); err != nil {
+			return fmt.Errorf("retract node: %w", err)
+		}
+	}
+	for _, edges := range d.retractEdges {
+		if _, err := w.RetractEdges(ctx, edges.node, edges.kind); err != nil {
+			return fmt.Errorf("retract edges: %w", err)
+		}
+	}
+	for _, node := range d.assertNodes {
+		if err := w.AssertNode(ctx, node); err != nil {
+			return fmt.Errorf("assert node: %w", err)
+		}
+	}
+	for _, edge := range d.assertEdges {
+		if err := w.AssertEdge(ctx, edge[0], edge[1]); err != nil {
+			return fmt.Errorf("assert edge: %w", err)
+		}
+	}
+	return nil
+}
+
+// The diffAssemblies function computes the mutations that converge the actual
+// assembly to the desired one. All mutations are ordered by the content-address
+// of their nodes, so the same assemblies always result in the same mutations.
+func diffAssemblies(actual, desired Assembly) assemblyDiff {
+	var d assemblyDiff
+	have, want := actual.Nodes(), desired.Nodes()
+
+	for _, h := range slices.SortedFunc(maps.Keys(have), NodeHash.Compare) {
+		if _, ok := want[h]; !ok {
+			d.retractNodes = append(d.retractNodes, have[h])
+		}
+	}
+	for _, h := range slices.SortedFunc(maps.Keys(want), NodeHash.Compare) {
+		if _, ok := have[h]; !ok {
+			d.assertNodes = append(d.assertNodes, want[h])
+		}
+	}
+
+	// We only retract stale edges between nodes that survive, as retracting a node
+	// already retracts all of its edges. We key retractions by content-address,
+	// as values need not be comparable.
+	type retraction struct {
+		node NodeHash
+		kind reflect.Type
+	}
+	haveEdges, wantEdges := edgesOf(actual), edgesOf(desired)
+	hasEdge, wantsEdge := edgeSet(haveEdges), edgeSet(wantEdges)
+	retracted := make(map[retraction]bool)
+	for _, e := range haveEdges {
+		_, fromOK := want[e[0]]
+		_, toOK := want[e[1]]
+		if !fromOK || !toOK || wantsEdge[e] {
+			continue
+		}
+		r := retraction{node: e[0], kind: reflect.TypeOf(have[e[1]])}
+		if !retracted[r] {
+			retracted[r] = true
+			d.retractEdges = append(d.retractEdges, kindOfEdges{node: have[e[0]], kind: r.kind})
+		}
+	}
+
+	// We assert desired edges that are missing, and also those retracted alongside
+	// stale edges (in either direction, as RetractEdges disregards it).
+	for _, e := range wantEdges {
+		from, to := want[e[0]], want[e[1]]
+		if hasEdge[e] &&
+			!retracted[retraction{node: e[0], kind: reflect.TypeOf(to)}] &&
+			!retracted[retraction{node: e[1], kind: reflect.TypeOf(from)}] {
+			continue
+		}
+		d.assertEdges = append(d.assertEdges, [2]Value{from, to})
+	}
+	return d
+}
+
+// The edgesOf function returns the edges of the given assembly as pairs of
+// content-addresses, sorted by their source and then by their target.
+func edgesOf(a Assembly) [][2]NodeHash {
+	var edges [][2]NodeHash
+	for _, from := range slices.SortedFunc(maps.Keys(a.Nodes()), NodeHash.Compare) {
+		for _, to := range slices.SortedFunc(slices.Values(a.EdgesOf(from)), NodeHash.Compare) {
+			edges = append(edges, [2]NodeHash{from, to})
+		}
+	}
+	return edges
+}
+
+// The edgeSet function returns the given edges as a set, for quick lookups.
+func edgeSet(edges [][2]NodeHash) map[[2]NodeHash]bool {
+	set := make(map[[2]NodeHash]bool, len(edges))
+	for _, e := range edges {
+		set[e] = true
+	}
+	return set
+}
@@ -0,0 +1,137 @@
+package digitaltwin
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestReconcileCompiler(t *testing.T) {
+	// The tree function returns an assembly of the given edges, rooted at "a".
+	tree := func(edges ...string) Assembly {
+		var b AssemblyBuilder
+		b.Roots(testValue{Value: "a"})
+		for _, e := range edges {
+			from, to, _ := strings.Cut(e, "->")
+			b.Connect(testValue{Value: from}, testValue{Value: to})
+		}
+		return b.Assemble()
+	}
+	actual := tree("a->b", "a->c", "c->d")
+
+	tests := []struct {
+		name    string
+		changed GraphChanged
+		desired Assembly
+		want    []string
+	}{
+		{
+			name:    "Converged",
+			changed: GraphChanged{Created: []AssemblyCreated{{actual}}},
+			desired: actual,
+			want:    nil,
+		},
+		{
+			name:    "RetractNode",
+			changed: GraphChanged{Created: []AssemblyCreated{{actual}}},
+			desired: tree("a->b", "a->c"),
+			want:    []string{"- d"},
+		},
+		{
+			name:    "AssertNodeAndEdge",
+			changed: GraphChanged{Updated: []AssemblyUpdated{{Assembly: actual}}},
+			desired: tree("a->b", "a->c", "c->d", "b->e"),
+			want:    []string{"+ e", "b -> e"},
+		},
+		{
+			name:    "RetractEdge",
+			changed: GraphChanged{Updated: []AssemblyUpdated{{Assembly: actual}}},
+			desired: tree("a->b", "c->d", "b->c"),
+			// Retracting a->c retracts a->b too, so the latter is asserted again.
+			want: []string{"a <-/-> testValue", "a -> b", "b -> c"},
+		},
+		{
+			name:    "Removed",
+			changed: GraphChanged{Removed: []AssemblyRemoved{{ID: actual.AssemblyID()}}},
+			desired: tree(),
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compiler := ReconcileCompiler(func(Assembly) Assembly { return tt.desired })
+			compilation, err := compiler(tt.changed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var w recordingWriter
+			if err := compilation(context.Background(), &w); err != nil {
+				t.Fatal(err)
+			}
+			// Mutations of the same phase are ordered by content-address, which is
+			// arbitrary as far as this test is concerned.
+			if diff := cmp.Diff(tt.want, w.ops, cmpopts.SortSlices(func(a, b string) bool { return a < b }), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("ReconcileCompiler() mutations mismatch (-want +got):\n%s", diff)
+			}
+			// All retractions must precede all assertions, lest they retract what was
+			// just asserted.
+			asserting := false
+			for _, op := range w.ops {
+				retraction := strings.HasPrefix(op, "-") || strings.Contains(op, "<-/->")
+				if asserting && retraction {
+					t.Errorf("ReconcileCompiler() retracted after asserting: %q", w.ops)
+					break
+				}
+				asserting = asserting || !retraction
+			}
+		})
+	}
+}
+
+// A recordingWriter is a GraphWriter that records the mutations applied to it.
+type recordingWriter struct {
+	ops []string
+}
+
+func (w *recordingWriter) AssertNode(_ context.Context, node Value) error {
+	w.ops = append(w.ops, fmt.Sprint("+ ", node.(testValue).Value))
+	return nil
+}
+
+func (w *recordingWriter) RetractNode(_ context.Context, node Value) error {
+	w.ops = append(w.ops, fmt.Sprint("- ", node.(testValue).Value))
+	return nil
+}
+
+func (w *recordingWriter) AssertEdge(_ context.Context, from, to Value) error {
+	w.ops = append(w.ops, fmt.Sprint(from.(testValue).Value, " -> ", to.(testValue).Value))
+	return nil
+}
+
+func (w *recordingWriter) RetractEdges(_ context.Context, node Value, kind reflect.Type) (int, error) {
+	w.ops = append(w.ops, fmt.Sprint(node.(testValue).Value, " <-/-> ", kind.Name()))
+	return 0, nil
+}
+
+func (w *recordingWriter) RetractAllEdges(_ context.Context, node Value) (int, error) {
+	w.ops = append(w.ops, fmt.Sprint(node.(testValue).Value, " <-/-> *"))
+	return 0, nil
+}
+
+func (w *recordingWriter) DetachNode(_ context.Context, node Value) error {
+	w.ops = append(w.ops, fmt.Sprint(node.(testValue).Value, " <-/-> *"))
+	return nil
+}
+
+func (w *recordingWriter) HasEdge(context.Context, Value, Value) (bool, error) {
+	return false, nil
+}
+
+func (w *recordingWriter) NodeExists(context.Context, Value) (bool, error) {
+	return false, nil
+}
@@ -34,6 +34,12 @@ var (
 	//
 	// Each record is associated with the digitaltwinGraphName.
 	disassemblyFailures metric.Int64Counter
+	// disassemblyLag measures the age of each GraphChanged notification upon its
+	// receipt, i.e. how far behind the disassembler is from the graph changes it
+	// consumes.
+	//
+	// Each record is associated with the digitaltwinGraphName.
+	disassemblyLag metric.Float64Histogram
 )
 
 func init() {
@@ -54,6 +60,15 @@ func init() {
 	if err != nil {
 		panic("digitaltwin: failed to init 'graphChanged.disassembly.failures' instrument")
 	}
+
+	disassemblyLag, err = meter.Float64Histogram(
+		"graphChanged.disassembly.lag",
+		metric.WithDescription("The age of a GraphChanged message upon its receipt, since the graph change it carries was computed."),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		panic("digitaltwin: failed to init 'graphChanged.disassembly.lag' instrument")
+	}
 }
 
 // measureDisassembly measures the disassembly process using the measurements
@@ -88,3 +103,10 @@ func measureDisassembly(ctx context.Context, graphName string, succeeded bool, d
 		disassemblyFailures.Add(ctx, 1, metric.WithAttributeSet(attrs))
 	}
 }
+
+// measureDisassemblyLag records the given lag in disassemblyLag, labelled with
+// the relevant digital twin's graph name, like measureDisassembly.
+func measureDisassemblyLag(ctx context.Context, graphName string, lag time.Duration) {
+	attrs := attribute.NewSet(attribute.String(digitaltwinGraphName, graphName))
+	disassemblyLag.Record(ctx, float64(lag)/float64(time.Millisecond), metric.WithAttributeSet(attrs))
+}
@@ -1,5 +1,11 @@
 package digitaltwin
 
+import (
+	"fmt"
+	"reflect"
+	"slices"
+)
+
 // Value is the atomic unit of information of an Assembly component graph.
 // Although the digitaltwin package could work with any type, we guard against
 // accidental use of types by requiring them to implement this interface.
@@ -16,6 +22,69 @@ type Value interface {
 	digitaltwin()
 }
 
+// A LabelResolver resolves the label a graph engine stores values of a given
+// type as (e.g. neo4jengine.Labels), so domain code may log or measure values by
+// their labels without importing the engine itself.
+type LabelResolver interface {
+	// LabelOf returns the label registered for the given type, or false if the
+	// type is not registered.
+	LabelOf(rt reflect.Type) (label string, ok bool)
+}
+
+// LabelOfValue returns the label the given LabelResolver resolves for the type
+// of the given Value, or false if its type is not registered.
+func LabelOfValue(r LabelResolver, v Value) (label string, ok bool) {
+	return r.LabelOf(reflect.TypeOf(v))
+}
+
+// Describe returns the business properties of the given Value, mapping the name
+// of every exported field (including fields promoted from embedded structs) to
+// its value, so domain-agnostic tools (e.g. UIs) may display any node without
+// knowing its Go type.
+//
+// Unlike the properties a graph engine stores (e.g. neo4jengine.FormatNode),
+// field values are returned as-is, neither converted nor tagged with a label.
+// Fields of embedded structs are described by their own name, unless another
+// field hides them. Describe dereferences pointers to structs, and returns nil
+// for values of any other kind.
+func Describe(v Value) map[string]any {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	rt := rv.Type()
+	props := make(map[string]any)
+	for _, f := range reflect.VisibleFields(rt) {
+		// Embedded structs are described by their promoted fields instead.
+		if !f.IsExported() || (f.Anonymous && indirect(f.Type).Kind() == reflect.Struct) {
+			continue
+		}
+		// A field hidden by another field of the same name is not addressable by its
+		// name, neither is a field promoted from an embedded pointer that is nil.
+		if promoted, ok := rt.FieldByName(f.Name); !ok || !slices.Equal(promoted.Index, f.Index) {
+			continue
+		}
+		field, err := rv.FieldByIndexErr(f.Index)
+		if err != nil {
+			continue
+		}
+		props[f.Name] = field.Interface()
+	}
+	return props
+}
+
+// The indirect function returns the type the given type points to, if it is a
+// pointer, or the type itself otherwise.
+func indirect(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Pointer {
+		return t.Elem()
+	}
+	return t
+}
+
 // InformationElement implements Value in order to embed into user-defined types
 // to explicitly implement Value.
 //
@@ -25,3 +94,39 @@ type Value interface {
 type InformationElement struct{}
 
 func (InformationElement) digitaltwin() {}
+
+// Scalar is a ready-made Value for leaf nodes that hold a single primitive
+// value, sparing users from declaring a struct that embeds InformationElement
+// for every such node.
+//
+// The type argument carries the meaning of the value, so prefer named types
+// over their underlying primitives. For example, use Scalar[IMSI] rather than
+// Scalar[string] so that IMSIs and APNs become nodes of different types:
+//
+//	type IMSI string
+//	type APN string
+//
+//	builder.Connect(Scalar[IMSI]{Value: "425010123456789"}, Scalar[APN]{Value: "internet"})
+//
+// The content-address of a Scalar takes its type argument into account, so
+// scalars of different types never share a content-address, even if their
+// values are equal.
+//
+// Storage engines identify nodes by a label per type, and the name of a generic
+// type (e.g. "Scalar[main.IMSI]") is rarely a valid label; so register every
+// instantiation under an explicit label (see neo4jengine.RegisterLabel).
+type Scalar[T scalar] struct {
+	InformationElement
+	Value T
+}
+
+func (s Scalar[T]) String() string { return fmt.Sprint(s.Value) }
+
+// The scalar constraint lists the primitive types a Scalar may hold, which are
+// the types the reflection-based content-address supports.
+type scalar interface {
+	~bool | ~string |
+		~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 |
+		~float32 | ~float64
+}
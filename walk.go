@@ -34,19 +34,107 @@ func WalkSubtree(v Visitor, tree Assembly, node NodeHash) {
 	v.Visit(nil)
 }
 
-type inspector func(value Value) bool
-
-func (f inspector) Visit(node Value) Visitor {
-	if f(node) {
-		return f
-	}
-	return nil
-}
-
 // Inspect traverses an Assembly in depth-first order: It starts by calling
 // f(root) for every root of the given tree; the tree must not be nil. If f
 // returns true, Inspect invokes f recursively for each child of the root node,
 // followed by a call of f(nil).
+//
+// Inspect calls f at most once for every node in the tree, skipping nodes it has
+// already visited. So, a child shared by several parents (e.g. in a diamond) is
+// visited only under the first parent to reach it; and if f returned false for
+// that child, its descendants are not visited through the other parents either.
+// This also guarantees Inspect terminates on a malformed assembly that contains
+// a cycle, rather than recursing indefinitely.
 func Inspect(tree Assembly, f func(value Value) bool) {
-	Walk(inspector(f), tree)
+	visited := make(map[NodeHash]struct{})
+	for _, root := range tree.Roots() {
+		inspect(tree, root, f, visited)
+	}
+}
+
+// InspectFrom traverses the subtree of the given start node within an Assembly,
+// just like Inspect traverses the subtrees of its roots: It starts by calling
+// f(start); If f returns true, InspectFrom invokes f recursively for each child
+// of the start node, followed by a call of f(nil). Like Inspect, it calls f at
+// most once for every node.
+//
+// If the start node is not part of the tree, InspectFrom returns without calling
+// f at all.
+func InspectFrom(tree Assembly, start NodeHash, f func(value Value) bool) {
+	if _, ok := tree.Nodes()[start]; !ok {
+		return
+	}
+	inspect(tree, start, f, make(map[NodeHash]struct{}))
+}
+
+// The inspect function implements the traversal of both Inspect and
+// InspectFrom, recording every node it passes to f in the visited set.
+func inspect(tree Assembly, node NodeHash, f func(value Value) bool, visited map[NodeHash]struct{}) {
+	if _, ok := visited[node]; ok {
+		return
+	}
+	visited[node] = struct{}{}
+	if !f(tree.Value(node)) {
+		return
+	}
+	for _, child := range tree.EdgesOf(node) {
+		inspect(tree, child, f, visited)
+	}
+	f(nil)
+}
+
+// Stats summarises the size and shape of an Assembly, as computed by
+// AssemblyStats.
+type Stats struct {
+	Nodes int // Number of nodes in the assembly.
+	Edges int // Number of directed edges between those nodes.
+	Roots int // Number of root nodes (i.e. without any ingres edges).
+	// Depth is the number of edges along the longest path from any root to a leaf.
+	// An assembly made of a single node has zero depth.
+	Depth int
+}
+
+// AssemblyStats computes the size and shape of the given Assembly in a single
+// pass over its nodes, visiting each node at most once. Use it to describe an
+// assembly in telemetry (e.g. span attributes), or to alert when a component
+// grows unexpectedly large.
+//
+// An empty assembly, such as AssemblyRemoved, returns the zero Stats.
+func AssemblyStats(a Assembly) Stats {
+	s := Stats{
+		Nodes: len(a.Nodes()),
+		Roots: len(a.Roots()),
+	}
+
+	// We memoise the depth of every node's subtree, so shared children (e.g. in a
+	// diamond) are only traversed once.
+	depths := make(map[NodeHash]int, s.Nodes)
+	var depth func(n NodeHash) int
+	depth = func(n NodeHash) int {
+		if d, ok := depths[n]; ok {
+			return d
+		}
+		// Mark the node before descending, so a malformed (cyclic) assembly does not
+		// recurse forever.
+		depths[n] = 0
+		children := a.EdgesOf(n)
+		s.Edges += len(children)
+		var d int
+		for _, child := range children {
+			d = max(d, depth(child)+1)
+		}
+		depths[n] = d
+		return d
+	}
+	for _, root := range a.Roots() {
+		s.Depth = max(s.Depth, depth(root))
+	}
+	// Count the edges of nodes unreachable from any root too; these have no bearing
+	// on the depth.
+	for n := range a.Nodes() {
+		if _, ok := depths[n]; !ok {
+			depth(n)
+		}
+	}
+	return s
 }
@@ -3,37 +3,11 @@ package digitaltwin
 import (
 	"fmt"
 	"slices"
+	"strings"
 	"testing"
 )
 
 func TestInspect(t *testing.T) {
-	// Create the assembly for the test.
-	//     ┌─ DDD
-	//     │
-	//   BB┤
-	//   │ │
-	//   │ └─ EEE
-	//   │
-	//A──┤
-	//   │
-	//   │ ┌─ FFF
-	//   │ │
-	//   CC┤
-	//     │
-	//     └─ GGG
-
-	var builder AssemblyBuilder
-	// Root
-	builder.Roots(fakeNode{Value: "A"})
-	// First level children
-	builder.Connect(fakeNode{Value: "A"}, fakeNode{Value: "BB"})
-	builder.Connect(fakeNode{Value: "A"}, fakeNode{Value: "CC"})
-	//Second level children
-	builder.Connect(fakeNode{Value: "BB"}, fakeNode{Value: "DDD"})
-	builder.Connect(fakeNode{Value: "BB"}, fakeNode{Value: "EEE"})
-	builder.Connect(fakeNode{Value: "CC"}, fakeNode{Value: "FFF"})
-	builder.Connect(fakeNode{Value: "CC"}, fakeNode{Value: "GGG"})
-
 	visited := make(map[fakeNode]struct{})
 	var visitOrder []fakeNode
 
@@ -48,7 +22,7 @@ func TestInspect(t *testing.T) {
 		return true
 	}
 
-	assembly := builder.Assemble()
+	assembly := inspectTree()
 	Inspect(assembly, testFunc)
 
 	for _, value := range assembly.Nodes() {
@@ -79,6 +53,149 @@ func TestInspect(t *testing.T) {
 	}
 }
 
+// The inspectTree function returns the following assembly, shared by the tests
+// in this file:
+//
+//	    ┌─ DDD
+//	    │
+//	  BB┤
+//	  │ │
+//	  │ └─ EEE
+//	  │
+//	A─┤
+//	  │
+//	  │ ┌─ FFF
+//	  │ │
+//	  CC┤
+//	    │
+//	    └─ GGG
+func inspectTree() Assembly {
+	var builder AssemblyBuilder
+	// Root
+	builder.Roots(fakeNode{Value: "A"})
+	// First level children
+	builder.Connect(fakeNode{Value: "A"}, fakeNode{Value: "BB"})
+	builder.Connect(fakeNode{Value: "A"}, fakeNode{Value: "CC"})
+	//Second level children
+	builder.Connect(fakeNode{Value: "BB"}, fakeNode{Value: "DDD"})
+	builder.Connect(fakeNode{Value: "BB"}, fakeNode{Value: "EEE"})
+	builder.Connect(fakeNode{Value: "CC"}, fakeNode{Value: "FFF"})
+	builder.Connect(fakeNode{Value: "CC"}, fakeNode{Value: "GGG"})
+	return builder.Assemble()
+}
+
+func TestAssemblyStats(t *testing.T) {
+	tests := []struct {
+		name     string
+		assembly Assembly
+		want     Stats
+	}{
+		{
+			name:     "Tree",
+			assembly: inspectTree(),
+			want:     Stats{Nodes: 7, Edges: 6, Roots: 1, Depth: 2},
+		},
+		{
+			name: "SingleNode",
+			assembly: AssemblyGraph{
+				Root:     []NodeHash{{1}},
+				Vertices: map[NodeHash]Value{{1}: fakeNode{Value: "A"}},
+			},
+			want: Stats{Nodes: 1, Roots: 1},
+		},
+		{
+			name:     "Removed",
+			assembly: AssemblyRemoved{},
+			want:     Stats{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AssemblyStats(tt.assembly); got != tt.want {
+				t.Errorf("AssemblyStats() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInspect_cycle(t *testing.T) {
+	// A malformed assembly whose root is also a child of its own descendant:
+	//
+	//	A ──> BB ──> CC
+	//	▲             │
+	//	└─────────────┘
+	a, bb, cc := fakeNode{Value: "A"}, fakeNode{Value: "BB"}, fakeNode{Value: "CC"}
+	assembly := AssemblyGraph{
+		Root: []NodeHash{MustContentAddress(a)},
+		Vertices: map[NodeHash]Value{
+			MustContentAddress(a):  a,
+			MustContentAddress(bb): bb,
+			MustContentAddress(cc): cc,
+		},
+		Neighbours: map[NodeHash][]NodeHash{
+			MustContentAddress(a):  {MustContentAddress(bb)},
+			MustContentAddress(bb): {MustContentAddress(cc)},
+			MustContentAddress(cc): {MustContentAddress(a)},
+		},
+	}
+
+	var got []fakeNode
+	Inspect(assembly, func(value Value) bool {
+		if value == nil {
+			return false
+		}
+		got = append(got, value.(fakeNode))
+		return true
+	})
+	if want := []fakeNode{a, bb, cc}; !slices.Equal(got, want) {
+		t.Errorf("Inspect() visited %v, want %v", got, want)
+	}
+}
+
+func TestInspectFrom(t *testing.T) {
+	tests := []struct {
+		name  string
+		start NodeHash
+		want  []fakeNode
+	}{
+		{
+			name:  "Interior",
+			start: MustContentAddress(fakeNode{Value: "BB"}),
+			want:  []fakeNode{{Value: "BB"}, {Value: "DDD"}, {Value: "EEE"}},
+		},
+		{
+			name:  "Leaf",
+			start: MustContentAddress(fakeNode{Value: "GGG"}),
+			want:  []fakeNode{{Value: "GGG"}},
+		},
+		{
+			name:  "Missing",
+			start: MustContentAddress(fakeNode{Value: "ZZZ"}),
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []fakeNode
+			InspectFrom(inspectTree(), tt.start, func(value Value) bool {
+				if value == nil {
+					return false
+				}
+				got = append(got, value.(fakeNode))
+				return true
+			})
+			// The order of siblings is unspecified, but the start node comes first.
+			if len(got) > 0 && got[0] != tt.want[0] {
+				t.Errorf("InspectFrom() visited %v first, want %v", got[0], tt.want[0])
+			}
+			slices.SortFunc(got, func(a, b fakeNode) int { return strings.Compare(a.Value, b.Value) })
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("InspectFrom() visited %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func ExampleInspect() {
 	var builder AssemblyBuilder
 